@@ -0,0 +1,173 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/ask"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/llm"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/query"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/rag"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/tokenizer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	askLimit       int
+	askMode        string
+	askShowContext bool
+	askNoStream    bool
+)
+
+var askCmd = &cobra.Command{
+	Use:   "ask [question]",
+	Short: "Answer a question from your emails, with citations",
+	Long: `Answer a question from your indexed emails.
+
+The question is searched like 'search' does (--mode, default from
+rag.search.mode), the best passages of the top --limit emails are packed
+into the prompt until rag.ask.context_tokens is reached, and the chat model
+(openai.chat_model) answers citing the emails as [1], [2], ... The cited
+emails are listed after the answer with their IDs, for 'thread' or
+'attachments'.
+
+The answer is streamed as it is generated; Ctrl+C stops it and still
+lists the emails cited so far. --no-stream prints it in one piece.
+
+Search operators and date expressions narrow the emails the answer may
+come from, e.g. "from:airline.com when is my flight" or "what did Bob say
+about the budget last week". --show-context prints the passages the model
+was given.`,
+	Example: `  go-local-rag-email ask "When is my flight to Tokyo?"
+  go-local-rag-email ask "what did finance decide about the Q3 budget" --show-context
+  go-local-rag-email ask "from:landlord@example.com when is the rent due"
+  go-local-rag-email ask "上周的会议定在哪天？"`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := application.Config()
+		question := strings.Join(args, " ")
+
+		q, err := query.Parse(question, time.Now())
+		if err != nil {
+			return fmt.Errorf("invalid question: %w", err)
+		}
+		search := q.Text
+		if strings.TrimSpace(search) == "" {
+			return fmt.Errorf("question has only operators, add some words to search for")
+		}
+
+		ragSvc, err := newRAGService()
+		if err != nil {
+			return err
+		}
+		svc, err := newAskService(ragSvc)
+		if err != nil {
+			return err
+		}
+
+		limit := askLimit
+		if limit <= 0 {
+			limit = cfg.RAG.Ask.Emails
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+		defer cancel()
+
+		prompt, err := svc.Prepare(ctx, question, search, rag.SearchOptions{Limit: limit, Mode: askMode, Filter: q})
+		if errors.Is(err, ask.ErrNoContext) {
+			fmt.Println("No indexed emails match the question. Try other words, or run 'index' first.")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("ask failed: %w", err)
+		}
+		if askShowContext {
+			printContext(prompt)
+		}
+
+		out := &streamPrinter{w: os.Stdout}
+		answer, err := svc.Answer(ctx, prompt, out.onDelta(askNoStream))
+		if err := out.Finish(answer.Text, err); err != nil {
+			return fmt.Errorf("ask failed: %w", err)
+		}
+		if answer.Text != "" {
+			printCitations(answer)
+		}
+		return nil
+	},
+}
+
+// newAskService builds the question answering service on top of search
+func newAskService(ragSvc *rag.Service) (*ask.Service, error) {
+	cfg := application.Config()
+	log := application.Logger()
+
+	llmSvc, err := llm.New(cfg.OpenAI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create LLM service: %w", err)
+	}
+	tok, err := tokenizer.ForModel(cfg.OpenAI.ChatModel)
+	if err != nil {
+		return nil, err
+	}
+	return ask.New(ragSvc, llmSvc, email.NewSQLiteRepository(application.SQLiteDB(), log), tok, log).
+		WithBudget(cfg.RAG.Ask.ContextTokens), nil
+}
+
+// printContext dumps the passages given to the model
+func printContext(prompt *ask.Prompt) {
+	fmt.Printf("── Context: %d emails, %d tokens ──\n", len(prompt.Sources), prompt.Tokens)
+	for _, src := range prompt.Sources {
+		fmt.Printf("\n[%d] %s\n", src.N, sourceTitle(src))
+		for _, p := range src.Passages {
+			fmt.Printf("  ─ chunk %d (score %.2f)\n", p.Position, p.Score)
+			for _, line := range strings.Split(strings.TrimSpace(p.Text), "\n") {
+				fmt.Printf("    %s\n", line)
+			}
+		}
+	}
+	fmt.Println()
+}
+
+// printCitations lists the emails the answer cites, or every email it was
+// given when it cites none
+func printCitations(answer *ask.Answer) {
+	sources, title := answer.Cited(), "Sources:"
+	if len(sources) == 0 {
+		sources, title = answer.Sources, "Emails consulted:"
+	}
+	fmt.Printf("\n%s\n", title)
+	for _, src := range sources {
+		fmt.Printf("  [%d] %s\n       id: %s\n", src.N, sourceTitle(src), src.EmailID)
+	}
+}
+
+// sourceTitle is the one-line description of a cited email
+func sourceTitle(src ask.Source) string {
+	var parts []string
+	if !src.Date.IsZero() {
+		parts = append(parts, src.Date.Local().Format("2006-01-02"))
+	}
+	parts = append(parts, truncate(src.From, 30))
+	subject := truncate(src.Subject, 60)
+	if src.Filename != "" {
+		subject = "📎 " + truncate(src.Filename, 30) + " — " + truncate(src.Subject, 40)
+	}
+	return strings.Join(append(parts, subject), "  ")
+}
+
+func init() {
+	askCmd.Flags().IntVarP(&askLimit, "limit", "n", 0, "Number of emails to retrieve (default rag.ask.emails)")
+	askCmd.Flags().StringVarP(&askMode, "mode", "m", "", "Search mode: vector, keyword or hybrid (default from config.yaml)")
+	askCmd.Flags().BoolVar(&askShowContext, "show-context", false, "Print the retrieved passages given to the model")
+	askCmd.Flags().BoolVar(&askNoStream, "no-stream", false, "Print the answer when it is complete instead of streaming it")
+	rootCmd.AddCommand(askCmd)
+}
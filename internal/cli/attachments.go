@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	attachmentrepo "github.com/M1ngdaXie/go-local-rag-email/internal/repository/attachment"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/blob"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/attachment"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/gmail"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/oauth"
+	"github.com/spf13/cobra"
+)
+
+var attachmentsSaveDir string
+
+var attachmentsCmd = &cobra.Command{
+	Use:   "attachments <email-id>",
+	Short: "List (and optionally save) the attachments of an email",
+	Long: `List the attachments of an email.
+
+Attachment bytes are kept in a content-addressed blob store under
+app.data_dir/blobs. Gmail attachments are only downloaded when they are
+needed, so --save may fetch them from Gmail first.`,
+	Example: `  go-local-rag-email attachments 18c2f0a1b2c3d4e5
+  go-local-rag-email attachments 18c2f0a1b2c3d4e5 --save ~/Downloads`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		svc, err := newAttachmentService()
+		if err != nil {
+			return err
+		}
+
+		atts, err := svc.List(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		if len(atts) == 0 {
+			fmt.Println("📭 这封邮件没有附件。")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "PART\tFILENAME\tTYPE\tSIZE\tSTATUS")
+		for _, a := range atts {
+			status := "not downloaded"
+			switch {
+			case a.IndexedAt != nil:
+				status = "indexed"
+			case a.ExtractError != "":
+				status = "error: " + truncate(a.ExtractError, 40)
+			case a.ContentHash != "":
+				status = "stored"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", a.PartID, a.Filename, a.MimeType, humanSize(a.Size), status)
+		}
+		w.Flush()
+
+		if attachmentsSaveDir == "" {
+			return nil
+		}
+
+		// 需要从 Gmail 下载时才去做 OAuth
+		if needsFetch(atts, svc) {
+			cfg := application.Config()
+			httpClient, err := oauth.GetClient(cfg.Gmail.CredentialsPath, cfg.Gmail.TokenPath)
+			if err != nil {
+				return fmt.Errorf("auth failed: %w", err)
+			}
+			gmailSvc, err := gmail.New(ctx, httpClient, gmail.WithQuota(cfg.Gmail.QuotaPerSecond))
+			if err != nil {
+				return fmt.Errorf("init gmail service failed: %w", err)
+			}
+			svc.WithFetcher(gmailSvc)
+		}
+
+		if err := os.MkdirAll(attachmentsSaveDir, 0755); err != nil {
+			return err
+		}
+		fmt.Println()
+		for _, a := range atts {
+			data, err := svc.Content(ctx, a)
+			if err != nil {
+				fmt.Printf("⚠️  %s: %v\n", a.Filename, err)
+				continue
+			}
+			path := filepath.Join(attachmentsSaveDir, filepath.Base(a.Filename))
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				return fmt.Errorf("failed to save %s: %w", a.Filename, err)
+			}
+			fmt.Printf("💾 %s\n", path)
+		}
+		return nil
+	},
+}
+
+// newAttachmentService wires the attachment repository and the blob store
+// under app.data_dir
+func newAttachmentService() (*attachment.Service, error) {
+	cfg := application.Config()
+	log := application.Logger()
+
+	blobs, err := blob.NewStore(filepath.Join(cfg.App.DataDir, "blobs"))
+	if err != nil {
+		return nil, err
+	}
+	repo := attachmentrepo.NewSQLiteRepository(application.SQLiteDB(), log)
+	return attachment.New(repo, blobs, log), nil
+}
+
+func needsFetch(atts []*domain.Attachment, svc *attachment.Service) bool {
+	for _, a := range atts {
+		if !svc.Stored(a) && a.RemoteID != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func humanSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+func init() {
+	attachmentsCmd.Flags().StringVar(&attachmentsSaveDir, "save", "", "Save the attachments into this directory")
+	rootCmd.AddCommand(attachmentsCmd)
+}
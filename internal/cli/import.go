@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/source"
+	syncsvc "github.com/M1ngdaXie/go-local-rag-email/internal/service/sync"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importIndex bool
+	importWatch bool
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import emails from local archives",
+	Long: `Import emails from local mail archives into the local database.
+
+Imported messages get a stable ID derived from their Message-ID, so
+importing the same archive twice (or the same message from two folders)
+does not create duplicates. New messages are indexed for search unless
+--index=false is given.`,
+}
+
+var importMboxCmd = &cobra.Command{
+	Use:   "mbox <path.mbox>...",
+	Short: "Import an mbox file (Thunderbird, Google Takeout, ...)",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sources := make([]source.Source, len(args))
+		for i, path := range args {
+			sources[i] = source.NewMbox(path)
+		}
+		return runImport(cmd, sources)
+	},
+}
+
+var importMaildirCmd = &cobra.Command{
+	Use:   "maildir <dir>",
+	Short: "Import a Maildir tree (cur/new/tmp, including Maildir++ sub-folders)",
+	Long: `Import every Maildir folder found under <dir>.
+
+With --watch the command keeps running after the initial import and picks
+up messages as they are delivered to any new/ directory, including folders
+created while it runs. Press Ctrl+C to stop.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runImport(cmd, []source.Source{source.NewMaildir(args[0], importWatch)})
+	},
+}
+
+var importEMLCmd = &cobra.Command{
+	Use:   "eml <glob>...",
+	Short: "Import loose .eml files (a directory is searched recursively)",
+	Example: `  go-local-rag-email import eml "$HOME/Downloads/*.eml"
+  go-local-rag-email import eml ~/mail-exports/`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runImport(cmd, []source.Source{source.NewEML(args...)})
+	},
+}
+
+// runImport drains each source into the email repository and prints a summary
+func runImport(cmd *cobra.Command, sources []source.Source) error {
+	// Ctrl+C 时优雅退出（watch 模式下这是唯一的退出方式）
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+	defer stop()
+
+	log := application.Logger()
+
+	attachments, err := newAttachmentService()
+	if err != nil {
+		return err
+	}
+
+	threads := newThreadService()
+	importer := syncsvc.NewImporter(email.NewSQLiteRepository(application.SQLiteDB(), log), log).
+		WithAttachments(attachments).
+		WithThreads(threads)
+	if importIndex {
+		ragSvc, err := newRAGService()
+		if err != nil {
+			return err
+		}
+		threads.WithIndex(ragSvc)
+		importer.WithIndexer(ragSvc)
+		attachments.WithIndexer(ragSvc)
+	}
+
+	for _, src := range sources {
+		fmt.Printf("Importing %s...\n", src.Name())
+
+		result, err := importer.Import(ctx, src)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return fmt.Errorf("import %s failed: %w", src.Name(), err)
+		}
+
+		fmt.Printf("✅ %s: %d messages read, %d new, %d updated, %d unchanged, %d duplicates, %d indexed.\n",
+			result.Source, result.Seen, result.Created, result.Updated, result.Unchanged, result.Duplicates, result.Indexed)
+		if result.Attachments > 0 {
+			fmt.Printf("📎 %d attachments stored, %d indexed.\n", result.Attachments, result.AttachmentsIndexed)
+		}
+		if len(result.Failed) > 0 {
+			fmt.Printf("⚠️  %d messages could not be parsed:\n", len(result.Failed))
+			for _, f := range result.Failed {
+				fmt.Printf("  - %s: %v\n", f.Ref, f.Err)
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	importCmd.PersistentFlags().BoolVar(&importIndex, "index", true, "Index new messages for search after storing them")
+	importMaildirCmd.Flags().BoolVar(&importWatch, "watch", false, "Keep running and import messages delivered to new/")
+
+	importCmd.AddCommand(importMboxCmd)
+	importCmd.AddCommand(importMaildirCmd)
+	importCmd.AddCommand(importEMLCmd)
+	rootCmd.AddCommand(importCmd)
+}
@@ -0,0 +1,183 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/chunk"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/embedding"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/keyword"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/vector"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/chunker"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/extract"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/llm"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/pipeline"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/rag"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/source"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/tokenizer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	indexLimit  int
+	indexSince  string
+	indexSource string
+	indexForce  bool
+)
+
+var indexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Index stored emails for search",
+	Long: `Index the emails stored in SQLite for semantic search.
+
+Emails are streamed through the chunk -> embed -> upsert stages of the
+indexing pipeline (see the pipeline section of config.yaml for the number
+of workers per stage). Text is cut with the strategy in rag.chunking
+(fixed, sentence, recursive or semantic).
+
+Indexing is incremental. Emails whose content and metadata did not change
+since they were indexed are skipped. Every embedded chunk is recorded with
+its content hash and embedding model, so for the others only chunks that
+changed are embedded and the points of chunks that are gone are deleted,
+e.g. when an email shrinks. When only the metadata (labels, thread) of an
+email changed, it is rewritten in Qdrant without re-embedding.
+
+After changing the embedding model or rag.chunking, run 'index --force' to
+look at every email again; chunks that are still current are not embedded
+twice.
+
+To fetch and index new mail in one go, use 'sync --index' instead.
+
+Examples:
+  go-local-rag-email index
+  go-local-rag-email index --since 30d
+  go-local-rag-email index --since "this year"
+  go-local-rag-email index --source mbox --limit 1000
+  go-local-rag-email index --force`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+
+		log := application.Logger()
+
+		filter := email.Filter{Source: indexSource}
+		if indexSince != "" {
+			since, err := parseTimeFlag(indexSince, time.Now())
+			if err != nil {
+				return fmt.Errorf("invalid --since: %w", err)
+			}
+			filter.DateFrom = &since
+		}
+
+		ragSvc, err := newRAGService()
+		if err != nil {
+			return err
+		}
+		attachments, err := newAttachmentService()
+		if err != nil {
+			return err
+		}
+		attachments.WithIndexer(ragSvc)
+
+		src := source.NewStored(email.NewSQLiteRepository(application.SQLiteDB(), log), filter, indexLimit).
+			WithAttachments(attachments)
+		if indexForce {
+			ragSvc.WithForce(true)
+		} else {
+			// 已经是最新的邮件不进流水线，除非还有附件没索引
+			src.WithSkip(func(e *domain.Email) bool {
+				return ragSvc.UpToDate(e) && !pendingAttachments(e)
+			})
+		}
+
+		fmt.Println("Indexing stored emails...")
+		summary, err := newPipeline(ragSvc).WithAttachments(attachments).Run(ctx, src, nil)
+		if errors.Is(err, context.Canceled) {
+			fmt.Println("⏸️  Indexing interrupted.")
+		} else if err != nil {
+			return fmt.Errorf("index failed: %w", err)
+		}
+
+		printIndexSummary(summary)
+		if n := src.Skipped(); n > 0 {
+			fmt.Printf("⏭️  %d emails were already up to date (use --force to check them anyway).\n", n)
+		}
+		return nil
+	},
+}
+
+// pendingAttachments reports whether an email has attachments that can be
+// indexed but were not yet
+func pendingAttachments(e *domain.Email) bool {
+	for _, att := range e.Attachments {
+		if att.IndexedAt == nil && extract.Supported(att.Filename, att.MimeType) {
+			return true
+		}
+	}
+	return false
+}
+
+// newRAGService builds the RAG service from config.yaml
+func newRAGService() (*rag.Service, error) {
+	cfg := application.Config()
+	log := application.Logger()
+
+	llmSvc, err := llm.New(cfg.OpenAI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create LLM service: %w", err)
+	}
+	tok, err := tokenizer.ForModel(cfg.OpenAI.EmbeddingModel)
+	if err != nil {
+		return nil, err
+	}
+	textChunker, err := chunker.New(cfg.RAG.Chunking, tok, llmSvc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rag.chunking: %w", err)
+	}
+
+	vectorRepo := vector.NewQdrantRepository(application.QdrantClient(), cfg.Qdrant, log)
+	return rag.New(vectorRepo, llmSvc, log).
+		WithChunks(chunk.NewSQLiteRepository(application.SQLiteDB(), log)).
+		WithEmbeddings(embedding.NewSQLiteRepository(application.SQLiteDB(), log)).
+		WithEmails(email.NewSQLiteRepository(application.SQLiteDB(), log)).
+		WithChunker(textChunker).
+		WithKeyword(keyword.NewSQLiteRepository(application.SQLiteDB(), log)).
+		WithEmbedBatch(cfg.Pipeline.EmbedBatch).
+		WithConfig(cfg.RAG), nil
+}
+
+// newPipeline builds an indexing pipeline sized by config.yaml
+func newPipeline(ragSvc *rag.Service) *pipeline.Pipeline {
+	return pipeline.New(ragSvc, application.Config().Pipeline, application.Logger())
+}
+
+// printIndexSummary prints what went through each pipeline stage
+func printIndexSummary(s *pipeline.Summary) {
+	fmt.Printf("🔎 Indexed %d emails (%d unchanged) in %s: %d/%d chunks embedded, %d reused, %d stale points removed, %d failed.\n",
+		s.Indexed, s.Skipped, s.Elapsed.Round(100*time.Millisecond), s.Embedded, s.Chunks, s.Reused, s.Deleted, s.IndexFailed)
+	fmt.Printf("   fetch %d → parse %d → store %d → chunk %d → embed %d → upsert %d\n",
+		s.Fetched, s.Parsed, s.Stored, s.Chunks, s.Embedded, s.Indexed)
+	if s.AttachmentsIndexed > 0 {
+		fmt.Printf("📎 %d attachments indexed.\n", s.AttachmentsIndexed)
+	}
+	if len(s.Failed) > 0 {
+		fmt.Printf("⚠️  %d messages could not be read:\n", len(s.Failed))
+		for _, f := range s.Failed {
+			fmt.Printf("  - %s: %v\n", f.Ref, f.Err)
+		}
+	}
+}
+
+func init() {
+	indexCmd.Flags().IntVar(&indexLimit, "limit", 0, "Index at most this many emails, newest first (0 = all)")
+	indexCmd.Flags().StringVar(&indexSince, "since", "", "Only index mail newer than an age (7d, 2w, 6m), date (2024-01-31) or expression (\"last month\")")
+	indexCmd.Flags().StringVar(&indexSource, "source", "", `Only index mail from one source, e.g. "gmail" or "mbox"`)
+	indexCmd.Flags().BoolVar(&indexForce, "force", false, "Also check emails that are up to date, e.g. after changing the embedding model or chunker")
+	rootCmd.AddCommand(indexCmd)
+}
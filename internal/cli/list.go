@@ -3,8 +3,11 @@ package cli
 import (
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
 	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/query"
 	"github.com/spf13/cobra"
 )
 var listCmd = &cobra.Command{
@@ -17,7 +20,24 @@ var listCmd = &cobra.Command{
         ctx := cmd.Context()
 
         // 使用你定义的 Pagination 获取前 20 封
-        emails, err := repo.List(ctx, email.Filter{}, email.Pagination{Limit: 20})
+        filter := email.Filter{}
+        if listQuery != "" {
+            // 和 search 一样的 Gmail 风格语法，这里只用运算符，剩下的文字当作必须包含的内容
+            q, err := query.Parse(listQuery, time.Now())
+            if err != nil {
+                return fmt.Errorf("invalid query: %w", err)
+            }
+            filter = *q.EmailFilter()
+            if q.Text != "" {
+                filter.Text = append(filter.Text, strings.Fields(q.Text)...)
+            }
+        }
+        filter.From = listFrom
+        filter.To = listTo
+        filter.Cc = listCc
+        filter.ListID = listListID
+        filter.ThreadID = listThread
+        emails, err := repo.List(ctx, filter, email.Pagination{Limit: listLimit})
         if err != nil {
             return fmt.Errorf("读取数据库失败: %w", err)
         }
@@ -33,6 +53,15 @@ var listCmd = &cobra.Command{
             fmt.Printf("ID:      %s\n", e.ID)
             fmt.Printf("Subject: %s\n", e.Subject)
             fmt.Printf("From:    %s\n", e.From)
+            if to, _ := e.GetToList(); len(to) > 0 {
+                fmt.Printf("To:      %s\n", formatAddresses(to))
+            }
+            if cc, _ := e.GetCcList(); len(cc) > 0 {
+                fmt.Printf("Cc:      %s\n", formatAddresses(cc))
+            }
+            if e.ListID != "" {
+                fmt.Printf("List:    %s\n", e.ListID)
+            }
             fmt.Printf("Date:    %s\n", e.Date.Format("2006-01-02 15:04"))
             
             // 关键：看看 RAG 用的 BodyText 是否成功解析了
@@ -50,6 +79,31 @@ var listCmd = &cobra.Command{
 }
 
 
+var (
+    listLimit  int
+    listFrom   string
+    listTo     string
+    listCc     string
+    listListID string
+    listThread string
+    listQuery  string
+)
+
+func formatAddresses(addrs []domain.Address) string {
+    parts := make([]string, len(addrs))
+    for i, a := range addrs {
+        parts[i] = a.String()
+    }
+    return strings.Join(parts, ", ")
+}
+
 func init() {
+    listCmd.Flags().IntVar(&listLimit, "limit", 20, "最多显示多少封邮件")
+    listCmd.Flags().StringVar(&listFrom, "from", "", "按发件人过滤")
+    listCmd.Flags().StringVar(&listTo, "to", "", "按收件人 (To) 过滤")
+    listCmd.Flags().StringVar(&listCc, "cc", "", "按抄送人 (Cc) 过滤")
+    listCmd.Flags().StringVar(&listListID, "list-id", "", "按邮件列表 List-Id 过滤")
+    listCmd.Flags().StringVar(&listThread, "thread", "", "按会话 thread ID 过滤")
+    listCmd.Flags().StringVarP(&listQuery, "query", "q", "", `Gmail 风格的查询，例如 "from:alice after:2025-06-01 has:attachment"`)
     rootCmd.AddCommand(listCmd)
 }
\ No newline at end of file
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	attachmentrepo "github.com/M1ngdaXie/go-local-rag-email/internal/repository/attachment"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/blob"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/chunk"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/purge"
+	"github.com/spf13/cobra"
+)
+
+var (
+	purgeOlderThan string
+	purgeDryRun    bool
+)
+
+var purgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Permanently remove emails that were deleted in the mailbox",
+	Long: `Permanently remove emails that sync has soft-deleted (deleted, trashed
+or marked as spam in Gmail), together with their vectors, chunks,
+attachment records and attachment files no other email uses.
+
+Examples:
+  go-local-rag-email purge --dry-run
+  go-local-rag-email purge --older-than 30d`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+
+		cfg := application.Config()
+		log := application.Logger()
+		db := application.SQLiteDB()
+
+		now := time.Now()
+		before := now
+		if purgeOlderThan != "" {
+			t, err := parseTimeFlag(purgeOlderThan, now)
+			if err != nil {
+				return fmt.Errorf("invalid --older-than: %w", err)
+			}
+			before = t
+		}
+
+		blobs, err := blob.NewStore(filepath.Join(cfg.App.DataDir, "blobs"))
+		if err != nil {
+			return err
+		}
+
+		// 向量只在真的要删邮件时才用得到：dry-run 或回收站为空时不连 Qdrant，也不需要 OpenAI key
+		emailRepo := email.NewSQLiteRepository(db, log)
+		var vectors purge.VectorIndex
+		if !purgeDryRun {
+			deleted, err := emailRepo.ListDeleted(ctx, before)
+			if err != nil {
+				return err
+			}
+			if len(deleted) > 0 {
+				ragSvc, err := newRAGService()
+				if err != nil {
+					return err
+				}
+				vectors = ragSvc
+			}
+		}
+
+		svc := purge.New(
+			emailRepo,
+			chunk.NewSQLiteRepository(db, log),
+			attachmentrepo.NewSQLiteRepository(db, log),
+			blobs,
+			vectors,
+			log,
+		)
+
+		result, err := svc.Purge(ctx, before, purgeDryRun)
+		// Ctrl+C 时仍然报告已经删掉的部分
+		if err != nil && (result == nil || !errors.Is(err, context.Canceled)) {
+			return fmt.Errorf("purge failed: %w", err)
+		}
+
+		if purgeDryRun {
+			fmt.Printf("🔍 Would purge %d emails and %d attachments.\n", result.Emails, result.Attachments)
+			return nil
+		}
+		fmt.Printf("🗑️  Purged %d emails, %d attachments, %d attachment files.\n",
+			result.Emails, result.Attachments, result.Blobs)
+		return nil
+	},
+}
+
+func init() {
+	purgeCmd.Flags().StringVar(&purgeOlderThan, "older-than", "", "Only purge mail deleted before an age (30d) or date (2024-01-31)")
+	purgeCmd.Flags().BoolVar(&purgeDryRun, "dry-run", false, "Only report what would be purged")
+	rootCmd.AddCommand(purgeCmd)
+}
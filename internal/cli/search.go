@@ -8,8 +8,7 @@ import (
 	"text/tabwriter"
 	"time"
 
-	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/vector"
-	"github.com/M1ngdaXie/go-local-rag-email/internal/service/llm"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/query"
 	"github.com/M1ngdaXie/go-local-rag-email/internal/service/rag"
 	"github.com/spf13/cobra"
 )
@@ -17,40 +16,99 @@ import (
 func NewSearchCmd() *cobra.Command {
 	var limit int
 	var minScore float32
+	var mode string
+	var from, labels []string
+	var after, before, thread string
 
 	cmd := &cobra.Command{
 		Use:   "search [query]",
-		Short: "Semantic search over your emails",
+		Short: "Search your emails by meaning and keywords",
 		Long: `Search your emails using natural language.
 
+--mode picks how results are found (default: rag.search.mode in config.yaml):
+  vector   semantic similarity of the embedded chunks (score = cosine)
+  keyword  SQLite FTS5 BM25 over subjects, bodies and chunks; good at exact
+           tokens like invoice numbers, ticket IDs and names
+  hybrid   both, merged with Reciprocal Rank Fusion (score 1 = ranked first
+           by both)
+
+Keyword search needs a binary built with FTS5 ('make build'); otherwise
+hybrid falls back to vector search.
+
+The query understands Gmail-style operators; they narrow the search before
+ranking, in Qdrant and in SQLite alike, and the remaining words are ranked:
+  from: to: cc:          address, domain or name (repeat to match any)
+  subject: label:        subject words; Gmail label ID or IMAP folder
+  after: before:         2025-06-01, 2025/06/01 or yesterday (before is exclusive)
+  older_than: newer_than 12h, 7d, 2w, 6m, 1y
+  has:attachment         is:unread, is:read, is:starred, is:important
+  "exact phrase"         must appear verbatim
+  -term                  negates a word, phrase or operator
+Date expressions among the words, in English or Chinese, filter by date
+too: "last week", "since March", "in Q3 2024", "2 days ago", "上个月",
+"去年第三季度". Bare years and month names only count after a preposition
+("in 2024"); quote a phrase to keep it as text ("Q3 planning").
+Quote the whole query when it contains a negation, so that it is not read
+as a flag. The --from, --after, --before, --label and --thread flags add to
+the operators. Emails indexed before these filters existed need one 'index'
+run to be filterable.
+
 Examples:
   email search "meeting notes from John"
   email search "invoices" --limit 10
-  email search "budget discussions" --min-score 0.6`,
+  email search "INV-2024-0012" --mode keyword
+  email search "budget discussions" --min-score 0.6
+  email search "contract renewal" --from acme.com --after 2024-01-01
+  email search "flight" --from alice@example.com --from bob@example.com --before 30d
+  email search "release plan" --label INBOX --label Label_12
+  email search "from:alice after:2025-06-01 has:attachment budget overrun"
+  email search "budget emails from last week"
+  email search "上个月的报销单"
+  email search 'subject:"weekly report" -from:noreply@example.com is:unread'`,
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg := application.Config()
-			log := application.Logger()
-
-			vectorRepo := vector.NewQdrantRepository(application.QdrantClient(), cfg.Qdrant, log)
-
-			llmSvc, err := llm.New(cfg.OpenAI)
+			ragSvc, err := newRAGService()
 			if err != nil {
-				return fmt.Errorf("failed to create LLM service: %w", err)
+				return err
 			}
 
-			ragSvc := rag.New(vectorRepo, llmSvc, log)
+			// Step 2: Parse the query; operators become filters, the rest is ranked
+			now := time.Now()
+			q, err := query.Parse(strings.Join(args, " "), now)
+			if err != nil {
+				return fmt.Errorf("invalid query: %w", err)
+			}
 
-			// Step 2: Build query from args
-			query := strings.Join(args, " ")
-			if strings.TrimSpace(query) == "" {
-				return fmt.Errorf("query cannot be empty")
+			// Step 3: Add the filter flags
+			q.From = append(q.From, from...)
+			q.Labels = append(q.Labels, labels...)
+			q.ThreadID = thread
+			if after != "" {
+				t, err := parseTimeFlag(after, now)
+				if err != nil {
+					return fmt.Errorf("invalid --after: %w", err)
+				}
+				if t.After(q.After) {
+					q.After = t
+				}
+			}
+			if before != "" {
+				t, err := parseTimeFlag(before, now)
+				if err != nil {
+					return fmt.Errorf("invalid --before: %w", err)
+				}
+				if q.Before.IsZero() || t.Before(q.Before) {
+					q.Before = t
+				}
+			}
+			if strings.TrimSpace(q.Text) == "" {
+				return fmt.Errorf("query has only operators, add some words to search for (or use 'list --query')")
 			}
 
 			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 			defer cancel()
 			// Step 4: Execute search
-			results, err := ragSvc.Search(ctx, query, limit)
+			results, err := ragSvc.Search(ctx, q.Text, rag.SearchOptions{Limit: limit, Mode: mode, Filter: q})
 			if err != nil {
 				return fmt.Errorf("search failed: %w", err)
 			}
@@ -80,6 +138,12 @@ Examples:
 
 	cmd.Flags().IntVarP(&limit, "limit", "n", 5, "Maximum number of results")
 	cmd.Flags().Float32VarP(&minScore, "min-score", "s", 0.0, "Minimum relevance score (0.0-1.0)")
+	cmd.Flags().StringVarP(&mode, "mode", "m", "", "Search mode: vector, keyword or hybrid (default from config.yaml)")
+	cmd.Flags().StringSliceVar(&from, "from", nil, "Only emails from this address or domain (repeatable)")
+	cmd.Flags().StringVar(&after, "after", "", "Only emails on or after an age (7d, 2w, 6m), date (2024-01-31) or expression (\"last week\")")
+	cmd.Flags().StringVar(&before, "before", "", "Only emails before an age, date or expression")
+	cmd.Flags().StringSliceVar(&labels, "label", nil, "Only emails with this label or folder (repeatable)")
+	cmd.Flags().StringVar(&thread, "thread", "", "Only emails in this thread")
 
 	return cmd
 }
@@ -87,8 +151,8 @@ Examples:
 // printSearchResults formats and displays search results
 func printSearchResults(results []rag.SearchResult) {
     w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0) // 间距调大一点点
-    fmt.Fprintln(w, "SCORE\tFROM\tSUBJECT")
-    fmt.Fprintln(w, "-----\t----\t-------")
+    fmt.Fprintln(w, "SCORE\tMATCH\tFROM\tSUBJECT")
+    fmt.Fprintln(w, "-----\t-----\t----\t-------")
 
     for _, r := range results {
         scoreStr := fmt.Sprintf("%.2f", r.Score)
@@ -103,13 +167,30 @@ func printSearchResults(results []rag.SearchResult) {
         // 还可以给 From 字段做一点脱敏或简化处理
         from := truncate(r.From, 20)
         
-        fmt.Fprintf(w, "%s\t%s\t%s\n", scoreStr, from, truncate(r.Subject, 60))
+        subject := truncate(r.Subject, 60)
+        if r.Source == rag.SourceAttachment {
+            subject = "📎 " + truncate(r.Filename, 30) + " — " + truncate(r.Subject, 40)
+        }
+
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", scoreStr, matchedBy(r), from, subject)
     }
 
     w.Flush()
     fmt.Printf("\nFound %d relevant emails.\n", len(results))
 }
 
+// matchedBy tells which ranking(s) found a result
+func matchedBy(r rag.SearchResult) string {
+    switch {
+    case r.VectorRank > 0 && r.KeywordRank > 0:
+        return "both"
+    case r.KeywordRank > 0:
+        return "keyword"
+    default:
+        return "vector"
+    }
+}
+
 // truncate shortens a string to maxLen, adding "..." if truncated
 func truncate(s string, maxLen int) string {
     runes := []rune(s) // 转换为 rune 切片处理多字节字符
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// streamPrinter renders a chat reply as it streams in, then closes it off
+type streamPrinter struct {
+	w     io.Writer
+	wrote bool
+	last  byte
+}
+
+// onDelta returns the callback that prints each piece of the reply, or nil
+// when the reply should be printed only once it is complete
+func (p *streamPrinter) onDelta(noStream bool) func(string) error {
+	if noStream {
+		return nil
+	}
+	return p.write
+}
+
+func (p *streamPrinter) write(delta string) error {
+	if !p.wrote {
+		// 模型常以空行开头，流式输出时先去掉
+		delta = strings.TrimLeft(delta, "\n")
+		if delta == "" {
+			return nil
+		}
+	}
+	if _, err := io.WriteString(p.w, delta); err != nil {
+		return err
+	}
+	p.wrote = true
+	p.last = delta[len(delta)-1]
+	return nil
+}
+
+// Finish prints the reply if it was not streamed and ends its line. A
+// Ctrl+C interruption is reported and swallowed, so that the caller can
+// still print what follows the reply (e.g. the citations of the part that
+// arrived); other errors are returned.
+func (p *streamPrinter) Finish(text string, err error) error {
+	if !p.wrote && text != "" {
+		p.write(text)
+	}
+	if p.wrote && p.last != '\n' {
+		fmt.Fprintln(p.w)
+	}
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintln(p.w, "⏹ Interrupted.")
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/llm"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/summary"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/tokenizer"
+	"github.com/spf13/cobra"
+)
+
+var summarizeNoStream bool
+
+var summarizeCmd = &cobra.Command{
+	Use:   "summarize <email-id>",
+	Short: "Summarize an email with the chat model",
+	Long: `Summarize a stored email: an overview, the key points and the action
+items, in the language of the email.
+
+The summary is streamed as it is generated (openai.chat_model); Ctrl+C
+stops it. --no-stream prints it in one piece. Email IDs are shown by
+'list', 'search' and 'ask'.`,
+	Example: `  go-local-rag-email summarize 18c2f0a1b2c3d4e5
+  go-local-rag-email summarize 18c2f0a1b2c3d4e5 --no-stream > summary.txt`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := application.Config()
+		log := application.Logger()
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+		defer cancel()
+
+		e, err := email.NewSQLiteRepository(application.SQLiteDB(), log).Get(ctx, args[0])
+		if errors.Is(err, email.ErrNotFound) {
+			return fmt.Errorf("no email with ID %q", args[0])
+		}
+		if err != nil {
+			return err
+		}
+
+		llmSvc, err := llm.New(cfg.OpenAI)
+		if err != nil {
+			return fmt.Errorf("failed to create LLM service: %w", err)
+		}
+		tok, err := tokenizer.ForModel(cfg.OpenAI.ChatModel)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("📧 %s\n   %s · %s\n\n", e.Subject, e.From, e.Date.Local().Format("2006-01-02 15:04"))
+		out := &streamPrinter{w: os.Stdout}
+		text, err := summary.New(llmSvc, tok, log).Summarize(ctx, e, out.onDelta(summarizeNoStream))
+		if err := out.Finish(text, err); err != nil {
+			return fmt.Errorf("summarize failed: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	summarizeCmd.Flags().BoolVar(&summarizeNoStream, "no-stream", false, "Print the summary when it is complete instead of streaming it")
+	rootCmd.AddCommand(summarizeCmd)
+}
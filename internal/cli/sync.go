@@ -2,27 +2,91 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/metadata"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/syncjob"
 	"github.com/M1ngdaXie/go-local-rag-email/internal/service/gmail"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/source"
+	syncsvc "github.com/M1ngdaXie/go-local-rag-email/internal/service/sync"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/daterange"
 	"github.com/M1ngdaXie/go-local-rag-email/pkg/oauth"
 	"github.com/spf13/cobra"
 )
 
 
-var maxEmails int64
+var (
+    maxEmails   int64
+    fullSync    bool
+    syncSince   string
+    syncUntil   string
+    syncQuery   string
+    syncLabels  []string
+    syncTrash   bool
+    syncReconcile bool
+    syncResume  bool
+    syncIndex   bool
+)
 
 var syncCmd = &cobra.Command{
     Use:   "sync",
     Short: "Sync emails from Gmail",
+    Long: `Sync emails from Gmail into the local database.
+
+The first run fetches the newest --max messages and remembers the mailbox
+historyId. Later runs only replay what changed since then (new, deleted and
+relabeled messages). If the stored historyId has expired, a full sync is
+performed automatically.
+
+Passing --since, --until, --query or --label runs a backfill instead: the
+matching slice of the mailbox is fetched page by page without touching the
+incremental sync state. Use --max 0 to fetch every matching message.
+--since and --until also take date expressions such as "last week",
+"since March", "Q3 2024" or "上个月": --since starts where the range
+starts and --until ends where it ends.
+
+Messages deleted in Gmail, or moved to Trash or Spam, are soft-deleted
+locally and their vectors are removed. About once a week (or with
+--reconcile) the local message IDs are also compared against the whole
+mailbox to catch deletions the history missed. --include-trash keeps
+trashed and spam messages instead. Use 'purge' to remove deleted mail for good.
+
+Progress is checkpointed as the sync goes (listed page, stored messages,
+phase). If a run is interrupted - Ctrl+C, lost network, the laptop going
+to sleep - 'sync --resume' continues where it stopped with the original
+options.
+
+With --index, new and changed messages are also indexed for search as they
+are stored: they stream through fetch -> parse -> store -> chunk -> embed ->
+upsert, each stage with its own workers (pipeline section of config.yaml).
+
+Examples:
+  go-local-rag-email sync --since 7d
+  go-local-rag-email sync --since 2023-01-01 --until 2023-07-01 --max 0
+  go-local-rag-email sync --since "last month" --until "last month"
+  go-local-rag-email sync --since 上周
+  go-local-rag-email sync --label work --query "has:attachment"
+  go-local-rag-email sync --resume
+  go-local-rag-email sync --index`,
     RunE: func(cmd *cobra.Command, args []string) error {
-        // 使用带有超时控制的 Context，防止同步任务无限期挂起
-        ctx, cancel := context.WithTimeout(cmd.Context(), 5*time.Minute)
-        defer cancel()
+        // 不设超时：大批量回填可能要跑几个小时，Ctrl+C 中断后用 --resume 继续
+        ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+        defer stop()
 
         cfg := application.Config()
+        log := application.Logger()
+
+        list, err := buildListOptions(time.Now())
+        if err != nil {
+            return err
+        }
 
         // 1. 获取认证客户端
         httpClient, err := oauth.GetClient(cfg.Gmail.CredentialsPath, cfg.Gmail.TokenPath)
@@ -31,42 +95,238 @@ var syncCmd = &cobra.Command{
         }
 
         // 2. 初始化 Gmail Service
-        gmailSvc, err := gmail.New(ctx, httpClient)
+        gmailSvc, err := gmail.New(ctx, httpClient,
+            gmail.WithConcurrency(cfg.Gmail.Concurrency),
+            gmail.WithQuota(cfg.Gmail.QuotaPerSecond),
+        )
         if err != nil {
             return fmt.Errorf("init gmail service failed: %w", err)
         }
 
-        // 3. 拉取邮件
-        fmt.Printf("Fetching up to %d emails from Gmail...\n", maxEmails)
-        emails, err := gmailSvc.FetchEmails(ctx, maxEmails)
+        attachments, err := newAttachmentService()
+        if err != nil {
+            return err
+        }
+        ragSvc, err := newRAGService()
+        if err != nil {
+            return err
+        }
+
+        // 3. 执行同步（增量 or 全量由 SyncMetadata 决定）
+        syncer := syncsvc.New(
+            gmailSvc,
+            email.NewSQLiteRepository(application.SQLiteDB(), log),
+            metadata.NewSQLiteRepository(application.SQLiteDB(), log),
+            syncjob.NewSQLiteRepository(application.SQLiteDB(), log),
+            log,
+        ).WithAttachments(attachments.WithFetcher(gmailSvc)).
+            WithThreads(newThreadService().WithIndex(ragSvc)).
+            WithVectors(ragSvc)
+
+        if syncIndex {
+            attachments.WithIndexer(ragSvc)
+            syncer.WithPipeline(newPipeline(ragSvc).WithAttachments(attachments))
+        }
+
+        result, err := syncer.Run(ctx, syncsvc.Options{
+            List:         list,
+            Full:         fullSync,
+            IncludeTrash: syncTrash,
+            Reconcile:    syncReconcile,
+            Resume:       syncResume,
+        })
+        if errors.Is(err, context.Canceled) {
+            fmt.Println("⏸️  Sync interrupted. Run 'sync --resume' to continue where it stopped.")
+            return nil
+        }
         if err != nil {
-            return fmt.Errorf("fetch failed: %w", err)
+            return fmt.Errorf("sync failed (run 'sync --resume' to retry from the last checkpoint): %w", err)
+        }
+
+        if result.Resumed {
+            fmt.Println("▶️  Resumed the interrupted sync.")
+        }
+
+        // 4. 打印总结报告
+        fmt.Printf("✅ Sync complete (%s, %s): fetched %d, %d new, %d updated, %d unchanged, %d relabeled, %d deleted.\n",
+            result.Mode, result.Account, result.Fetched, result.Created, result.Updated, result.Unchanged, result.Relabeled, result.Deleted)
+        if result.Restored > 0 {
+            fmt.Printf("♻️  %d messages restored from trash.\n", result.Restored)
         }
-        fmt.Printf("Successfully fetched %d emails\n", len(emails))
-
-        // 4. 保存到 SQLite
-        repo := email.NewSQLiteRepository(application.SQLiteDB(), application.Logger())
-        
-        var newCount int
-        for _, e := range emails {
-            // 在 Repository 层建议实现 "Upsert" 逻辑或在 Create 时检查 ID 冲突
-            err := repo.Create(ctx, e)
-            if err != nil {
-                // 如果是唯一的 ID 冲突（邮件已存在），我们可以忽略它继续执行
-                // 假设你的 repo 返回特定的 Duplicate 错误
-                continue 
+
+        if len(result.Failed) > 0 {
+            fmt.Printf("⚠️  %d messages could not be fetched:\n", len(result.Failed))
+            for _, f := range result.Failed {
+                fmt.Printf("  - %s: %v\n", f.Ref, f.Err)
             }
-            newCount++
         }
+        if result.Index != nil {
+            // 下载失败的邮件上面已经列过了
+            index := *result.Index
+            index.Failed = nil
+            printIndexSummary(&index)
+        }
+
+        return nil
+    },
+}
+
+// buildListOptions turns the sync flags into Gmail list options
+func buildListOptions(now time.Time) (gmail.ListOptions, error) {
+	opts := gmail.ListOptions{
+		MaxResults: maxEmails,
+		Query:      syncQuery,
+		Labels:     syncLabels,
+	}
 
-        // 5. 打印总结报告
-        fmt.Printf("✅ Sync complete: %d new emails saved to database.\n", newCount)
+	var err error
+	if syncSince != "" {
+		if opts.Since, err = parseTimeFlag(syncSince, now); err != nil {
+			return opts, fmt.Errorf("invalid --since: %w", err)
+		}
+	}
+	if syncUntil != "" {
+		if opts.Until, err = parseUntilFlag(syncUntil, now); err != nil {
+			return opts, fmt.Errorf("invalid --until: %w", err)
+		}
+	}
+	if !opts.Since.IsZero() && !opts.Until.IsZero() && !opts.Since.Before(opts.Until) {
+		return opts, fmt.Errorf("--since must be before --until")
+	}
 
+	return opts, nil
+}
+
+// parseTimeFlag accepts a relative age ("12h", "7d", "2w", "6m", "1y"), an
+// absolute date ("2006-01-02" / "2006/01/02") in local time, or a date
+// expression ("last week", "since March", "上个月"), whose start it returns
+func parseTimeFlag(value string, now time.Time) (time.Time, error) {
+	return parseTimeBound(value, now, false)
+}
+
+// parseUntilFlag is parseTimeFlag for an inclusive upper bound such as
+// --until: a date expression ends where its range ends, so --until
+// "last month" still includes the whole of last month
+func parseUntilFlag(value string, now time.Time) (time.Time, error) {
+	return parseTimeBound(value, now, true)
+}
+
+func parseTimeBound(value string, now time.Time, upper bool) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	t, err := parseAgeOrDate(value, now)
+	if err == nil {
+		return t, nil
+	}
+
+	r, rangeErr := daterange.New().WithClock(func() time.Time { return now }).Parse(value)
+	if rangeErr != nil {
+		return time.Time{}, fmt.Errorf("%w, or a date expression like \"last week\"", err)
+	}
+	switch {
+	case upper && r.End.IsZero():
+		return time.Time{}, fmt.Errorf("%q has no end", value)
+	case upper:
+		return r.End, nil
+	case r.Start.IsZero():
+		return time.Time{}, fmt.Errorf("%q has no start", value)
+	}
+	return r.Start, nil
+}
+
+// parseAgeOrDate reads an age like 7d or a date like 2006-01-02
+func parseAgeOrDate(value string, now time.Time) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "2006/01/02", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	if len(value) < 2 {
+		return time.Time{}, fmt.Errorf("%q is neither a date nor an age like 7d", value)
+	}
+	n, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || n < 0 {
+		return time.Time{}, fmt.Errorf("%q is neither a date nor an age like 7d", value)
+	}
+
+	switch value[len(value)-1] {
+	case 'h':
+		return now.Add(-time.Duration(n) * time.Hour), nil
+	case 'd':
+		return now.AddDate(0, 0, -n), nil
+	case 'w':
+		return now.AddDate(0, 0, -7*n), nil
+	case 'm':
+		return now.AddDate(0, -n, 0), nil
+	case 'y':
+		return now.AddDate(-n, 0, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown unit in %q (use h, d, w, m or y)", value)
+}
+
+var imapIdle bool
+
+var syncIMAPCmd = &cobra.Command{
+    Use:   "imap",
+    Short: "Sync emails from the IMAP account in config.yaml",
+    Long: `Sync emails from a generic IMAP account (imap section of config.yaml).
+
+Each folder is synced incrementally using its UIDVALIDITY/UIDNEXT stored in
+the sync metadata; if the server resets UIDVALIDITY the folder is refetched.
+With --idle the command keeps the connection open and imports new mail from
+the first configured folder as it arrives. Press Ctrl+C to stop.`,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+        defer stop()
+
+        cfg := application.Config()
+        log := application.Logger()
+        db := application.SQLiteDB()
+
+        attachments, err := newAttachmentService()
+        if err != nil {
+            return err
+        }
+
+        importer := syncsvc.NewImporter(email.NewSQLiteRepository(db, log), log).
+            WithAttachments(attachments).
+            WithThreads(newThreadService())
+        syncer := syncsvc.NewIMAPSyncer(importer, metadata.NewSQLiteRepository(db, log), log)
+
+        src := source.NewIMAP(cfg.IMAP, imapIdle)
+        fmt.Printf("Syncing %s (folders: %s)...\n", src.Account(), strings.Join(src.Folders(), ", "))
+
+        result, err := syncer.Run(ctx, src)
+        // Ctrl+C 时仍然报告已经导入的部分；还没开始导入就被打断时没有结果
+        if err != nil && (result == nil || !errors.Is(err, context.Canceled)) {
+            return fmt.Errorf("imap sync failed: %w", err)
+        }
+
+        fmt.Printf("✅ Sync complete (%s): %d messages read, %d new, %d updated, %d unchanged.\n",
+            result.Source, result.Seen, result.Created, result.Updated, result.Unchanged)
+        if len(result.Failed) > 0 {
+            fmt.Printf("⚠️  %d messages could not be fetched:\n", len(result.Failed))
+            for _, f := range result.Failed {
+                fmt.Printf("  - %s: %v\n", f.Ref, f.Err)
+            }
+        }
         return nil
     },
 }
 
 func init() {
-	syncCmd.Flags().Int64Var(&maxEmails, "max", 50, "Max emails to sync")
+	syncIMAPCmd.Flags().BoolVar(&imapIdle, "idle", false, "Stay connected and import new mail as it arrives (IMAP IDLE)")
+	syncCmd.AddCommand(syncIMAPCmd)
+
+	syncCmd.Flags().Int64Var(&maxEmails, "max", 50, "Max emails to fetch on a full sync or backfill (0 = no limit)")
+	syncCmd.Flags().BoolVar(&fullSync, "full", false, "Ignore the stored historyId and do a full sync")
+	syncCmd.Flags().StringVar(&syncSince, "since", "", "Only fetch mail newer than an age (7d, 2w, 6m), date (2024-01-31) or expression (\"last week\")")
+	syncCmd.Flags().StringVar(&syncUntil, "until", "", "Only fetch mail up to an age, date or expression (\"last month\" includes last month)")
+	syncCmd.Flags().StringVar(&syncQuery, "query", "", `Gmail search query, e.g. "label:work has:attachment"`)
+	syncCmd.Flags().StringSliceVar(&syncLabels, "label", nil, "Only fetch mail with this label (repeatable)")
+	syncCmd.Flags().BoolVar(&syncTrash, "include-trash", false, "Keep messages in Trash and Spam instead of deleting them locally")
+	syncCmd.Flags().BoolVar(&syncReconcile, "reconcile", false, "Compare local message IDs with the whole mailbox to find deletions")
+	syncCmd.Flags().BoolVar(&syncResume, "resume", false, "Continue the last interrupted sync from its checkpoint")
+	syncCmd.Flags().BoolVar(&syncIndex, "index", false, "Also index new and changed messages for search")
 	rootCmd.AddCommand(syncCmd)
 }
@@ -14,7 +14,7 @@ var testLLMCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ctx := context.Background()
 
-		fmt.Println("=== Testing LLM Service (OpenAI Embeddings) ===\n")
+		fmt.Print("=== Testing LLM Service (OpenAI Embeddings) ===\n\n")
 
 		// 1. Create LLM service using config
 		cfg := application.Config()
@@ -24,7 +24,7 @@ var testLLMCmd = &cobra.Command{
 		if err != nil {
 			return fmt.Errorf("failed to create LLM service: %w", err)
 		}
-		fmt.Println("LLM service created successfully\n")
+		fmt.Print("LLM service created successfully\n\n")
 
 		// 2. Test single embedding
 		fmt.Println("--- Test 1: Single Embedding ---")
@@ -1,18 +1,32 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/M1ngdaXie/go-local-rag-email/internal/service/gmail"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/mailparse"
 	"github.com/spf13/cobra"
 )
 
 var testParserCmd = &cobra.Command{
 	Use:   "test-parser",
 	Short: "Test email parser with a filthy HTML email",
+	Long: `Test email parser with a filthy HTML email.
+
+With --fixtures, every message listed in <dir>/expected.json is parsed
+and its subject, sender and body are checked against the expectations.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		fmt.Println("=== Testing Email Parser with Filthy HTML ===\n")
+		if parserFixtures != "" {
+			return runParserFixtures(parserFixtures)
+		}
+
+		fmt.Print("=== Testing Email Parser with Filthy HTML ===\n\n")
 
 		// 1. Get the test email
 		msg := gmail.GetFilthyEmail()
@@ -51,8 +65,8 @@ var testParserCmd = &cobra.Command{
 			fmt.Println("PASS: Body text extracted")
 		}
 
-		// Check HTML tags are stripped
-		if strings.Contains(parsed.BodyText, "<") || strings.Contains(parsed.BodyText, ">") {
+		// Check HTML tags are stripped (decoded text like "<excited>" is fine)
+		if htmlTagPattern.MatchString(parsed.BodyText) {
 			fmt.Println("WARN: Body may still contain HTML tags")
 		} else {
 			fmt.Println("PASS: HTML tags stripped")
@@ -65,11 +79,107 @@ var testParserCmd = &cobra.Command{
 			fmt.Println("PASS: HTML entities decoded")
 		}
 
+		// Check display:none content is dropped
+		if strings.Contains(parsed.BodyText, "unsubscribe") {
+			fmt.Println("FAIL: Hidden element leaked into body")
+		} else {
+			fmt.Println("PASS: Hidden elements dropped")
+		}
+
+		// Check link targets are kept
+		if !strings.Contains(parsed.BodyText, "Check details (https://glassdoor.com/test)") {
+			fmt.Println("FAIL: Link rendered without its URL")
+		} else {
+			fmt.Println("PASS: Links rendered as text (url)")
+		}
+
+		// Check paragraphs survive
+		if !strings.Contains(parsed.BodyText, "\n") {
+			fmt.Println("FAIL: Body collapsed into a single line")
+		} else {
+			fmt.Println("PASS: Paragraph structure kept")
+		}
+
 		fmt.Println("\n=== Test Complete ===")
 		return nil
 	},
 }
 
+// parserFixture is one entry of a fixture corpus's expected.json
+type parserFixture struct {
+	File         string `json:"file"`
+	Subject      string `json:"subject"`
+	FromContains string `json:"from_contains"`
+	BodyContains string `json:"body_contains"`
+}
+
+var parserFixtures string
+
+// htmlTagPattern matches markup that survived conversion
+var htmlTagPattern = regexp.MustCompile(`(?i)</?(html|body|div|p|span|a|br|h[1-6]|table|td|tr|style)\b[^>]*>`)
+
+// runParserFixtures parses every fixture in dir and compares the result
+// with expected.json
+func runParserFixtures(dir string) error {
+	data, err := os.ReadFile(filepath.Join(dir, "expected.json"))
+	if err != nil {
+		return fmt.Errorf("failed to read expectations: %w", err)
+	}
+	var fixtures []parserFixture
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return fmt.Errorf("failed to parse expectations: %w", err)
+	}
+
+	fmt.Printf("=== Parsing %d fixtures from %s ===\n\n", len(fixtures), dir)
+
+	failed := 0
+	for _, f := range fixtures {
+		problems := checkParserFixture(dir, f)
+		if len(problems) == 0 {
+			fmt.Printf("PASS  %s\n", f.File)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL  %s\n", f.File)
+		for _, p := range problems {
+			fmt.Printf("      %s\n", p)
+		}
+	}
+
+	fmt.Printf("\n%d passed, %d failed\n", len(fixtures)-failed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d fixture(s) failed", failed)
+	}
+	return nil
+}
+
+func checkParserFixture(dir string, f parserFixture) []string {
+	raw, err := os.ReadFile(filepath.Join(dir, f.File))
+	if err != nil {
+		return []string{err.Error()}
+	}
+	parsed, err := mailparse.Parse(raw)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var problems []string
+	if parsed.Subject != f.Subject {
+		problems = append(problems, fmt.Sprintf("subject = %q, want %q", parsed.Subject, f.Subject))
+	}
+	if f.FromContains != "" && !strings.Contains(parsed.From, f.FromContains) {
+		problems = append(problems, fmt.Sprintf("from = %q, want it to contain %q", parsed.From, f.FromContains))
+	}
+	if !strings.Contains(parsed.BodyText, f.BodyContains) {
+		problems = append(problems, fmt.Sprintf("body does not contain %q:\n%s", f.BodyContains, parsed.BodyText))
+	}
+	if strings.ContainsRune(parsed.BodyText, utf8.RuneError) || strings.ContainsRune(parsed.Subject, utf8.RuneError) {
+		problems = append(problems, "output contains U+FFFD replacement characters")
+	}
+	return problems
+}
+
 func init() {
+	testParserCmd.Flags().StringVar(&parserFixtures, "fixtures", "", "解析目录中的 fixture 邮件并与 expected.json 比对 (如 test/fixtures/mime)")
 	rootCmd.AddCommand(testParserCmd)
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/chunk"
 	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
 	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/vector"
 	"github.com/M1ngdaXie/go-local-rag-email/internal/service/llm"
@@ -17,7 +18,7 @@ var testRAGCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ctx := context.Background()
 
-		fmt.Println("=== Testing RAG Pipeline ===\n")
+		fmt.Print("=== Testing RAG Pipeline ===\n\n")
 
 		// 1. Create dependencies
 		cfg := application.Config()
@@ -36,9 +37,11 @@ var testRAGCmd = &cobra.Command{
 		}
 
 		// RAG service
-		ragSvc := rag.New(vectorRepo, llmSvc, log)
+		ragSvc := rag.New(vectorRepo, llmSvc, log).
+			WithChunks(chunk.NewSQLiteRepository(application.SQLiteDB(), log)).
+			WithConfig(cfg.RAG)
 
-		fmt.Println("Services initialized successfully\n")
+		fmt.Print("Services initialized successfully\n\n")
 
 		// 2. Fetch emails from SQLite
 		fmt.Println("--- Step 1: Fetching emails from SQLite ---")
@@ -76,7 +79,7 @@ var testRAGCmd = &cobra.Command{
 		testQuery := "Software engineer"
 		fmt.Printf("Query: %q\n", testQuery)
 
-		results, err := ragSvc.Search(ctx, testQuery, 5)
+		results, err := ragSvc.Search(ctx, testQuery, rag.SearchOptions{Limit: 5, Mode: rag.ModeVector})
 		if err != nil {
 			fmt.Printf("Search error: %v\n", err)
 		} else {
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	threadrepo "github.com/M1ngdaXie/go-local-rag-email/internal/repository/thread"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/thread"
+	"github.com/spf13/cobra"
+)
+
+var (
+	threadRebuild bool
+	threadLimit   int
+)
+
+var threadCmd = &cobra.Command{
+	Use:   "thread [thread-id | email-id]",
+	Short: "Print a whole conversation in order",
+	Long: `Print every message of a conversation, oldest first.
+
+The argument may be a thread ID or the ID of any email in the thread.
+Without an argument the most recently active threads are listed.
+
+Gmail provides thread IDs; mail from mbox, Maildir, .eml and IMAP is
+threaded from In-Reply-To/References. Use --rebuild to rethread
+everything, e.g. after importing an old archive.`,
+	Example: `  go-local-rag-email thread
+  go-local-rag-email thread 18c2f0a1b2c3d4e5
+  go-local-rag-email thread --rebuild`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		svc := newThreadService()
+
+		if threadRebuild {
+			moved, err := svc.Rebuild(ctx)
+			if err != nil {
+				return fmt.Errorf("rebuild threads failed: %w", err)
+			}
+			fmt.Printf("✅ Threads rebuilt, %d emails moved to a different thread.\n", moved)
+			if len(args) == 0 {
+				return nil
+			}
+		}
+
+		if len(args) == 0 {
+			return listThreads(cmd)
+		}
+
+		id := args[0]
+		t, emails, err := svc.Conversation(ctx, id)
+		if err != nil {
+			// 参数也可以是线程里任意一封邮件的 ID
+			e, getErr := email.NewSQLiteRepository(application.SQLiteDB(), application.Logger()).Get(ctx, id)
+			if errors.Is(getErr, email.ErrNotFound) {
+				return err
+			}
+			if getErr != nil {
+				return getErr
+			}
+			if t, emails, err = svc.Conversation(ctx, e.ThreadID); err != nil {
+				return err
+			}
+		}
+
+		if t != nil {
+			fmt.Printf("🧵 %s\n", t.Subject)
+			fmt.Printf("   %d messages, %s → %s\n", t.MessageCount,
+				t.FirstDate.Format("2006-01-02 15:04"), t.LastDate.Format("2006-01-02 15:04"))
+			if participants, _ := t.GetParticipants(); len(participants) > 0 {
+				fmt.Printf("   Participants: %s\n", formatAddresses(participants))
+			}
+			fmt.Println()
+		}
+
+		for i, e := range emails {
+			fmt.Println(strings.Repeat("─", 60))
+			fmt.Printf("[%d/%d] %s\n", i+1, len(emails), e.Date.Format("2006-01-02 15:04"))
+			fmt.Printf("From:    %s\n", e.From)
+			if to, _ := e.GetToList(); len(to) > 0 {
+				fmt.Printf("To:      %s\n", formatAddresses(to))
+			}
+			if cc, _ := e.GetCcList(); len(cc) > 0 {
+				fmt.Printf("Cc:      %s\n", formatAddresses(cc))
+			}
+			fmt.Printf("Subject: %s\n\n", e.Subject)
+			fmt.Println(strings.TrimSpace(e.BodyText))
+			fmt.Println()
+		}
+		return nil
+	},
+}
+
+// listThreads prints the most recently active threads
+func listThreads(cmd *cobra.Command) error {
+	repo := threadrepo.NewSQLiteRepository(application.SQLiteDB(), application.Logger())
+	threads, err := repo.List(cmd.Context(), threadLimit, 0)
+	if err != nil {
+		return err
+	}
+	if len(threads) == 0 {
+		fmt.Println("📭 还没有会话。请先运行 'sync' 或 'import'，或者用 --rebuild 重建。")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "THREAD\tMSGS\tLAST\tSUBJECT")
+	for _, t := range threads {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", t.ID, t.MessageCount, t.LastDate.Format("2006-01-02"), truncate(t.Subject, 60))
+	}
+	return w.Flush()
+}
+
+// newThreadService wires the thread service to the SQLite repositories
+func newThreadService() *thread.Service {
+	db := application.SQLiteDB()
+	log := application.Logger()
+	return thread.New(email.NewSQLiteRepository(db, log), threadrepo.NewSQLiteRepository(db, log), log)
+}
+
+func init() {
+	threadCmd.Flags().BoolVar(&threadRebuild, "rebuild", false, "Rethread all non-Gmail mail and recompute every thread")
+	threadCmd.Flags().IntVar(&threadLimit, "limit", 20, "Number of threads to list when no ID is given")
+	rootCmd.AddCommand(threadCmd)
+}
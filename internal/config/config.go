@@ -4,12 +4,15 @@ import "time"
 
 // Config holds all application configuration
 type Config struct {
-	App     AppConfig
-	Gmail   GmailConfig
-	OpenAI  OpenAIConfig
-	SQLite  SQLiteConfig
-	Qdrant  QdrantConfig
-	Logging LoggingConfig
+	App      AppConfig
+	Gmail    GmailConfig
+	IMAP     IMAPConfig
+	OpenAI   OpenAIConfig
+	SQLite   SQLiteConfig
+	Qdrant   QdrantConfig
+	RAG      RAGConfig
+	Pipeline PipelineConfig
+	Logging  LoggingConfig
 }
 
 // AppConfig holds application-level settings
@@ -23,11 +26,35 @@ type GmailConfig struct {
 	CredentialsPath string   `mapstructure:"credentials_path"`
 	TokenPath       string   `mapstructure:"token_path"`
 	Scopes          []string `mapstructure:"scopes"`
+
+	// Concurrency is the number of parallel message downloads
+	Concurrency int `mapstructure:"concurrency"`
+	// QuotaPerSecond is the token-bucket rate in Gmail quota units
+	// (messages.get costs 5, the per-user limit is 250/s)
+	QuotaPerSecond int `mapstructure:"quota_per_second"`
+}
+
+// IMAPConfig holds settings for a generic IMAP account
+type IMAPConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+
+	// Auth is "login" (username/password) or "xoauth2" (OAuth access token)
+	Auth       string `mapstructure:"auth"`
+	OAuthToken string `mapstructure:"oauth_token"`
+
+	// TLS selects implicit TLS (port 993); otherwise STARTTLS is used when offered
+	TLS     bool     `mapstructure:"tls"`
+	Folders []string `mapstructure:"folders"`
 }
 
 // OpenAIConfig holds OpenAI API settings
 type OpenAIConfig struct {
-	APIKey         string  `mapstructure:"api_key"`
+	APIKey string `mapstructure:"api_key"`
+	// BaseURL points at an OpenAI-compatible API instead of api.openai.com
+	BaseURL        string  `mapstructure:"base_url"`
 	EmbeddingModel string  `mapstructure:"embedding_model"`
 	ChatModel      string  `mapstructure:"chat_model"`
 	MaxTokens      int     `mapstructure:"max_tokens"`
@@ -53,6 +80,67 @@ type QdrantConfig struct {
 	Distance       string `mapstructure:"distance"`
 }
 
+// RAGConfig holds indexing settings
+type RAGConfig struct {
+	// IndexQuoted also embeds quoted replies and forwarded history; by
+	// default only the new content of each message is searchable
+	IndexQuoted     bool `mapstructure:"index_quoted"`
+	IndexSignatures bool `mapstructure:"index_signatures"`
+
+	Chunking ChunkingConfig `mapstructure:"chunking"`
+	Search   SearchConfig   `mapstructure:"search"`
+	Ask      AskConfig      `mapstructure:"ask"`
+}
+
+// AskConfig sizes the context 'ask' gives the chat model
+type AskConfig struct {
+	// Emails is the number of emails retrieved per question
+	Emails int `mapstructure:"emails"`
+
+	// ContextTokens is the token budget of the retrieved passages in the
+	// prompt; passages past it are dropped, lowest ranked first
+	ContextTokens int `mapstructure:"context_tokens"`
+}
+
+// SearchConfig tunes how vector and keyword results are fused
+type SearchConfig struct {
+	// Mode is the default of search --mode: "vector", "keyword" or "hybrid"
+	Mode string `mapstructure:"mode"`
+
+	// RRFK is the k constant of Reciprocal Rank Fusion; the weights scale
+	// each ranking's contribution
+	RRFK          int     `mapstructure:"rrf_k"`
+	VectorWeight  float64 `mapstructure:"vector_weight"`
+	KeywordWeight float64 `mapstructure:"keyword_weight"`
+}
+
+// ChunkingConfig selects how text is cut into chunks before embedding
+type ChunkingConfig struct {
+	// Strategy is "fixed", "sentence", "recursive" or "semantic"
+	Strategy string `mapstructure:"strategy"`
+	// Size is the max tokens per chunk; Overlap is repeated between
+	// neighbouring chunks (not used by semantic)
+	Size    int `mapstructure:"size"`
+	Overlap int `mapstructure:"overlap"`
+
+	// BreakpointPercentile makes the semantic strategy cut where the
+	// distance between consecutive sentences is above this percentile
+	BreakpointPercentile float64 `mapstructure:"breakpoint_percentile"`
+}
+
+// PipelineConfig sizes the stages of the sync/index pipeline. Each stage
+// runs its own workers; Buffer bounds the channels between them.
+type PipelineConfig struct {
+	Buffer    int `mapstructure:"buffer"`
+	Parsers   int `mapstructure:"parsers"`
+	Chunkers  int `mapstructure:"chunkers"`
+	Embedders int `mapstructure:"embedders"`
+	Upserters int `mapstructure:"upserters"`
+
+	// EmbedBatch is the number of chunks sent per embeddings request
+	EmbedBatch int `mapstructure:"embed_batch"`
+}
+
 // LoggingConfig holds logging settings
 type LoggingConfig struct {
 	Level    string `mapstructure:"level"`
@@ -66,6 +66,14 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("gmail.credentials_path", "configs/credentials.json")
 	v.SetDefault("gmail.token_path", "~/.go-local-rag-email/token.json")
 	v.SetDefault("gmail.scopes", []string{"https://www.googleapis.com/auth/gmail.readonly"})
+	v.SetDefault("gmail.concurrency", 8)
+	v.SetDefault("gmail.quota_per_second", 200)
+
+	// IMAP defaults
+	v.SetDefault("imap.port", 993)
+	v.SetDefault("imap.auth", "login")
+	v.SetDefault("imap.tls", true)
+	v.SetDefault("imap.folders", []string{"INBOX"})
 
 	// OpenAI defaults
 	v.SetDefault("openai.embedding_model", "text-embedding-3-small")
@@ -87,6 +95,28 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("qdrant.vector_size", 1536)
 	v.SetDefault("qdrant.distance", "Cosine")
 
+	// RAG defaults
+	v.SetDefault("rag.index_quoted", false)
+	v.SetDefault("rag.index_signatures", false)
+	v.SetDefault("rag.chunking.strategy", "fixed")
+	v.SetDefault("rag.chunking.size", 500)
+	v.SetDefault("rag.chunking.overlap", 50)
+	v.SetDefault("rag.chunking.breakpoint_percentile", 90)
+	v.SetDefault("rag.search.mode", "hybrid")
+	v.SetDefault("rag.search.rrf_k", 60)
+	v.SetDefault("rag.search.vector_weight", 1.0)
+	v.SetDefault("rag.search.keyword_weight", 1.0)
+	v.SetDefault("rag.ask.emails", 8)
+	v.SetDefault("rag.ask.context_tokens", 3000)
+
+	// Pipeline defaults
+	v.SetDefault("pipeline.buffer", 64)
+	v.SetDefault("pipeline.parsers", 4)
+	v.SetDefault("pipeline.chunkers", 4)
+	v.SetDefault("pipeline.embedders", 2)
+	v.SetDefault("pipeline.upserters", 2)
+	v.SetDefault("pipeline.embed_batch", 64)
+
 	// Logging defaults
 	v.SetDefault("logging.level", "info")
 }
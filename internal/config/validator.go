@@ -46,5 +46,38 @@ func Validate(cfg *Config) error {
 		)
 	}
 
+	// ---- RAG ----
+	switch cfg.RAG.Chunking.Strategy {
+	case "", "fixed", "sentence", "recursive", "semantic":
+	default:
+		return fmt.Errorf("rag.chunking.strategy must be fixed, sentence, recursive or semantic (got %q)", cfg.RAG.Chunking.Strategy)
+	}
+
+	if cfg.RAG.Chunking.Size < 0 || cfg.RAG.Chunking.Size > 8191 {
+		return fmt.Errorf("rag.chunking.size must be between 1 and 8191 tokens (got %d)", cfg.RAG.Chunking.Size)
+	}
+
+	if cfg.RAG.Chunking.Overlap < 0 || (cfg.RAG.Chunking.Size > 0 && cfg.RAG.Chunking.Overlap >= cfg.RAG.Chunking.Size) {
+		return fmt.Errorf("rag.chunking.overlap must be smaller than rag.chunking.size (got %d)", cfg.RAG.Chunking.Overlap)
+	}
+
+	if p := cfg.RAG.Chunking.BreakpointPercentile; p < 0 || p > 100 {
+		return fmt.Errorf("rag.chunking.breakpoint_percentile must be between 0 and 100 (got %g)", p)
+	}
+
+	switch cfg.RAG.Search.Mode {
+	case "", "vector", "keyword", "hybrid":
+	default:
+		return fmt.Errorf("rag.search.mode must be vector, keyword or hybrid (got %q)", cfg.RAG.Search.Mode)
+	}
+
+	if cfg.RAG.Search.VectorWeight < 0 || cfg.RAG.Search.KeywordWeight < 0 {
+		return fmt.Errorf("rag.search weights cannot be negative")
+	}
+
+	if cfg.RAG.Ask.Emails < 0 || cfg.RAG.Ask.ContextTokens < 0 {
+		return fmt.Errorf("rag.ask.emails and rag.ask.context_tokens cannot be negative")
+	}
+
 	return nil
 }
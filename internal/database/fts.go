@@ -0,0 +1,142 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// ftsTables index email subjects and chunk contents for keyword (BM25)
+// search. They are external-content tables: the text stays in emails and
+// chunks, and the triggers keep the index in step. The whole body is not
+// indexed, its quoted history would drown out the mail it quotes; the body
+// chunks carry the segmented body instead.
+//
+// The trigram tokenizer matches any substring of three or more characters,
+// so Chinese and Japanese text, which has no spaces between words, can be
+// searched too; shorter terms are matched with LIKE by the keyword
+// repository.
+var ftsTables = map[string]string{
+	"emails_fts": `CREATE VIRTUAL TABLE emails_fts USING fts5(
+		subject,
+		content='emails', tokenize='trigram remove_diacritics 1')`,
+	"chunks_fts": `CREATE VIRTUAL TABLE chunks_fts USING fts5(
+		content,
+		content='chunks', content_rowid='id', tokenize='trigram remove_diacritics 1')`,
+}
+
+var ftsTriggers = map[string]string{
+	"emails_fts_ai": `CREATE TRIGGER emails_fts_ai AFTER INSERT ON emails BEGIN
+		INSERT INTO emails_fts(rowid, subject) VALUES (new.rowid, new.subject);
+	END`,
+	"emails_fts_ad": `CREATE TRIGGER emails_fts_ad AFTER DELETE ON emails BEGIN
+		INSERT INTO emails_fts(emails_fts, rowid, subject) VALUES ('delete', old.rowid, old.subject);
+	END`,
+	"emails_fts_au": `CREATE TRIGGER emails_fts_au AFTER UPDATE OF subject ON emails BEGIN
+		INSERT INTO emails_fts(emails_fts, rowid, subject) VALUES ('delete', old.rowid, old.subject);
+		INSERT INTO emails_fts(rowid, subject) VALUES (new.rowid, new.subject);
+	END`,
+	"chunks_fts_ai": `CREATE TRIGGER chunks_fts_ai AFTER INSERT ON chunks BEGIN
+		INSERT INTO chunks_fts(rowid, content) VALUES (new.id, new.content);
+	END`,
+	"chunks_fts_ad": `CREATE TRIGGER chunks_fts_ad AFTER DELETE ON chunks BEGIN
+		INSERT INTO chunks_fts(chunks_fts, rowid, content) VALUES ('delete', old.id, old.content);
+	END`,
+	"chunks_fts_au": `CREATE TRIGGER chunks_fts_au AFTER UPDATE OF content ON chunks BEGIN
+		INSERT INTO chunks_fts(chunks_fts, rowid, content) VALUES ('delete', old.id, old.content);
+		INSERT INTO chunks_fts(rowid, content) VALUES (new.id, new.content);
+	END`,
+}
+
+// setupFTS creates the full-text tables and their triggers. FTS5 is only
+// compiled into the SQLite driver with the sqlite_fts5 build tag (see the
+// Makefile); without it the triggers are dropped so that writes keep
+// working, and keyword search reports that it is unavailable.
+func setupFTS(db *gorm.DB, log logger.Logger) error {
+	var enabled int
+	if err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled).Error; err != nil {
+		return fmt.Errorf("failed to check for FTS5: %w", err)
+	}
+
+	if enabled == 0 {
+		// 之前用带 FTS5 的版本建过触发器的话，不删掉每次写 emails 都会报 no such module
+		for name := range ftsTriggers {
+			if err := db.Exec("DROP TRIGGER IF EXISTS " + name).Error; err != nil {
+				return fmt.Errorf("failed to drop %s: %w", name, err)
+			}
+		}
+		log.Warn("SQLite was built without FTS5, keyword search is disabled (build with -tags sqlite_fts5)")
+		return nil
+	}
+
+	for name, stmt := range ftsTables {
+		var existing string
+		if err := db.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", name).
+			Scan(&existing).Error; err != nil {
+			return fmt.Errorf("failed to look up %s: %w", name, err)
+		}
+		if existing == stmt {
+			continue
+		}
+		// 列或者分词器变了：删掉旧表和它的触发器，下面重新建好后整体重建
+		if existing != "" {
+			if err := dropFTS(db, name); err != nil {
+				return err
+			}
+			log.Info("Full-text table definition changed, recreating it", "table", name)
+		}
+		if err := db.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("failed to create full-text table: %w", err)
+		}
+	}
+
+	var existing []string
+	if err := db.Raw("SELECT name FROM sqlite_master WHERE type = 'trigger' AND name LIKE '%_fts_%'").
+		Scan(&existing).Error; err != nil {
+		return fmt.Errorf("failed to list triggers: %w", err)
+	}
+	have := map[string]bool{}
+	for _, name := range existing {
+		have[name] = true
+	}
+
+	missing := false
+	for name, stmt := range ftsTriggers {
+		if have[name] {
+			continue
+		}
+		missing = true
+		if err := db.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("failed to create %s: %w", name, err)
+		}
+	}
+
+	// 新建的索引，或者中间有一段时间没有触发器（不带 FTS5 的版本写过库），都要整体重建
+	if missing {
+		for table := range ftsTables {
+			if err := db.Exec("INSERT INTO " + table + "(" + table + ") VALUES ('rebuild')").Error; err != nil {
+				return fmt.Errorf("failed to rebuild %s: %w", table, err)
+			}
+		}
+		log.Info("Rebuilt the full-text index")
+	}
+	return nil
+}
+
+// dropFTS drops a full-text table and the triggers that feed it
+func dropFTS(db *gorm.DB, table string) error {
+	for name := range ftsTriggers {
+		if !strings.HasPrefix(name, table+"_") {
+			continue
+		}
+		if err := db.Exec("DROP TRIGGER IF EXISTS " + name).Error; err != nil {
+			return fmt.Errorf("failed to drop %s: %w", name, err)
+		}
+	}
+	if err := db.Exec("DROP TABLE IF EXISTS " + table).Error; err != nil {
+		return fmt.Errorf("failed to drop %s: %w", table, err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// migrateAddressLists rewrites to_list values stored in the legacy
+// ["alice@example.com"] format as [{"address":"alice@example.com"}], so
+// every address column shares the same JSON shape
+func migrateAddressLists(db *gorm.DB, log logger.Logger) error {
+	var rows []domain.Email
+	err := db.Unscoped().
+		Select("id", "to_list").
+		Where("to_list LIKE ?", `["%`).
+		Find(&rows).Error
+	if err != nil {
+		return fmt.Errorf("failed to scan legacy to_list rows: %w", err)
+	}
+
+	for _, row := range rows {
+		// GetToList 同时兼容新旧两种格式，重新 Set 一次即完成转换
+		addrs, err := row.GetToList()
+		if err != nil {
+			log.Warn("Skipping unreadable to_list", "id", row.ID, "error", err)
+			continue
+		}
+		if err := row.SetToList(addrs); err != nil {
+			return err
+		}
+		if err := db.Unscoped().Model(&domain.Email{}).Where("id = ?", row.ID).
+			UpdateColumn("to_list", row.ToJSON).Error; err != nil {
+			return fmt.Errorf("failed to migrate to_list of %s: %w", row.ID, err)
+		}
+	}
+
+	if len(rows) > 0 {
+		log.Info("Migrated legacy recipient lists", "rows", len(rows))
+	}
+	return nil
+}
+
+// migrateContentHashes fills content_hash for rows stored before the
+// column existed, so the first Upsert after upgrading reports them as
+// unchanged instead of rewriting every email
+func migrateContentHashes(db *gorm.DB, log logger.Logger) error {
+	var rows []*domain.Email
+	migrated := 0
+	err := db.Unscoped().
+		Where("content_hash IS NULL OR content_hash = ''").
+		FindInBatches(&rows, 500, func(tx *gorm.DB, batch int) error {
+			for _, row := range rows {
+				if err := db.Unscoped().Model(&domain.Email{}).Where("id = ?", row.ID).
+					UpdateColumn("content_hash", row.ComputeHash()).Error; err != nil {
+					return fmt.Errorf("failed to hash %s: %w", row.ID, err)
+				}
+			}
+			migrated += len(rows)
+			return nil
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to backfill content hashes: %w", err)
+	}
+
+	if migrated > 0 {
+		log.Info("Backfilled email content hashes", "rows", migrated)
+	}
+	return nil
+}
+
+// migrateHasAttachments fills the has_attachments column added for
+// has:attachment searches from the attachments table
+func migrateHasAttachments(db *gorm.DB, log logger.Logger) error {
+	result := db.Unscoped().Model(&domain.Email{}).
+		Where("id IN (?)", db.Model(&domain.Attachment{}).Select("email_id").Where("inline = ?", false)).
+		UpdateColumn("has_attachments", true)
+	if result.Error != nil {
+		return fmt.Errorf("failed to backfill has_attachments: %w", result.Error)
+	}
+
+	if result.RowsAffected > 0 {
+		log.Info("Backfilled email attachment flags", "rows", result.RowsAffected)
+	}
+	return nil
+}
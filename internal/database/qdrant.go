@@ -51,7 +51,7 @@ func CreateEmailCollection(ctx context.Context, client *qdrant.Client, cfg confi
 
 	if exists {
 		log.Info("Qdrant collection already exists", "name", cfg.CollectionName)
-		return nil
+		return ensurePayloadIndexes(ctx, client, cfg, log)
 	}
 
 	// Step 2: Create the collection with vector configuration
@@ -69,5 +69,71 @@ func CreateEmailCollection(ctx context.Context, client *qdrant.Client, cfg confi
 	// Step 3: Log success
 	log.Info("Created Qdrant collection", "name", cfg.CollectionName, "size", cfg.VectorSize)
 
+	return ensurePayloadIndexes(ctx, client, cfg, log)
+}
+
+// payloadIndexes are the payload fields search filters on. Without an
+// index Qdrant has to check the payload of every candidate point, and
+// full-text matches (from, to, cc, subject, content) need a text index to
+// match words case-insensitively instead of exact substrings.
+var payloadIndexes = map[string]payloadIndex{
+	"email_id":       {Type: qdrant.FieldType_FieldTypeKeyword},
+	"thread_id":      {Type: qdrant.FieldType_FieldTypeKeyword},
+	"from_address":   {Type: qdrant.FieldType_FieldTypeKeyword},
+	"from_domain":    {Type: qdrant.FieldType_FieldTypeKeyword},
+	"labels":         {Type: qdrant.FieldType_FieldTypeKeyword},
+	"source":         {Type: qdrant.FieldType_FieldTypeKeyword},
+	"timestamp":      {Type: qdrant.FieldType_FieldTypeInteger},
+	"has_attachment": {Type: qdrant.FieldType_FieldTypeBool},
+	"from":           textIndex(qdrant.TokenizerType_Word, false),
+	"to":             textIndex(qdrant.TokenizerType_Word, false),
+	"cc":             textIndex(qdrant.TokenizerType_Word, false),
+	"subject":        textIndex(qdrant.TokenizerType_Multilingual, false),
+	"content":        textIndex(qdrant.TokenizerType_Multilingual, true),
+}
+
+type payloadIndex struct {
+	Type   qdrant.FieldType
+	Params *qdrant.PayloadIndexParams
+}
+
+// textIndex is a lowercased full-text index; phrases enables the phrase
+// matching that quoted search terms use
+func textIndex(tokenizer qdrant.TokenizerType, phrases bool) payloadIndex {
+	lowercase := true
+	return payloadIndex{
+		Type: qdrant.FieldType_FieldTypeText,
+		Params: qdrant.NewPayloadIndexParamsText(&qdrant.TextIndexParams{
+			Tokenizer:      tokenizer,
+			Lowercase:      &lowercase,
+			PhraseMatching: &phrases,
+		}),
+	}
+}
+
+// ensurePayloadIndexes creates the payload indexes that are missing
+func ensurePayloadIndexes(ctx context.Context, client *qdrant.Client, cfg config.QdrantConfig, log logger.Logger) error {
+	info, err := client.GetCollectionInfo(ctx, cfg.CollectionName)
+	if err != nil {
+		return fmt.Errorf("failed to get collection info: %w", err)
+	}
+
+	wait := true
+	for field, index := range payloadIndexes {
+		if _, ok := info.GetPayloadSchema()[field]; ok {
+			continue
+		}
+		_, err := client.CreateFieldIndex(ctx, &qdrant.CreateFieldIndexCollection{
+			CollectionName:   cfg.CollectionName,
+			Wait:             &wait,
+			FieldName:        field,
+			FieldType:        index.Type.Enum(),
+			FieldIndexParams: index.Params,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create payload index on %s: %w", field, err)
+		}
+		log.Info("Created Qdrant payload index", "field", field)
+	}
 	return nil
 }
@@ -20,7 +20,13 @@ func NewSQLite(cfg config.SQLiteConfig, log logger.Logger) (*gorm.DB, error) {
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
-	db, err := gorm.Open(sqlite.Open(cfg.Path), &gorm.Config{Logger: gormLog})
+	// sync/index 流水线里存储和 chunk 阶段会同时写库，写锁冲突时等一会儿而不是直接报 SQLITE_BUSY
+	dsn := cfg.Path + "?_busy_timeout=5000"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: gormLog,
+		// 把 SQLite 的约束错误翻译成 gorm.ErrDuplicatedKey 等哨兵错误
+		TranslateError: true,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -47,14 +53,38 @@ func NewSQLite(cfg config.SQLiteConfig, log logger.Logger) (*gorm.DB, error) {
 		}
 	}
 
+	// 新加的列要在迁移之后从已有数据回填
+	backfillAttachments := !db.Migrator().HasColumn(&domain.Email{}, "has_attachments")
+
 	err = db.AutoMigrate(
 		&domain.Email{},
 		&domain.Chunk{}, 
+		&domain.Embedding{},
+		&domain.SyncMetadata{},
+		&domain.Attachment{},
+		&domain.Thread{},
+		&domain.SyncJob{},
+		&domain.SyncJobItem{},
 	)
 	if err != nil {
 		return nil, fmt.Errorf("auto-migration failed: %w", err)
 	}
 
+	if err := migrateAddressLists(db, log); err != nil {
+		return nil, fmt.Errorf("data migration failed: %w", err)
+	}
+	if err := migrateContentHashes(db, log); err != nil {
+		return nil, fmt.Errorf("data migration failed: %w", err)
+	}
+	if backfillAttachments {
+		if err := migrateHasAttachments(db, log); err != nil {
+			return nil, fmt.Errorf("data migration failed: %w", err)
+		}
+	}
+	if err := setupFTS(db, log); err != nil {
+		return nil, fmt.Errorf("full-text index setup failed: %w", err)
+	}
+
 	log.Info("SQLite database connected", "path", cfg.Path)
 
 	return db, nil
@@ -1,6 +1,8 @@
 package domain
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"time"
 
@@ -12,21 +14,53 @@ type Email struct {
 	// ID 是主键，手动设置 (Gmail ID)
 	ID        string    `gorm:"primaryKey;column:id"` 
 	ThreadID  string    `gorm:"index;column:thread_id"` 
+	// 邮件来源：gmail / mbox ...
+	Source    string    `gorm:"index;column:source"`
 	Subject   string    `gorm:"column:subject"`
 	From      string    `gorm:"index;column:from_address"` // 'From' 是 SQL 关键字，最好改个名
 	
-	// 注意：数据库里存的是 JSON 字符串，但我们在业务代码里想用 []string
+	// 注意：数据库里存的是 JSON 字符串，但我们在业务代码里想用 []Address
 	// GORM 也可以用 serializer:json，但为了让你理解原理，这里演示手动转换
-	ToJSON    string    `gorm:"column:to_list"` 
+	ToJSON      string  `gorm:"column:to_list"` 
+	CcJSON      string  `gorm:"column:cc_list"`
+	BccJSON     string  `gorm:"column:bcc_list"`
+	ReplyToJSON string  `gorm:"column:reply_to_list"`
+
+	// Threading headers (RFC 5322 §3.6.4)，Message-ID 不带尖括号
+	MessageID      string `gorm:"index;column:message_id"`
+	InReplyTo      string `gorm:"index;column:in_reply_to"`
+	ReferencesJSON string `gorm:"column:references_list"`
+
+	// List-Id 中尖括号里的部分，例如 "team.example.com"
+	ListID    string    `gorm:"index;column:list_id"`
+
+	// Gmail label IDs (INBOX, UNREAD, Label_123 ...)，同样以 JSON 字符串存储
+	LabelsJSON string   `gorm:"column:labels"`
 	
 	Snippet   string    `gorm:"column:snippet"`
 	BodyText  string    `gorm:"column:body_text"`
 	
 	Date      time.Time `gorm:"index;column:date"`
+
+	// HasAttachments 表示有非内嵌的附件，search 的 has:attachment 用它过滤
+	HasAttachments bool `gorm:"index;column:has_attachments"`
+
+	// ContentHash 是内容字段的 SHA-256，Upsert 用它判断邮件是否真的变了
+	ContentHash string  `gorm:"column:content_hash"`
+
+	// IndexedHash 是最近一次成功索引时的 ContentHash，IndexedAt 是那次的时间；
+	// 都为空表示还没索引过。IndexedMeta 是写进 Qdrant 的元数据（线程、标签等）
+	// 的 hash，元数据没变就不用再 SetPayload。Upsert 不会改这几列
+	IndexedHash string     `gorm:"column:indexed_hash"`
+	IndexedMeta string     `gorm:"column:indexed_meta"`
+	IndexedAt   *time.Time `gorm:"column:indexed_at"`
 	
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"` // 软删除，相当于 Java 的 @SQLDelete(sql="UPDATE... SET deleted=true")
+
+	// Attachments 只在解析和导入过程中携带，单独存在 attachments 表里
+	Attachments []Attachment `gorm:"-" json:"-"`
 }
 
 // TableName specifies the table name for GORM
@@ -34,23 +68,234 @@ func (Email) TableName() string {
 	return "emails"
 }
 
+// Address is a parsed mailbox, e.g. "Alice <alice@example.com>"
+type Address struct {
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address"`
+}
+
+// String formats the address the way it appears in a header
+func (a Address) String() string {
+	if a.Name == "" {
+		return a.Address
+	}
+	return a.Name + " <" + a.Address + ">"
+}
+
 // GetToList parses the To field (stored as JSON string) into a slice
-func (e *Email) GetToList() ([]string, error) {
-	var toList []string
-	err := json.Unmarshal([]byte(e.ToJSON), &toList)
-	return toList, err
+func (e *Email) GetToList() ([]Address, error) {
+	return decodeAddresses(e.ToJSON)
 }
 
 // SetToList converts a slice to JSON string and stores in To field
-func (e *Email) SetToList(recipients []string) error{
-	bytes, err := json.Marshal(recipients)
-	if err != nil{
+func (e *Email) SetToList(recipients []Address) error {
+	return encodeJSON(recipients, &e.ToJSON)
+}
+
+// GetCcList parses the stored Cc addresses
+func (e *Email) GetCcList() ([]Address, error) {
+	return decodeAddresses(e.CcJSON)
+}
+
+// SetCcList stores the Cc addresses
+func (e *Email) SetCcList(recipients []Address) error {
+	return encodeJSON(recipients, &e.CcJSON)
+}
+
+// GetBccList parses the stored Bcc addresses
+func (e *Email) GetBccList() ([]Address, error) {
+	return decodeAddresses(e.BccJSON)
+}
+
+// SetBccList stores the Bcc addresses
+func (e *Email) SetBccList(recipients []Address) error {
+	return encodeJSON(recipients, &e.BccJSON)
+}
+
+// GetReplyToList parses the stored Reply-To addresses
+func (e *Email) GetReplyToList() ([]Address, error) {
+	return decodeAddresses(e.ReplyToJSON)
+}
+
+// SetReplyToList stores the Reply-To addresses
+func (e *Email) SetReplyToList(recipients []Address) error {
+	return encodeJSON(recipients, &e.ReplyToJSON)
+}
+
+// GetReferences parses the stored References message IDs, oldest first
+func (e *Email) GetReferences() ([]string, error) {
+	if e.ReferencesJSON == "" {
+		return nil, nil
+	}
+	var refs []string
+	err := json.Unmarshal([]byte(e.ReferencesJSON), &refs)
+	return refs, err
+}
+
+// SetReferences stores the References message IDs
+func (e *Email) SetReferences(refs []string) error {
+	return encodeJSON(refs, &e.ReferencesJSON)
+}
+
+// decodeAddresses accepts both the current [{"name","address"}] format and
+// the legacy ["alice@example.com"] string list
+func decodeAddresses(raw string) ([]Address, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var addrs []Address
+	if err := json.Unmarshal([]byte(raw), &addrs); err == nil {
+		return addrs, nil
+	}
+
+	var legacy []string
+	if err := json.Unmarshal([]byte(raw), &legacy); err != nil {
+		return nil, err
+	}
+	addrs = make([]Address, len(legacy))
+	for i, a := range legacy {
+		addrs[i] = Address{Address: a}
+	}
+	return addrs, nil
+}
+
+// encodeJSON marshals v into *dst, leaving it empty for empty slices
+func encodeJSON[T any](v []T, dst *string) error {
+	if len(v) == 0 {
+		*dst = ""
+		return nil
+	}
+	bytes, err := json.Marshal(v)
+	if err != nil {
 		return err
 	}
-	e.ToJSON = string(bytes)
+	*dst = string(bytes)
 	return nil
 }
 
+// GetLabels parses the stored label IDs into a slice
+func (e *Email) GetLabels() ([]string, error) {
+	if e.LabelsJSON == "" {
+		return nil, nil
+	}
+	var labels []string
+	err := json.Unmarshal([]byte(e.LabelsJSON), &labels)
+	return labels, err
+}
+
+// SetLabels converts label IDs to a JSON string and stores them
+func (e *Email) SetLabels(labels []string) error {
+	bytes, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+	e.LabelsJSON = string(bytes)
+	return nil
+}
+
+// SetAttachments sets the parsed attachments and HasAttachments; inline
+// parts such as signature images do not count as attachments
+func (e *Email) SetAttachments(atts []Attachment) {
+	e.Attachments = atts
+	e.HasAttachments = false
+	for _, att := range atts {
+		if !att.Inline {
+			e.HasAttachments = true
+			break
+		}
+	}
+}
+
+// ComputeHash returns the SHA-256 of the stored message fields. Thread IDs
+// are left out: rethreading is bookkeeping, not a change to the message.
+func (e *Email) ComputeHash() string {
+	h := sha256.New()
+	for _, field := range []string{
+		e.Source, e.Subject, e.From,
+		e.ToJSON, e.CcJSON, e.BccJSON, e.ReplyToJSON,
+		e.MessageID, e.InReplyTo, e.ReferencesJSON, e.ListID,
+		e.LabelsJSON, e.Snippet, e.BodyText,
+		e.Date.UTC().Format(time.RFC3339Nano),
+	} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Indexed reports whether the email's current content has been indexed
+func (e *Email) Indexed() bool {
+	return e.IndexedAt != nil && e.IndexedHash != "" && e.IndexedHash == e.ContentHash
+}
+
+// Thread is the conversation aggregate, rebuilt from its emails whenever
+// a sync touches it. Gmail supplies thread IDs; other sources are threaded
+// from In-Reply-To/References (JWZ).
+type Thread struct {
+	ID      string `gorm:"primaryKey;column:id"`
+	Subject string `gorm:"column:subject"` // 去掉 Re:/Fwd: 前缀后的主题
+
+	// 所有发件人和收件人 (From/To/Cc) 去重后的 JSON 数组
+	ParticipantsJSON string `gorm:"column:participants"`
+	MessageCount     int    `gorm:"column:message_count"`
+
+	FirstDate time.Time `gorm:"column:first_date"`
+	LastDate  time.Time `gorm:"index;column:last_date"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TableName for Thread
+func (Thread) TableName() string {
+	return "threads"
+}
+
+// GetParticipants parses the participant list
+func (t *Thread) GetParticipants() ([]Address, error) {
+	return decodeAddresses(t.ParticipantsJSON)
+}
+
+// SetParticipants encodes the participant list
+func (t *Thread) SetParticipants(addrs []Address) error {
+	return encodeJSON(addrs, &t.ParticipantsJSON)
+}
+
+// Attachment is a file attached to an email. The bytes live in the
+// content-addressed blob store; ContentHash is empty until they have been
+// downloaded (Gmail attachments are fetched lazily by RemoteID).
+type Attachment struct {
+	// ID 由 EmailID 和 MIME part ID 组成，例如 "18c2f.../2"
+	ID       string `gorm:"primaryKey;column:id"`
+	EmailID  string `gorm:"index;column:email_id"`
+	PartID   string `gorm:"column:part_id"`
+	Filename string `gorm:"column:filename"`
+	MimeType string `gorm:"column:mime_type"`
+	Size     int64  `gorm:"column:size"`
+
+	// SHA-256 (hex) of the content, also the blob file name
+	ContentHash string `gorm:"index;column:content_hash"`
+
+	// Gmail attachmentId，用于按需调用 Messages.Attachments.Get
+	RemoteID string `gorm:"column:remote_id"`
+	Inline   bool   `gorm:"column:inline"`
+
+	// 文本抽取状态：IndexedAt 非空表示已经切块并写入 Qdrant
+	ExtractError string     `gorm:"column:extract_error"`
+	IndexedAt    *time.Time `gorm:"column:indexed_at"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// Data 是解析时已经拿到的内容（本地归档、Gmail 小附件），不入库
+	Data []byte `gorm:"-" json:"-"`
+}
+
+// TableName for Attachment
+func (Attachment) TableName() string {
+	return "attachments"
+}
+
 // Chunk represents a text chunk from an email (for RAG)
 type Chunk struct {
 	ID        uint      `gorm:"primaryKey;autoIncrement"`
@@ -62,11 +307,26 @@ type Chunk struct {
 	TokenCnt  int       `gorm:"column:token_count"`
 	
 	Source    string    `gorm:"column:source"` 
-	// body / subject / snippet
+	// body / quoted / signature / attachment
+
+	// AttachmentID 只有附件的 chunk 才有；Position 是在这个附件里的顺序
+	AttachmentID string `gorm:"index;column:attachment_id;not null;default:''"`
+
+	// ContentHash 是 Content 的 SHA-256，用来判断重新索引时要不要再 embed
+	ContentHash string `gorm:"column:content_hash"`
+
+	// Chunker 是切出这个 chunk 的策略；邮件没变、策略也没变时直接复用
+	Chunker string `gorm:"column:chunker"`
 	
 	CreatedAt time.Time
 }
 
+// ComputeHash returns the SHA-256 of the chunk content
+func (c *Chunk) ComputeHash() string {
+	sum := sha256.Sum256([]byte(c.Content))
+	return hex.EncodeToString(sum[:])
+}
+
 // TableName for Chunk
 func (Chunk) TableName() string {
 	return "chunks"
@@ -79,6 +339,9 @@ type Embedding struct {
 	ChunkID  uint      `gorm:"uniqueIndex;column:chunk_id"`
 	EmailID  string    `gorm:"index;column:email_id"`
 
+	// AttachmentID is set for the chunks of an attachment
+	AttachmentID string `gorm:"index;column:attachment_id;not null;default:''"`
+
 	VectorID string    `gorm:"uniqueIndex;column:vector_id"` 
 	// Qdrant point ID
 	
@@ -86,8 +349,13 @@ type Embedding struct {
 	// text-embedding-3-small
 	
 	Dim      int       `gorm:"column:dimension"`
+
+	// ContentHash is the Chunk.ContentHash that was embedded; a chunk whose
+	// hash and model still match is not embedded again
+	ContentHash string `gorm:"column:content_hash"`
 	
 	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 
@@ -96,12 +364,28 @@ func (Embedding) TableName() string {
 	return "embeddings"
 }
 
-// SyncMetadata tracks the last sync time with Gmail
+// SyncMetadata tracks the sync state of a mail source
 type SyncMetadata struct {
 	ID            uint      `gorm:"primaryKey;autoIncrement"`
+
+	// Source identifies the mailbox, e.g. "gmail:alice@example.com"
+	Source        string    `gorm:"uniqueIndex;column:source"`
+
+	// HistoryID is the Gmail mailbox historyId at the end of the last sync.
+	// Incremental syncs call users.history.list starting from here.
+	HistoryID     uint64    `gorm:"column:history_id"`
+
+	// IMAP folder state: when UIDVALIDITY changes every cached UID is void
+	// and the folder is refetched; otherwise only UIDs >= UIDNext are new.
+	UIDValidity   uint32    `gorm:"column:uid_validity"`
+	UIDNext       uint32    `gorm:"column:uid_next"`
 	
 	LastSyncTime  time.Time `gorm:"column:last_sync_time"`
 	EmailsCount   int       `gorm:"column:emails_count"`
+
+	// ReconciledAt is when local IDs were last diffed against the mailbox
+	// to catch deletions that fell outside the history window
+	ReconciledAt  time.Time `gorm:"column:reconciled_at"`
 	
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
@@ -112,3 +396,63 @@ type SyncMetadata struct {
 func (SyncMetadata) TableName() string {
 	return "sync_metadata"
 }
+
+// Sync job phases, in order
+const (
+	SyncPhaseFetch = "fetch" // listing message IDs (or replaying history)
+	SyncPhaseStore = "store" // downloading and storing the listed messages
+	SyncPhaseIndex = "index" // embedding stored messages that were not indexed yet
+	SyncPhaseDone  = "done"
+)
+
+// SyncJob is the checkpoint of one sync run, so an interrupted run
+// (Ctrl+C, laptop sleep, network loss) can continue with `sync --resume`
+type SyncJob struct {
+	ID     uint   `gorm:"primaryKey;autoIncrement"`
+	Source string `gorm:"index;column:source"`
+	Mode   string `gorm:"column:mode"`
+	Phase  string `gorm:"column:phase"`
+
+	// 恢复时按原来的参数继续，而不是命令行上新给的参数
+	Query            string `gorm:"column:query"`
+	MaxResults       int64  `gorm:"column:max_results"`
+	IncludeSpamTrash bool   `gorm:"column:include_spam_trash"`
+
+	// PageToken is the messages.list page to request next; empty once
+	// listing has finished (or before it started)
+	PageToken string `gorm:"column:page_token"`
+
+	// HistoryID is recorded in SyncMetadata when the job completes
+	HistoryID uint64 `gorm:"column:history_id"`
+
+	Listed  int `gorm:"column:listed"`
+	Stored  int `gorm:"column:stored"`
+	Indexed int `gorm:"column:indexed"`
+
+	// Error is the reason the last attempt stopped, if it failed
+	Error string `gorm:"column:error"`
+
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	FinishedAt *time.Time `gorm:"column:finished_at"`
+}
+
+// TableName for SyncJob
+func (SyncJob) TableName() string {
+	return "sync_jobs"
+}
+
+// SyncJobItem is one listed message of a sync job and how far it got
+type SyncJobItem struct {
+	JobID     uint   `gorm:"primaryKey;column:job_id"`
+	MessageID string `gorm:"primaryKey;column:message_id"`
+	// Position keeps the listing order (newest first)
+	Position int  `gorm:"column:position"`
+	Stored   bool `gorm:"index;column:stored"`
+	Indexed  bool `gorm:"column:indexed"`
+}
+
+// TableName for SyncJobItem
+func (SyncJobItem) TableName() string {
+	return "sync_job_items"
+}
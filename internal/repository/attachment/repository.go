@@ -0,0 +1,28 @@
+package attachment
+
+import (
+	"context"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+)
+
+// Repository defines operations for attachment metadata
+type Repository interface {
+	// Save creates or updates an attachment by ID
+	Save(ctx context.Context, att *domain.Attachment) error
+
+	// Get returns an attachment by ID, or nil if it does not exist
+	Get(ctx context.Context, id string) (*domain.Attachment, error)
+
+	// ListByEmail returns the attachments of an email in part order
+	ListByEmail(ctx context.Context, emailID string) ([]*domain.Attachment, error)
+
+	// ListUnindexed returns attachments that have not been indexed yet
+	ListUnindexed(ctx context.Context, limit int) ([]*domain.Attachment, error)
+
+	// DeleteByEmail removes the attachment rows of an email
+	DeleteByEmail(ctx context.Context, emailID string) error
+
+	// CountByHash returns how many attachments reference a blob
+	CountByHash(ctx context.Context, hash string) (int64, error)
+}
@@ -0,0 +1,97 @@
+package attachment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+	"gorm.io/gorm"
+)
+
+type sqliteRepo struct {
+	db     *gorm.DB
+	logger logger.Logger
+}
+
+// NewSQLiteRepository creates a new SQLite-based attachment repository
+func NewSQLiteRepository(db *gorm.DB, log logger.Logger) Repository {
+	return &sqliteRepo{
+		db:     db,
+		logger: log,
+	}
+}
+
+// Save creates or updates an attachment
+func (r *sqliteRepo) Save(ctx context.Context, att *domain.Attachment) error {
+	if att.ID == "" || att.EmailID == "" {
+		return fmt.Errorf("attachment id and email id are required")
+	}
+	// 主键是字符串，GORM 的 Save 会先 UPDATE，没有命中再 INSERT
+	if err := r.db.WithContext(ctx).Save(att).Error; err != nil {
+		return fmt.Errorf("failed to save attachment: %w", err)
+	}
+	return nil
+}
+
+// Get returns an attachment by ID
+func (r *sqliteRepo) Get(ctx context.Context, id string) (*domain.Attachment, error) {
+	var att domain.Attachment
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&att).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+	return &att, nil
+}
+
+// ListByEmail returns the attachments of an email
+func (r *sqliteRepo) ListByEmail(ctx context.Context, emailID string) ([]*domain.Attachment, error) {
+	var atts []*domain.Attachment
+	err := r.db.WithContext(ctx).
+		Where("email_id = ?", emailID).
+		Order("part_id ASC").
+		Find(&atts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attachments: %w", err)
+	}
+	return atts, nil
+}
+
+// ListUnindexed returns attachments without an IndexedAt timestamp
+func (r *sqliteRepo) ListUnindexed(ctx context.Context, limit int) ([]*domain.Attachment, error) {
+	var atts []*domain.Attachment
+	query := r.db.WithContext(ctx).
+		Where("indexed_at IS NULL").
+		Order("created_at ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&atts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list unindexed attachments: %w", err)
+	}
+	return atts, nil
+}
+
+// DeleteByEmail removes the attachment rows of an email
+func (r *sqliteRepo) DeleteByEmail(ctx context.Context, emailID string) error {
+	if err := r.db.WithContext(ctx).Where("email_id = ?", emailID).Delete(&domain.Attachment{}).Error; err != nil {
+		return fmt.Errorf("failed to delete attachments: %w", err)
+	}
+	return nil
+}
+
+// CountByHash returns how many attachments reference a blob
+func (r *sqliteRepo) CountByHash(ctx context.Context, hash string) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&domain.Attachment{}).
+		Where("content_hash = ?", hash).
+		Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count attachments: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,104 @@
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Store keeps immutable blobs on disk addressed by the SHA-256 of their
+// content, so an attachment forwarded ten times is stored once.
+// Layout: <dir>/ab/abcdef... (first two hex digits as a fan-out directory).
+type Store struct {
+	dir string
+}
+
+// NewStore creates a blob store rooted at dir, creating it if needed
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Hash returns the content address of data
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Put stores data and returns its hash. Writing a blob that already
+// exists is a no-op.
+func (s *Store) Put(data []byte) (string, error) {
+	hash := Hash(data)
+	path := s.Path(hash)
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	// 先写临时文件再 rename，进程中途退出也不会留下半个 blob
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create blob: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to store blob: %w", err)
+	}
+	return hash, nil
+}
+
+// Get reads a blob by hash. It returns an error wrapping os.ErrNotExist
+// when the blob is missing.
+func (s *Store) Get(hash string) ([]byte, error) {
+	if len(hash) < 3 {
+		return nil, fmt.Errorf("invalid blob hash %q", hash)
+	}
+	data, err := os.ReadFile(s.Path(hash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", hash, err)
+	}
+	return data, nil
+}
+
+// Has reports whether a blob exists
+func (s *Store) Has(hash string) bool {
+	if len(hash) < 3 {
+		return false
+	}
+	_, err := os.Stat(s.Path(hash))
+	return err == nil
+}
+
+// Delete removes a blob; deleting a missing blob is not an error.
+// Blobs are shared by content, so callers must check nothing else
+// references the hash first.
+func (s *Store) Delete(hash string) error {
+	if len(hash) < 3 {
+		return fmt.Errorf("invalid blob hash %q", hash)
+	}
+	if err := os.Remove(s.Path(hash)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete blob %s: %w", hash, err)
+	}
+	return nil
+}
+
+// Path returns the file path of a blob
+func (s *Store) Path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash)
+}
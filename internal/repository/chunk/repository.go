@@ -0,0 +1,26 @@
+package chunk
+
+import (
+	"context"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+)
+
+// Repository defines operations for the text chunks an email is split into
+type Repository interface {
+	// ReplaceForEmail stores the new set of chunks of an email's own text,
+	// updating rows in place by position and deleting the ones past the
+	// end. The chunks of its attachments are left alone.
+	ReplaceForEmail(ctx context.Context, emailID string, chunks []*domain.Chunk) error
+
+	// ReplaceForAttachment is ReplaceForEmail for the chunks of one
+	// attachment of an email
+	ReplaceForAttachment(ctx context.Context, emailID, attachmentID string, chunks []*domain.Chunk) error
+
+	// ListByEmail returns the chunks of an email, its attachments' after
+	// its own, in position order
+	ListByEmail(ctx context.Context, emailID string) ([]*domain.Chunk, error)
+
+	// DeleteByEmail removes the chunks of an email
+	DeleteByEmail(ctx context.Context, emailID string) error
+}
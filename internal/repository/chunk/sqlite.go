@@ -0,0 +1,104 @@
+package chunk
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+	"gorm.io/gorm"
+)
+
+type sqliteRepo struct {
+	db     *gorm.DB
+	logger logger.Logger
+}
+
+// NewSQLiteRepository creates a new SQLite-based chunk repository
+func NewSQLiteRepository(db *gorm.DB, log logger.Logger) Repository {
+	return &sqliteRepo{
+		db:     db,
+		logger: log,
+	}
+}
+
+// ReplaceForEmail stores the new set of chunks of an email in one
+// transaction. Rows are matched by position and only rewritten when they
+// changed, so chunk IDs (which embedding records point to) stay stable;
+// rows past the new last position are deleted. The chunks get their IDs.
+func (r *sqliteRepo) ReplaceForEmail(ctx context.Context, emailID string, chunks []*domain.Chunk) error {
+	return r.replace(ctx, emailID, "", chunks)
+}
+
+// ReplaceForAttachment does the same for the chunks of one attachment
+func (r *sqliteRepo) ReplaceForAttachment(ctx context.Context, emailID, attachmentID string, chunks []*domain.Chunk) error {
+	return r.replace(ctx, emailID, attachmentID, chunks)
+}
+
+// replace stores the chunks of an email ("" attachmentID) or of one of
+// its attachments
+func (r *sqliteRepo) replace(ctx context.Context, emailID, attachmentID string, chunks []*domain.Chunk) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing []*domain.Chunk
+		if err := tx.Where("email_id = ? AND attachment_id = ?", emailID, attachmentID).Find(&existing).Error; err != nil {
+			return err
+		}
+		byPosition := make(map[int]*domain.Chunk, len(existing))
+		for _, c := range existing {
+			byPosition[c.Position] = c
+		}
+
+		var created []*domain.Chunk
+		for _, c := range chunks {
+			c.EmailID, c.AttachmentID = emailID, attachmentID
+			old, ok := byPosition[c.Position]
+			if !ok {
+				c.ID = 0
+				created = append(created, c)
+				continue
+			}
+			c.ID, c.CreatedAt = old.ID, old.CreatedAt
+			if old.ContentHash == c.ContentHash && old.Source == c.Source && old.TokenCnt == c.TokenCnt {
+				continue
+			}
+			if err := tx.Save(c).Error; err != nil {
+				return err
+			}
+		}
+		if len(created) > 0 {
+			if err := tx.CreateInBatches(created, 100).Error; err != nil {
+				return err
+			}
+		}
+
+		// 邮件变短时，多出来的旧 chunk 删掉
+		return tx.Where("email_id = ? AND attachment_id = ? AND position >= ?", emailID, attachmentID, len(chunks)).
+			Delete(&domain.Chunk{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to replace chunks: %w", err)
+	}
+	return nil
+}
+
+// ListByEmail returns the chunks of an email, its attachments' after its
+// own, in position order
+func (r *sqliteRepo) ListByEmail(ctx context.Context, emailID string) ([]*domain.Chunk, error) {
+	var chunks []*domain.Chunk
+	err := r.db.WithContext(ctx).
+		Where("email_id = ?", emailID).
+		Order("attachment_id ASC, position ASC").
+		Find(&chunks).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chunks: %w", err)
+	}
+	return chunks, nil
+}
+
+// DeleteByEmail removes the chunks of an email
+func (r *sqliteRepo) DeleteByEmail(ctx context.Context, emailID string) error {
+	if err := r.db.WithContext(ctx).Where("email_id = ?", emailID).Delete(&domain.Chunk{}).Error; err != nil {
+		return fmt.Errorf("failed to delete chunks: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+package email
+
+import "errors"
+
+var (
+	// ErrNotFound is returned when no (live) email has the requested ID
+	ErrNotFound = errors.New("email not found")
+
+	// ErrDuplicate is returned by Create when the ID is already stored
+	ErrDuplicate = errors.New("email already exists")
+)
@@ -0,0 +1,146 @@
+package email
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/vector"
+	"gorm.io/gorm"
+)
+
+// likeEscaper escapes the LIKE wildcards; Gmail label IDs such as
+// "Label_12" contain underscores
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// contains returns the LIKE pattern matching s anywhere, to be used with
+// ESCAPE '\'
+func contains(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
+
+// Scope applies filter to a query on the emails table, e.g.
+//
+//	db.Model(&domain.Email{}).Scopes(email.Scope(filter))
+//
+// Other repositories use it to restrict their own queries with a subquery.
+func Scope(filter Filter) func(*gorm.DB) *gorm.DB {
+	return func(query *gorm.DB) *gorm.DB {
+		if filter.From != "" {
+			// 记得要跟 domain tag 里的 column 名字一致
+			query = query.Where("from_address LIKE ?", "%"+filter.From+"%")
+		}
+		// date 按原始时区存成文本，不同时区之间直接比较字符串会错，换成 Unix 时间再比
+		if filter.DateFrom != nil {
+			query = query.Where("unixepoch(date) >= ?", filter.DateFrom.Unix())
+		}
+		if filter.DateTo != nil {
+			query = query.Where("unixepoch(date) < ?", filter.DateTo.Unix())
+		}
+
+		// 地址列存的是 JSON，LIKE 子串匹配即可覆盖 name 和 address
+		if filter.To != "" {
+			query = query.Where("to_list LIKE ?", "%"+filter.To+"%")
+		}
+		if filter.Cc != "" {
+			query = query.Where("cc_list LIKE ?", "%"+filter.Cc+"%")
+		}
+		if filter.Recipient != "" {
+			like := "%" + filter.Recipient + "%"
+			query = query.Where("to_list LIKE ? OR cc_list LIKE ? OR bcc_list LIKE ?", like, like, like)
+		}
+		if filter.ListID != "" {
+			query = query.Where("list_id = ?", filter.ListID)
+		}
+		if filter.ThreadID != "" {
+			query = query.Where("thread_id = ?", filter.ThreadID)
+		}
+		if filter.MessageID != "" {
+			query = query.Where("message_id = ?", filter.MessageID)
+		}
+		if filter.References != "" {
+			// references_list 存的是 JSON 数组，按编码后的带引号形式匹配整个 ID
+			quoted, _ := json.Marshal(filter.References)
+			query = query.Where(`(in_reply_to = ? OR references_list LIKE ? ESCAPE '\')`, filter.References, contains(string(quoted)))
+		}
+		if filter.Source != "" {
+			query = query.Where("source = ?", filter.Source)
+		}
+		if filter.ExcludeSource != "" {
+			query = query.Where("source <> ?", filter.ExcludeSource)
+		}
+
+		query = whereSender(query, filter.FromAny)
+		query = whereAny(query, "to_list", filter.ToAny)
+		query = whereAny(query, "cc_list", filter.CcAny)
+		for _, s := range filter.Subject {
+			query = query.Where(`subject LIKE ? ESCAPE '\'`, contains(s))
+		}
+		for _, label := range filter.Labels {
+			// labels 存的是 JSON 数组，带上引号避免 "work" 匹配到 "homework"
+			query = query.Where(`labels LIKE ? ESCAPE '\'`, contains(`"`+label+`"`))
+		}
+		for _, text := range filter.Text {
+			like := contains(text)
+			query = query.Where(`(subject LIKE ? ESCAPE '\' OR body_text LIKE ? ESCAPE '\')`, like, like)
+		}
+		if filter.HasAttachments != nil {
+			query = query.Where("has_attachments = ?", *filter.HasAttachments)
+		}
+
+		for _, not := range filter.Not {
+			// NOT 里只放条件，不能带上外层的 Model 和软删除子句
+			conds := query.Session(&gorm.Session{NewDB: true}).Scopes(Scope(not))
+			query = query.Not(conds)
+		}
+		return query
+	}
+}
+
+// whereAny adds "column LIKE v1 OR column LIKE v2 ..." for values
+func whereAny(query *gorm.DB, column string, values []string) *gorm.DB {
+	if len(values) == 0 {
+		return query
+	}
+	conds := make([]string, len(values))
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		conds[i] = column + ` LIKE ? ESCAPE '\'`
+		args[i] = contains(v)
+	}
+	return query.Where("("+strings.Join(conds, " OR ")+")", args...)
+}
+
+// whereSender adds the condition that the sender matches any of values.
+// from_address holds the From header as received ("Alice <alice@acme.com>"
+// or a bare address), so addresses and domains are anchored at its end:
+// from:acme.com must not match sales.acme.com or acme.com.cn, the same as
+// the exact from_domain match in Qdrant.
+func whereSender(query *gorm.DB, values []string) *gorm.DB {
+	if len(values) == 0 {
+		return query
+	}
+	var conds []string
+	var args []interface{}
+	for _, v := range values {
+		field, value := vector.SenderField(v)
+		if value == "" {
+			continue
+		}
+		escaped := likeEscaper.Replace(value)
+		switch field {
+		case "from_address":
+			conds = append(conds, `from_address LIKE ? ESCAPE '\'`, `from_address LIKE ? ESCAPE '\'`)
+			args = append(args, escaped, "%<"+escaped+">")
+		case "from_domain":
+			conds = append(conds, `from_address LIKE ? ESCAPE '\'`, `from_address LIKE ? ESCAPE '\'`)
+			args = append(args, "%@"+escaped, "%@"+escaped+">")
+		default:
+			conds = append(conds, `from_address LIKE ? ESCAPE '\'`)
+			args = append(args, contains(value))
+		}
+	}
+	if len(conds) == 0 {
+		return query
+	}
+	return query.Where("("+strings.Join(conds, " OR ")+")", args...)
+}
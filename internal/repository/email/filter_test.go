@@ -0,0 +1,96 @@
+package email_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/config"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/database"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/vector"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/mailparse"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+)
+
+// TestScopeSender checks that from: matches the same senders in SQLite as
+// the exact from_address/from_domain keywords do in Qdrant
+func TestScopeSender(t *testing.T) {
+	db, err := database.NewSQLite(config.SQLiteConfig{
+		Path:            filepath.Join(t.TempDir(), "emails.db"),
+		MaxOpenConns:    1,
+		MaxIdleConns:    1,
+		ConnMaxLifetime: time.Hour,
+	}, logger.NewSlog("error"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emails := []*domain.Email{
+		{ID: "alice", From: "Alice Smith <Alice@Acme.com>"},
+		{ID: "bare", From: "bob@acme.com"},
+		{ID: "sales", From: "Sales <team@sales.acme.com>"},
+		{ID: "cn", From: "li@acme.com.cn"},
+		{ID: "malice", From: "malice@acme.com"},
+		{ID: "under", From: "x_y@other.org"},
+	}
+	if err := db.Create(emails).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// want is sorted by email ID
+	tests := []struct {
+		from string
+		want []string
+	}{
+		{"alice@acme.com", []string{"alice"}},
+		{"ALICE@ACME.COM", []string{"alice"}},
+		{"acme.com", []string{"alice", "bare", "malice"}},
+		{"@acme.com", []string{"alice", "bare", "malice"}},
+		{"sales.acme.com", []string{"sales"}},
+		{"acme.com.cn", []string{"cn"}},
+		{"xy@other.org", nil},
+		{"x_y@other.org", []string{"under"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		err := db.Model(&domain.Email{}).Scopes(email.Scope(email.Filter{FromAny: []string{tt.from}})).
+			Order("id").Pluck("id", &got).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("SQLite from:%s = %v, want %v", tt.from, got, tt.want)
+		}
+
+		// Qdrant 侧按 rag 写入的 payload 精确匹配
+		var qdrant []string
+		field, value := vector.SenderField(tt.from)
+		for _, e := range emails {
+			address := strings.ToLower(mailparse.ParseAddressList(e.From)[0].Address)
+			payload := map[string]string{
+				"from_address": address,
+				"from_domain":  address[strings.LastIndex(address, "@")+1:],
+			}
+			if payload[field] == value {
+				qdrant = append(qdrant, e.ID)
+			}
+		}
+		if strings.Join(qdrant, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("Qdrant from:%s = %v, want %v", tt.from, qdrant, tt.want)
+		}
+	}
+
+	// 名字仍是子串匹配，任何一个命中即可
+	var got []string
+	err = db.Model(&domain.Email{}).Scopes(email.Scope(email.Filter{FromAny: []string{"smith", "sales"}})).
+		Order("id").Pluck("id", &got).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != "alice,sales" {
+		t.Errorf("SQLite from:smith OR from:sales = %v, want [alice sales]", got)
+	}
+}
@@ -9,9 +9,19 @@ import (
 
 // Repository defines operations for email storage
 type Repository interface {
-	// Create stores a new email in the database
+	// Create stores a new email in the database; ErrDuplicate if the ID exists
 	Create(ctx context.Context, email *domain.Email) error
 
+	// Upsert inserts an email or updates it when its content hash changed
+	Upsert(ctx context.Context, email *domain.Email) (Change, error)
+
+	// BulkUpsert upserts a batch of emails in one transaction
+	BulkUpsert(ctx context.Context, emails []*domain.Email) (*UpsertResult, error)
+
+	// MarkIndexed records that the current content of emails is indexed,
+	// with the metadata hash in their IndexedMeta
+	MarkIndexed(ctx context.Context, emails []*domain.Email) error
+
 	// Get retrieves an email by ID
 	Get(ctx context.Context, id string) (*domain.Email, error)
 
@@ -20,6 +30,31 @@ type Repository interface {
 
 	// Count returns the total number of emails matching the filter
 	Count(ctx context.Context, filter Filter) (int64, error)
+
+	// UpdateLabels replaces the label IDs of an email
+	UpdateLabels(ctx context.Context, id string, labels []string) error
+
+	// Delete soft-deletes an email (sets deleted_at)
+	Delete(ctx context.Context, id string) error
+
+	// ListHeaders is List without bodies: it loads only the addressing and
+	// threading columns, oldest first, which is enough to rebuild threads
+	ListHeaders(ctx context.Context, filter Filter) ([]*domain.Email, error)
+
+	// UpdateThreadIDs reassigns emails to threads (email ID -> thread ID)
+	UpdateThreadIDs(ctx context.Context, threadIDs map[string]string) error
+
+	// ListIDs returns the IDs of all matching emails
+	ListIDs(ctx context.Context, filter Filter) ([]string, error)
+
+	// Restore clears deleted_at on a soft-deleted email
+	Restore(ctx context.Context, id string) error
+
+	// ListDeleted returns the headers of emails soft-deleted before a time
+	ListDeleted(ctx context.Context, before time.Time) ([]*domain.Email, error)
+
+	// Purge permanently removes an email row, deleted or not
+	Purge(ctx context.Context, id string) error
 }
 
 // Filter holds criteria for filtering emails
@@ -27,6 +62,66 @@ type Filter struct {
 	From string
 	DateFrom *time.Time
 	DateTo *time.Time
+
+	// Address filters match a substring of the name or address,
+	// e.g. To: "team@example.com" or Cc: "me@example.com"
+	To        string
+	Cc        string
+	// Recipient matches To, Cc or Bcc
+	Recipient string
+
+	ListID    string
+	ThreadID  string
+	MessageID string
+
+	// References matches the replies to a Message-ID: emails whose
+	// In-Reply-To or References contain it
+	References string
+
+	// Source / ExcludeSource keep or skip emails from one source, e.g. "gmail"
+	Source        string
+	ExcludeSource string
+
+	// The fields below come from search queries (see the query package).
+	// FromAny, ToAny and CcAny match any of their values; Subject, Labels
+	// and Text must all match. Matching is case-insensitive.
+	//
+	// FromAny values are told apart like in the Qdrant filter (see
+	// vector.SenderField): an address matches exactly, a domain matches
+	// senders at exactly that domain and a name matches a substring.
+	FromAny []string
+	ToAny   []string
+	CcAny   []string
+	Subject []string
+	Labels  []string
+
+	// Text phrases must appear in the subject or body
+	Text []string
+
+	// HasAttachments keeps emails with (true) or without (false) attachments
+	HasAttachments *bool
+
+	// Not drops the emails matching any of these filters
+	Not []Filter
+}
+
+// Change describes what an upsert did to a row
+type Change string
+
+const (
+	Inserted  Change = "inserted"
+	Updated   Change = "updated"
+	Unchanged Change = "unchanged"
+)
+
+// UpsertResult summarizes a BulkUpsert
+type UpsertResult struct {
+	Inserted  int
+	Updated   int
+	Unchanged int
+
+	// Changes maps each email ID to what happened to its row
+	Changes map[string]Change
 }
 
 // Pagination holds offset and limit for paging
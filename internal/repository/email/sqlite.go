@@ -2,11 +2,14 @@ package email
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
 	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type sqliteRepo struct {
@@ -24,9 +27,13 @@ func NewSQLiteRepository(db *gorm.DB, log logger.Logger) Repository {
 
 // Create stores a new email
 func (r *sqliteRepo) Create(ctx context.Context, email *domain.Email) error {
+	email.ContentHash = email.ComputeHash()
 	result := r.db.WithContext(ctx).Create(email)
 	if result.Error != nil{
-		return result.Error
+		if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+			return fmt.Errorf("%w: %s", ErrDuplicate, email.ID)
+		}
+		return fmt.Errorf("failed to create email: %w", result.Error)
 	}
 	r.logger.Debug("Created email", "id", email.ID)
 	return nil
@@ -37,8 +44,8 @@ func (r *sqliteRepo) Get(ctx context.Context, id string) (*domain.Email, error)
 	var email domain.Email
 	err := r.db.WithContext(ctx).Where("id = ?", id).First(&email).Error
 	if err != nil {                                                                                                                                                                                                    
-      if err == gorm.ErrRecordNotFound {                                                                                                                                                                             
-          return nil, fmt.Errorf("email not found: %s", id)                                                                                                                                                          
+      if errors.Is(err, gorm.ErrRecordNotFound) {
+          return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
       }                                                                                                                                                                                                              
       return nil, fmt.Errorf("failed to get email: %w", err)                                                                                                                                                         
   } 
@@ -46,6 +53,143 @@ func (r *sqliteRepo) Get(ctx context.Context, id string) (*domain.Email, error)
 	return &email, nil
 }
 
+// upsertColumns are overwritten when an existing email changed. Clearing
+// deleted_at means a message that shows up again (e.g. moved out of the
+// trash) is restored.
+var upsertColumns = []string{
+	"thread_id", "source", "subject", "from_address", "to_list", "cc_list",
+	"bcc_list", "reply_to_list", "message_id", "in_reply_to", "references_list",
+	"list_id", "labels", "snippet", "body_text", "date", "has_attachments",
+	"content_hash", "updated_at", "deleted_at",
+}
+
+// upsertBatchSize keeps the IN (...) lookup under SQLite's variable limit
+const upsertBatchSize = 500
+
+// Upsert inserts an email or updates it when its content hash changed
+func (r *sqliteRepo) Upsert(ctx context.Context, email *domain.Email) (Change, error) {
+	result, err := r.BulkUpsert(ctx, []*domain.Email{email})
+	if err != nil {
+		return "", err
+	}
+	return result.Changes[email.ID], nil
+}
+
+// BulkUpsert upserts a batch of emails in one transaction. Rows whose
+// content hash matches are left alone (updated_at keeps its value);
+// everything else goes through INSERT ... ON CONFLICT(id) DO UPDATE.
+func (r *sqliteRepo) BulkUpsert(ctx context.Context, emails []*domain.Email) (*UpsertResult, error) {
+	result := &UpsertResult{Changes: make(map[string]Change, len(emails))}
+	if len(emails) == 0 {
+		return result, nil
+	}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(emails); start += upsertBatchSize {
+			batch := emails[start:min(start+upsertBatchSize, len(emails))]
+			if err := r.upsertBatch(tx, batch, result); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert emails: %w", err)
+	}
+
+	r.logger.Debug("Upserted emails", "inserted", result.Inserted, "updated", result.Updated, "unchanged", result.Unchanged)
+	return result, nil
+}
+
+func (r *sqliteRepo) upsertBatch(tx *gorm.DB, batch []*domain.Email, result *UpsertResult) error {
+	ids := make([]string, 0, len(batch))
+	for _, e := range batch {
+		ids = append(ids, e.ID)
+	}
+
+	// 先查出已有行的 hash（包括软删除的），用来区分 inserted / updated / unchanged
+	var existing []*domain.Email
+	err := tx.Unscoped().Select("id", "content_hash", "deleted_at", "indexed_hash", "indexed_meta", "indexed_at").
+		Where("id IN ?", ids).Find(&existing).Error
+	if err != nil {
+		return err
+	}
+	stored := make(map[string]*domain.Email, len(existing))
+	for _, e := range existing {
+		stored[e.ID] = e
+	}
+
+	var writes []*domain.Email
+	for _, e := range batch {
+		e.ContentHash = e.ComputeHash()
+
+		// 同一批里重复的 ID 只写一次
+		if _, seen := result.Changes[e.ID]; seen {
+			continue
+		}
+
+		old, ok := stored[e.ID]
+		if ok {
+			// 索引状态留在库里，调用方靠它判断没变的邮件是否还要索引
+			e.IndexedHash, e.IndexedMeta, e.IndexedAt = old.IndexedHash, old.IndexedMeta, old.IndexedAt
+		}
+		switch {
+		case !ok:
+			result.Changes[e.ID] = Inserted
+			result.Inserted++
+		case old.ContentHash == e.ContentHash && !old.DeletedAt.Valid:
+			result.Changes[e.ID] = Unchanged
+			result.Unchanged++
+			continue
+		default:
+			result.Changes[e.ID] = Updated
+			result.Updated++
+		}
+		e.DeletedAt = gorm.DeletedAt{}
+		writes = append(writes, e)
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns(upsertColumns),
+	}).Create(&writes).Error
+}
+
+// MarkIndexed stores the content and metadata hashes each email was
+// indexed with. It leaves updated_at alone, the content did not change.
+func (r *sqliteRepo) MarkIndexed(ctx context.Context, emails []*domain.Email) error {
+	if len(emails) == 0 {
+		return nil
+	}
+	now := time.Now()
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, e := range emails {
+			if e.ContentHash == "" {
+				e.ContentHash = e.ComputeHash()
+			}
+			err := tx.Model(&domain.Email{}).Where("id = ?", e.ID).UpdateColumns(map[string]interface{}{
+				"indexed_hash": e.ContentHash,
+				"indexed_meta": e.IndexedMeta,
+				"indexed_at":   now,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark emails indexed: %w", err)
+	}
+	for _, e := range emails {
+		e.IndexedHash, e.IndexedAt = e.ContentHash, &now
+	}
+	return nil
+}
+
 // List retrieves emails with filters and pagination
 func (r *sqliteRepo) List(ctx context.Context, filter Filter, page Pagination) ([]*domain.Email, error) {
 	var emails []*domain.Email
@@ -67,18 +211,9 @@ func (r *sqliteRepo) List(ctx context.Context, filter Filter, page Pagination) (
 	return emails, nil
 }
 func (r *sqliteRepo) buildFilter(ctx context.Context, filter Filter) *gorm.DB {
-    query := r.db.WithContext(ctx).Model(&domain.Email{})
-
-    if filter.From != "" {
-        // 记得要跟 domain tag 里的 column 名字一致
-        query = query.Where("from_address LIKE ?", "%"+filter.From+"%")
-    }
-    if filter.DateFrom != nil {
-        query = query.Where("date >= ?", *filter.DateFrom)
-    }
-    
-    return query
+    return r.db.WithContext(ctx).Model(&domain.Email{}).Scopes(Scope(filter))
 }
+
 // Count returns the total number of emails matching the filter
 func (r *sqliteRepo) Count(ctx context.Context, filter Filter) (int64, error) {
 	var count int64
@@ -90,3 +225,124 @@ func (r *sqliteRepo) Count(ctx context.Context, filter Filter) (int64, error) {
 		  }
 	return count, nil
 }
+
+
+// UpdateLabels replaces the label IDs of an email. The content hash is
+// recomputed so a later Upsert with the same labels is a no-op.
+func (r *sqliteRepo) UpdateLabels(ctx context.Context, id string, labels []string) error {
+	e, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := e.SetLabels(labels); err != nil {
+		return fmt.Errorf("failed to encode labels: %w", err)
+	}
+
+	result := r.db.WithContext(ctx).Model(&domain.Email{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"labels":       e.LabelsJSON,
+		"content_hash": e.ComputeHash(),
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update labels: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	r.logger.Debug("Updated email labels", "id", id, "labels", labels)
+	return nil
+}
+
+// Delete soft-deletes an email
+func (r *sqliteRepo) Delete(ctx context.Context, id string) error {
+	result := r.db.WithContext(ctx).Where("id = ?", id).Delete(&domain.Email{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete email: %w", result.Error)
+	}
+	r.logger.Debug("Deleted email", "id", id, "affected", result.RowsAffected)
+	return nil
+}
+
+// headerColumns are the columns ListHeaders loads
+var headerColumns = []string{
+	"id", "thread_id", "source", "subject", "from_address", "to_list", "cc_list",
+	"message_id", "in_reply_to", "references_list", "date",
+}
+
+// ListHeaders retrieves the header columns of matching emails, oldest first
+func (r *sqliteRepo) ListHeaders(ctx context.Context, filter Filter) ([]*domain.Email, error) {
+	var emails []*domain.Email
+	err := r.buildFilter(ctx, filter).
+		Select(headerColumns).
+		Order("date ASC").
+		Find(&emails).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list email headers: %w", err)
+	}
+	return emails, nil
+}
+
+// UpdateThreadIDs reassigns emails to threads in a single transaction
+func (r *sqliteRepo) UpdateThreadIDs(ctx context.Context, threadIDs map[string]string) error {
+	if len(threadIDs) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for id, threadID := range threadIDs {
+			// UpdateColumn 不会改 updated_at，重新归类会话不算邮件内容变化
+			err := tx.Model(&domain.Email{}).Where("id = ?", id).UpdateColumn("thread_id", threadID).Error
+			if err != nil {
+				return fmt.Errorf("failed to update thread of %s: %w", id, err)
+			}
+		}
+		r.logger.Debug("Updated thread IDs", "count", len(threadIDs))
+		return nil
+	})
+}
+
+// ListIDs returns the IDs of all matching emails
+func (r *sqliteRepo) ListIDs(ctx context.Context, filter Filter) ([]string, error) {
+	var ids []string
+	if err := r.buildFilter(ctx, filter).Pluck("id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to list email ids: %w", err)
+	}
+	return ids, nil
+}
+
+// Restore clears deleted_at, e.g. when a trashed message is moved back
+func (r *sqliteRepo) Restore(ctx context.Context, id string) error {
+	result := r.db.WithContext(ctx).Unscoped().Model(&domain.Email{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		UpdateColumn("deleted_at", nil)
+	if result.Error != nil {
+		return fmt.Errorf("failed to restore email: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: no deleted email %s", ErrNotFound, id)
+	}
+	r.logger.Debug("Restored email", "id", id)
+	return nil
+}
+
+// ListDeleted returns the headers of emails soft-deleted before a time
+func (r *sqliteRepo) ListDeleted(ctx context.Context, before time.Time) ([]*domain.Email, error) {
+	var emails []*domain.Email
+	err := r.db.WithContext(ctx).Unscoped().
+		Select(append(headerColumns, "deleted_at")).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+		Order("deleted_at ASC").
+		Find(&emails).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deleted emails: %w", err)
+	}
+	return emails, nil
+}
+
+// Purge permanently removes an email row
+func (r *sqliteRepo) Purge(ctx context.Context, id string) error {
+	result := r.db.WithContext(ctx).Unscoped().Where("id = ?", id).Delete(&domain.Email{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to purge email: %w", result.Error)
+	}
+	r.logger.Debug("Purged email", "id", id, "affected", result.RowsAffected)
+	return nil
+}
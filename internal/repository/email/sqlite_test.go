@@ -0,0 +1,164 @@
+package email_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/config"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/database"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+)
+
+func newRepo(t *testing.T) email.Repository {
+	t.Helper()
+	log := logger.NewSlog("error")
+	db, err := database.NewSQLite(config.SQLiteConfig{
+		Path:            filepath.Join(t.TempDir(), "emails.db"),
+		MaxOpenConns:    1,
+		MaxIdleConns:    1,
+		ConnMaxLifetime: time.Hour,
+	}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return email.NewSQLiteRepository(db, log)
+}
+
+func TestBulkUpsert(t *testing.T) {
+	repo := newRepo(t)
+	ctx := context.Background()
+	date := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	parse := func() []*domain.Email {
+		return []*domain.Email{
+			{ID: "a", Subject: "Budget", BodyText: "Q3 numbers", Date: date},
+			{ID: "b", Subject: "Lunch", BodyText: "Noon?", Date: date},
+		}
+	}
+	check := func(name string, result *email.UpsertResult, inserted, updated, unchanged int) {
+		t.Helper()
+		if result.Inserted != inserted || result.Updated != updated || result.Unchanged != unchanged {
+			t.Errorf("%s: inserted %d, updated %d, unchanged %d; want %d, %d, %d", name,
+				result.Inserted, result.Updated, result.Unchanged, inserted, updated, unchanged)
+		}
+	}
+
+	result, err := repo.BulkUpsert(ctx, parse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("insert", result, 2, 0, 0)
+	if result.Changes["a"] != email.Inserted || result.Changes["b"] != email.Inserted {
+		t.Errorf("insert changes = %v", result.Changes)
+	}
+	before, err := repo.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.ContentHash == "" {
+		t.Error("content hash was not stored")
+	}
+
+	// 内容没变的邮件不写库，updated_at 保持原值
+	result, err = repo.BulkUpsert(ctx, parse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("unchanged re-upsert", result, 0, 0, 2)
+	after, err := repo.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.UpdatedAt.Equal(before.UpdatedAt) {
+		t.Errorf("unchanged re-upsert moved updated_at from %v to %v", before.UpdatedAt, after.UpdatedAt)
+	}
+
+	if err := repo.MarkIndexed(ctx, parse()[:1]); err != nil {
+		t.Fatal(err)
+	}
+	changed := parse()
+	changed[0].BodyText = "Q3 numbers, revised"
+	// 同一批里重复的 ID 只算一次
+	changed = append(changed, changed[1])
+	result, err = repo.BulkUpsert(ctx, changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("changed re-upsert", result, 0, 1, 1)
+	if result.Changes["a"] != email.Updated || result.Changes["b"] != email.Unchanged {
+		t.Errorf("changed re-upsert changes = %v", result.Changes)
+	}
+	got, err := repo.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.BodyText != "Q3 numbers, revised" || got.ContentHash == before.ContentHash {
+		t.Errorf("update did not store the new body and hash: %q", got.BodyText)
+	}
+	// 内容变了，索引状态还在，但已经不算索引过
+	if got.IndexedAt == nil || got.Indexed() {
+		t.Errorf("updated email: indexed at %v, Indexed() = %v; want the old state kept and not indexed", got.IndexedAt, got.Indexed())
+	}
+
+	// 软删除后再出现的邮件即使内容没变也要恢复
+	if err := repo.Delete(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	result, err = repo.BulkUpsert(ctx, parse()[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("re-upsert of a deleted email", result, 0, 1, 0)
+	if _, err := repo.Get(ctx, "b"); err != nil {
+		t.Errorf("deleted email was not restored: %v", err)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	repo := newRepo(t)
+	ctx := context.Background()
+	e := &domain.Email{ID: "a", Subject: "Budget", BodyText: "Q3 numbers"}
+
+	for _, want := range []email.Change{email.Inserted, email.Unchanged} {
+		change, err := repo.Upsert(ctx, e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if change != want {
+			t.Errorf("Upsert = %q, want %q", change, want)
+		}
+	}
+	e.Subject = "Re: Budget"
+	if change, err := repo.Upsert(ctx, e); err != nil || change != email.Updated {
+		t.Errorf("Upsert of a changed email = %q, %v; want %q", change, err, email.Updated)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	repo := newRepo(t)
+	ctx := context.Background()
+
+	if _, err := repo.Get(ctx, "missing"); !errors.Is(err, email.ErrNotFound) {
+		t.Errorf("Get of a missing ID = %v, want ErrNotFound", err)
+	}
+
+	e := &domain.Email{ID: "a", Subject: "Budget"}
+	if err := repo.Create(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Create(ctx, &domain.Email{ID: "a", Subject: "Other"}); !errors.Is(err, email.ErrDuplicate) {
+		t.Errorf("Create of an existing ID = %v, want ErrDuplicate", err)
+	}
+
+	// 软删除的邮件 Get 不到
+	if err := repo.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Get(ctx, "a"); !errors.Is(err, email.ErrNotFound) {
+		t.Errorf("Get of a deleted email = %v, want ErrNotFound", err)
+	}
+}
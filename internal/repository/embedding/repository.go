@@ -0,0 +1,26 @@
+package embedding
+
+import (
+	"context"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+)
+
+// Repository tracks which chunks are embedded in Qdrant, with which model
+// and for which content
+type Repository interface {
+	// ListByEmail returns the embedding records of an email's own chunks
+	ListByEmail(ctx context.Context, emailID string) ([]*domain.Embedding, error)
+
+	// ListByAttachment returns the embedding records of an attachment
+	ListByAttachment(ctx context.Context, attachmentID string) ([]*domain.Embedding, error)
+
+	// Save inserts or updates records, matched by vector ID
+	Save(ctx context.Context, embeddings []*domain.Embedding) error
+
+	// DeleteByVectorIDs removes the records of deleted points
+	DeleteByVectorIDs(ctx context.Context, vectorIDs []string) error
+
+	// DeleteByEmail removes every record of an email
+	DeleteByEmail(ctx context.Context, emailID string) error
+}
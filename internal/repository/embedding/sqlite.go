@@ -0,0 +1,93 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type sqliteRepo struct {
+	db     *gorm.DB
+	logger logger.Logger
+}
+
+// NewSQLiteRepository creates a new SQLite-based embedding repository
+func NewSQLiteRepository(db *gorm.DB, log logger.Logger) Repository {
+	return &sqliteRepo{
+		db:     db,
+		logger: log,
+	}
+}
+
+// ListByEmail returns the embedding records of an email's own chunks
+func (r *sqliteRepo) ListByEmail(ctx context.Context, emailID string) ([]*domain.Embedding, error) {
+	var embeddings []*domain.Embedding
+	if err := r.db.WithContext(ctx).Where("email_id = ? AND attachment_id = ''", emailID).Find(&embeddings).Error; err != nil {
+		return nil, fmt.Errorf("failed to list embeddings: %w", err)
+	}
+	return embeddings, nil
+}
+
+// ListByAttachment returns the embedding records of an attachment
+func (r *sqliteRepo) ListByAttachment(ctx context.Context, attachmentID string) ([]*domain.Embedding, error) {
+	var embeddings []*domain.Embedding
+	if err := r.db.WithContext(ctx).Where("attachment_id = ?", attachmentID).Find(&embeddings).Error; err != nil {
+		return nil, fmt.Errorf("failed to list embeddings: %w", err)
+	}
+	return embeddings, nil
+}
+
+// Save inserts or updates records, matched by vector ID. SQLite may hand
+// the ID of a deleted chunk to a new one, so records that still point at
+// one of the chunks under another vector ID are dropped first.
+func (r *sqliteRepo) Save(ctx context.Context, embeddings []*domain.Embedding) error {
+	if len(embeddings) == 0 {
+		return nil
+	}
+
+	vectorIDs := make([]string, len(embeddings))
+	chunkIDs := make([]uint, len(embeddings))
+	for i, e := range embeddings {
+		e.ID = 0
+		vectorIDs[i] = e.VectorID
+		chunkIDs[i] = e.ChunkID
+	}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("chunk_id IN ? AND vector_id NOT IN ?", chunkIDs, vectorIDs).
+			Delete(&domain.Embedding{}).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "vector_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"chunk_id", "email_id", "attachment_id", "model", "dimension", "content_hash", "updated_at"}),
+		}).CreateInBatches(embeddings, 100).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save embeddings: %w", err)
+	}
+	return nil
+}
+
+// DeleteByVectorIDs removes the records of deleted points
+func (r *sqliteRepo) DeleteByVectorIDs(ctx context.Context, vectorIDs []string) error {
+	if len(vectorIDs) == 0 {
+		return nil
+	}
+	if err := r.db.WithContext(ctx).Where("vector_id IN ?", vectorIDs).Delete(&domain.Embedding{}).Error; err != nil {
+		return fmt.Errorf("failed to delete embeddings: %w", err)
+	}
+	return nil
+}
+
+// DeleteByEmail removes every record of an email
+func (r *sqliteRepo) DeleteByEmail(ctx context.Context, emailID string) error {
+	if err := r.db.WithContext(ctx).Where("email_id = ?", emailID).Delete(&domain.Embedding{}).Error; err != nil {
+		return fmt.Errorf("failed to delete embeddings: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package keyword
+
+import (
+	"context"
+	"errors"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+)
+
+// ErrUnavailable is returned when SQLite was built without FTS5
+var ErrUnavailable = errors.New("keyword search is unavailable: SQLite was built without FTS5 (build with -tags sqlite_fts5)")
+
+// Repository runs BM25 full-text queries over email subjects and the
+// contents of their body chunks
+type Repository interface {
+	// Search returns the best matching live emails, best first. A non-nil
+	// filter restricts the results to the emails it matches.
+	Search(ctx context.Context, query string, limit int, filter *email.Filter) ([]*Hit, error)
+}
+
+// Hit is an email matched by a keyword query
+type Hit struct {
+	EmailID string
+	Subject string
+	From    string
+
+	// Source is the chunk source of the best match ("body" when it was the
+	// subject of the email itself)
+	Source string
+
+	// Rank is the BM25 score as SQLite reports it: lower is better. Emails
+	// only matched by short terms rank after all BM25 hits and carry minus
+	// the number of terms they contain.
+	Rank float64
+}
@@ -0,0 +1,170 @@
+package keyword
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+	"gorm.io/gorm"
+)
+
+type sqliteRepo struct {
+	db     *gorm.DB
+	logger logger.Logger
+}
+
+// NewSQLiteRepository creates a keyword repository on the FTS5 tables
+// maintained by the database package
+func NewSQLiteRepository(db *gorm.DB, log logger.Logger) Repository {
+	return &sqliteRepo{
+		db:     db,
+		logger: log,
+	}
+}
+
+// searchSQL ranks emails by their best body chunk or subject match. Quoted
+// and signature chunks are left out like they are from the embeddings:
+// they repeat other emails and would outrank them. Subject hits weigh three
+// times as much as chunk hits. The first %s takes the hit subqueries, the
+// second the filter subquery.
+//
+// BM25 hits (tier 0) come before substring hits of short terms (tier 1),
+// which are ranked by how many of the terms they contain.
+const searchSQL = `
+SELECT e.id AS email_id, e.subject AS subject, e.from_address AS from_address,
+       h.source AS source, MIN(h.tier) AS tier,
+       COALESCE(MIN(CASE WHEN h.tier = 0 THEN h.rank END), MIN(h.rank)) AS rank
+FROM (%s) h
+JOIN emails e ON e.id = h.email_id
+WHERE e.deleted_at IS NULL%s
+GROUP BY e.id
+ORDER BY tier, rank
+LIMIT ?`
+
+const (
+	chunkMatchSQL = `
+    SELECT c.email_id AS email_id, c.source AS source, 0 AS tier, bm25(chunks_fts) AS rank
+    FROM chunks_fts JOIN chunks c ON c.id = chunks_fts.rowid
+    WHERE chunks_fts MATCH ? AND c.source IN ('body', 'attachment')`
+
+	subjectMatchSQL = `
+    SELECT em.id AS email_id, 'body' AS source, 0 AS tier, bm25(emails_fts, 3.0) AS rank
+    FROM emails_fts JOIN emails em ON em.rowid = emails_fts.rowid
+    WHERE emails_fts MATCH ?`
+
+	// %s 是每个短词一项的 LIKE 求和，n 为命中的短词数
+	chunkLikeSQL = `
+    SELECT email_id, source, 1 AS tier, -n AS rank FROM (
+        SELECT c.email_id AS email_id, c.source AS source, %s AS n
+        FROM chunks c WHERE c.source IN ('body', 'attachment')
+    ) WHERE n > 0`
+
+	subjectLikeSQL = `
+    SELECT email_id, 'body' AS source, 1 AS tier, -3 * n AS rank FROM (
+        SELECT em.id AS email_id, %s AS n FROM emails em
+    ) WHERE n > 0`
+)
+
+// Search returns the best matching live emails, best first
+func (r *sqliteRepo) Search(ctx context.Context, query string, limit int, filter *email.Filter) ([]*Hit, error) {
+	match, short := MatchQuery(query)
+	if match == "" && len(short) == 0 {
+		return nil, nil
+	}
+
+	var hits []string
+	var args []interface{}
+	if match != "" {
+		hits = append(hits, chunkMatchSQL, subjectMatchSQL)
+		args = append(args, match, match)
+	}
+	if len(short) > 0 {
+		// trigram 索引匹配不了不到三个字符的词（“报销”、“Q3”），改成子串匹配
+		n, likeArgs := likeCount("c.content", short)
+		hits = append(hits, fmt.Sprintf(chunkLikeSQL, n))
+		args = append(args, likeArgs...)
+		n, likeArgs = likeCount("em.subject", short)
+		hits = append(hits, fmt.Sprintf(subjectLikeSQL, n))
+		args = append(args, likeArgs...)
+	}
+
+	var rows []struct {
+		EmailID     string
+		Subject     string
+		FromAddress string
+		Source      string
+		Rank        float64
+	}
+	where := ""
+	if filter != nil {
+		where = " AND e.id IN (?)"
+		args = append(args, r.db.Model(&domain.Email{}).Select("id").Scopes(email.Scope(*filter)))
+	}
+	args = append(args, limit)
+	sql := fmt.Sprintf(searchSQL, strings.Join(hits, "\n    UNION ALL"), where)
+	err := r.db.WithContext(ctx).Raw(sql, args...).Scan(&rows).Error
+	if err != nil {
+		if msg := err.Error(); strings.Contains(msg, "no such table") || strings.Contains(msg, "no such module") {
+			return nil, ErrUnavailable
+		}
+		return nil, fmt.Errorf("keyword search failed: %w", err)
+	}
+
+	results := make([]*Hit, len(rows))
+	for i, row := range rows {
+		results[i] = &Hit{
+			EmailID: row.EmailID,
+			Subject: row.Subject,
+			From:    row.FromAddress,
+			Source:  row.Source,
+			Rank:    row.Rank,
+		}
+	}
+	r.logger.Debug("Keyword search completed", "query", match, "short_terms", short, "results", len(results))
+	return results, nil
+}
+
+// minTermLen is the shortest term the trigram tokenizer can match
+const minTermLen = 3
+
+// MatchQuery turns free text into an FTS5 query: every word becomes a
+// quoted phrase, so "INV-2024-0012" or "o'brien" cannot break the FTS5
+// syntax, and the phrases are OR-ed so BM25 ranks emails matching more
+// of them first. Words shorter than the trigram tokenizer can match, such
+// as most Chinese words, are returned in short to be matched as substrings.
+func MatchQuery(query string) (match string, short []string) {
+	var phrases []string
+	for _, word := range strings.Fields(query) {
+		// trigram 按原文子串匹配，词两边的标点（"budget,"）要去掉；
+		// 纯标点没有可索引的内容，FTS5 会把空短语当语法错误
+		word = strings.TrimFunc(word, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+		if word == "" {
+			continue
+		}
+		if utf8.RuneCountInString(word) < minTermLen {
+			short = append(short, word)
+			continue
+		}
+		phrases = append(phrases, `"`+strings.ReplaceAll(word, `"`, `""`)+`"`)
+	}
+	return strings.Join(phrases, " OR "), short
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// likeCount builds an expression counting how many of terms occur in
+// column, with its arguments
+func likeCount(column string, terms []string) (string, []interface{}) {
+	parts := make([]string, len(terms))
+	args := make([]interface{}, len(terms))
+	for i, term := range terms {
+		parts[i] = "(" + column + ` LIKE ? ESCAPE '\')`
+		args[i] = "%" + likeEscaper.Replace(term) + "%"
+	}
+	return "(" + strings.Join(parts, " + ") + ")", args
+}
@@ -0,0 +1,103 @@
+package keyword_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/config"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/database"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/keyword"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+)
+
+func TestSearch(t *testing.T) {
+	log := logger.NewSlog("error")
+	db, err := database.NewSQLite(config.SQLiteConfig{
+		Path:            filepath.Join(t.TempDir(), "emails.db"),
+		MaxOpenConns:    1,
+		MaxIdleConns:    1,
+		ConnMaxLifetime: time.Hour,
+	}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emails := []*domain.Email{
+		{ID: "lunch", Subject: "午饭", From: "a@example.com"},
+		{ID: "expense", Subject: "报销单已批准", From: "b@example.com"},
+		{ID: "budget", Subject: "Q3 budget review", From: "c@example.com"},
+	}
+	chunks := []*domain.Chunk{
+		{EmailID: "lunch", Source: "body", Content: "上个月的报销单请尽快提交，发票也要附上"},
+		{EmailID: "lunch", Source: "quoted", Content: "> 以前引用的旧邮件：预算 预算 预算"},
+		{EmailID: "budget", Source: "body", Content: "The café numbers are in, 100% final."},
+		{EmailID: "budget", Source: "signature", Content: "Sent from my phone"},
+		// 附件的 chunk，和 rag.ChunkAttachment 写进去的一样
+		{EmailID: "budget", Source: "attachment", AttachmentID: "budget-att", Content: "Attachment: forecast.xlsx\nEmail subject: Q3 budget review\n\nSheet: Kostenvoranschlag"},
+		{EmailID: "expense", Source: "attachment", AttachmentID: "expense-att", Content: "Attachment: receipt.pdf\nEmail subject: 报销单已批准\n\n纳税人识别号 税号 XJ-QW"},
+	}
+	if err := db.Create(emails).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(chunks).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	repo := keyword.NewSQLiteRepository(db, log)
+	if _, err := repo.Search(context.Background(), "budget", 10, nil); errors.Is(err, keyword.ErrUnavailable) {
+		t.Skip("SQLite built without FTS5 (run with -tags sqlite_fts5)")
+	}
+
+	// want is sorted, the ranking itself is BM25's business
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// 没有空格的中文也能搜到，两个字的词走子串匹配
+		{"报销单", []string{"expense", "lunch"}},
+		{"发票", []string{"lunch"}},
+		{"报销 发票", []string{"expense", "lunch"}},
+		{"Q3", []string{"budget"}},
+		{"budget, cafe", []string{"budget"}},
+		{"100%", []string{"budget"}},
+
+		// 只出现在附件里的词
+		{"Kostenvoranschlag", []string{"budget"}},
+		{"forecast.xlsx", []string{"budget"}},
+		{"税号", []string{"expense"}},
+
+		// 引用的历史和签名不参与关键词检索
+		{"预算", nil},
+		{"phone", nil},
+		{"%", nil},
+	}
+	for _, tt := range tests {
+		hits, err := repo.Search(context.Background(), tt.query, 10, nil)
+		if err != nil {
+			t.Errorf("Search(%q): %v", tt.query, err)
+			continue
+		}
+		var got []string
+		for _, h := range hits {
+			got = append(got, h.EmailID)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// 命中附件时 Source 要标出来，检索结果才能指向附件
+	hits, err := repo.Search(context.Background(), "Kostenvoranschlag", 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Source != "attachment" {
+		t.Errorf("Search(Kostenvoranschlag) = %+v, want one hit from the attachment", hits)
+	}
+}
@@ -0,0 +1,17 @@
+package metadata
+
+import (
+	"context"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+)
+
+// Repository defines operations for per-source sync state
+type Repository interface {
+	// Get returns the sync metadata for a source, or nil if the source
+	// has never been synced
+	Get(ctx context.Context, source string) (*domain.SyncMetadata, error)
+
+	// Save creates or updates the sync metadata for meta.Source
+	Save(ctx context.Context, meta *domain.SyncMetadata) error
+}
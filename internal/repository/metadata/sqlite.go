@@ -0,0 +1,52 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+	"gorm.io/gorm"
+)
+
+type sqliteRepo struct {
+	db     *gorm.DB
+	logger logger.Logger
+}
+
+// NewSQLiteRepository creates a new SQLite-based sync metadata repository
+func NewSQLiteRepository(db *gorm.DB, log logger.Logger) Repository {
+	return &sqliteRepo{
+		db:     db,
+		logger: log,
+	}
+}
+
+// Get returns the sync metadata for a source
+func (r *sqliteRepo) Get(ctx context.Context, source string) (*domain.SyncMetadata, error) {
+	var meta domain.SyncMetadata
+	err := r.db.WithContext(ctx).Where("source = ?", source).First(&meta).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 第一次同步，没有记录
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get sync metadata: %w", err)
+	}
+	return &meta, nil
+}
+
+// Save creates or updates the sync metadata
+func (r *sqliteRepo) Save(ctx context.Context, meta *domain.SyncMetadata) error {
+	if meta.Source == "" {
+		return fmt.Errorf("sync metadata source is required")
+	}
+
+	// ID 为 0 说明是新记录，GORM 的 Save 会执行 INSERT，否则 UPDATE
+	if err := r.db.WithContext(ctx).Save(meta).Error; err != nil {
+		return fmt.Errorf("failed to save sync metadata: %w", err)
+	}
+	r.logger.Debug("Saved sync metadata", "source", meta.Source, "history_id", meta.HistoryID)
+	return nil
+}
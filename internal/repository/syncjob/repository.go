@@ -0,0 +1,39 @@
+package syncjob
+
+import (
+	"context"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+)
+
+// Repository defines operations for resumable sync checkpoints
+type Repository interface {
+	// Create stores a new job
+	Create(ctx context.Context, job *domain.SyncJob) error
+
+	// Save updates a job's phase, page token and counters
+	Save(ctx context.Context, job *domain.SyncJob) error
+
+	// Unfinished returns the most recent job of a source that has not
+	// reached the done phase, or nil if there is none
+	Unfinished(ctx context.Context, source string) (*domain.SyncJob, error)
+
+	// Discard deletes the unfinished jobs of a source and their items
+	Discard(ctx context.Context, source string) error
+
+	// Finish marks a job done and drops its items
+	Finish(ctx context.Context, job *domain.SyncJob) error
+
+	// AddItems records listed message IDs; IDs already recorded are ignored
+	AddItems(ctx context.Context, jobID uint, ids []string, position int) error
+
+	// Pending returns the IDs not stored yet, in listing order
+	Pending(ctx context.Context, jobID uint) ([]string, error)
+
+	// Unindexed returns the IDs stored but not indexed yet
+	Unindexed(ctx context.Context, jobID uint) ([]string, error)
+
+	// MarkStored / MarkIndexed record progress of individual messages
+	MarkStored(ctx context.Context, jobID uint, ids []string) error
+	MarkIndexed(ctx context.Context, jobID uint, ids []string) error
+}
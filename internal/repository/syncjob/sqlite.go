@@ -0,0 +1,168 @@
+package syncjob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// idBatchSize keeps IN (...) lists under SQLite's variable limit
+const idBatchSize = 500
+
+type sqliteRepo struct {
+	db     *gorm.DB
+	logger logger.Logger
+}
+
+// NewSQLiteRepository creates a new SQLite-based sync job repository
+func NewSQLiteRepository(db *gorm.DB, log logger.Logger) Repository {
+	return &sqliteRepo{
+		db:     db,
+		logger: log,
+	}
+}
+
+// Create stores a new job
+func (r *sqliteRepo) Create(ctx context.Context, job *domain.SyncJob) error {
+	if err := r.db.WithContext(ctx).Create(job).Error; err != nil {
+		return fmt.Errorf("failed to create sync job: %w", err)
+	}
+	return nil
+}
+
+// Save updates a job
+func (r *sqliteRepo) Save(ctx context.Context, job *domain.SyncJob) error {
+	if err := r.db.WithContext(ctx).Save(job).Error; err != nil {
+		return fmt.Errorf("failed to save sync job: %w", err)
+	}
+	return nil
+}
+
+// Unfinished returns the latest job of a source that is not done
+func (r *sqliteRepo) Unfinished(ctx context.Context, source string) (*domain.SyncJob, error) {
+	var job domain.SyncJob
+	err := r.db.WithContext(ctx).
+		Where("source = ? AND phase <> ?", source, domain.SyncPhaseDone).
+		Order("id DESC").
+		First(&job).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get sync job: %w", err)
+	}
+	return &job, nil
+}
+
+// Discard deletes the unfinished jobs of a source and their items
+func (r *sqliteRepo) Discard(ctx context.Context, source string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		err := tx.Model(&domain.SyncJob{}).
+			Where("source = ? AND phase <> ?", source, domain.SyncPhaseDone).
+			Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		if err := tx.Where("job_id IN ?", ids).Delete(&domain.SyncJobItem{}).Error; err != nil {
+			return fmt.Errorf("failed to discard sync job items: %w", err)
+		}
+		if err := tx.Where("id IN ?", ids).Delete(&domain.SyncJob{}).Error; err != nil {
+			return fmt.Errorf("failed to discard sync jobs: %w", err)
+		}
+		r.logger.Debug("Discarded unfinished sync jobs", "source", source, "count", len(ids))
+		return nil
+	})
+}
+
+// Finish marks a job done and drops its items; the job row is kept as history
+func (r *sqliteRepo) Finish(ctx context.Context, job *domain.SyncJob) error {
+	now := time.Now()
+	job.Phase = domain.SyncPhaseDone
+	job.FinishedAt = &now
+	job.PageToken = ""
+	job.Error = ""
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(job).Error; err != nil {
+			return fmt.Errorf("failed to finish sync job: %w", err)
+		}
+		if err := tx.Where("job_id = ?", job.ID).Delete(&domain.SyncJobItem{}).Error; err != nil {
+			return fmt.Errorf("failed to delete sync job items: %w", err)
+		}
+		return nil
+	})
+}
+
+// AddItems records listed message IDs starting at position
+func (r *sqliteRepo) AddItems(ctx context.Context, jobID uint, ids []string, position int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	items := make([]domain.SyncJobItem, len(ids))
+	for i, id := range ids {
+		items[i] = domain.SyncJobItem{JobID: jobID, MessageID: id, Position: position + i}
+	}
+	// 恢复时同一页可能会被重新列出，已经记录过的 ID 保持原状态
+	err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		CreateInBatches(items, 200).Error
+	if err != nil {
+		return fmt.Errorf("failed to add sync job items: %w", err)
+	}
+	return nil
+}
+
+// Pending returns the IDs not stored yet, in listing order
+func (r *sqliteRepo) Pending(ctx context.Context, jobID uint) ([]string, error) {
+	var ids []string
+	err := r.db.WithContext(ctx).Model(&domain.SyncJobItem{}).
+		Where("job_id = ? AND stored = ?", jobID, false).
+		Order("position ASC").
+		Pluck("message_id", &ids).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending items: %w", err)
+	}
+	return ids, nil
+}
+
+// Unindexed returns the IDs stored but not indexed yet
+func (r *sqliteRepo) Unindexed(ctx context.Context, jobID uint) ([]string, error) {
+	var ids []string
+	err := r.db.WithContext(ctx).Model(&domain.SyncJobItem{}).
+		Where("job_id = ? AND stored = ? AND indexed = ?", jobID, true, false).
+		Order("position ASC").
+		Pluck("message_id", &ids).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unindexed items: %w", err)
+	}
+	return ids, nil
+}
+
+// MarkStored records that messages were stored
+func (r *sqliteRepo) MarkStored(ctx context.Context, jobID uint, ids []string) error {
+	return r.mark(ctx, jobID, ids, "stored")
+}
+
+// MarkIndexed records that messages were indexed
+func (r *sqliteRepo) MarkIndexed(ctx context.Context, jobID uint, ids []string) error {
+	return r.mark(ctx, jobID, ids, "indexed")
+}
+
+func (r *sqliteRepo) mark(ctx context.Context, jobID uint, ids []string, column string) error {
+	for start := 0; start < len(ids); start += idBatchSize {
+		batch := ids[start:min(start+idBatchSize, len(ids))]
+		err := r.db.WithContext(ctx).Model(&domain.SyncJobItem{}).
+			Where("job_id = ? AND message_id IN ?", jobID, batch).
+			UpdateColumn(column, true).Error
+		if err != nil {
+			return fmt.Errorf("failed to mark sync job items %s: %w", column, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package thread
+
+import (
+	"context"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+)
+
+// Repository defines operations for thread aggregates
+type Repository interface {
+	// Save creates or updates a thread
+	Save(ctx context.Context, thread *domain.Thread) error
+
+	// Get returns a thread by ID, or nil if it does not exist
+	Get(ctx context.Context, id string) (*domain.Thread, error)
+
+	// List returns threads with the most recent activity first
+	List(ctx context.Context, limit, offset int) ([]*domain.Thread, error)
+
+	// Delete removes a thread (e.g. after all of its emails were deleted)
+	Delete(ctx context.Context, id string) error
+}
@@ -0,0 +1,72 @@
+package thread
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+	"gorm.io/gorm"
+)
+
+type sqliteRepo struct {
+	db     *gorm.DB
+	logger logger.Logger
+}
+
+// NewSQLiteRepository creates a new SQLite-based thread repository
+func NewSQLiteRepository(db *gorm.DB, log logger.Logger) Repository {
+	return &sqliteRepo{
+		db:     db,
+		logger: log,
+	}
+}
+
+// Save creates or updates a thread
+func (r *sqliteRepo) Save(ctx context.Context, thread *domain.Thread) error {
+	if thread.ID == "" {
+		return fmt.Errorf("thread id is required")
+	}
+	if err := r.db.WithContext(ctx).Save(thread).Error; err != nil {
+		return fmt.Errorf("failed to save thread: %w", err)
+	}
+	return nil
+}
+
+// Get returns a thread by ID
+func (r *sqliteRepo) Get(ctx context.Context, id string) (*domain.Thread, error) {
+	var thread domain.Thread
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&thread).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get thread: %w", err)
+	}
+	return &thread, nil
+}
+
+// List returns threads ordered by last activity
+func (r *sqliteRepo) List(ctx context.Context, limit, offset int) ([]*domain.Thread, error) {
+	var threads []*domain.Thread
+	query := r.db.WithContext(ctx).Order("last_date DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+	if err := query.Find(&threads).Error; err != nil {
+		return nil, fmt.Errorf("failed to list threads: %w", err)
+	}
+	return threads, nil
+}
+
+// Delete removes a thread
+func (r *sqliteRepo) Delete(ctx context.Context, id string) error {
+	if err := r.db.WithContext(ctx).Where("id = ?", id).Delete(&domain.Thread{}).Error; err != nil {
+		return fmt.Errorf("failed to delete thread: %w", err)
+	}
+	return nil
+}
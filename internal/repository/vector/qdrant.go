@@ -3,6 +3,7 @@ package vector
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/M1ngdaXie/go-local-rag-email/internal/config"
 	pkgLogger "github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
@@ -69,6 +70,8 @@ func (r *qdrantRepo) Search(ctx context.Context, vec []float32, opts SearchOptio
 		Limit:          &limit,
 		ScoreThreshold: &opts.ScoreThreshold,
 		WithPayload:    pb.NewWithPayload(true),
+		// 过滤在 Qdrant 的 HNSW 检索里完成，不是先取 top K 再丢
+		Filter: toQdrantFilter(opts.Filter),
 	}
 
 
@@ -87,32 +90,10 @@ func (r *qdrantRepo) Search(ctx context.Context, vec []float32, opts SearchOptio
 			Payload: make(map[string]interface{}),
 		}
 
-		// 提取 payload 中的字段
-		if item.Payload != nil {
-			if val, ok := item.Payload["email_id"]; ok {
-				if strVal := val.GetStringValue(); strVal != "" {
-					results[i].Payload["email_id"] = strVal
-				}
-			}
-			if val, ok := item.Payload["subject"]; ok {
-				if strVal := val.GetStringValue(); strVal != "" {
-					results[i].Payload["subject"] = strVal
-				}
-			}
-			if val, ok := item.Payload["from"]; ok {
-				if strVal := val.GetStringValue(); strVal != "" {
-					results[i].Payload["from"] = strVal
-				}
-			}
-			if val, ok := item.Payload["content"]; ok {
-				if strVal := val.GetStringValue(); strVal != "" {
-					results[i].Payload["content"] = strVal
-				}
-			}
-			if val, ok := item.Payload["date"]; ok {
-				if strVal := val.GetStringValue(); strVal != "" {
-					results[i].Payload["date"] = strVal
-				}
+		// 提取 payload 中的字段（字符串、数字、列表都原样转换回 Go 值）
+		for key, val := range item.Payload {
+			if v := fromValue(val); v != nil {
+				results[i].Payload[key] = v
 			}
 		}
 	}
@@ -178,6 +159,28 @@ func (r *qdrantRepo) DeleteByEmailID(ctx context.Context, emailID string) error
 	return nil
 }
 
+// SetPayload updates payload fields of every vector of an email
+func (r *qdrantRepo) SetPayload(ctx context.Context, emailID string, payload map[string]interface{}) error {
+	values, err := pb.TryValueMap(payload)
+	if err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	wait := true
+	_, err = r.client.SetPayload(ctx, &pb.SetPayloadPoints{
+		CollectionName: r.collectionName,
+		Wait:           &wait,
+		Payload:        values,
+		PointsSelector: pb.NewPointsSelectorFilter(&pb.Filter{
+			Must: []*pb.Condition{pb.NewMatchKeyword("email_id", emailID)},
+		}),
+	})
+	if err != nil {
+		return fmt.Errorf("qdrant set_payload failed: %w", err)
+	}
+	return nil
+}
+
 // CollectionInfo returns collection statistics
 func (r *qdrantRepo) CollectionInfo(ctx context.Context) (*CollectionInfo, error) {
 	// 1. 获取信息 (直接传 collection name)
@@ -213,9 +216,127 @@ func (r *qdrantRepo) CollectionInfo(ctx context.Context) (*CollectionInfo, error
 	}, nil
 }
 
+// toQdrantFilter translates a Filter into Qdrant conditions on the indexed
+// payload fields (see database.payloadIndexes)
+func toQdrantFilter(f *Filter) *pb.Filter {
+	if f.IsEmpty() {
+		return nil
+	}
+
+	filter := &pb.Filter{}
+	// 多个发件人（收件人）之间是 OR
+	var senders []*pb.Condition
+	for _, from := range f.From {
+		field, value := SenderField(from)
+		if value == "" {
+			continue
+		}
+		if field == "from" {
+			senders = append(senders, pb.NewMatchText(field, value))
+		} else {
+			senders = append(senders, pb.NewMatchKeyword(field, value))
+		}
+	}
+	filter.Must = appendAny(filter.Must, senders)
+	filter.Must = appendAny(filter.Must, textConditions("to", f.To))
+	filter.Must = appendAny(filter.Must, textConditions("cc", f.Cc))
+
+	if !f.After.IsZero() || !f.Before.IsZero() {
+		r := &pb.Range{}
+		if !f.After.IsZero() {
+			gte := float64(f.After.Unix())
+			r.Gte = &gte
+		}
+		if !f.Before.IsZero() {
+			lt := float64(f.Before.Unix())
+			r.Lt = &lt
+		}
+		filter.Must = append(filter.Must, pb.NewRange("timestamp", r))
+	}
+
+	for _, label := range f.Labels {
+		filter.Must = append(filter.Must, pb.NewMatchKeyword("labels", strings.ToLower(label)))
+	}
+	if f.ThreadID != "" {
+		filter.Must = append(filter.Must, pb.NewMatchKeyword("thread_id", f.ThreadID))
+	}
+	filter.Must = append(filter.Must, textConditions("subject", f.Subject)...)
+	for _, text := range f.Text {
+		filter.Must = append(filter.Must, pb.NewMatchPhrase("content", text))
+	}
+	if f.HasAttachment != nil {
+		filter.Must = append(filter.Must, pb.NewMatchBool("has_attachment", *f.HasAttachment))
+	}
+
+	for _, not := range f.Exclude {
+		if sub := toQdrantFilter(not); sub != nil {
+			filter.MustNot = append(filter.MustNot, pb.NewFilterAsCondition(sub))
+		}
+	}
+	return filter
+}
+
+// textConditions matches each value as words of a full-text indexed field
+func textConditions(field string, values []string) []*pb.Condition {
+	var conds []*pb.Condition
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			conds = append(conds, pb.NewMatchText(field, v))
+		}
+	}
+	return conds
+}
+
+// appendAny adds a condition matching any of conds
+func appendAny(must []*pb.Condition, conds []*pb.Condition) []*pb.Condition {
+	switch len(conds) {
+	case 0:
+		return must
+	case 1:
+		return append(must, conds[0])
+	}
+	return append(must, pb.NewFilterAsCondition(&pb.Filter{Should: conds}))
+}
+
 // Helper: Convert string to Qdrant UUID PointID
 func stringToPointID(s string) *pb.PointId {
 	return &pb.PointId{
 		PointIdOptions: &pb.PointId_Uuid{Uuid: s},
 	}
-}
\ No newline at end of file
+}
+
+// fromValue converts a Qdrant payload value back into a plain Go value.
+// Empty strings and nulls are dropped so callers can rely on type assertions
+func fromValue(v *pb.Value) interface{} {
+	switch kind := v.GetKind().(type) {
+	case *pb.Value_StringValue:
+		if kind.StringValue == "" {
+			return nil
+		}
+		return kind.StringValue
+	case *pb.Value_IntegerValue:
+		return kind.IntegerValue
+	case *pb.Value_DoubleValue:
+		return kind.DoubleValue
+	case *pb.Value_BoolValue:
+		return kind.BoolValue
+	case *pb.Value_ListValue:
+		list := make([]interface{}, 0, len(kind.ListValue.GetValues()))
+		for _, item := range kind.ListValue.GetValues() {
+			if converted := fromValue(item); converted != nil {
+				list = append(list, converted)
+			}
+		}
+		return list
+	case *pb.Value_StructValue:
+		m := make(map[string]interface{}, len(kind.StructValue.GetFields()))
+		for key, item := range kind.StructValue.GetFields() {
+			if converted := fromValue(item); converted != nil {
+				m[key] = converted
+			}
+		}
+		return m
+	default:
+		return nil
+	}
+}
@@ -1,6 +1,10 @@
 package vector
 
-import "context"
+import (
+	"context"
+	"strings"
+	"time"
+)
 
 // Repository defines operations for vector storage (embeddings)
 type Repository interface {
@@ -18,6 +22,10 @@ type Repository interface {
 	// This uses payload filtering in Qdrant
 	DeleteByEmailID(ctx context.Context, emailID string) error
 
+	// SetPayload updates payload fields of every vector of an email,
+	// leaving the other fields and the vectors alone
+	SetPayload(ctx context.Context, emailID string, payload map[string]interface{}) error
+
 	// CollectionInfo returns stats about the collection
 	CollectionInfo(ctx context.Context) (*CollectionInfo, error)
 }
@@ -37,10 +45,69 @@ type SearchOptions struct {
 	// 相似度阈值（0 ~ 1），低于这个直接丢掉
 	ScoreThreshold float32
 
-	// 可选：payload 过滤条件（Qdrant Filter）
-	Filter map[string]interface{}
+	// 可选：按邮件元数据过滤，在 Qdrant 里检索时就生效
+	Filter *Filter
+}
+
+// Filter narrows a search to the vectors of matching emails. The set
+// fields are AND-ed together; the From, To and Cc values are OR-ed.
+type Filter struct {
+	// From matches sender addresses ("alice@example.com"), domains
+	// ("example.com" or "@example.com") or words of the sender ("alice"),
+	// case-insensitively; see SenderField
+	From []string
+
+	// To and Cc match words of the recipient addresses
+	To []string
+	Cc []string
+
+	// After (inclusive) and Before (exclusive) bound the email date
+	After  time.Time
+	Before time.Time
+
+	// Labels must all be present: Gmail label IDs such as INBOX or
+	// Label_123, or IMAP folder names, case-insensitively
+	Labels []string
+
+	ThreadID string
+
+	// Subject words must all appear in the subject
+	Subject []string
+
+	// Text phrases must all appear in the content of the vector's chunk
+	Text []string
+
+	// HasAttachment keeps emails with (true) or without (false) attachments
+	HasAttachment *bool
+
+	// Exclude drops the vectors matching any of these filters
+	Exclude []*Filter
 }
 
+// IsEmpty reports whether the filter matches everything
+func (f *Filter) IsEmpty() bool {
+	return f == nil || (len(f.From) == 0 && len(f.To) == 0 && len(f.Cc) == 0 &&
+		f.After.IsZero() && f.Before.IsZero() && len(f.Labels) == 0 && f.ThreadID == "" &&
+		len(f.Subject) == 0 && len(f.Text) == 0 && f.HasAttachment == nil && len(f.Exclude) == 0)
+}
+
+// SenderField tells which payload field a From value is matched against:
+// a full address matches from_address, a domain matches from_domain (that
+// domain only, not its subdomains) and anything else (a name) is a word
+// match on from. value is normalized. The SQLite filter classifies From
+// values the same way so both search paths agree.
+func SenderField(from string) (field, value string) {
+	from = strings.ToLower(strings.TrimSpace(from))
+	switch at := strings.Index(from, "@"); {
+	case at > 0:
+		return "from_address", from
+	case at == 0:
+		return "from_domain", from[1:]
+	case strings.Contains(from, ".") && !strings.ContainsAny(from, " \t"):
+		return "from_domain", from
+	}
+	return "from", from
+}
 
 // SearchResult represents a search result from Qdrant
 type SearchResult struct {
@@ -0,0 +1,284 @@
+// Package ask answers questions about the mailbox with retrieval-augmented
+// generation: the passages that search finds are numbered, packed into the
+// prompt within a token budget, and the chat model answers citing them.
+package ask
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/llm"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/rag"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/tokenizer"
+)
+
+// defaultBudget is the context token budget when none is configured
+const defaultBudget = 3000
+
+// minPassageTokens is the smallest truncated passage worth including when
+// the budget runs out in the middle of one
+const minPassageTokens = 50
+
+// ErrNoContext is returned when search finds nothing to answer from
+var ErrNoContext = errors.New("no indexed emails match the question")
+
+// Retriever finds the passages a question is answered from; rag.Service
+// satisfies it
+type Retriever interface {
+	Retrieve(ctx context.Context, text string, opts rag.SearchOptions) ([]rag.Passage, error)
+}
+
+// ChatModel generates the answer; llm.Service satisfies it
+type ChatModel interface {
+	Chat(ctx context.Context, messages []llm.Message) (string, error)
+	ChatStream(ctx context.Context, messages []llm.Message, onDelta func(string) error) (string, error)
+}
+
+// Service answers questions from the indexed emails
+type Service struct {
+	retriever Retriever
+	chat      ChatModel
+	emailRepo email.Repository
+	tok       *tokenizer.Tokenizer
+	budget    int
+	now       func() time.Time
+	logger    logger.Logger
+}
+
+// New creates an ask service. tok counts the prompt tokens and must match
+// the chat model (tokenizer.ForModel).
+func New(retriever Retriever, chat ChatModel, emailRepo email.Repository, tok *tokenizer.Tokenizer, log logger.Logger) *Service {
+	return &Service{
+		retriever: retriever,
+		chat:      chat,
+		emailRepo: emailRepo,
+		tok:       tok,
+		budget:    defaultBudget,
+		now:       time.Now,
+		logger:    log,
+	}
+}
+
+// WithBudget sets how many tokens of passages go into the prompt
+func (s *Service) WithBudget(tokens int) *Service {
+	if tokens > 0 {
+		s.budget = tokens
+	}
+	return s
+}
+
+// WithClock sets the time the prompt calls today, for relative questions
+// such as "what did I get yesterday"
+func (s *Service) WithClock(now func() time.Time) *Service {
+	s.now = now
+	return s
+}
+
+// Source is a numbered email (or attachment) of the prompt with the
+// passages of it that fit in the budget
+type Source struct {
+	N        int
+	EmailID  string
+	Subject  string
+	From     string
+	Date     time.Time
+	Filename string
+	Passages []rag.Passage
+}
+
+// Prompt is a question with the context retrieved for it, ready to send
+type Prompt struct {
+	Question string
+	Sources  []Source
+
+	// Tokens is the size of the packed context
+	Tokens int
+}
+
+// Answer is the model's reply and the sources it was given
+type Answer struct {
+	Text    string
+	Sources []Source
+	Tokens  int
+}
+
+// Ask retrieves the passages for question, packs them into the prompt and
+// asks the chat model. search is the text to retrieve with (the question
+// without its operators) and opts narrows the search.
+func (s *Service) Ask(ctx context.Context, question, search string, opts rag.SearchOptions) (*Answer, error) {
+	prompt, err := s.Prepare(ctx, question, search, opts)
+	if err != nil {
+		return nil, err
+	}
+	return s.Answer(ctx, prompt, nil)
+}
+
+// Prepare retrieves and packs the context of question without calling the
+// model, so that it can be shown before the answer streams
+func (s *Service) Prepare(ctx context.Context, question, search string, opts rag.SearchOptions) (*Prompt, error) {
+	passages, err := s.retriever.Retrieve(ctx, search, opts)
+	if err != nil {
+		return nil, fmt.Errorf("retrieval failed: %w", err)
+	}
+	if len(passages) == 0 {
+		return nil, ErrNoContext
+	}
+
+	sources, tokens := s.pack(ctx, passages)
+	s.logger.Debug("Packed context", "sources", len(sources), "passages", len(passages), "tokens", tokens)
+	return &Prompt{Question: question, Sources: sources, Tokens: tokens}, nil
+}
+
+// Answer asks the chat model. With onDelta the reply is streamed to it as
+// it is generated. The answer is returned even on error, holding what was
+// received before the stream was interrupted (Ctrl+C).
+func (s *Service) Answer(ctx context.Context, prompt *Prompt, onDelta func(string) error) (*Answer, error) {
+	messages := s.messages(prompt.Question, prompt.Sources)
+	var text string
+	var err error
+	if onDelta != nil {
+		text, err = s.chat.ChatStream(ctx, messages, onDelta)
+	} else {
+		text, err = s.chat.Chat(ctx, messages)
+	}
+
+	return &Answer{Text: strings.TrimSpace(text), Sources: prompt.Sources, Tokens: prompt.Tokens}, err
+}
+
+// pack groups the passages by email in rank order and keeps them until the
+// budget is spent. The last passage that does not fit is truncated if a
+// useful part of it still fits.
+func (s *Service) pack(ctx context.Context, passages []rag.Passage) ([]Source, int) {
+	var sources []Source
+	index := map[string]int{}
+	used := 0
+	for _, p := range passages {
+		key := p.EmailID + "|" + p.AttachmentID
+		i, ok := index[key]
+		if !ok {
+			src := s.source(ctx, p)
+			if used+s.tok.Count(header(src)) > s.budget {
+				break
+			}
+			src.N = len(sources) + 1
+			used += s.tok.Count(header(src))
+			sources = append(sources, src)
+			i = len(sources) - 1
+			index[key] = i
+		}
+
+		text := strings.TrimSpace(p.Text)
+		n := s.tok.Count(text)
+		if used+n > s.budget {
+			left := s.budget - used
+			if left < minPassageTokens {
+				break
+			}
+			text = s.tok.Truncate(text, left) + " …"
+			n = left
+		}
+		p.Text = text
+		sources[i].Passages = append(sources[i].Passages, p)
+		used += n
+		if used >= s.budget {
+			break
+		}
+	}
+
+	// 预算太小时可能有只剩标题的来源，去掉它们
+	kept := sources[:0]
+	for _, src := range sources {
+		if len(src.Passages) > 0 {
+			src.N = len(kept) + 1
+			kept = append(kept, src)
+		}
+	}
+	return kept, used
+}
+
+// source builds the citation of a passage from its stored email, falling
+// back to what the search result carries
+func (s *Service) source(ctx context.Context, p rag.Passage) Source {
+	src := Source{
+		EmailID:  p.EmailID,
+		Subject:  p.Subject,
+		From:     p.From,
+		Filename: p.Filename,
+	}
+	if s.emailRepo == nil {
+		return src
+	}
+	e, err := s.emailRepo.Get(ctx, p.EmailID)
+	if err != nil {
+		s.logger.Warn("Failed to load cited email", "email_id", p.EmailID, "error", err)
+		return src
+	}
+	src.Subject, src.From, src.Date = e.Subject, e.From, e.Date
+	return src
+}
+
+const systemPrompt = `You answer questions about the user's email. Use only the numbered emails below; they are excerpts, so do not assume anything they do not say.
+Cite every fact with the number of the email it comes from in square brackets, e.g. [2] or [1][3].
+If the emails do not contain the answer, say so briefly instead of guessing.
+Answer in the language of the question. Today is %s.`
+
+// messages builds the chat prompt
+func (s *Service) messages(question string, sources []Source) []llm.Message {
+	var b strings.Builder
+	for _, src := range sources {
+		b.WriteString(header(src))
+		for _, p := range src.Passages {
+			b.WriteString(p.Text)
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("Question: ")
+	b.WriteString(question)
+
+	return []llm.Message{
+		{Role: llm.RoleSystem, Content: fmt.Sprintf(systemPrompt, s.now().Format("Monday, 2006-01-02"))},
+		{Role: llm.RoleUser, Content: b.String()},
+	}
+}
+
+// header is the title line of a source in the prompt
+func header(src Source) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%d] Subject: %s\nFrom: %s", src.N, src.Subject, src.From)
+	if !src.Date.IsZero() {
+		fmt.Fprintf(&b, "\nDate: %s", src.Date.Format("2006-01-02 15:04 MST"))
+	}
+	if src.Filename != "" {
+		fmt.Fprintf(&b, "\nAttachment: %s", src.Filename)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// Cited returns the sources the answer cites, in citation order. Numbers
+// that do not match a source are ignored.
+func (a *Answer) Cited() []Source {
+	var cited []Source
+	seen := map[int]bool{}
+	for _, m := range citationPattern.FindAllStringSubmatch(a.Text, -1) {
+		for _, part := range strings.Split(m[1], ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || n < 1 || n > len(a.Sources) || seen[n] {
+				continue
+			}
+			seen[n] = true
+			cited = append(cited, a.Sources[n-1])
+		}
+	}
+	return cited
+}
@@ -0,0 +1,173 @@
+package attachment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	attachmentrepo "github.com/M1ngdaXie/go-local-rag-email/internal/repository/attachment"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/blob"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/extract"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+)
+
+// ErrNoContent is returned when an attachment's bytes are neither in the
+// blob store nor fetchable from the remote mailbox
+var ErrNoContent = errors.New("attachment content not available")
+
+// Fetcher downloads attachment content that was not included when the
+// message was fetched; gmail.Service satisfies it
+type Fetcher interface {
+	FetchAttachment(ctx context.Context, messageID, attachmentID string) ([]byte, error)
+}
+
+// Indexer embeds extracted attachment text; rag.Service satisfies it
+type Indexer interface {
+	IndexAttachment(ctx context.Context, email *domain.Email, att *domain.Attachment, text string) error
+}
+
+// Service stores attachment metadata and blobs, and extracts and indexes
+// the text of supported file types
+type Service struct {
+	repo    attachmentrepo.Repository
+	blobs   *blob.Store
+	fetcher Fetcher
+	indexer Indexer
+	logger  logger.Logger
+}
+
+// New creates an attachment service backed by repo and blobs
+func New(repo attachmentrepo.Repository, blobs *blob.Store, log logger.Logger) *Service {
+	return &Service{
+		repo:   repo,
+		blobs:  blobs,
+		logger: log,
+	}
+}
+
+// WithFetcher enables lazy downloads of attachments that only have a RemoteID
+func (s *Service) WithFetcher(f Fetcher) *Service {
+	s.fetcher = f
+	return s
+}
+
+// WithIndexer makes IndexEmails embed extracted text
+func (s *Service) WithIndexer(idx Indexer) *Service {
+	s.indexer = idx
+	return s
+}
+
+// Save persists the attachments carried by email. Content already in
+// memory (local archives, small Gmail attachments) goes straight to the
+// blob store; everything else is left for Content to fetch on demand.
+func (s *Service) Save(ctx context.Context, email *domain.Email) error {
+	for i := range email.Attachments {
+		att := &email.Attachments[i]
+		if att.EmailID == "" {
+			att.EmailID = email.ID
+		}
+		if att.Data != nil {
+			hash, err := s.blobs.Put(att.Data)
+			if err != nil {
+				return err
+			}
+			att.ContentHash = hash
+			att.Size = int64(len(att.Data))
+		}
+		if err := s.repo.Save(ctx, att); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stored reports whether the content of att is already in the blob store
+func (s *Service) Stored(att *domain.Attachment) bool {
+	return att.ContentHash != "" && s.blobs.Has(att.ContentHash)
+}
+
+// Content returns the bytes of an attachment, downloading and storing
+// them first if they are not in the blob store yet
+func (s *Service) Content(ctx context.Context, att *domain.Attachment) ([]byte, error) {
+	if s.Stored(att) {
+		return s.blobs.Get(att.ContentHash)
+	}
+	if att.RemoteID == "" || s.fetcher == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoContent, att.ID)
+	}
+
+	data, err := s.fetcher.FetchAttachment(ctx, att.EmailID, att.RemoteID)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := s.blobs.Put(data)
+	if err != nil {
+		return nil, err
+	}
+	att.ContentHash = hash
+	att.Size = int64(len(data))
+	if err := s.repo.Save(ctx, att); err != nil {
+		return nil, err
+	}
+	s.logger.Debug("Fetched attachment", "id", att.ID, "filename", att.Filename, "bytes", len(data))
+	return data, nil
+}
+
+// List returns the stored attachments of an email
+func (s *Service) List(ctx context.Context, emailID string) ([]*domain.Attachment, error) {
+	return s.repo.ListByEmail(ctx, emailID)
+}
+
+// IndexEmails extracts and indexes the supported attachments of emails
+// that have not been indexed yet. It returns how many were indexed;
+// per-attachment failures are recorded on the attachment and logged.
+func (s *Service) IndexEmails(ctx context.Context, emails []*domain.Email) (int, error) {
+	if s.indexer == nil {
+		return 0, nil
+	}
+
+	indexed := 0
+	for _, email := range emails {
+		for i := range email.Attachments {
+			att := &email.Attachments[i]
+			if att.IndexedAt != nil || !extract.Supported(att.Filename, att.MimeType) {
+				continue
+			}
+
+			err := s.index(ctx, email, att)
+			if ctx.Err() != nil {
+				return indexed, ctx.Err()
+			}
+			if err != nil {
+				s.logger.Warn("Failed to index attachment", "id", att.ID, "filename", att.Filename, "error", err)
+				att.ExtractError = err.Error()
+			} else {
+				now := time.Now()
+				att.IndexedAt = &now
+				att.ExtractError = ""
+				indexed++
+			}
+			if err := s.repo.Save(ctx, att); err != nil {
+				return indexed, err
+			}
+		}
+	}
+	return indexed, nil
+}
+
+func (s *Service) index(ctx context.Context, email *domain.Email, att *domain.Attachment) error {
+	data, err := s.Content(ctx, att)
+	if err != nil {
+		return err
+	}
+	text, err := extract.Text(att.Filename, att.MimeType, data)
+	if err != nil {
+		return err
+	}
+	if text == "" {
+		return nil
+	}
+	return s.indexer.IndexAttachment(ctx, email, att, text)
+}
@@ -0,0 +1,128 @@
+// Package chunker cuts text into token-bounded chunks before embedding.
+// Several strategies are available so they can be compared on a real
+// mailbox; the rag.chunking section of config.yaml picks one.
+package chunker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/config"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/tokenizer"
+)
+
+// Chunking strategies
+const (
+	StrategyFixed     = "fixed"
+	StrategySentence  = "sentence"
+	StrategyRecursive = "recursive"
+	StrategySemantic  = "semantic"
+)
+
+// Defaults used when config.yaml leaves a value unset
+const (
+	DefaultSize                 = 500
+	DefaultOverlap              = 50
+	DefaultBreakpointPercentile = 90
+)
+
+// Chunker splits text into chunks of at most a fixed number of tokens.
+// Chunks come back trimmed, in order, with their token counts.
+type Chunker interface {
+	// Name identifies the strategy, e.g. "recursive"
+	Name() string
+	Chunk(ctx context.Context, text string) ([]tokenizer.Piece, error)
+}
+
+// Embedder turns texts into vectors for semantic chunking; llm.Service
+// satisfies it
+type Embedder interface {
+	GenerateEmbeddings(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// New builds the chunker selected by cfg. embedder is only used by the
+// semantic strategy.
+func New(cfg config.ChunkingConfig, tok *tokenizer.Tokenizer, embedder Embedder) (Chunker, error) {
+	size := cfg.Size
+	if size <= 0 {
+		size = DefaultSize
+	}
+	overlap := max(cfg.Overlap, 0)
+
+	switch cfg.Strategy {
+	case "", StrategyFixed:
+		return NewFixed(tok, size, overlap), nil
+	case StrategySentence:
+		return NewSentence(tok, size, overlap), nil
+	case StrategyRecursive:
+		return NewRecursive(tok, size, overlap), nil
+	case StrategySemantic:
+		if embedder == nil {
+			return nil, fmt.Errorf("semantic chunking needs an embedder")
+		}
+		percentile := cfg.BreakpointPercentile
+		if percentile <= 0 {
+			percentile = DefaultBreakpointPercentile
+		}
+		return NewSemantic(tok, embedder, size, percentile), nil
+	}
+	return nil, fmt.Errorf("unknown chunking strategy %q (use fixed, sentence, recursive or semantic)", cfg.Strategy)
+}
+
+// pack greedily joins consecutive parts into chunks of at most size
+// tokens. Each new chunk starts with the trailing parts of the previous
+// one that fit in overlap tokens. Every part must fit in size on its own.
+func pack(tok *tokenizer.Tokenizer, parts []string, size, overlap int) []tokenizer.Piece {
+	counts := make([]int, len(parts))
+	for i, p := range parts {
+		counts[i] = tok.Count(p)
+	}
+
+	var chunks []tokenizer.Piece
+	for start := 0; start < len(parts); {
+		end, total := start, 0
+		for end < len(parts) && (end == start || total+counts[end] <= size) {
+			total += counts[end]
+			end++
+		}
+		chunks = appendPiece(chunks, tok, strings.Join(parts[start:end], ""))
+		if end == len(parts) {
+			break
+		}
+
+		// 往回带上几段作为重叠，但要给下一段留出位置
+		next, carried := end, 0
+		for next > start+1 && carried+counts[next-1] <= overlap && carried+counts[next-1]+counts[end] <= size {
+			next--
+			carried += counts[next]
+		}
+		start = next
+	}
+	return chunks
+}
+
+// fit cuts the parts that are longer than size tokens into token windows
+func fit(tok *tokenizer.Tokenizer, parts []string, size int) []string {
+	var out []string
+	for _, p := range parts {
+		if tok.Count(p) <= size {
+			out = append(out, p)
+			continue
+		}
+		for _, piece := range tok.Split(p, size, 0) {
+			out = append(out, piece.Text)
+		}
+	}
+	return out
+}
+
+// appendPiece trims text and appends it with its token count, skipping
+// blank chunks
+func appendPiece(chunks []tokenizer.Piece, tok *tokenizer.Tokenizer, text string) []tokenizer.Piece {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return chunks
+	}
+	return append(chunks, tokenizer.Piece{Text: text, Tokens: tok.Count(text)})
+}
@@ -0,0 +1,256 @@
+package chunker
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/config"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/tokenizer"
+)
+
+func mustTokenizer(t *testing.T) *tokenizer.Tokenizer {
+	t.Helper()
+	tok, err := tokenizer.Get(tokenizer.CL100K)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tok
+}
+
+func TestSplitSentences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"latin", "Hi Bob. How are you? Fine!", []string{"Hi Bob. ", "How are you? ", "Fine!"}},
+		{"decimals stay whole", "Pi is 3.14 exactly. Yes.", []string{"Pi is 3.14 exactly. ", "Yes."}},
+		{"line breaks", "Agenda\n1. Budget\n2. Hiring", []string{"Agenda\n", "1. Budget\n", "2. Hiring"}},
+		{"closing quote stays with the sentence", `He said "stop." Then left.`, []string{`He said "stop." `, "Then left."}},
+		{"opening quote starts the next sentence", `Done. "Really?" she asked.`, []string{"Done. ", `"Really?" `, "she asked."}},
+
+		// 缩写和姓名首字母后面的句点不算句末
+		{"titles", "Dr. Smith met Mr. Jones. They agreed.", []string{"Dr. Smith met Mr. Jones. ", "They agreed."}},
+		{"e.g. and i.e.", "Bring snacks, e.g. fruit or i.e. anything. Thanks.", []string{"Bring snacks, e.g. fruit or i.e. anything. ", "Thanks."}},
+		{"initials", "Ask J. R. Tolkien. He knows.", []string{"Ask J. R. Tolkien. ", "He knows."}},
+		{"abbreviation in parentheses", "See the chart (fig. 3) below. Done.", []string{"See the chart (fig. 3) below. ", "Done."}},
+		{"abbreviation at the end", "Meet the team at Acme Inc.", []string{"Meet the team at Acme Inc."}},
+
+		// 中文句号、问号不需要后面跟空格
+		{"cjk", "你好。我们明天见！好吗？", []string{"你好。", "我们明天见！", "好吗？"}},
+		{"cjk closing bracket", "他说：「好的。」然后走了。", []string{"他说：「好的。」", "然后走了。"}},
+		{"mixed", "会议改到周五。See you then. 谢谢！", []string{"会议改到周五。", "See you then. ", "谢谢！"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitSentences(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitSentences(%q)\n got %q\nwant %q", tt.text, got, tt.want)
+			}
+			if strings.Join(got, "") != tt.text {
+				t.Errorf("parts do not add up to the text: %q", got)
+			}
+		})
+	}
+}
+
+func TestPackOverlap(t *testing.T) {
+	tok := mustTokenizer(t)
+	var parts []string
+	for i := range 6 {
+		parts = append(parts, fmt.Sprintf("Sentence %c is here. ", 'A'+i))
+	}
+	n := tok.Count(parts[0])
+	for _, p := range parts {
+		if tok.Count(p) != n {
+			t.Fatalf("parts have different token counts, the test needs equal ones")
+		}
+	}
+
+	// 每块放得下三句，重叠带上一句
+	chunks := pack(tok, parts, 3*n, n)
+	var got []string
+	for _, c := range chunks {
+		got = append(got, c.Text)
+		if c.Tokens > 3*n {
+			t.Errorf("chunk %q has %d tokens, want at most %d", c.Text, c.Tokens, 3*n)
+		}
+	}
+	want := []string{
+		"Sentence A is here. Sentence B is here. Sentence C is here.",
+		"Sentence C is here. Sentence D is here. Sentence E is here.",
+		"Sentence E is here. Sentence F is here.",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pack with overlap\n got %q\nwant %q", got, want)
+	}
+
+	// 没有重叠时每句只出现一次
+	got = nil
+	for _, c := range pack(tok, parts, 3*n, 0) {
+		got = append(got, c.Text)
+	}
+	want = []string{
+		"Sentence A is here. Sentence B is here. Sentence C is here.",
+		"Sentence D is here. Sentence E is here. Sentence F is here.",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pack without overlap\n got %q\nwant %q", got, want)
+	}
+
+	// 重叠不能把下一句挤出块外：块只放得下两句时不带重叠
+	for i, c := range pack(tok, parts, 2*n, 2*n) {
+		if c.Tokens > 2*n {
+			t.Errorf("chunk %d has %d tokens, want at most %d", i, c.Tokens, 2*n)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	values := []float64{0.9, 0.1, 0.5, 0.3, 0.7, 0.2, 0.8, 0.4, 0.6, 1.0}
+	tests := []struct {
+		p    float64
+		want float64
+	}{
+		{0, 0.1},
+		{50, 0.6},
+		{90, 0.9},
+		{100, 1.0},
+	}
+	for _, tt := range tests {
+		if got := percentile(values, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+	if values[0] != 0.9 {
+		t.Error("percentile sorted its input")
+	}
+}
+
+// topicEmbedder embeds a text by how often it mentions each topic
+type topicEmbedder struct {
+	topics []string
+	calls  int
+	inputs int
+}
+
+func (e *topicEmbedder) GenerateEmbeddings(_ context.Context, texts []string) ([][]float32, error) {
+	e.calls++
+	e.inputs += len(texts)
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		for _, topic := range e.topics {
+			vectors[i] = append(vectors[i], float32(strings.Count(text, topic)))
+		}
+	}
+	return vectors, nil
+}
+
+func TestSemanticBreakpoint(t *testing.T) {
+	tok := mustTokenizer(t)
+	cats := "The cat sleeps all day. Our cat likes the sofa. A cat chased the ball. That cat purrs loudly. "
+	taxes := "The tax form is due. Every tax receipt is filed. My tax adviser called. The tax refund arrived."
+	embedder := &topicEmbedder{topics: []string{"cat", "tax"}}
+	c := NewSemantic(tok, embedder, tok.Count(cats+taxes)-1, DefaultBreakpointPercentile)
+
+	chunks, err := c.Chunk(context.Background(), cats+taxes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range chunks {
+		got = append(got, p.Text)
+	}
+	// 话题变化的地方距离最大，在那里切开
+	want := []string{strings.TrimSpace(cats), taxes}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("semantic chunks\n got %q\nwant %q", got, want)
+	}
+	if embedder.calls != 1 || embedder.inputs != 8 {
+		t.Errorf("embedded %d windows in %d requests, want 8 in 1", embedder.inputs, embedder.calls)
+	}
+
+	// 一块放得下的文本不用 embed
+	embedder.calls = 0
+	if _, err := c.Chunk(context.Background(), cats); err != nil {
+		t.Fatal(err)
+	}
+	if embedder.calls != 0 {
+		t.Errorf("short text made %d embeddings requests, want 0", embedder.calls)
+	}
+}
+
+func TestStrategies(t *testing.T) {
+	tok := mustTokenizer(t)
+	var b strings.Builder
+	for i := range 40 {
+		fmt.Fprintf(&b, "Paragraph %d talks about item number %d in some detail.", i, i)
+		if i%4 == 3 {
+			b.WriteString("\n\n")
+		} else {
+			b.WriteString(" ")
+		}
+	}
+	text := b.String()
+
+	for _, strategy := range []string{StrategyFixed, StrategySentence, StrategyRecursive} {
+		t.Run(strategy, func(t *testing.T) {
+			c, err := New(config.ChunkingConfig{Strategy: strategy, Size: 60, Overlap: 10}, tok, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Name() != strategy {
+				t.Errorf("Name() = %q, want %q", c.Name(), strategy)
+			}
+			chunks, err := c.Chunk(context.Background(), text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chunks) < 2 {
+				t.Fatalf("got %d chunks, want several", len(chunks))
+			}
+			// 固定窗口解码后重新分词可能多出一两个 token
+			limit := 60
+			if strategy == StrategyFixed {
+				limit += 2
+			}
+			joined := ""
+			for i, p := range chunks {
+				if p.Tokens > limit || p.Tokens != tok.Count(p.Text) {
+					t.Errorf("chunk %d has %d tokens (counted %d), want at most %d", i, p.Tokens, tok.Count(p.Text), limit)
+				}
+				if p.Text != strings.TrimSpace(p.Text) || p.Text == "" {
+					t.Errorf("chunk %d is not trimmed: %q", i, p.Text)
+				}
+				joined += p.Text + " "
+			}
+			// 每一句都落在某个块里
+			for i := range 40 {
+				if s := fmt.Sprintf("item number %d in", i); !strings.Contains(joined, s) && strategy != StrategyFixed {
+					t.Errorf("no chunk contains %q", s)
+				}
+			}
+			if strategy != StrategyFixed {
+				for i, p := range chunks {
+					if !strings.HasSuffix(p.Text, ".") {
+						t.Errorf("chunk %d ends mid-sentence: %q", i, p.Text)
+					}
+				}
+			}
+
+			if chunks, _ := c.Chunk(context.Background(), "  \n "); chunks != nil {
+				t.Errorf("blank text gave %q, want no chunks", chunks)
+			}
+		})
+	}
+
+	if _, err := New(config.ChunkingConfig{Strategy: StrategySemantic}, tok, nil); err == nil {
+		t.Error("semantic chunker without an embedder returned no error")
+	}
+	if _, err := New(config.ChunkingConfig{Strategy: "paragraph"}, tok, nil); err == nil {
+		t.Error("unknown strategy returned no error")
+	}
+}
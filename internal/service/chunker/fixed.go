@@ -0,0 +1,47 @@
+package chunker
+
+import (
+	"context"
+	"strings"
+
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/tokenizer"
+)
+
+// Fixed slides a window of size tokens over the text, ignoring its
+// structure. It is the cheapest strategy and the baseline to compare with.
+type Fixed struct {
+	tok     *tokenizer.Tokenizer
+	size    int
+	overlap int
+}
+
+// NewFixed creates a sliding-window chunker
+func NewFixed(tok *tokenizer.Tokenizer, size, overlap int) *Fixed {
+	return &Fixed{tok: tok, size: size, overlap: overlap}
+}
+
+// Name identifies the strategy
+func (c *Fixed) Name() string {
+	return StrategyFixed
+}
+
+// Chunk splits text into overlapping token windows
+func (c *Fixed) Chunk(ctx context.Context, text string) ([]tokenizer.Piece, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+
+	var chunks []tokenizer.Piece
+	for _, piece := range c.tok.Split(text, c.size, c.overlap) {
+		content := strings.TrimSpace(piece.Text)
+		if content == "" {
+			continue
+		}
+		if len(content) != len(piece.Text) {
+			piece.Tokens = c.tok.Count(content)
+		}
+		chunks = append(chunks, tokenizer.Piece{Text: content, Tokens: piece.Tokens})
+	}
+	return chunks, nil
+}
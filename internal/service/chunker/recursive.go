@@ -0,0 +1,82 @@
+package chunker
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/tokenizer"
+)
+
+var (
+	paragraphBreak = regexp.MustCompile(`\n[ \t]*\n\s*`)
+	lineBreak      = regexp.MustCompile(`\n`)
+	wordBreak      = regexp.MustCompile(`\s+`)
+)
+
+// Recursive splits text on the coarsest boundary that makes the pieces
+// fit: paragraphs first, then lines, sentences and words, and token
+// windows as a last resort. The pieces are then packed into chunks.
+type Recursive struct {
+	tok     *tokenizer.Tokenizer
+	size    int
+	overlap int
+}
+
+// NewRecursive creates a recursive chunker
+func NewRecursive(tok *tokenizer.Tokenizer, size, overlap int) *Recursive {
+	return &Recursive{tok: tok, size: size, overlap: overlap}
+}
+
+// Name identifies the strategy
+func (c *Recursive) Name() string {
+	return StrategyRecursive
+}
+
+// Chunk splits text recursively and packs the pieces into chunks
+func (c *Recursive) Chunk(ctx context.Context, text string) ([]tokenizer.Piece, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+	return pack(c.tok, c.split(text, 0), c.size, c.overlap), nil
+}
+
+// separators go from the coarsest boundary to the finest
+var separators = []func(string) []string{
+	func(s string) []string { return splitAfter(s, paragraphBreak) },
+	func(s string) []string { return splitAfter(s, lineBreak) },
+	splitSentences,
+	func(s string) []string { return splitAfter(s, wordBreak) },
+}
+
+func (c *Recursive) split(text string, level int) []string {
+	if c.tok.Count(text) <= c.size {
+		return []string{text}
+	}
+	if level == len(separators) {
+		return fit(c.tok, []string{text}, c.size)
+	}
+
+	var parts []string
+	for _, part := range separators[level](text) {
+		parts = append(parts, c.split(part, level+1)...)
+	}
+	return parts
+}
+
+// splitAfter cuts text after every match of re, keeping the separators
+func splitAfter(text string, re *regexp.Regexp) []string {
+	var parts []string
+	start := 0
+	for _, m := range re.FindAllStringIndex(text, -1) {
+		if m[1] > start {
+			parts = append(parts, text[start:m[1]])
+			start = m[1]
+		}
+	}
+	if start < len(text) {
+		parts = append(parts, text[start:])
+	}
+	return parts
+}
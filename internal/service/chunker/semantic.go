@@ -0,0 +1,125 @@
+package chunker
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/tokenizer"
+)
+
+// semanticBatch is the number of sentences embedded per request
+const semanticBatch = 256
+
+// Semantic starts a new chunk where the topic changes: every sentence is
+// embedded (together with its neighbours, which smooths out short lines
+// like "Thanks,") and the text is cut where the cosine distance between
+// consecutive sentences is above the breakpoint percentile. Groups shorter
+// than a quarter of size are not cut off; longer than size are packed
+// further. Chunks do not overlap.
+//
+// Unlike the other strategies it costs one embeddings request per email
+// (per 256 sentences) each time the email is chunked. The RAG service
+// reuses the stored chunks of emails that did not change since they were
+// indexed, and texts that fit in one chunk are not embedded.
+type Semantic struct {
+	tok        *tokenizer.Tokenizer
+	embedder   Embedder
+	size       int
+	percentile float64
+}
+
+// NewSemantic creates a semantic chunker. percentile is in (0, 100]; a
+// lower value cuts more often.
+func NewSemantic(tok *tokenizer.Tokenizer, embedder Embedder, size int, percentile float64) *Semantic {
+	return &Semantic{tok: tok, embedder: embedder, size: size, percentile: percentile}
+}
+
+// Name identifies the strategy
+func (c *Semantic) Name() string {
+	return StrategySemantic
+}
+
+// Chunk splits text at the largest similarity drops between sentences
+func (c *Semantic) Chunk(ctx context.Context, text string) ([]tokenizer.Piece, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+	if c.tok.Count(text) <= c.size {
+		return appendPiece(nil, c.tok, text), nil
+	}
+
+	sentences := fit(c.tok, splitSentences(text), c.size)
+	if len(sentences) < 3 {
+		return pack(c.tok, sentences, c.size, 0), nil
+	}
+
+	vectors, err := c.embed(ctx, sentences)
+	if err != nil {
+		return nil, err
+	}
+	distances := make([]float64, len(sentences)-1)
+	for i := range distances {
+		distances[i] = 1 - cosine(vectors[i], vectors[i+1])
+	}
+	threshold := percentile(distances, c.percentile)
+
+	// 太短的段落不单独成块，例如签名里的 "Bob"
+	minTokens := c.size / 4
+	var chunks []tokenizer.Piece
+	start, tokens := 0, 0
+	for i, d := range distances {
+		tokens += c.tok.Count(sentences[i])
+		if d > threshold && tokens >= minTokens {
+			chunks = append(chunks, pack(c.tok, sentences[start:i+1], c.size, 0)...)
+			start, tokens = i+1, 0
+		}
+	}
+	return append(chunks, pack(c.tok, sentences[start:], c.size, 0)...), nil
+}
+
+// embed embeds each sentence together with the one before and after it
+func (c *Semantic) embed(ctx context.Context, sentences []string) ([][]float32, error) {
+	windows := make([]string, len(sentences))
+	for i := range sentences {
+		windows[i] = strings.Join(sentences[max(i-1, 0):min(i+2, len(sentences))], "")
+	}
+
+	vectors := make([][]float32, 0, len(windows))
+	for start := 0; start < len(windows); start += semanticBatch {
+		batch := windows[start:min(start+semanticBatch, len(windows))]
+		embeddings, err := c.embedder.GenerateEmbeddings(ctx, batch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed sentences: %w", err)
+		}
+		if len(embeddings) != len(batch) {
+			return nil, fmt.Errorf("got %d sentence embeddings, want %d", len(embeddings), len(batch))
+		}
+		vectors = append(vectors, embeddings...)
+	}
+	return vectors, nil
+}
+
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range min(len(a), len(b)) {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// percentile returns the p-th percentile (0-100) of values
+func percentile(values []float64, p float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	idx := int(math.Round(p / 100 * float64(len(sorted)-1)))
+	return sorted[min(max(idx, 0), len(sorted)-1)]
+}
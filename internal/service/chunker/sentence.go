@@ -0,0 +1,113 @@
+package chunker
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/tokenizer"
+)
+
+// Sentence packs whole sentences into chunks, so a chunk never stops in
+// the middle of one unless a single sentence is longer than size
+type Sentence struct {
+	tok     *tokenizer.Tokenizer
+	size    int
+	overlap int
+}
+
+// NewSentence creates a sentence-packing chunker
+func NewSentence(tok *tokenizer.Tokenizer, size, overlap int) *Sentence {
+	return &Sentence{tok: tok, size: size, overlap: overlap}
+}
+
+// Name identifies the strategy
+func (c *Sentence) Name() string {
+	return StrategySentence
+}
+
+// Chunk splits text into sentences and packs them into chunks; the
+// overlap is made of whole sentences
+func (c *Sentence) Chunk(ctx context.Context, text string) ([]tokenizer.Piece, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+	return pack(c.tok, fit(c.tok, splitSentences(text), c.size), c.size, c.overlap), nil
+}
+
+// abbreviations end with a period that does not end the sentence
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "jr": true,
+	"sr": true, "st": true, "vs": true, "e.g": true, "i.e": true, "cf": true,
+	"inc": true, "ltd": true, "co": true, "no": true, "approx": true, "fig": true,
+}
+
+// splitSentences cuts text after sentence terminators and line breaks.
+// Each part keeps its trailing whitespace, so the parts add up to text.
+// Latin terminators need a following space or quote ("3.14" stays
+// whole) and a period after an abbreviation, an initial or a list
+// number ("Dr.", "e.g.", "J.", "1.") does not count; CJK ones (。！？) end
+// a sentence on their own.
+func splitSentences(text string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(text); {
+		r, n := utf8.DecodeRuneInString(text[i:])
+		i += n
+
+		end := false
+		switch {
+		case r == '\n', strings.ContainsRune("。！？；…", r):
+			end = true
+		case r == '.' || r == '!' || r == '?':
+			next, _ := utf8.DecodeRuneInString(text[i:])
+			end = i == len(text) || unicode.IsSpace(next) || strings.ContainsRune("\"'”’)", next)
+			if end && r == '.' && i < len(text) && abbreviated(text[start:i-1]) {
+				end = false
+			}
+		}
+		if !end {
+			continue
+		}
+
+		// 句末的引号、括号和空白归到这一句；ASCII 引号也可能是下一句的开头
+		for i < len(text) {
+			r, n := utf8.DecodeRuneInString(text[i:])
+			if r == '"' || r == '\'' {
+				next, _ := utf8.DecodeRuneInString(text[i+n:])
+				if i+n < len(text) && !unicode.IsSpace(next) {
+					break
+				}
+			} else if !unicode.IsSpace(r) && !strings.ContainsRune("”’)）」』。！？!?.…", r) {
+				break
+			}
+			i += n
+		}
+		parts = append(parts, text[start:i])
+		start = i
+	}
+	if start < len(text) {
+		parts = append(parts, text[start:])
+	}
+	return parts
+}
+
+// abbreviated reports whether the word at the end of text is an
+// abbreviation, a single-letter initial or, when it is all of text, the
+// number of a list item ("1. Budget")
+func abbreviated(text string) bool {
+	word := text
+	if i := strings.LastIndexFunc(text, func(r rune) bool { return unicode.IsSpace(r) || r == '(' }); i >= 0 {
+		_, n := utf8.DecodeRuneInString(text[i:])
+		word = text[i+n:]
+	}
+	if word != "" && word == strings.TrimSpace(text) && strings.Trim(word, "0123456789") == "" {
+		return true
+	}
+	if utf8.RuneCountInString(word) == 1 {
+		return unicode.IsUpper([]rune(word)[0])
+	}
+	return abbreviations[strings.ToLower(word)]
+}
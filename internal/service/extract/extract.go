@@ -0,0 +1,123 @@
+// Package extract pulls indexable text out of attachment files.
+package extract
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/mailparse"
+)
+
+// ErrUnsupported is returned for file types we have no extractor for
+var ErrUnsupported = errors.New("unsupported attachment type")
+
+// MaxSize is the largest attachment we try to extract text from
+const MaxSize = 32 << 20
+
+// Format identifies which extractor handles a file
+type Format string
+
+const (
+	FormatNone Format = ""
+	FormatText Format = "text"
+	FormatHTML Format = "html"
+	FormatPDF  Format = "pdf"
+	FormatDOCX Format = "docx"
+	FormatXLSX Format = "xlsx"
+	FormatCSV  Format = "csv"
+	FormatICS  Format = "ics"
+)
+
+// mimeFormats maps MIME types to formats; generic types such as
+// application/octet-stream fall through to the file extension
+var mimeFormats = map[string]Format{
+	"application/pdf": FormatPDF,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": FormatDOCX,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":       FormatXLSX,
+	"text/csv":                  FormatCSV,
+	"text/tab-separated-values": FormatCSV,
+	"application/csv":           FormatCSV,
+	"text/calendar":             FormatICS,
+	"application/ics":           FormatICS,
+	"text/html":                 FormatHTML,
+	"application/json":          FormatText,
+	"application/xml":           FormatText,
+}
+
+var extFormats = map[string]Format{
+	".pdf":  FormatPDF,
+	".docx": FormatDOCX,
+	".xlsx": FormatXLSX,
+	".csv":  FormatCSV,
+	".tsv":  FormatCSV,
+	".ics":  FormatICS,
+	".html": FormatHTML,
+	".htm":  FormatHTML,
+	".txt":  FormatText,
+	".md":   FormatText,
+	".json": FormatText,
+	".xml":  FormatText,
+	".log":  FormatText,
+}
+
+// Detect picks the extractor for an attachment from its MIME type,
+// falling back to the file extension
+func Detect(filename, mimeType string) Format {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(mimeType, ";", 2)[0]))
+	if f, ok := mimeFormats[mediaType]; ok {
+		return f
+	}
+	if f, ok := extFormats[strings.ToLower(filepath.Ext(filename))]; ok {
+		return f
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return FormatText
+	}
+	return FormatNone
+}
+
+// Supported reports whether Text can handle the attachment, so callers can
+// avoid downloading files they would throw away
+func Supported(filename, mimeType string) bool {
+	return Detect(filename, mimeType) != FormatNone
+}
+
+// Text extracts plain text from an attachment. mimeType may carry a
+// charset parameter, which is honoured for text formats.
+func Text(filename, mimeType string, data []byte) (text string, err error) {
+	if len(data) > MaxSize {
+		return "", fmt.Errorf("attachment too large to extract (%d bytes)", len(data))
+	}
+
+	// 第三方解析器遇到畸形文件可能 panic，不能让一个附件拖垮整个同步
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("extract %s: recovered from panic: %v", filename, r)
+		}
+	}()
+
+	switch Detect(filename, mimeType) {
+	case FormatText:
+		text = mailparse.DecodeText(data, mimeType)
+	case FormatHTML:
+		text = mailparse.HTMLToText(mailparse.DecodeText(data, mimeType))
+	case FormatPDF:
+		text, err = pdfText(data)
+	case FormatDOCX:
+		text, err = docxText(data)
+	case FormatXLSX:
+		text, err = xlsxText(data)
+	case FormatCSV:
+		text, err = csvText(mailparse.DecodeText(data, mimeType), filename)
+	case FormatICS:
+		text, err = icsText(mailparse.DecodeText(data, mimeType))
+	default:
+		return "", ErrUnsupported
+	}
+	if err != nil {
+		return "", fmt.Errorf("extract %s: %w", filename, err)
+	}
+	return strings.TrimSpace(text), nil
+}
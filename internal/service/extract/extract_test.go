@@ -0,0 +1,116 @@
+package extract_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/extract"
+)
+
+const fixtureDir = "../../../test/fixtures/attachments"
+
+func TestTextFixtures(t *testing.T) {
+	tests := []struct {
+		file     string
+		mimeType string
+		want     string // 完整输出；为空时只检查 contains
+		contains []string
+	}{
+		{
+			file:     "invoice.pdf",
+			mimeType: "application/pdf",
+			contains: []string{"Invoice INV-2024-0012", "Total 1200 EUR"},
+		},
+		{
+			file: "contract.docx",
+			want: "Service Agreement\nBetween Acme Corp and 北京科技有限公司\nItem | Price\nSupport | 1200 EUR\nSigned\nBerlin",
+		},
+		{
+			// 共享字符串、富文本、行内字符串、布尔值；空表不输出
+			file: "budget.xlsx",
+			want: "Sheet: Q3\nTeam | Budget\nMarketing | 45000\nApproved | TRUE",
+		},
+		{
+			file:     "meeting.ics",
+			mimeType: "text/calendar",
+			want: "Event: Q3 budget review\nStart: 2025-10-20 10:00 (Asia/Tokyo)\nEnd: 2025-10-20 11:00 (Asia/Tokyo)\n" +
+				"Location: Room 4B, Tokyo office\nOrganizer: Alice <alice@example.com>\n" +
+				"Attendees: Bob <bob@example.com>, carol@example.com\n" +
+				"Description: Agenda:\n1. Forecast\n2. Hiring plan that is long enough to be folded\n\n" +
+				"Event: Offsite\nStart: 2025-11-01",
+		},
+		{
+			file: "expenses.csv",
+			want: "Date | Item | Amount\n2025-06-01 | Taxi, airport | 45.00\n2025-06-02 | Hotel",
+		},
+		{
+			// 逗号在单元格里，按制表符分列
+			file: "expenses.tsv",
+			want: "Date | Item | Amount\n2025-06-01 | Taxi, airport | 45.00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join(fixtureDir, tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !extract.Supported(tt.file, tt.mimeType) {
+				t.Fatalf("%s is not supported", tt.file)
+			}
+			text, err := extract.Text(tt.file, tt.mimeType, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != "" && text != tt.want {
+				t.Errorf("Text =\n%q\nwant\n%q", text, tt.want)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(text, s) {
+					t.Errorf("Text = %q, want it to contain %q", text, s)
+				}
+			}
+		})
+	}
+}
+
+func TestTextErrors(t *testing.T) {
+	if _, err := extract.Text("photo.jpg", "image/jpeg", []byte{0xff, 0xd8}); !errors.Is(err, extract.ErrUnsupported) {
+		t.Errorf("Text(photo.jpg) = %v, want ErrUnsupported", err)
+	}
+	if extract.Supported("photo.jpg", "image/jpeg") {
+		t.Error("photo.jpg reported as supported")
+	}
+	// 损坏的文件返回错误，不能 panic
+	for _, file := range []string{"broken.pdf", "broken.docx", "broken.xlsx"} {
+		if _, err := extract.Text(file, "", []byte("not a real file")); err == nil {
+			t.Errorf("Text(%s) with garbage data returned no error", file)
+		}
+	}
+	if _, err := extract.Text("empty.ics", "", []byte("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n")); err == nil {
+		t.Error("calendar without events returned no error")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		filename, mimeType string
+		want               extract.Format
+	}{
+		{"report.pdf", "application/pdf", extract.FormatPDF},
+		// 附件常被标成 application/octet-stream，这时看扩展名
+		{"Budget.XLSX", "application/octet-stream", extract.FormatXLSX},
+		{"invite", "text/calendar; charset=utf-8", extract.FormatICS},
+		{"data.tsv", "", extract.FormatCSV},
+		{"notes", "text/x-markdown", extract.FormatText},
+		{"photo.jpg", "image/jpeg", extract.FormatNone},
+	}
+	for _, tt := range tests {
+		if got := extract.Detect(tt.filename, tt.mimeType); got != tt.want {
+			t.Errorf("Detect(%q, %q) = %q, want %q", tt.filename, tt.mimeType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package extract
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// icsFields are the VEVENT properties worth indexing, in output order
+var icsFields = []struct {
+	name  string
+	label string
+}{
+	{"SUMMARY", "Event"},
+	{"DTSTART", "Start"},
+	{"DTEND", "End"},
+	{"LOCATION", "Location"},
+	{"ORGANIZER", "Organizer"},
+	{"ATTENDEE", "Attendee"},
+	{"DESCRIPTION", "Description"},
+}
+
+// icsText summarises the events of an iCalendar file (meeting invites)
+func icsText(text string) (string, error) {
+	lines := unfoldICS(text)
+
+	var events []string
+	var current map[string][]string
+	for _, line := range lines {
+		name, params, value := splitICSLine(line)
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			current = make(map[string][]string)
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if current != nil {
+				events = append(events, formatEvent(current))
+			}
+			current = nil
+		case current != nil:
+			if name == "DTSTART" || name == "DTEND" {
+				value = formatICSTime(value, params)
+			}
+			if name == "ORGANIZER" || name == "ATTENDEE" {
+				value = icsPerson(value, params)
+			}
+			current[name] = append(current[name], unescapeICS(value))
+		}
+	}
+
+	if len(events) == 0 {
+		return "", fmt.Errorf("no events in calendar")
+	}
+	return strings.Join(events, "\n\n"), nil
+}
+
+func formatEvent(props map[string][]string) string {
+	var lines []string
+	for _, f := range icsFields {
+		values := props[f.name]
+		if len(values) == 0 {
+			continue
+		}
+		if f.name == "ATTENDEE" {
+			lines = append(lines, "Attendees: "+strings.Join(values, ", "))
+			continue
+		}
+		lines = append(lines, f.label+": "+values[0])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// unfoldICS joins continuation lines (RFC 5545 §3.1)
+func unfoldICS(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// splitICSLine splits "NAME;PARAM=x:value" into its parts
+func splitICSLine(line string) (string, map[string]string, string) {
+	head, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return "", nil, ""
+	}
+	parts := strings.Split(head, ";")
+	params := make(map[string]string)
+	for _, p := range parts[1:] {
+		if k, v, ok := strings.Cut(p, "="); ok {
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, value
+}
+
+func formatICSTime(value string, params map[string]string) string {
+	if params["VALUE"] == "DATE" {
+		if t, err := time.Parse("20060102", value); err == nil {
+			return t.Format("2006-01-02")
+		}
+		return value
+	}
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t.Format("2006-01-02 15:04 MST")
+	}
+	if t, err := time.Parse("20060102T150405", value); err == nil {
+		if tz := params["TZID"]; tz != "" {
+			return t.Format("2006-01-02 15:04") + " (" + tz + ")"
+		}
+		return t.Format("2006-01-02 15:04")
+	}
+	return value
+}
+
+// icsPerson renders "CN=Alice:mailto:alice@example.com" as "Alice <alice@example.com>"
+func icsPerson(value string, params map[string]string) string {
+	addr := value
+	if len(addr) >= 7 && strings.EqualFold(addr[:7], "mailto:") {
+		addr = addr[7:]
+	}
+	if cn := params["CN"]; cn != "" && cn != addr {
+		return cn + " <" + addr + ">"
+	}
+	return addr
+}
+
+var icsUnescaper = strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+func unescapeICS(s string) string {
+	return icsUnescaper.Replace(s)
+}
@@ -0,0 +1,314 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxZipEntry caps how much of a single OOXML part is decompressed,
+// protecting against zip bombs
+const maxZipEntry = 64 << 20
+
+// docxText reads word/document.xml and keeps one line per paragraph.
+// Table cells are separated by " | " so rows stay readable.
+func docxText(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("open docx: %w", err)
+	}
+	doc, err := readZipEntry(zr, "word/document.xml")
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		out       strings.Builder
+		paragraph strings.Builder
+		cellIndex []int // 嵌套表格时每层当前是第几个单元格
+	)
+	flush := func() {
+		if text := strings.TrimSpace(paragraph.String()); text != "" {
+			if len(cellIndex) > 0 && cellIndex[len(cellIndex)-1] > 1 {
+				out.WriteString(" | ")
+			} else if out.Len() > 0 {
+				out.WriteString("\n")
+			}
+			out.WriteString(text)
+		}
+		paragraph.Reset()
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(doc))
+	inText := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("parse document.xml: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				paragraph.WriteString("\t")
+			case "br", "cr":
+				paragraph.WriteString("\n")
+			case "tbl":
+				cellIndex = append(cellIndex, 0)
+			case "tr":
+				if len(cellIndex) > 0 {
+					cellIndex[len(cellIndex)-1] = 0
+				}
+			case "tc":
+				if len(cellIndex) > 0 {
+					cellIndex[len(cellIndex)-1]++
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				flush()
+			case "tbl":
+				if len(cellIndex) > 0 {
+					cellIndex = cellIndex[:len(cellIndex)-1]
+				}
+			}
+		case xml.CharData:
+			if inText {
+				paragraph.Write(t)
+			}
+		}
+	}
+	flush()
+	return out.String(), nil
+}
+
+// xlsxText renders every worksheet as "Sheet: <name>" followed by one
+// " | " separated line per row
+func xlsxText(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("open xlsx: %w", err)
+	}
+
+	shared, err := xlsxSharedStrings(zr)
+	if err != nil {
+		return "", err
+	}
+	sheets, err := xlsxSheets(zr)
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string
+	for _, sheet := range sheets {
+		raw, err := readZipEntry(zr, sheet.path)
+		if err != nil {
+			return "", err
+		}
+		rows, err := xlsxRows(raw, shared)
+		if err != nil {
+			return "", fmt.Errorf("parse sheet %q: %w", sheet.name, err)
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		parts = append(parts, "Sheet: "+sheet.name+"\n"+strings.Join(rows, "\n"))
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+type xlsxSheet struct {
+	name string
+	path string
+}
+
+// xlsxSheets resolves sheet names to their part paths via the workbook
+// relationships, in workbook order
+func xlsxSheets(zr *zip.Reader) ([]xlsxSheet, error) {
+	workbook, err := readZipEntry(zr, "xl/workbook.xml")
+	if err != nil {
+		return nil, err
+	}
+	var wb struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(workbook, &wb); err != nil {
+		return nil, fmt.Errorf("parse workbook.xml: %w", err)
+	}
+
+	targets := make(map[string]string)
+	if rels, err := readZipEntry(zr, "xl/_rels/workbook.xml.rels"); err == nil {
+		var r struct {
+			Relationships []struct {
+				ID     string `xml:"Id,attr"`
+				Target string `xml:"Target,attr"`
+			} `xml:"Relationship"`
+		}
+		if err := xml.Unmarshal(rels, &r); err == nil {
+			for _, rel := range r.Relationships {
+				target := rel.Target
+				if strings.HasPrefix(target, "/") {
+					target = strings.TrimPrefix(target, "/")
+				} else {
+					target = path.Join("xl", target)
+				}
+				targets[rel.ID] = target
+			}
+		}
+	}
+
+	sheets := make([]xlsxSheet, 0, len(wb.Sheets))
+	for i, s := range wb.Sheets {
+		p, ok := targets[s.RID]
+		if !ok {
+			p = fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)
+		}
+		sheets = append(sheets, xlsxSheet{name: s.Name, path: p})
+	}
+	return sheets, nil
+}
+
+// xlsxSharedStrings loads the shared string table (absent in some files)
+func xlsxSharedStrings(zr *zip.Reader) ([]string, error) {
+	raw, err := readZipEntry(zr, "xl/sharedStrings.xml")
+	if err != nil {
+		return nil, nil
+	}
+	var sst struct {
+		Items []struct {
+			T string `xml:"t"`
+			R []struct {
+				T string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"si"`
+	}
+	if err := xml.Unmarshal(raw, &sst); err != nil {
+		return nil, fmt.Errorf("parse sharedStrings.xml: %w", err)
+	}
+	strs := make([]string, len(sst.Items))
+	for i, item := range sst.Items {
+		if len(item.R) == 0 {
+			strs[i] = item.T
+			continue
+		}
+		// 富文本单元格由多个 run 组成
+		var b strings.Builder
+		for _, r := range item.R {
+			b.WriteString(r.T)
+		}
+		strs[i] = b.String()
+	}
+	return strs, nil
+}
+
+// xlsxRows renders the non-empty rows of a worksheet
+func xlsxRows(raw []byte, shared []string) ([]string, error) {
+	var ws struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(raw, &ws); err != nil {
+		return nil, err
+	}
+
+	var rows []string
+	for _, row := range ws.Rows {
+		cells := make(map[int]string)
+		maxCol := -1
+		for i, c := range row.Cells {
+			col := columnIndex(c.Ref, i)
+			var v string
+			switch c.Type {
+			case "s":
+				if idx, err := strconv.Atoi(c.Value); err == nil && idx >= 0 && idx < len(shared) {
+					v = shared[idx]
+				}
+			case "inlineStr":
+				v = c.Inline
+			case "b":
+				v = map[string]string{"0": "FALSE", "1": "TRUE"}[c.Value]
+			default:
+				v = c.Value
+			}
+			if v = strings.TrimSpace(v); v != "" {
+				cells[col] = v
+				maxCol = max(maxCol, col)
+			}
+		}
+		if maxCol < 0 {
+			continue
+		}
+		cols := make([]int, 0, len(cells))
+		for col := range cells {
+			cols = append(cols, col)
+		}
+		sort.Ints(cols)
+		values := make([]string, 0, len(cols))
+		for _, col := range cols {
+			values = append(values, cells[col])
+		}
+		rows = append(rows, strings.Join(values, " | "))
+	}
+	return rows, nil
+}
+
+// columnIndex converts the letters of a cell reference ("AB12") to a
+// zero-based column, falling back to the cell's position in the row
+func columnIndex(ref string, fallback int) int {
+	col := 0
+	n := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+		n++
+	}
+	if n == 0 {
+		return fallback
+	}
+	return col - 1
+}
+
+func readZipEntry(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("open %s: %w", name, err)
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(io.LimitReader(rc, maxZipEntry))
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", name, err)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("%s not found", name)
+}
@@ -0,0 +1,51 @@
+package extract
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// pdfText extracts text page by page, keeping each visual row on one line
+func pdfText(data []byte) (string, error) {
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("open pdf: %w", err)
+	}
+
+	var pages []string
+	for i := 1; i <= r.NumPage(); i++ {
+		page := r.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		rows, err := page.GetTextByRow()
+		if err != nil {
+			return "", fmt.Errorf("read page %d: %w", i, err)
+		}
+
+		var lines []string
+		for _, row := range rows {
+			var words []string
+			for _, word := range row.Content {
+				if s := strings.TrimSpace(word.S); s != "" {
+					words = append(words, s)
+				}
+			}
+			if len(words) > 0 {
+				lines = append(lines, strings.Join(words, " "))
+			}
+		}
+		if len(lines) > 0 {
+			pages = append(pages, strings.Join(lines, "\n"))
+		}
+	}
+
+	if len(pages) == 0 {
+		// 扫描件 PDF 没有文本层，需要 OCR，这里不处理
+		return "", fmt.Errorf("pdf has no text layer")
+	}
+	return strings.Join(pages, "\n\n"), nil
+}
@@ -0,0 +1,42 @@
+package extract
+
+import (
+	"encoding/csv"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// csvText renders CSV/TSV rows as " | " separated lines
+func csvText(text, filename string) (string, error) {
+	r := csv.NewReader(strings.NewReader(text))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	if strings.EqualFold(filepath.Ext(filename), ".tsv") || strings.Count(firstLine(text), "\t") > strings.Count(firstLine(text), ",") {
+		r.Comma = '\t'
+	}
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("parse csv: %w", err)
+	}
+
+	lines := make([]string, 0, len(records))
+	for _, rec := range records {
+		var cells []string
+		for _, cell := range rec {
+			if cell = strings.TrimSpace(cell); cell != "" {
+				cells = append(cells, cell)
+			}
+		}
+		if len(cells) > 0 {
+			lines = append(lines, strings.Join(cells, " | "))
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
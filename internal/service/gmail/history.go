@@ -0,0 +1,145 @@
+package gmail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// ErrHistoryExpired is returned by History when the start historyId is too
+// old (Gmail keeps roughly a week of history). Callers should fall back to
+// a full resync.
+var ErrHistoryExpired = errors.New("gmail history id expired")
+
+// Profile holds the mailbox identity and its current historyId
+type Profile struct {
+	EmailAddress  string
+	HistoryID     uint64
+	MessagesTotal int64
+}
+
+// HistoryChanges summarizes mailbox changes since a historyId
+type HistoryChanges struct {
+	// HistoryID is the mailbox historyId to resume from next time
+	HistoryID uint64
+
+	// Added lists IDs of new messages, in the order they arrived
+	Added []string
+
+	// Deleted lists IDs of permanently deleted messages
+	Deleted []string
+
+	// Relabeled maps message ID to its full label set after the change
+	Relabeled map[string][]string
+}
+
+// Profile returns the authenticated mailbox profile
+func (s *Service) Profile(ctx context.Context) (*Profile, error) {
+	var p *gmail.Profile
+	err := s.call(ctx, costGetProfile, func() (err error) {
+		p, err = s.client.Users.GetProfile("me").Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get profile: %w", err)
+	}
+	return &Profile{
+		EmailAddress:  p.EmailAddress,
+		HistoryID:     p.HistoryId,
+		MessagesTotal: p.MessagesTotal,
+	}, nil
+}
+
+// History lists all mailbox changes after startHistoryID via users.history.list.
+//
+// Events are collapsed per message: a message that is added and then deleted
+// within the window only shows up in Deleted, and label events only keep the
+// latest label set.
+func (s *Service) History(ctx context.Context, startHistoryID uint64) (*HistoryChanges, error) {
+	changes := &HistoryChanges{
+		HistoryID: startHistoryID,
+		Relabeled: make(map[string][]string),
+	}
+
+	added := make(map[string]bool)
+	deleted := make(map[string]bool)
+
+	pageToken := ""
+	for {
+		call := s.client.Users.History.List("me").
+			StartHistoryId(startHistoryID).
+			HistoryTypes("messageAdded", "messageDeleted", "labelAdded", "labelRemoved").
+			Context(ctx)
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+
+		var resp *gmail.ListHistoryResponse
+		err := s.call(ctx, costHistoryList, func() (err error) {
+			resp, err = call.Do()
+			return err
+		})
+		if err != nil {
+			if isNotFound(err) {
+				return nil, ErrHistoryExpired
+			}
+			return nil, fmt.Errorf("unable to list history: %w", err)
+		}
+
+		for _, h := range resp.History {
+			for _, m := range h.MessagesAdded {
+				if m.Message == nil || added[m.Message.Id] {
+					continue
+				}
+				added[m.Message.Id] = true
+				changes.Added = append(changes.Added, m.Message.Id)
+			}
+			for _, m := range h.MessagesDeleted {
+				if m.Message != nil {
+					deleted[m.Message.Id] = true
+				}
+			}
+			for _, l := range h.LabelsAdded {
+				if l.Message != nil {
+					changes.Relabeled[l.Message.Id] = l.Message.LabelIds
+				}
+			}
+			for _, l := range h.LabelsRemoved {
+				if l.Message != nil {
+					changes.Relabeled[l.Message.Id] = l.Message.LabelIds
+				}
+			}
+		}
+		if resp.HistoryId > changes.HistoryID {
+			changes.HistoryID = resp.HistoryId
+		}
+
+		if pageToken = resp.NextPageToken; pageToken == "" {
+			break
+		}
+	}
+
+	// 已删除的邮件不需要再拉取或更新 Label
+	if len(deleted) > 0 {
+		kept := changes.Added[:0]
+		for _, id := range changes.Added {
+			if !deleted[id] {
+				kept = append(kept, id)
+			}
+		}
+		changes.Added = kept
+		for id := range deleted {
+			delete(changes.Relabeled, id)
+			changes.Deleted = append(changes.Deleted, id)
+		}
+	}
+
+	// 新邮件拉取时已经带上最新的 Label
+	for _, id := range changes.Added {
+		delete(changes.Relabeled, id)
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,82 @@
+package gmail
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/retry"
+	"google.golang.org/api/googleapi"
+)
+
+// Gmail API quota units per call
+// (https://developers.google.com/gmail/api/reference/quota)
+const (
+	costGetProfile     = 1
+	costHistoryList    = 2
+	costMessagesList   = 5
+	costMessagesGet    = 5
+	costAttachmentsGet = 5
+)
+
+// DefaultQuotaPerSecond stays below Gmail's 250 units/user/second limit
+const DefaultQuotaPerSecond = 200
+
+// DefaultConcurrency is the number of parallel messages.get workers
+const DefaultConcurrency = 8
+
+// call waits for cost quota units and runs fn, retrying rate-limit and
+// server errors with exponential backoff
+func (s *Service) call(ctx context.Context, cost int, fn func() error) error {
+	return retry.Do(ctx, s.retry, func() error {
+		if err := s.limiter.WaitN(ctx, cost); err != nil {
+			return err
+		}
+		return fn()
+	})
+}
+
+// classifyError decides whether a Gmail API error is transient
+func classifyError(err error) (bool, time.Duration) {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		// 网络层错误（连接重置、超时等）值得重试，但 ctx 取消不行
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded), 0
+	}
+
+	wait := retryAfter(apiErr.Header)
+	switch {
+	case apiErr.Code == http.StatusTooManyRequests:
+		return true, wait
+	case apiErr.Code >= 500:
+		return true, wait
+	case apiErr.Code == http.StatusForbidden:
+		// Gmail 用 403 + rateLimitExceeded 表示按用户限流
+		for _, e := range apiErr.Errors {
+			if e.Reason == "rateLimitExceeded" || e.Reason == "userRateLimitExceeded" {
+				return true, wait
+			}
+		}
+	}
+	return false, 0
+}
+
+// retryAfter parses a Retry-After header given in seconds
+func retryAfter(h http.Header) time.Duration {
+	if h == nil {
+		return 0
+	}
+	secs, err := strconv.Atoi(h.Get("Retry-After"))
+	if err != nil || secs <= 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// isNotFound reports whether err is a Gmail 404
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
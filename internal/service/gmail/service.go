@@ -5,45 +5,294 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net/http"
-	"regexp"
+	"mime"
+	"net/textproto"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/mailparse"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/source"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/retry"
+	"golang.org/x/time/rate"
 	"google.golang.org/api/gmail/v1"
 	"google.golang.org/api/option"
 )
 
 type Service struct {
-	client *gmail.Service
+	client      *gmail.Service
+	limiter     *rate.Limiter
+	retry       retry.Policy
+	concurrency int
 }
 
-func New(ctx context.Context, httpClient *http.Client) (*Service, error) {
-	svc, err := gmail.NewService(ctx, option.WithHTTPClient(httpClient))
+// Option customizes a Service
+type Option func(*settings)
+
+type settings struct {
+	endpoint       string
+	concurrency    int
+	quotaPerSecond int
+	retry          retry.Policy
+}
+
+// WithEndpoint points the client at a different API root, e.g. an
+// httptest server that fakes the Gmail REST API
+func WithEndpoint(url string) Option {
+	return func(s *settings) { s.endpoint = url }
+}
+
+// WithConcurrency sets the number of parallel messages.get workers
+func WithConcurrency(n int) Option {
+	return func(s *settings) {
+		if n > 0 {
+			s.concurrency = n
+		}
+	}
+}
+
+// WithQuota sets the token-bucket refill rate in Gmail quota units per second
+func WithQuota(unitsPerSecond int) Option {
+	return func(s *settings) {
+		if unitsPerSecond > 0 {
+			s.quotaPerSecond = unitsPerSecond
+		}
+	}
+}
+
+// WithRetryPolicy overrides the backoff used for 429/5xx responses
+func WithRetryPolicy(p retry.Policy) Option {
+	return func(s *settings) { s.retry = p }
+}
+
+func New(ctx context.Context, httpClient *http.Client, opts ...Option) (*Service, error) {
+	cfg := settings{
+		concurrency:    DefaultConcurrency,
+		quotaPerSecond: DefaultQuotaPerSecond,
+		retry:          retry.DefaultPolicy,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cfg.retry.Classify = classifyError
+
+	clientOpts := []option.ClientOption{option.WithHTTPClient(httpClient)}
+	if cfg.endpoint != "" {
+		clientOpts = append(clientOpts, option.WithEndpoint(cfg.endpoint))
+	}
+
+	svc, err := gmail.NewService(ctx, clientOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("error creating gmail service: %w", err)
 	}
-	return &Service{client: svc}, nil
+
+	// 令牌桶：每秒补充 quotaPerSecond 个配额单位，桶容量同为一秒的量
+	// （至少要能容纳最贵的一次调用，否则 WaitN 会直接报错）
+	burst := max(cfg.quotaPerSecond, costMessagesGet)
+	return &Service{
+		client:      svc,
+		limiter:     rate.NewLimiter(rate.Limit(cfg.quotaPerSecond), burst),
+		retry:       cfg.retry,
+		concurrency: cfg.concurrency,
+	}, nil
+}
+
+// ListOptions scopes which messages FetchEmails lists
+type ListOptions struct {
+	// MaxResults caps the total number of messages; <= 0 means no limit
+	MaxResults int64
+
+	// Query is a raw Gmail search query, e.g. "from:alice has:attachment"
+	Query string
+
+	// Labels restricts results to messages carrying all of these labels
+	Labels []string
+
+	// Since / Until bound the message date (zero value = unbounded)
+	Since time.Time
+	Until time.Time
+
+	// IncludeSpamTrash also lists messages in Trash and Spam, which
+	// users.messages.list leaves out by default
+	IncludeSpamTrash bool
+}
+
+// maxPageSize is the largest page users.messages.list will return
+const maxPageSize = 500
+
+// SearchQuery builds the Gmail "q" parameter from the options
+func (o ListOptions) SearchQuery() string {
+	var terms []string
+	if q := strings.TrimSpace(o.Query); q != "" {
+		terms = append(terms, q)
+	}
+	for _, l := range o.Labels {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+		// Gmail 搜索里 label 名的空格要用 "-" 代替
+		terms = append(terms, "label:"+strings.ReplaceAll(l, " ", "-"))
+	}
+	// after/before 接受 Unix 秒，比 YYYY/MM/DD 更精确且没有时区歧义
+	if !o.Since.IsZero() {
+		terms = append(terms, fmt.Sprintf("after:%d", o.Since.Unix()))
+	}
+	if !o.Until.IsZero() {
+		terms = append(terms, fmt.Sprintf("before:%d", o.Until.Unix()))
+	}
+	return strings.Join(terms, " ")
 }
 
-// FetchEmails 抓取最近的邮件
-func (s *Service) FetchEmails(ctx context.Context, maxResults int64) ([]*domain.Email, error) {
-	resp, err := s.client.Users.Messages.List("me").MaxResults(maxResults).Do()
+// ListMessageIDs pages through users.messages.list and returns the IDs of
+// all matching messages, newest first
+func (s *Service) ListMessageIDs(ctx context.Context, opts ListOptions) ([]string, error) {
+	var ids []string
+	pageToken := ""
+	for {
+		pageSize := int64(maxPageSize)
+		if opts.MaxResults > 0 {
+			pageSize = min(pageSize, opts.MaxResults-int64(len(ids)))
+		}
+
+		page, next, err := s.ListMessagePage(ctx, opts, pageToken, pageSize)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, page...)
+
+		pageToken = next
+		if pageToken == "" || (opts.MaxResults > 0 && int64(len(ids)) >= opts.MaxResults) {
+			break
+		}
+	}
+
+	return ids, nil
+}
+
+// ListMessagePage lists one page of matching message IDs starting at
+// pageToken ("" for the first page). The returned token is "" on the last
+// page. Resumable syncs store the token between pages.
+func (s *Service) ListMessagePage(ctx context.Context, opts ListOptions, pageToken string, pageSize int64) ([]string, string, error) {
+	if pageSize <= 0 || pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	call := s.client.Users.Messages.List("me").MaxResults(pageSize).Context(ctx)
+	if q := opts.SearchQuery(); q != "" {
+		call = call.Q(q)
+	}
+	if opts.IncludeSpamTrash {
+		call = call.IncludeSpamTrash(true)
+	}
+	if pageToken != "" {
+		call = call.PageToken(pageToken)
+	}
+
+	var resp *gmail.ListMessagesResponse
+	err := s.call(ctx, costMessagesList, func() (err error) {
+		resp, err = call.Do()
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("unable to list messages: %w", err)
+		return nil, "", fmt.Errorf("unable to list messages: %w", err)
 	}
 
-	var emails []*domain.Email
+	ids := make([]string, 0, len(resp.Messages))
 	for _, m := range resp.Messages {
-		// 获取完整内容（包括 Headers 和 Payload）
-		msg, err := s.client.Users.Messages.Get("me", m.Id).Format("full").Do()
-		if err != nil {
-			continue // 生产环境建议记录日志
+		ids = append(ids, m.Id)
+	}
+	return ids, resp.NextPageToken, nil
+}
+
+// FetchEmails lists the messages matching opts and downloads each of them
+func (s *Service) FetchEmails(ctx context.Context, opts ListOptions) (*FetchReport, error) {
+	ids, err := s.ListMessageIDs(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.FetchMessages(ctx, ids)
+}
+
+// FetchReport is the outcome of downloading a batch of messages
+type FetchReport struct {
+	// Emails holds the parsed messages, in the order they were requested
+	Emails []*domain.Email
+
+	// Missing lists messages that were deleted after being listed (404)
+	Missing []string
+
+	// Failed lists messages that still failed after retries
+	Failed []source.Failure
+}
+
+// FetchMessages downloads and parses the given messages using a bounded
+// worker pool. Per-message failures are collected in the report; the
+// returned error is only set when ctx is cancelled.
+func (s *Service) FetchMessages(ctx context.Context, ids []string) (*FetchReport, error) {
+	msgs, report, err := s.fetchRaw(ctx, ids)
+	report.Emails = make([]*domain.Email, 0, len(msgs))
+	for _, msg := range msgs {
+		report.Emails = append(report.Emails, parseMessage(msg))
+	}
+	return report, err
+}
+
+// fetchRaw downloads the given messages without parsing them. Messages come
+// back in the order they were requested; missing and failed ones are
+// reported instead.
+func (s *Service) fetchRaw(ctx context.Context, ids []string) ([]*gmail.Message, *FetchReport, error) {
+	type outcome struct {
+		msg *gmail.Message
+		err error
+	}
+	outcomes := make([]outcome, len(ids))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(s.concurrency, len(ids)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// 获取完整内容（包括 Headers 和 Payload）
+				outcomes[i].err = s.call(ctx, costMessagesGet, func() (err error) {
+					outcomes[i].msg, err = s.client.Users.Messages.Get("me", ids[i]).Format("full").Context(ctx).Do()
+					return err
+				})
+			}
+		}()
+	}
+
+feed:
+	for i := range ids {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	report := &FetchReport{}
+	msgs := make([]*gmail.Message, 0, len(ids))
+	for i, o := range outcomes {
+		switch {
+		case o.err == nil && o.msg != nil:
+			msgs = append(msgs, o.msg)
+		case o.err == nil || ctx.Err() != nil:
+			// 没来得及处理，或者请求被取消（ctx 已取消），都不算失败
+		case isNotFound(o.err):
+			report.Missing = append(report.Missing, ids[i])
+		default:
+			report.Failed = append(report.Failed, source.Failure{Ref: ids[i], Err: o.err})
 		}
-		emails = append(emails, parseMessage(msg))
 	}
 
-	return emails, nil
+	return msgs, report, ctx.Err()
 }
 
 func parseMessage(msg *gmail.Message) *domain.Email {
@@ -51,21 +300,25 @@ func parseMessage(msg *gmail.Message) *domain.Email {
 		ID:       msg.Id,
 		ThreadID: msg.ThreadId,
 		Snippet:  msg.Snippet,
+		Source:   "gmail",
 	}
 
 	var dateStr string
 
 	// 1. 提取 Headers
+	header := make(textproto.MIMEHeader)
 	for _, h := range msg.Payload.Headers {
+		header.Add(h.Name, h.Value)
 		switch h.Name {
 		case "From":
-			email.From = h.Value
+			email.From = mailparse.DecodeHeader(h.Value)
 		case "Subject":
-			email.Subject = h.Value
+			email.Subject = mailparse.DecodeHeader(h.Value)
 		case "Date":
 			dateStr = h.Value
 		}
 	}
+	mailparse.ApplyHeaders(email, header.Get)
 
 	// 2. 解析日期 (使用 InternalDate 作为 fallback)
 	email.Date = parseEmailDateWithFallback(dateStr, msg.InternalDate)
@@ -73,6 +326,14 @@ func parseMessage(msg *gmail.Message) *domain.Email {
 	// 3. 提取正文 (RAG 的核心数据)
 	email.BodyText = getBodyText(msg.Payload)
 
+	// 附件只记录元数据，内容在索引时再通过 Attachments.Get 按需下载
+	email.SetAttachments(collectAttachments(email.ID, msg.Payload))
+
+	// 4. 记录 Label，增量同步时会根据 history 事件更新
+	if len(msg.LabelIds) > 0 {
+		_ = email.SetLabels(msg.LabelIds)
+	}
+
 	return email
 }
 
@@ -84,7 +345,7 @@ func getBodyText(payload *gmail.MessagePart) string {
 
 	// Step 2: Fallback to HTML with tags stripped
 	if htmlText := findHTMLText(payload); htmlText != "" {
-		return stripHTMLTags(htmlText)
+		return mailparse.HTMLToText(htmlText)
 	}
 
 	return ""
@@ -92,37 +353,95 @@ func getBodyText(payload *gmail.MessagePart) string {
 
 // findPlainText recursively searches for text/plain content
 func findPlainText(payload *gmail.MessagePart) string {
-	if payload.MimeType == "text/plain" && payload.Body != nil && payload.Body.Data != "" {
+	return findText(payload, "text/plain")
+}
+
+// findHTMLText recursively searches for text/html content
+func findHTMLText(payload *gmail.MessagePart) string {
+	return findText(payload, "text/html")
+}
+
+// findText returns the first non-attachment part of the given MIME type,
+// converted to UTF-8. Gmail has already undone the transfer encoding but
+// leaves the bytes in the part's declared charset.
+func findText(payload *gmail.MessagePart, mimeType string) string {
+	if payload.MimeType == mimeType && payload.Filename == "" && payload.Body != nil && payload.Body.Data != "" {
 		if decoded, err := decodeBase64Body(payload.Body.Data); err == nil {
-			return decoded
+			return mailparse.DecodeText(decoded, partHeader(payload, "Content-Type"))
 		}
 	}
-
 	for _, part := range payload.Parts {
-		if text := findPlainText(part); text != "" {
+		if text := findText(part, mimeType); text != "" {
 			return text
 		}
 	}
 	return ""
 }
 
-// findHTMLText recursively searches for text/html content
-func findHTMLText(payload *gmail.MessagePart) string {
-	if payload.MimeType == "text/html" && payload.Body != nil && payload.Body.Data != ""{
-		if decoded, err := decodeBase64Body(payload.Body.Data); err == nil {
-			return decoded
+// collectAttachments walks the part tree and records every part that has
+// a file name. Small attachments come inline in Body.Data; larger ones
+// only carry an attachmentId.
+func collectAttachments(emailID string, payload *gmail.MessagePart) []domain.Attachment {
+	var atts []domain.Attachment
+	var visit func(part *gmail.MessagePart)
+	visit = func(part *gmail.MessagePart) {
+		if part.Filename != "" && part.Body != nil {
+			partID := part.PartId
+			if partID == "" {
+				partID = "0"
+			}
+			disposition, _, _ := mime.ParseMediaType(partHeader(part, "Content-Disposition"))
+			att := domain.Attachment{
+				ID:       mailparse.AttachmentID(emailID, partID),
+				EmailID:  emailID,
+				PartID:   partID,
+				Filename: part.Filename,
+				MimeType: part.MimeType,
+				Size:     part.Body.Size,
+				RemoteID: part.Body.AttachmentId,
+				Inline:   disposition == "inline",
+			}
+			if part.Body.Data != "" {
+				if data, err := decodeBase64Body(part.Body.Data); err == nil {
+					att.Data = data
+				}
+			}
+			atts = append(atts, att)
 		}
-	}
-	for _, part := range payload.Parts{
-		if text := findHTMLText(part); text != ""{
-			return text
+		for _, child := range part.Parts {
+			visit(child)
 		}
 	}
+	visit(payload)
+	return atts
+}
 
+// FetchAttachment downloads the content of an attachment that Gmail did
+// not inline in messages.get
+func (s *Service) FetchAttachment(ctx context.Context, messageID, attachmentID string) ([]byte, error) {
+	var body *gmail.MessagePartBody
+	err := s.call(ctx, costAttachmentsGet, func() error {
+		var err error
+		body, err = s.client.Users.Messages.Attachments.Get("me", messageID, attachmentID).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch attachment %s of %s: %w", attachmentID, messageID, err)
+	}
+	return decodeBase64Body(body.Data)
+}
+
+// partHeader returns the first header of a part with the given name
+func partHeader(part *gmail.MessagePart, name string) string {
+	for _, h := range part.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
+		}
+	}
 	return ""
 }
 
-func decodeBase64Body(data string) (string, error) {
+func decodeBase64Body(data string) ([]byte, error) {
 	var decoded []byte
 	var err error
 
@@ -136,85 +455,16 @@ func decodeBase64Body(data string) (string, error) {
 	}
 
 	if err != nil {
-		return "", fmt.Errorf("all decoding attempts failed: %v", err)
+		return nil, fmt.Errorf("all decoding attempts failed: %v", err)
 	}
 
-	return string(decoded), nil
+	return decoded, nil
 }
 
-// stripHTMLTags removes HTML tags and decodes entities for RAG processing
-func stripHTMLTags(input string) string {
-	content := input
-
-	// 0. 先删除 <style> 和 <script> 块（包括内容）
-	// 这些标签的内容不是可读文本，必须整块移除
-	reStyle := regexp.MustCompile(`(?is)<style[^>]*>.*?</style>`)
-	content = reStyle.ReplaceAllString(content, "")
-
-	reScript := regexp.MustCompile(`(?is)<script[^>]*>.*?</script>`)
-	content = reScript.ReplaceAllString(content, "")
-
-	// 1. 预处理：将块级标签替换为换行符，保留基本的段落结构
-	// 把 <br>, <p>, </div> 等替换为换行，防止文字粘连
-	re := regexp.MustCompile(`(?i)<(br|p|/p|/div|/h[1-6])\s*/?>`)
-	content = re.ReplaceAllString(content, "\n")
-
-	// 2. 核心：删除所有 HTML 标签
-	// 匹配 < 符号开始，到 > 符号结束的所有内容
-	reTags := regexp.MustCompile(`<[^>]*>`)
-	content = reTags.ReplaceAllString(content, " ")
-
-	// 3. 处理 HTML 实体字符 (Entity Decoding)
-	replacer := strings.NewReplacer(
-		"&amp;", "&",
-		"&lt;", "<",
-		"&gt;", ">",
-		"&nbsp;", " ",
-		"&quot;", "\"",
-		"&#39;", "'",
-	)
-	content = replacer.Replace(content)
-
-	// 4. 清理空白字符：将多个连续空格压缩为一个，去掉首尾空格
-	// 使用正则表达式 \s+ 匹配所有空白符（空格、制表符等）
-	reSpace := regexp.MustCompile(`\s+`)
-	content = reSpace.ReplaceAllString(content, " ")
-	
-	// 5. 去掉首尾空格并返回
-	return strings.TrimSpace(content)
-}
-
-// parseEmailDate tries multiple date formats commonly used in email headers
-func parseEmailDate(dateStr string) time.Time {
-	// 预处理：去掉末尾可能存在的 (UTC) 或 (PST) 等非标准后缀
-	// 邮件头有时会出现 "Mon, 02 Jan 2006 15:04:05 -0700 (UTC)"
-	dateStr = regexp.MustCompile(`\s\([A-Z]{3}\)$`).ReplaceAllString(dateStr, "")
-
-	formats := []string{
-		time.RFC1123Z,                      // "Mon, 02 Jan 2006 15:04:05 -0700"
-		time.RFC1123,                       // "Mon, 02 Jan 2006 15:04:05 MST"
-		"Mon, 2 Jan 2006 15:04:05 -0700",   // 单位数字日期
-		"02 Jan 2006 15:04:05 -0700",       // 无星期
-		"2 Jan 2006 15:04:05 -0700",        // 无星期且单位数字
-		time.RFC3339,                       // ISO 格式
-		"2006-01-02 15:04:05",              // 简单格式
-	}
-
-	for _, format := range formats {
-		t, err := time.Parse(format, dateStr)
-		if err == nil {
-			return t
-		}
-	}
-
-	// 如果所有格式都失败了，记录原始字符串方便以后 Debug 增加格式
-	// fmt.Printf("⚠️ 无法解析日期字符串: %s\n", dateStr)
-	return time.Time{}
-}
 // parseEmailDateWithFallback uses InternalDate (Unix ms) as reliable fallback
 func parseEmailDateWithFallback(dateStr string, internalDateMs int64) time.Time {
 	// 1. 优先尝试解析 Header 里的 Date 字符串
-	t := parseEmailDate(dateStr)
+	t := mailparse.ParseDate(dateStr)
 
 	// 2. 如果解析失败（返回了零值），或者 Date 字符串本身为空
 	if t.IsZero() {
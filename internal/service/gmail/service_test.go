@@ -0,0 +1,293 @@
+package gmail_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/gmail"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/retry"
+)
+
+// fakeGmail serves users.messages.get. reply decides the response to
+// each call of a message (1 for the first call); nil serves the message.
+type fakeGmail struct {
+	reply func(id string, call int) (status int, reason string, header http.Header)
+
+	mu       sync.Mutex
+	calls    map[string]int
+	inFlight int
+	peak     int
+}
+
+func (f *fakeGmail) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const prefix = "/gmail/v1/users/me/messages/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.NotFound(w, r)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, prefix)
+
+	f.mu.Lock()
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[id]++
+	call := f.calls[id]
+	f.inFlight++
+	f.peak = max(f.peak, f.inFlight)
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+
+	// 让并发的请求有机会重叠
+	time.Sleep(5 * time.Millisecond)
+
+	if f.reply != nil {
+		if status, reason, header := f.reply(id, call); status != 0 {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			writeError(w, status, reason)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":       id,
+		"threadId": "thread-" + id,
+		"payload": map[string]interface{}{
+			"mimeType": "text/plain",
+			"headers":  []map[string]string{{"name": "Subject", "value": "Message " + id}},
+			"body":     map[string]string{"data": base64.URLEncoding.EncodeToString([]byte("Body of " + id))},
+		},
+	})
+}
+
+func (f *fakeGmail) callsOf(id string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[id]
+}
+
+// writeError writes a Google API error body, which googleapi.Error parses
+func writeError(w http.ResponseWriter, status int, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    status,
+			"message": http.StatusText(status),
+			"errors":  []map[string]string{{"reason": reason, "message": reason}},
+		},
+	})
+}
+
+// fastRetry keeps the backoff short so the tests run quickly
+var fastRetry = retry.Policy{MaxAttempts: 4, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+func newService(t *testing.T, fake *fakeGmail, opts ...gmail.Option) *gmail.Service {
+	t.Helper()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	opts = append([]gmail.Option{gmail.WithEndpoint(server.URL + "/"), gmail.WithRetryPolicy(fastRetry)}, opts...)
+	svc, err := gmail.New(context.Background(), server.Client(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func messageIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("m%02d", i)
+	}
+	return ids
+}
+
+func TestFetchMessagesRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		reason    string
+		failures  int // 前几次调用失败
+		wantCalls int
+		wantFail  bool
+	}{
+		{"429", http.StatusTooManyRequests, "rateLimitExceeded", 2, 3, false},
+		{"500", http.StatusInternalServerError, "backendError", 1, 2, false},
+		{"503", http.StatusServiceUnavailable, "backendError", 3, 4, false},
+		{"5xx until attempts run out", http.StatusBadGateway, "backendError", 10, 4, true},
+		{"403 rateLimitExceeded", http.StatusForbidden, "rateLimitExceeded", 2, 3, false},
+		{"403 userRateLimitExceeded", http.StatusForbidden, "userRateLimitExceeded", 1, 2, false},
+		{"plain 403", http.StatusForbidden, "forbidden", 10, 1, true},
+		{"400", http.StatusBadRequest, "invalidArgument", 10, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGmail{reply: func(id string, call int) (int, string, http.Header) {
+				if call <= tt.failures {
+					return tt.status, tt.reason, nil
+				}
+				return 0, "", nil
+			}}
+			svc := newService(t, fake)
+
+			report, err := svc.FetchMessages(context.Background(), []string{"m1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if calls := fake.callsOf("m1"); calls != tt.wantCalls {
+				t.Errorf("messages.get called %d times, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantFail {
+				if len(report.Failed) != 1 || len(report.Emails) != 0 {
+					t.Errorf("report = %d emails, %d failed; want the message reported as failed", len(report.Emails), len(report.Failed))
+				}
+				return
+			}
+			if len(report.Emails) != 1 || report.Emails[0].Subject != "Message m1" {
+				t.Errorf("report = %+v, want message m1", report)
+			}
+		})
+	}
+}
+
+func TestFetchMessagesRetryAfter(t *testing.T) {
+	fake := &fakeGmail{reply: func(id string, call int) (int, string, http.Header) {
+		if call == 1 {
+			return http.StatusTooManyRequests, "rateLimitExceeded", http.Header{"Retry-After": {"1"}}
+		}
+		return 0, "", nil
+	}}
+	svc := newService(t, fake)
+
+	start := time.Now()
+	report, err := svc.FetchMessages(context.Background(), []string{"m1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Emails) != 1 {
+		t.Fatalf("got %d emails, want 1", len(report.Emails))
+	}
+	// 退避只有几毫秒，等够一秒说明用的是 Retry-After
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want the 1s Retry-After", elapsed)
+	}
+}
+
+func TestFetchMessagesConcurrency(t *testing.T) {
+	fake := &fakeGmail{}
+	svc := newService(t, fake, gmail.WithConcurrency(3))
+
+	ids := messageIDs(24)
+	report, err := svc.FetchMessages(context.Background(), ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.peak > 3 {
+		t.Errorf("%d requests in flight, want at most 3", fake.peak)
+	}
+	if fake.peak < 2 {
+		t.Errorf("%d requests in flight, want the workers to run in parallel", fake.peak)
+	}
+	// 并发下载也按请求的顺序返回
+	for i, e := range report.Emails {
+		if e.ID != ids[i] {
+			t.Fatalf("email %d is %s, want %s", i, e.ID, ids[i])
+		}
+	}
+	if len(report.Emails) != len(ids) {
+		t.Errorf("got %d emails, want %d", len(report.Emails), len(ids))
+	}
+}
+
+func TestFetchMessagesQuota(t *testing.T) {
+	fake := &fakeGmail{}
+	// 每秒 100 个配额单位，messages.get 5 个单位一次：桶里的 20 次用完后每秒 20 次
+	svc := newService(t, fake, gmail.WithConcurrency(8), gmail.WithQuota(100))
+
+	start := time.Now()
+	report, err := svc.FetchMessages(context.Background(), messageIDs(30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Emails) != 30 {
+		t.Fatalf("got %d emails, want 30", len(report.Emails))
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("30 calls took %s, want the limiter to hold the last 10 for ~500ms", elapsed)
+	}
+}
+
+func TestFetchMessagesPartialFailure(t *testing.T) {
+	fake := &fakeGmail{reply: func(id string, call int) (int, string, http.Header) {
+		switch id {
+		case "gone":
+			return http.StatusNotFound, "notFound", nil
+		case "bad":
+			return http.StatusBadRequest, "invalidArgument", nil
+		case "flaky":
+			if call == 1 {
+				return http.StatusServiceUnavailable, "backendError", nil
+			}
+		}
+		return 0, "", nil
+	}}
+	svc := newService(t, fake, gmail.WithConcurrency(2))
+
+	report, err := svc.FetchMessages(context.Background(), []string{"a", "gone", "bad", "flaky", "b"})
+	if err != nil {
+		t.Fatalf("FetchMessages = %v, want per-message failures in the report", err)
+	}
+
+	var got []string
+	for _, e := range report.Emails {
+		got = append(got, e.ID)
+	}
+	if strings.Join(got, ",") != "a,flaky,b" {
+		t.Errorf("emails = %v, want [a flaky b]", got)
+	}
+	if len(report.Missing) != 1 || report.Missing[0] != "gone" {
+		t.Errorf("missing = %v, want [gone]", report.Missing)
+	}
+	if len(report.Failed) != 1 || report.Failed[0].Ref != "bad" || report.Failed[0].Err == nil {
+		t.Errorf("failed = %+v, want bad with its error", report.Failed)
+	}
+}
+
+func TestFetchMessagesCancelled(t *testing.T) {
+	var served atomic.Int32
+	ctx, cancel := context.WithCancel(context.Background())
+	fake := &fakeGmail{reply: func(id string, call int) (int, string, http.Header) {
+		if served.Add(1) == 3 {
+			cancel()
+		}
+		return 0, "", nil
+	}}
+	svc := newService(t, fake, gmail.WithConcurrency(1))
+
+	report, err := svc.FetchMessages(ctx, messageIDs(20))
+	if err == nil {
+		t.Fatal("FetchMessages returned no error after cancellation")
+	}
+	if len(report.Failed) != 0 {
+		t.Errorf("cancelled messages reported as failed: %+v", report.Failed)
+	}
+	if len(report.Emails) >= 20 {
+		t.Errorf("got all %d emails, want the fetch to stop", len(report.Emails))
+	}
+}
@@ -2,17 +2,23 @@ package llm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/M1ngdaXie/go-local-rag-email/internal/config"
 	openai "github.com/sashabaranov/go-openai"
 )
 
-// Service wraps OpenAI API for embedding generation
+// Service wraps OpenAI API for embedding generation and chat completions
 type Service struct {
 	client *openai.Client
 	model  openai.EmbeddingModel
+
+	chatModel   string
+	maxTokens   int
+	temperature float32
 }
 
 // New creates a new LLM service
@@ -21,14 +27,107 @@ func New(cfg config.OpenAIConfig) (*Service, error) {
 		return nil, fmt.Errorf("OpenAI API key is required")
 	}
 
-	client := openai.NewClient(cfg.APIKey)
+	clientConfig := openai.DefaultConfig(cfg.APIKey)
+	if cfg.BaseURL != "" {
+		// OpenAI 兼容的服务（本地模型、代理）或测试用的 httptest 服务器
+		clientConfig.BaseURL = cfg.BaseURL
+	}
+	client := openai.NewClientWithConfig(clientConfig)
 
 	return &Service{
-		client: client,
-		model:  openai.EmbeddingModel(cfg.EmbeddingModel), // e.g., "text-embedding-3-small"
+		client:      client,
+		model:       openai.EmbeddingModel(cfg.EmbeddingModel), // e.g., "text-embedding-3-small"
+		chatModel:   cfg.ChatModel,
+		maxTokens:   cfg.MaxTokens,
+		temperature: float32(cfg.Temperature),
 	}, nil
 }
 
+// Model returns the embedding model the vectors are generated with
+func (s *Service) Model() string {
+	return string(s.model)
+}
+
+// ChatModel returns the model answers are generated with
+func (s *Service) ChatModel() string {
+	return s.chatModel
+}
+
+// Chat roles
+const (
+	RoleSystem    = openai.ChatMessageRoleSystem
+	RoleUser      = openai.ChatMessageRoleUser
+	RoleAssistant = openai.ChatMessageRoleAssistant
+)
+
+// Message is one message of a chat conversation
+type Message struct {
+	Role    string
+	Content string
+}
+
+// Chat sends the conversation to the chat model and returns its reply.
+// max_tokens caps the reply, not the prompt.
+func (s *Service) Chat(ctx context.Context, messages []Message) (string, error) {
+	resp, err := s.client.CreateChatCompletion(ctx, s.chatRequest(messages))
+	if err != nil {
+		return "", fmt.Errorf("openai chat api error: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no choices returned from openai")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// ChatStream is Chat with the reply streamed over SSE: onDelta gets each
+// piece of text as it arrives, and the whole reply is returned at the end.
+// When ctx is cancelled or onDelta fails, the stream is closed and the
+// text received so far is returned with the error.
+func (s *Service) ChatStream(ctx context.Context, messages []Message, onDelta func(string) error) (string, error) {
+	stream, err := s.client.CreateChatCompletionStream(ctx, s.chatRequest(messages))
+	if err != nil {
+		return "", fmt.Errorf("openai chat api error: %w", err)
+	}
+	defer stream.Close()
+
+	var reply strings.Builder
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return reply.String(), nil
+		}
+		if err != nil {
+			// Ctrl+C 时返回 ctx 的错误，调用方好区分是中断还是失败
+			if ctx.Err() != nil {
+				return reply.String(), ctx.Err()
+			}
+			return reply.String(), fmt.Errorf("openai chat stream error: %w", err)
+		}
+		if len(resp.Choices) == 0 || resp.Choices[0].Delta.Content == "" {
+			continue
+		}
+		delta := resp.Choices[0].Delta.Content
+		reply.WriteString(delta)
+		if err := onDelta(delta); err != nil {
+			return reply.String(), err
+		}
+	}
+}
+
+// chatRequest builds the completion request of a conversation
+func (s *Service) chatRequest(messages []Message) openai.ChatCompletionRequest {
+	req := openai.ChatCompletionRequest{
+		Model:       s.chatModel,
+		MaxTokens:   s.maxTokens,
+		Temperature: s.temperature,
+		Messages:    make([]openai.ChatCompletionMessage, len(messages)),
+	}
+	for i, m := range messages {
+		req.Messages[i] = openai.ChatCompletionMessage{Role: m.Role, Content: m.Content}
+	}
+	return req
+}
+
 // GenerateEmbedding generates a vector embedding for a single text input
 func (s *Service) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
 	cleanText := strings.TrimSpace(text)
@@ -38,7 +137,7 @@ func (s *Service) GenerateEmbedding(ctx context.Context, text string) ([]float32
 
 	// Step 2: Create request
 	req := openai.EmbeddingRequest{
-		Model: openai.SmallEmbedding3, 
+		Model: s.model,
 		Input: []string{cleanText},
 	}
 
@@ -75,7 +174,7 @@ func (s *Service) GenerateEmbeddings(ctx context.Context, texts []string) ([][]f
 
 	// Step 3: 创建批量请求
 	req := openai.EmbeddingRequest{
-		Model: openai.SmallEmbedding3, // 使用 text-embedding-3-small
+		Model: s.model, // 配置里的 embedding_model，默认 text-embedding-3-small
 		Input: validTexts,             // 直接传入切片
 	}
 
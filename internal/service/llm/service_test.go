@@ -0,0 +1,115 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/config"
+)
+
+// sseServer stands in for the chat completions endpoint: it streams deltas
+// as server-sent events, then blocks until the client goes away if hang is
+// set, or ends the stream with [DONE]
+func sseServer(t *testing.T, deltas []string, hang bool) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		var req struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &req); err != nil || !req.Stream || req.Model != "test-model" {
+			t.Errorf("unexpected request %s", body)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		for _, d := range deltas {
+			content, _ := json.Marshal(d)
+			fmt.Fprintf(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%s}}]}\n\n", content)
+			flusher.Flush()
+		}
+		if hang {
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		flusher.Flush()
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestService(t *testing.T, url string) *Service {
+	t.Helper()
+	svc, err := New(config.OpenAIConfig{APIKey: "test", BaseURL: url, ChatModel: "test-model"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func TestChatStream(t *testing.T) {
+	deltas := []string{"Your flight ", "to Tokyo ", "leaves on ", "March 3 [1]."}
+	svc := newTestService(t, sseServer(t, deltas, false).URL)
+
+	var got []string
+	reply, err := svc.ChatStream(context.Background(), []Message{{Role: RoleUser, Content: "when?"}}, func(d string) error {
+		got = append(got, d)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, deltas) {
+		t.Errorf("deltas = %q, want %q", got, deltas)
+	}
+	if want := strings.Join(deltas, ""); reply != want {
+		t.Errorf("reply = %q, want %q", reply, want)
+	}
+}
+
+func TestChatStreamCancel(t *testing.T) {
+	svc := newTestService(t, sseServer(t, []string{"Partial "}, true).URL)
+
+	// 收到第一段后取消，相当于用户按了 Ctrl+C
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reply, err := svc.ChatStream(ctx, []Message{{Role: RoleUser, Content: "when?"}}, func(string) error {
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if reply != "Partial " {
+		t.Errorf("reply = %q, want the text received before the cancel", reply)
+	}
+}
+
+func TestChatStreamCallbackError(t *testing.T) {
+	svc := newTestService(t, sseServer(t, []string{"a", "b", "c"}, false).URL)
+
+	stop := errors.New("stop")
+	reply, err := svc.ChatStream(context.Background(), nil, func(d string) error {
+		if d == "b" {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || reply != "ab" {
+		t.Errorf("ChatStream = %q, %v; want \"ab\", %v", reply, err, stop)
+	}
+}
@@ -0,0 +1,160 @@
+package mailparse
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// charsetAliases covers labels seen in real mail that neither the WHATWG
+// nor the IANA index recognise
+var charsetAliases = map[string]string{
+	"utf8":              "utf-8",
+	"unicode-1-1-utf-8": "utf-8",
+	"cp936":             "gbk",
+	"x-gbk":             "gbk",
+	"gb_2312-80":        "gb2312",
+	"cp932":             "shift_jis",
+	"ms932":             "shift_jis",
+	"x-sjis":            "shift_jis",
+	"ks_c_5601":         "euc-kr",
+	"cp949":             "euc-kr",
+	"x-mac-roman":       "macintosh",
+	"ansi_x3.4-1968":    "us-ascii",
+	"646":               "us-ascii",
+}
+
+// LookupCharset resolves a MIME charset label to an encoding.
+// It returns nil for UTF-8 and US-ASCII, which need no conversion.
+func LookupCharset(label string) (encoding.Encoding, error) {
+	label = strings.ToLower(strings.Trim(strings.TrimSpace(label), `"'`))
+	if alias, ok := charsetAliases[label]; ok {
+		label = alias
+	}
+
+	switch label {
+	case "", "utf-8", "us-ascii", "ascii":
+		return nil, nil
+	case "gb2312", "euc-cn":
+		// GB2312 声明的邮件里经常混着 GBK 扩展字符，统一按超集 GB18030 解码
+		return simplifiedchinese.GB18030, nil
+	case "iso-8859-1", "latin1", "latin-1":
+		// WHATWG 把 latin1 映射到 windows-1252，这里保持一致：
+		// 0x80-0x9F 在真实邮件里几乎总是 Windows 的弯引号和破折号
+		return charmap.Windows1252, nil
+	}
+
+	if enc, err := htmlindex.Get(label); err == nil {
+		return enc, nil
+	}
+	if enc, err := ianaindex.MIME.Encoding(label); err == nil && enc != nil {
+		return enc, nil
+	}
+	return nil, fmt.Errorf("unsupported charset %q", label)
+}
+
+// DecodeCharset converts text in the given charset to UTF-8.
+// An unknown charset, or bytes that are invalid in the declared one, fall
+// back to sniffing so a wrong label never turns the whole body into U+FFFD.
+func DecodeCharset(data []byte, label string) string {
+	enc, err := LookupCharset(label)
+	if err == nil && enc == nil {
+		if utf8.Valid(data) {
+			return string(data)
+		}
+		// 声明 UTF-8 / 未声明但实际不是 UTF-8，交给嗅探
+		return sniffDecode(data, "text/plain")
+	}
+	if err != nil {
+		return sniffDecode(data, "text/plain")
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return sniffDecode(data, "text/plain")
+	}
+	return string(decoded)
+}
+
+// sniffDecode guesses the encoding of undeclared text (HTML <meta> tags,
+// BOMs, then windows-1252 as the WHATWG default)
+func sniffDecode(data []byte, contentType string) string {
+	enc, _, _ := charset.DetermineEncoding(data, contentType)
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return strings.ToValidUTF8(string(data), "�")
+	}
+	return string(decoded)
+}
+
+// DecodeText converts a decoded MIME part body to UTF-8 using the charset
+// parameter of its Content-Type. HTML parts without a charset are sniffed
+// for a <meta charset> declaration.
+func DecodeText(data []byte, contentType string) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	label := params["charset"]
+	if label == "" && mediaType == "text/html" && !utf8.Valid(data) {
+		return sniffDecode(data, "text/html")
+	}
+
+	text := DecodeCharset(bytes.TrimPrefix(data, utf8BOM), label)
+	if strings.EqualFold(params["format"], "flowed") {
+		text = unflow(text, strings.EqualFold(params["delsp"], "yes"))
+	}
+	return text
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// charsetReader lets mime.WordDecoder handle encoded-words in any charset
+// we can look up, e.g. =?GB2312?B?...?= or =?ISO-2022-JP?B?...?=
+func charsetReader(label string, input io.Reader) (io.Reader, error) {
+	enc, err := LookupCharset(label)
+	if err != nil {
+		return nil, err
+	}
+	if enc == nil {
+		return input, nil
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+// unflow joins the soft line breaks of RFC 3676 format=flowed text
+func unflow(text string, delsp bool) string {
+	lines := strings.Split(text, "\n")
+	var b strings.Builder
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		// 签名分隔符 "-- " 不是软换行
+		soft := strings.HasSuffix(line, " ") && line != "-- " && i < len(lines)-1
+		if strings.HasPrefix(line, " ") {
+			line = line[1:] // space-stuffing
+		}
+		if soft {
+			if delsp {
+				line = strings.TrimSuffix(line, " ")
+			}
+			b.WriteString(line)
+			continue
+		}
+		b.WriteString(line)
+		if i < len(lines)-1 {
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
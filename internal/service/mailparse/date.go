@@ -0,0 +1,41 @@
+package mailparse
+
+import (
+	"net/mail"
+	"regexp"
+	"time"
+)
+
+// ParseDate tries multiple date formats commonly used in email headers.
+// It returns the zero time if none match.
+func ParseDate(dateStr string) time.Time {
+	// 预处理：去掉末尾可能存在的 (UTC) 或 (PST) 等非标准后缀
+	// 邮件头有时会出现 "Mon, 02 Jan 2006 15:04:05 -0700 (UTC)"
+	dateStr = regexp.MustCompile(`\s\([A-Z]{3}\)$`).ReplaceAllString(dateStr, "")
+
+	formats := []string{
+		time.RFC1123Z,                    // "Mon, 02 Jan 2006 15:04:05 -0700"
+		time.RFC1123,                     // "Mon, 02 Jan 2006 15:04:05 MST"
+		"Mon, 2 Jan 2006 15:04:05 -0700", // 单位数字日期
+		"02 Jan 2006 15:04:05 -0700",     // 无星期
+		"2 Jan 2006 15:04:05 -0700",      // 无星期且单位数字
+		time.RFC3339,                     // ISO 格式
+		"2006-01-02 15:04:05",            // 简单格式
+	}
+
+	for _, format := range formats {
+		t, err := time.Parse(format, dateStr)
+		if err == nil {
+			return t
+		}
+	}
+
+	// 兜底：net/mail 能处理注释、两位年份等更宽松的 RFC 5322 写法
+	if t, err := mail.ParseDate(dateStr); err == nil {
+		return t
+	}
+
+	// 如果所有格式都失败了，记录原始字符串方便以后 Debug 增加格式
+	// fmt.Printf("⚠️ 无法解析日期字符串: %s\n", dateStr)
+	return time.Time{}
+}
@@ -0,0 +1,37 @@
+package mailparse_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/mailparse"
+)
+
+func TestParseDate(t *testing.T) {
+	want := time.Date(2006, 1, 2, 22, 4, 5, 0, time.UTC)
+	tests := []struct {
+		date string
+		want time.Time
+	}{
+		{"Mon, 02 Jan 2006 15:04:05 -0700", want},
+		{"Mon, 2 Jan 2006 15:04:05 -0700", want},
+		{"02 Jan 2006 15:04:05 -0700", want},
+		{"2 Jan 2006 15:04:05 -0700", want},
+		// 时区注释：三个字母的先被去掉，其余的交给 net/mail
+		{"Mon, 02 Jan 2006 15:04:05 -0700 (PDT)", want},
+		{"Mon, 02 Jan 2006 22:04:05 +0000 (GMT Standard Time)", want},
+		{"Mon, 02 Jan 2006 22:04:05 GMT", want},
+		// 两位年份、省略秒
+		{"Mon, 2 Jan 06 15:04:05 -0700", want},
+		{"Mon, 2 Jan 2006 15:04 -0700", want.Add(-5 * time.Second)},
+		{"2006-01-02T22:04:05Z", want},
+		{"2006-01-02 22:04:05", want},
+		{"yesterday", time.Time{}},
+		{"", time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := mailparse.ParseDate(tt.date); !got.Equal(tt.want) {
+			t.Errorf("ParseDate(%q) = %v, want %v", tt.date, got, tt.want)
+		}
+	}
+}
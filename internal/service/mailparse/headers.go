@@ -0,0 +1,98 @@
+package mailparse
+
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+)
+
+// HeaderGetter returns the first value of a header, or "" if absent.
+// textproto.MIMEHeader.Get and mail.Header.Get both satisfy it.
+type HeaderGetter func(key string) string
+
+var addressParser = &mail.AddressParser{WordDecoder: wordDecoder}
+
+// ApplyHeaders fills the addressing, threading and mailing-list fields of
+// email from the message headers
+func ApplyHeaders(email *domain.Email, get HeaderGetter) {
+	_ = email.SetToList(ParseAddressList(get("To")))
+	_ = email.SetCcList(ParseAddressList(get("Cc")))
+	_ = email.SetBccList(ParseAddressList(get("Bcc")))
+	_ = email.SetReplyToList(ParseAddressList(get("Reply-To")))
+
+	email.MessageID = NormalizeMessageID(get("Message-Id"))
+	if ids := ParseMessageIDs(get("In-Reply-To")); len(ids) > 0 {
+		// In-Reply-To 理论上只有一个，个别客户端会写多个，取最后一个
+		email.InReplyTo = ids[len(ids)-1]
+	}
+	_ = email.SetReferences(ParseMessageIDs(get("References")))
+	email.ListID = ParseListID(get("List-Id"))
+}
+
+// ParseAddressList parses an address header into name/address pairs.
+// Malformed entries are kept as-is in Address rather than dropped.
+func ParseAddressList(value string) []domain.Address {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	if list, err := addressParser.ParseList(value); err == nil {
+		return toAddresses(list)
+	}
+
+	// 整体解析失败时（比如某个地址不合规范），逐个解析，尽量保留信息
+	var out []domain.Address
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if a, err := addressParser.Parse(part); err == nil {
+			out = append(out, toAddresses([]*mail.Address{a})...)
+		} else {
+			out = append(out, domain.Address{Address: DecodeHeader(part)})
+		}
+	}
+	return out
+}
+
+func toAddresses(list []*mail.Address) []domain.Address {
+	out := make([]domain.Address, 0, len(list))
+	for _, a := range list {
+		out = append(out, domain.Address{
+			Name:    strings.TrimSpace(a.Name),
+			Address: strings.ToLower(a.Address),
+		})
+	}
+	return out
+}
+
+var msgIDPattern = regexp.MustCompile(`<([^<>\s]+)>`)
+
+// ParseMessageIDs extracts the message IDs of a References or In-Reply-To
+// header, tolerating missing whitespace between them
+func ParseMessageIDs(value string) []string {
+	matches := msgIDPattern.FindAllStringSubmatch(value, -1)
+	if len(matches) == 0 {
+		// 没有尖括号的写法：按空白切分
+		return strings.Fields(value)
+	}
+	ids := make([]string, 0, len(matches))
+	for _, m := range matches {
+		ids = append(ids, m[1])
+	}
+	return ids
+}
+
+// ParseListID returns the identifier inside the angle brackets of a
+// List-Id header ("Team <team.example.com>" -> "team.example.com")
+func ParseListID(value string) string {
+	value = strings.TrimSpace(value)
+	if m := msgIDPattern.FindStringSubmatch(value); m != nil {
+		return strings.ToLower(m[1])
+	}
+	return strings.ToLower(value)
+}
@@ -0,0 +1,477 @@
+package mailparse
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// HTMLToText converts an HTML body into readable plain text for RAG processing.
+//
+// Paragraphs, headings, list items and table rows stay on their own lines,
+// links are rendered as "text (url)", blockquotes are prefixed with "> ",
+// and content a mail client would never show (scripts, styles, display:none
+// blocks, preheaders, tracking pixels) is dropped. Entities are decoded by
+// the tokenizer.
+func HTMLToText(input string) string {
+	c := &htmlConverter{}
+	z := html.NewTokenizer(strings.NewReader(input))
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			// io.EOF 或者无法恢复的错误，都按已解析的内容输出
+			return c.result()
+
+		case html.TextToken:
+			if c.hidden == 0 {
+				c.text(string(z.Text()))
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			attrs := readAttrs(z, hasAttr)
+			void := tt == html.SelfClosingTagToken || voidElements[tag]
+
+			if c.hidden > 0 || isHiddenElement(tag, attrs) {
+				if !void {
+					c.hidden++
+					c.push(tag, true)
+				}
+				continue
+			}
+			c.start(tag, attrs)
+			if !void {
+				c.push(tag, false)
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			c.pop(string(name))
+		}
+	}
+}
+
+// voidElements never have an end tag
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+// blockElements start and end on their own line
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "center": true,
+	"dd": true, "div": true, "dl": true, "dt": true, "fieldset": true,
+	"figcaption": true, "figure": true, "footer": true, "form": true,
+	"header": true, "main": true, "nav": true, "section": true,
+	"table": true, "tbody": true, "thead": true, "tfoot": true, "caption": true,
+}
+
+// paragraphElements are separated from their neighbours by a blank line
+var paragraphElements = map[string]bool{
+	"p": true, "blockquote": true, "pre": true, "ul": true, "ol": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// skippedElements never contain readable text
+var skippedElements = map[string]bool{
+	"head": true, "script": true, "style": true, "title": true, "template": true,
+	"noscript": true, "svg": true, "object": true, "iframe": true, "select": true,
+}
+
+type openElement struct {
+	tag    string
+	hidden bool
+}
+
+type listState struct {
+	ordered bool
+	index   int
+}
+
+type linkState struct {
+	href  string
+	start int // output length when the <a> was opened
+}
+
+// htmlConverter accumulates text while walking the token stream
+type htmlConverter struct {
+	out strings.Builder
+
+	stack  []openElement
+	hidden int // >0 while inside an element that is not rendered
+
+	lists []listState
+	link  *linkState
+	quote int // blockquote depth
+	pre   int
+
+	pendingBreaks int  // newlines owed before the next text
+	breakQuote    int  // blockquote depth when the first owed newline was requested
+	pendingSpace  bool // a collapsed whitespace run is owed before the next text
+	pendingCell   bool // a " | " cell separator is owed before the next text
+	rowHasText    bool
+	lineStart     bool
+}
+
+func (c *htmlConverter) push(tag string, hidden bool) {
+	c.stack = append(c.stack, openElement{tag: tag, hidden: hidden})
+}
+
+// pop closes the innermost open element named tag, implicitly closing any
+// unclosed elements nested inside it. Stray end tags are ignored.
+func (c *htmlConverter) pop(tag string) {
+	i := len(c.stack) - 1
+	for ; i >= 0; i-- {
+		if c.stack[i].tag == tag {
+			break
+		}
+	}
+	if i < 0 {
+		return
+	}
+	for j := len(c.stack) - 1; j >= i; j-- {
+		el := c.stack[j]
+		if el.hidden {
+			c.hidden--
+		} else {
+			c.end(el.tag)
+		}
+	}
+	c.stack = c.stack[:i]
+}
+
+// start handles an opening tag of a rendered element
+func (c *htmlConverter) start(tag string, attrs map[string]string) {
+	switch {
+	case tag == "br":
+		c.breakLine(1)
+	case tag == "hr":
+		c.breakLine(2)
+		c.write("---")
+		c.breakLine(2)
+	case tag == "img":
+		// 链接里的图片（按钮、logo）用 alt 充当链接文字
+		if c.link != nil && !isTrackingPixel(attrs) {
+			c.text(attrs["alt"])
+		}
+	case tag == "a":
+		c.link = &linkState{href: strings.TrimSpace(attrs["href"]), start: c.out.Len()}
+	case tag == "ul" || tag == "ol":
+		c.breakLine(listBreak(len(c.lists)))
+		c.lists = append(c.lists, listState{ordered: tag == "ol", index: startIndex(attrs)})
+	case tag == "li":
+		c.breakLine(1)
+		c.listMarker()
+	case tag == "tr":
+		c.breakLine(1)
+		c.rowHasText = false
+	case tag == "td" || tag == "th":
+		if c.rowHasText {
+			c.pendingCell = true
+		}
+	case tag == "blockquote":
+		c.breakLine(2)
+		c.quote++
+	case tag == "pre":
+		c.breakLine(2)
+		c.pre++
+	case isHeading(tag):
+		c.breakLine(2)
+		c.write(strings.Repeat("#", int(tag[1]-'0')) + " ")
+	case paragraphElements[tag]:
+		c.breakLine(2)
+	case blockElements[tag]:
+		c.breakLine(1)
+	}
+}
+
+// end handles a closing tag of a rendered element
+func (c *htmlConverter) end(tag string) {
+	switch {
+	case tag == "a":
+		c.closeLink()
+	case tag == "ul" || tag == "ol":
+		if len(c.lists) > 0 {
+			c.lists = c.lists[:len(c.lists)-1]
+		}
+		c.breakLine(listBreak(len(c.lists)))
+	case tag == "li" || tag == "tr":
+		c.breakLine(1)
+	case tag == "blockquote":
+		c.breakLine(2)
+		if c.quote > 0 {
+			c.quote--
+		}
+	case tag == "pre":
+		if c.pre > 0 {
+			c.pre--
+		}
+		c.breakLine(2)
+	case paragraphElements[tag]:
+		c.breakLine(2)
+	case blockElements[tag]:
+		c.breakLine(1)
+	}
+}
+
+// closeLink appends the link target unless it adds nothing to the text
+func (c *htmlConverter) closeLink() {
+	link := c.link
+	c.link = nil
+	if link == nil || !isReadableURL(link.href) {
+		return
+	}
+
+	label := strings.TrimSpace(c.out.String()[link.start:])
+	target := strings.TrimPrefix(link.href, "mailto:")
+	if label == "" || label == target || label == link.href {
+		if label == "" {
+			c.text(target)
+		}
+		return
+	}
+	c.pendingSpace = true
+	c.text("(" + target + ")")
+}
+
+// text appends a run of character data, collapsing whitespace outside <pre>
+func (c *htmlConverter) text(s string) {
+	s = invisibleChars.Replace(s)
+	if c.pre > 0 {
+		lines := strings.Split(s, "\n")
+		for i, line := range lines {
+			if i > 0 {
+				c.breakLine(1)
+			}
+			if line != "" {
+				c.write(line)
+			}
+		}
+		return
+	}
+
+	if s != "" && isSpace(s[0]) {
+		c.pendingSpace = true
+	}
+	words := strings.Fields(s)
+	for i, w := range words {
+		if i > 0 {
+			c.pendingSpace = true
+		}
+		c.write(w)
+	}
+	if len(words) > 0 && isSpace(s[len(s)-1]) {
+		c.pendingSpace = true
+	}
+}
+
+// write emits s after flushing any owed line breaks, separators and spaces
+func (c *htmlConverter) write(s string) {
+	if c.pendingBreaks > 0 && c.out.Len() > 0 {
+		// 引用块内部的空行也带上 ">"，保持引用段落连续
+		blank := "\n"
+		if depth := min(c.quote, c.breakQuote); depth > 0 {
+			blank = "\n" + strings.TrimSpace(strings.Repeat("> ", depth))
+		}
+		c.out.WriteString(strings.Repeat(blank, c.pendingBreaks-1) + "\n")
+		c.lineStart = true
+	}
+	if c.out.Len() == 0 {
+		c.lineStart = true
+	}
+	c.pendingBreaks = 0
+
+	if c.lineStart {
+		if c.quote > 0 {
+			c.out.WriteString(strings.Repeat("> ", c.quote))
+		}
+		c.lineStart = false
+		c.pendingSpace = false
+	}
+	if c.pendingCell {
+		c.out.WriteString(" | ")
+		c.pendingCell = false
+		c.pendingSpace = false
+	}
+	if c.pendingSpace && !strings.HasSuffix(c.out.String(), " ") {
+		c.out.WriteByte(' ')
+		c.pendingSpace = false
+	}
+
+	c.out.WriteString(s)
+	c.rowHasText = true
+}
+
+// breakLine requests at least n newlines before the next text
+func (c *htmlConverter) breakLine(n int) {
+	if c.pendingBreaks == 0 {
+		c.breakQuote = c.quote
+	}
+	if n > c.pendingBreaks {
+		c.pendingBreaks = n
+	}
+	c.pendingSpace = false
+	c.pendingCell = false
+}
+
+func (c *htmlConverter) listMarker() {
+	if len(c.lists) == 0 {
+		c.write("- ")
+		return
+	}
+	l := &c.lists[len(c.lists)-1]
+	indent := strings.Repeat("  ", len(c.lists)-1)
+	if l.ordered {
+		c.write(indent + strconv.Itoa(l.index) + ". ")
+		l.index++
+	} else {
+		c.write(indent + "- ")
+	}
+	// 标记后面的文字不再额外补空格
+	c.pendingSpace = false
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// result trims trailing whitespace from every line and squeezes blank lines
+func (c *htmlConverter) result() string {
+	lines := strings.Split(c.out.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	text := blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
+
+func readAttrs(z *html.Tokenizer, hasAttr bool) map[string]string {
+	attrs := make(map[string]string)
+	for hasAttr {
+		var key, val []byte
+		key, val, hasAttr = z.TagAttr()
+		attrs[string(key)] = string(val)
+	}
+	return attrs
+}
+
+// isHiddenElement reports whether an element and everything inside it is
+// invisible in a mail client
+func isHiddenElement(tag string, attrs map[string]string) bool {
+	if skippedElements[tag] {
+		return true
+	}
+	if _, ok := attrs["hidden"]; ok {
+		return true
+	}
+	if tag == "img" && isTrackingPixel(attrs) {
+		return true
+	}
+	// 营销邮件的 preheader：只在收件箱预览里显示的一行摘要
+	for _, class := range strings.Fields(strings.ToLower(attrs["class"])) {
+		if strings.Contains(class, "preheader") {
+			return true
+		}
+	}
+
+	style := parseStyle(attrs["style"])
+	switch {
+	case style["display"] == "none",
+		style["visibility"] == "hidden",
+		style["mso-hide"] == "all",
+		isZero(style["opacity"]),
+		isZero(style["font-size"]),
+		isZero(style["max-height"]) && style["overflow"] == "hidden":
+		return true
+	}
+	return false
+}
+
+// isTrackingPixel matches the 1x1 (or 0x0) images used for open tracking
+func isTrackingPixel(attrs map[string]string) bool {
+	style := parseStyle(attrs["style"])
+	tiny := func(attr, prop string) bool {
+		if v, ok := attrs[attr]; ok {
+			if n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(v), "px")); err == nil && n <= 1 {
+				return true
+			}
+		}
+		if v, ok := style[prop]; ok {
+			if n, err := strconv.Atoi(strings.TrimSuffix(v, "px")); err == nil && n <= 1 {
+				return true
+			}
+		}
+		return false
+	}
+	return tiny("width", "width") || tiny("height", "height")
+}
+
+// parseStyle splits an inline style attribute into lower-cased declarations
+func parseStyle(style string) map[string]string {
+	decls := make(map[string]string)
+	for _, decl := range strings.Split(style, ";") {
+		key, val, ok := strings.Cut(decl, ":")
+		if !ok {
+			continue
+		}
+		val = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(val), "!important"))
+		decls[strings.ToLower(strings.TrimSpace(key))] = strings.ToLower(val)
+	}
+	return decls
+}
+
+func isZero(v string) bool {
+	switch strings.TrimSpace(v) {
+	case "0", "0px", "0pt", "0em", "0%", "0.0":
+		return true
+	}
+	return false
+}
+
+// isReadableURL filters out hrefs that would only add noise to the text
+func isReadableURL(href string) bool {
+	lower := strings.ToLower(href)
+	return strings.HasPrefix(lower, "http://") ||
+		strings.HasPrefix(lower, "https://") ||
+		strings.HasPrefix(lower, "mailto:")
+}
+
+func isHeading(tag string) bool {
+	return len(tag) == 2 && tag[0] == 'h' && tag[1] >= '1' && tag[1] <= '6'
+}
+
+// listBreak keeps nested lists tight and separates top-level lists
+func listBreak(depth int) int {
+	if depth > 0 {
+		return 1
+	}
+	return 2
+}
+
+func startIndex(attrs map[string]string) int {
+	if n, err := strconv.Atoi(attrs["start"]); err == nil {
+		return n
+	}
+	return 1
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
+
+// invisibleChars strips the zero-width padding newsletters put after the
+// preheader, and turns non-breaking spaces into ordinary ones
+var invisibleChars = strings.NewReplacer(
+	"\u00a0", " ", // no-break space
+	"\u200b", "", // zero width space
+	"\u200c", "", // zero width non-joiner (&zwnj;)
+	"\u200d", "", // zero width joiner
+	"\u2060", "", // word joiner
+	"\ufeff", "", // byte order mark
+	"\u034f", "", // combining grapheme joiner (&#847;)
+	"\u00ad", "", // soft hyphen
+)
@@ -0,0 +1,74 @@
+package mailparse_test
+
+import (
+	"testing"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/mailparse"
+)
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "script, style and head are dropped",
+			html: `<html><head><title>Newsletter</title><style>p { color: red }</style></head>` +
+				`<body><script>var x = "<p>not text</p>";</script><p>Hello</p><noscript>Enable JS</noscript></body></html>`,
+			want: "Hello",
+		},
+		{
+			name: "hidden content is dropped",
+			html: `<div class="preheader">Preview line</div><p style="display: none !important">Hidden</p>` +
+				`<p hidden>Also hidden</p><p>Visible<img src="https://t.example.com/o.gif" width="1" height="1"></p>`,
+			want: "Visible",
+		},
+		{
+			name: "paragraphs, headings and line breaks",
+			html: `<h1>Agenda</h1><p>First line<br>second line</p><div>Block</div><div>Next block</div><hr><p>After</p>`,
+			want: "# Agenda\n\nFirst line\nsecond line\n\nBlock\nNext block\n\n---\n\nAfter",
+		},
+		{
+			name: "whitespace collapses outside pre",
+			html: "<p>  lots   of\n\tspace  </p><pre>keep\n  this</pre>",
+			want: "lots of space\n\nkeep\n  this",
+		},
+		{
+			name: "entities",
+			html: `<p>Tom &amp; Jerry &lt;3 caf&eacute; &#8364;5&nbsp;each &quot;now&quot;&#8203;</p>`,
+			want: `Tom & Jerry <3 café €5 each "now"`,
+		},
+		{
+			name: "unordered and ordered lists",
+			html: `<p>Todo:</p><ul><li>Milk</li><li>Eggs<ul><li>Brown</li></ul></li></ul><ol start="3"><li>Third</li><li>Fourth</li></ol>`,
+			want: "Todo:\n\n- Milk\n- Eggs\n  - Brown\n\n3. Third\n4. Fourth",
+		},
+		{
+			name: "links",
+			html: `<p><a href="https://example.com/report">Read the report</a>, ` +
+				`<a href="https://example.com">https://example.com</a>, ` +
+				`<a href="mailto:bob@example.com">bob@example.com</a>, ` +
+				`<a href="javascript:void(0)">click</a> and <a href="https://example.com/x"><img alt="Logo" src="logo.png"></a></p>`,
+			want: "Read the report (https://example.com/report), https://example.com, bob@example.com, click and Logo (https://example.com/x)",
+		},
+		{
+			name: "tables and blockquotes",
+			html: `<table><tr><th>Item</th><th>Cost</th></tr><tr><td>Taxi</td><td>12</td></tr></table>` +
+				`<blockquote><p>Quoted</p><p>Reply</p></blockquote>`,
+			want: "Item | Cost\nTaxi | 12\n\n> Quoted\n>\n> Reply",
+		},
+		{
+			name: "unclosed tags",
+			html: `<p>One<p>Two<div>Three`,
+			want: "One\n\nTwo\nThree",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mailparse.HTMLToText(tt.html); got != tt.want {
+				t.Errorf("HTMLToText()\n got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
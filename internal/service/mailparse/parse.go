@@ -0,0 +1,309 @@
+package mailparse
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+)
+
+// maxPartSize caps how much of a single MIME part is read into memory
+const maxPartSize = 16 << 20
+
+// maxAttachmentSize caps how much of an attachment is kept in memory;
+// larger files are recorded without content
+const maxAttachmentSize = 32 << 20
+
+// maxDepth stops pathological multipart nesting
+const maxDepth = 16
+
+// snippetLen matches the length of Gmail's snippets
+const snippetLen = 200
+
+// Parse converts a raw RFC 5322 message into a domain.Email.
+// Multipart bodies are walked to find text/plain (preferred) or text/html,
+// and RFC 2047 encoded-word headers are decoded.
+func Parse(raw []byte) (*domain.Email, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("read message: %w", err)
+	}
+	header := textproto.MIMEHeader(msg.Header)
+
+	messageID := NormalizeMessageID(header.Get("Message-Id"))
+
+	email := &domain.Email{
+		ID:      StableID(messageID, raw),
+		Subject: DecodeHeader(header.Get("Subject")),
+		From:    DecodeHeader(header.Get("From")),
+		Date:    ParseDate(header.Get("Date")),
+	}
+	ApplyHeaders(email, header.Get)
+
+	// Google Takeout 导出的 mbox 带有 Gmail 的会话 ID 和标签
+	if thrid := header.Get("X-Gm-Thrid"); thrid != "" {
+		email.ThreadID = thrid
+	} else {
+		email.ThreadID = email.ID
+	}
+	if labels := header.Get("X-Gmail-Labels"); labels != "" {
+		_ = email.SetLabels(splitList(DecodeHeader(labels)))
+	}
+
+	var body bodyParts
+	if err := walk(header, msg.Body, &body, 0, ""); err != nil {
+		return nil, fmt.Errorf("parse body: %w", err)
+	}
+	email.BodyText = body.text()
+	email.Snippet = Snippet(email.BodyText)
+
+	for i := range body.attachments {
+		body.attachments[i].EmailID = email.ID
+		body.attachments[i].ID = AttachmentID(email.ID, body.attachments[i].PartID)
+	}
+	email.SetAttachments(body.attachments)
+
+	return email, nil
+}
+
+// bodyParts collects the first text/plain and text/html parts found,
+// plus every attachment
+type bodyParts struct {
+	plain       string
+	html        string
+	attachments []domain.Attachment
+}
+
+func (b *bodyParts) text() string {
+	if strings.TrimSpace(b.plain) != "" {
+		return strings.TrimSpace(b.plain)
+	}
+	if b.html != "" {
+		return HTMLToText(b.html)
+	}
+	return ""
+}
+
+// walk descends into a MIME entity and records its text content.
+// partID follows IMAP numbering ("1", "2.1", ...) and is empty for the
+// top-level entity.
+func walk(header textproto.MIMEHeader, body io.Reader, out *bodyParts, depth int, partID string) error {
+	if depth > maxDepth {
+		return fmt.Errorf("multipart nesting exceeds %d levels", maxDepth)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		// 缺失或损坏的 Content-Type 按 RFC 2045 默认为 text/plain
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		boundary := params["boundary"]
+		if boundary == "" {
+			return fmt.Errorf("%s without boundary", mediaType)
+		}
+		mr := multipart.NewReader(body, boundary)
+		for n := 1; ; n++ {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			childID := strconv.Itoa(n)
+			if partID != "" {
+				childID = partID + "." + childID
+			}
+			if err := walk(part.Header, part, out, depth+1, childID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if partID == "" {
+		partID = "1"
+	}
+	if filename := AttachmentFilename(header); isAttachment(header) || filename != "" && !isBodyType(mediaType) {
+		return readAttachment(header, body, mediaType, filename, partID, out)
+	}
+
+	switch mediaType {
+	case "text/plain", "text/html":
+	default:
+		return nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(decodeTransfer(header, body), maxPartSize))
+	if err != nil {
+		return fmt.Errorf("decode %s part: %w", mediaType, err)
+	}
+
+	if mediaType == "text/plain" && out.plain == "" {
+		out.plain = DecodeText(data, header.Get("Content-Type"))
+	}
+	if mediaType == "text/html" && out.html == "" {
+		out.html = DecodeText(data, header.Get("Content-Type"))
+	}
+	return nil
+}
+
+// decodeTransfer undoes the Content-Transfer-Encoding of a part
+func decodeTransfer(header textproto.MIMEHeader, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		// 只保留 base64 字母表里的字符，容忍换行、空格和截断的填充
+		return base64.NewDecoder(base64.RawStdEncoding, &base64Filter{r: body})
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+// readAttachment records an attachment part together with its decoded content
+func readAttachment(header textproto.MIMEHeader, body io.Reader, mediaType, filename, partID string, out *bodyParts) error {
+	data, err := io.ReadAll(io.LimitReader(decodeTransfer(header, body), maxAttachmentSize+1))
+	if err != nil {
+		return fmt.Errorf("decode attachment %q: %w", filename, err)
+	}
+
+	disposition, _, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	att := domain.Attachment{
+		PartID:   partID,
+		Filename: filename,
+		MimeType: mediaType,
+		Size:     int64(len(data)),
+		Inline:   disposition == "inline",
+	}
+	if len(data) <= maxAttachmentSize {
+		att.Data = data
+	}
+	out.attachments = append(out.attachments, att)
+	return nil
+}
+
+// AttachmentFilename returns the decoded file name of a part from
+// Content-Disposition (RFC 2231 aware) or the legacy Content-Type name
+func AttachmentFilename(header textproto.MIMEHeader) string {
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		return DecodeHeader(params["filename"])
+	}
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Type")); err == nil && params["name"] != "" {
+		return DecodeHeader(params["name"])
+	}
+	return ""
+}
+
+// AttachmentID builds the attachment primary key from its email and part
+func AttachmentID(emailID, partID string) string {
+	return emailID + "/" + partID
+}
+
+func isBodyType(mediaType string) bool {
+	return mediaType == "text/plain" || mediaType == "text/html"
+}
+
+// isAttachment reports whether a part is an attachment rather than body text
+func isAttachment(header textproto.MIMEHeader) bool {
+	disposition, params, err := mime.ParseMediaType(header.Get("Content-Disposition"))
+	if err != nil {
+		return false
+	}
+	return disposition == "attachment" || (disposition == "inline" && params["filename"] != "")
+}
+
+// base64Filter drops everything outside the base64 alphabet, including
+// '=' padding, so it can feed a RawStdEncoding decoder
+type base64Filter struct {
+	r io.Reader
+}
+
+func (f *base64Filter) Read(p []byte) (int, error) {
+	for {
+		n, err := f.r.Read(p)
+		kept := 0
+		for _, c := range p[:n] {
+			if isBase64Char(c) {
+				p[kept] = c
+				kept++
+			}
+		}
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+func isBase64Char(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '+' || c == '/'
+}
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// DecodeHeader decodes RFC 2047 encoded-words ("=?GB2312?B?...?=") in any
+// supported charset. Raw 8-bit headers that are not UTF-8 are sniffed;
+// undecodable values are returned unchanged.
+func DecodeHeader(value string) string {
+	if !utf8.ValidString(value) {
+		value = sniffDecode([]byte(value), "text/plain")
+	}
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return strings.TrimSpace(value)
+	}
+	return strings.TrimSpace(decoded)
+}
+
+// NormalizeMessageID strips angle brackets and whitespace from a Message-ID
+func NormalizeMessageID(id string) string {
+	id = strings.TrimSpace(id)
+	id = strings.TrimPrefix(id, "<")
+	id = strings.TrimSuffix(id, ">")
+	return strings.TrimSpace(id)
+}
+
+// StableID derives a deterministic email ID from the Message-ID, so the same
+// message imported twice (or from two archives) maps to the same row.
+// Messages without a Message-ID fall back to a hash of their raw bytes.
+func StableID(messageID string, raw []byte) string {
+	var sum [32]byte
+	if messageID != "" {
+		sum = sha256.Sum256([]byte(messageID))
+	} else {
+		sum = sha256.Sum256(raw)
+	}
+	return "msg-" + hex.EncodeToString(sum[:12])
+}
+
+// Snippet returns the first ~200 characters of text on a single line
+func Snippet(text string) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) <= snippetLen {
+		return string(runes)
+	}
+	return string(runes[:snippetLen])
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,79 @@
+package mailparse_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/mailparse"
+)
+
+const fixtureDir = "../../../test/fixtures/mime"
+
+// fixture is one entry of expected.json; test-parser --fixtures reads the
+// same file
+type fixture struct {
+	File         string `json:"file"`
+	Subject      string `json:"subject"`
+	FromContains string `json:"from_contains"`
+	BodyContains string `json:"body_contains"`
+}
+
+func TestParseFixtures(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join(fixtureDir, "expected.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fixtures []fixture
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		t.Fatal(err)
+	}
+
+	// 新加的 .eml 忘了写期望值时也要报出来
+	files, err := filepath.Glob(filepath.Join(fixtureDir, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed := make(map[string]bool, len(fixtures))
+	for _, f := range fixtures {
+		listed[f.File] = true
+	}
+	for _, file := range files {
+		if !listed[filepath.Base(file)] {
+			t.Errorf("%s has no entry in expected.json", filepath.Base(file))
+		}
+	}
+
+	for _, f := range fixtures {
+		t.Run(f.File, func(t *testing.T) {
+			raw, err := os.ReadFile(filepath.Join(fixtureDir, f.File))
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := mailparse.Parse(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if parsed.Subject != f.Subject {
+				t.Errorf("subject = %q, want %q", parsed.Subject, f.Subject)
+			}
+			if !strings.Contains(parsed.From, f.FromContains) {
+				t.Errorf("from = %q, want it to contain %q", parsed.From, f.FromContains)
+			}
+			if parsed.From == "" {
+				t.Error("from is empty")
+			}
+			if !strings.Contains(parsed.BodyText, f.BodyContains) {
+				t.Errorf("body does not contain %q:\n%s", f.BodyContains, parsed.BodyText)
+			}
+			if strings.ContainsRune(parsed.Subject, utf8.RuneError) || strings.ContainsRune(parsed.From, utf8.RuneError) ||
+				strings.ContainsRune(parsed.BodyText, utf8.RuneError) {
+				t.Error("output contains U+FFFD replacement characters")
+			}
+		})
+	}
+}
@@ -0,0 +1,373 @@
+package mailparse
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SegmentKind classifies a run of lines in an email body
+type SegmentKind string
+
+const (
+	// SegmentBody is text the sender wrote for this message
+	SegmentBody SegmentKind = "body"
+	// SegmentQuoted is earlier correspondence: "> " quotes, the history
+	// below an "On ... wrote:" or Outlook header, forwarded messages
+	SegmentQuoted SegmentKind = "quoted"
+	// SegmentSignature covers signatures, "Sent from my iPhone" footers
+	// and legal disclaimers
+	SegmentSignature SegmentKind = "signature"
+)
+
+// Segment is a contiguous part of a body with a single kind
+type Segment struct {
+	Kind SegmentKind
+	Text string
+}
+
+// maxSignatureLines bounds how many lines after a closing ("Best regards,")
+// are treated as the sender's signature block
+const maxSignatureLines = 6
+
+var (
+	// attribution lines that introduce a quoted reply
+	attributionPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)^on\b.{4,300}\b(wrote|writes)\s*:\s*$`),
+		regexp.MustCompile(`(?i)^le\b.{4,300}\ba écrit\s*:\s*$`),
+		regexp.MustCompile(`(?i)^am\b.{4,300}\bschrieb.{0,120}:\s*$`),
+		regexp.MustCompile(`(?i)^el\b.{4,300}\bescribió\s*:\s*$`),
+		regexp.MustCompile(`(?i)^il\b.{4,300}\bha scritto\s*:\s*$`),
+		regexp.MustCompile(`(?i)^op\b.{4,300}\bschreef.{0,120}:\s*$`),
+		regexp.MustCompile(`^.{0,300}(写道|寫道|のメッセージ)\s*[:：]?\s*$`),
+		regexp.MustCompile(`(?i)^.{1,200}<[^<>\s]+@[^<>\s]+>\s*wrote\s*:\s*$`),
+	}
+
+	// markers after which the rest of the body is a forwarded or original message
+	separatorPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)^-{2,}\s*(forwarded message|original message|weitergeleitete nachricht|ursprüngliche nachricht|message transféré|message d'origine)\s*-{2,}$`),
+		regexp.MustCompile(`(?i)^begin forwarded message\s*:?$`),
+		regexp.MustCompile(`^-{2,}\s*(转发的邮件|轉寄的郵件|原始邮件|原始郵件|原始信件)\s*-{2,}$`),
+	}
+
+	// Outlook-style header blocks ("From: ... Sent: ... To: ... Subject: ...")
+	outlookFrom    = regexp.MustCompile(`(?i)^\*?(from|von|de|发件人|寄件者|差出人)\s*\*?\s*[:：]`)
+	outlookSent    = regexp.MustCompile(`(?i)^\*?(sent|date|gesendet|envoyé|enviado|发送时间|日期|寄件日期|送信日時)\s*\*?\s*[:：]`)
+	outlookSubject = regexp.MustCompile(`(?i)^\*?(to|subject|an|betreff|à|objet|收件人|主题|主旨|件名)\s*\*?\s*[:：]`)
+	underscoreRule = regexp.MustCompile(`^_{10,}$`)
+
+	// footers added by mobile clients
+	mobileFooter = regexp.MustCompile(`(?i)^(sent from my \w+|sent from (outlook|mail) for \w+|get outlook for \w+|sent from yahoo mail|发自我的\s*\w+|从我的\s*\w+\s*发送|iPhoneから送信)`)
+
+	// legal disclaimers, matched anywhere in a paragraph
+	disclaimerPattern = regexp.MustCompile(`(?i)(confidentiality notice|this (e-?mail|message)( and any (files|attachments))? (is|are|may be) (confidential|intended solely|privileged)|if you are not the intended recipient|disclaimer\s*:|本邮件(及其附件)?(含有|包含|可能包含).{0,20}(保密|机密)|此邮件.{0,20}(保密|机密))`)
+
+	// closings that usually precede the sender's name and contact details
+	closingPattern = regexp.MustCompile(`(?i)^(best|best regards|kind regards|warm regards|regards|many thanks|thanks|thank you|cheers|sincerely|yours|br|谢谢|多谢|此致|祝好|顺祝商祺|よろしくお願いします)[,.!，。！]?\s*$`)
+)
+
+// SegmentText splits a plain-text body into new content, quoted history
+// and signatures. Adjacent lines of the same kind are merged.
+// If nothing is left as body (e.g. a bare forward), quoted segments are
+// promoted to body so the message still has indexable content.
+func SegmentText(body string) []Segment {
+	lines := strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n")
+	kinds := make([]SegmentKind, len(lines))
+	for i := range kinds {
+		kinds[i] = SegmentBody
+	}
+
+	markQuotes(lines, kinds)
+	markSignatures(lines, kinds)
+	markDisclaimers(lines, kinds)
+	markClosing(lines, kinds)
+
+	segments := group(lines, kinds)
+
+	hasBody := false
+	for _, s := range segments {
+		if s.Kind == SegmentBody {
+			hasBody = true
+			break
+		}
+	}
+	if !hasBody {
+		for i := range segments {
+			if segments[i].Kind == SegmentQuoted {
+				segments[i].Kind = SegmentBody
+			}
+		}
+		segments = merge(segments)
+	}
+	return segments
+}
+
+// NewContent returns only the body segments of a message, joined
+func NewContent(body string) string {
+	var parts []string
+	for _, s := range SegmentText(body) {
+		if s.Kind == SegmentBody {
+			parts = append(parts, s.Text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// markQuotes tags "> " lines and everything below a reply header
+func markQuotes(lines []string, kinds []SegmentKind) {
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+
+		if strings.HasPrefix(line, ">") {
+			kinds[i] = SegmentQuoted
+			continue
+		}
+
+		// 引用头 "On Mon, Oct 20, 2025 at 10:00 AM Alice <alice@x.com> wrote:"
+		// 经常被客户端折成两行
+		headerLen := 0
+		switch {
+		case isAttribution(line):
+			headerLen = 1
+		case i+1 < len(lines) && isAttribution(line+" "+strings.TrimSpace(lines[i+1])):
+			headerLen = 2
+		case isSeparator(line):
+			headerLen = 1
+		case isOutlookHeader(lines, i):
+			headerLen = 1
+		case underscoreRule.MatchString(line) && isOutlookHeader(lines, nextNonEmpty(lines, i+1)):
+			headerLen = 1
+		}
+		if headerLen == 0 {
+			continue
+		}
+
+		// 行内回复：引用头后面紧跟 "> " 引用，引用结束后还可能有新内容
+		next := nextNonEmpty(lines, i+headerLen)
+		if next < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[next]), ">") && !isSeparator(line) {
+			for j := i; j < i+headerLen; j++ {
+				kinds[j] = SegmentQuoted
+			}
+			i += headerLen - 1
+			continue
+		}
+
+		// 顶部回复：剩下的全部是历史邮件
+		for j := i; j < len(lines); j++ {
+			kinds[j] = SegmentQuoted
+		}
+		return
+	}
+}
+
+// markSignatures tags the "-- " signature block and mobile footers
+func markSignatures(lines []string, kinds []SegmentKind) {
+	for i, line := range lines {
+		if kinds[i] != SegmentBody {
+			continue
+		}
+		trimmed := strings.TrimRight(line, " \t")
+		if trimmed == "--" {
+			// 签名一直持续到引用开始的地方
+			for j := i; j < len(lines) && kinds[j] == SegmentBody; j++ {
+				kinds[j] = SegmentSignature
+			}
+			continue
+		}
+		if mobileFooter.MatchString(strings.TrimSpace(line)) {
+			kinds[i] = SegmentSignature
+		}
+	}
+}
+
+// markDisclaimers tags disclaimer paragraphs and any body text after them
+// up to the next quoted block
+func markDisclaimers(lines []string, kinds []SegmentKind) {
+	start := 0
+	for start < len(lines) {
+		end := start
+		for end < len(lines) && strings.TrimSpace(lines[end]) != "" {
+			end++
+		}
+		if end > start && kinds[start] == SegmentBody && disclaimerPattern.MatchString(strings.Join(lines[start:end], " ")) {
+			for j := start; j < len(lines) && kinds[j] != SegmentQuoted; j++ {
+				kinds[j] = SegmentSignature
+			}
+		}
+		start = end + 1
+	}
+}
+
+// markClosing tags the short block (name, title, phone) that follows a
+// closing such as "Best regards," at the end of the new content. The
+// closing must come after some text and be followed only by lines that
+// look like a name or contact details: "Thanks!" at the top of a message
+// or before a sentence is content.
+func markClosing(lines []string, kinds []SegmentKind) {
+	// 找到第一段非正文之前的最后一行正文
+	end := 0
+	for end < len(lines) && kinds[end] == SegmentBody {
+		end++
+	}
+
+	for i := end - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if !closingPattern.MatchString(line) {
+			continue
+		}
+		if nextNonEmpty(lines, 0) >= i {
+			// 落款前面没有正文，"Thanks!" 只是开头的客套话
+			return
+		}
+		var rest []int
+		for j := i + 1; j < end; j++ {
+			if strings.TrimSpace(lines[j]) != "" {
+				rest = append(rest, j)
+			}
+		}
+		if len(rest) == 0 || len(rest) > maxSignatureLines {
+			return
+		}
+		for _, j := range rest {
+			if !isSignatureLine(strings.TrimSpace(lines[j])) {
+				return
+			}
+		}
+		for j := i + 1; j < end; j++ {
+			kinds[j] = SegmentSignature
+		}
+		return
+	}
+}
+
+var (
+	// contact details in a signature block: addresses, links and phone numbers
+	contactPattern = regexp.MustCompile(`(?i)[^\s<>()|,;]+@[^\s<>()|,;]+\.[a-z]{2,}|(https?://|www\.)[^\s|,;]+|\+?\(?\d[\d ().\-/]{5,}\d`)
+
+	// small words allowed in names and titles ("VP of Engineering")
+	titleWords = map[string]bool{"of": true, "and": true, "at": true, "for": true, "de": true, "von": true, "van": true, "der": true, "la": true, "le": true, "du": true}
+)
+
+// maxSignatureWords bounds the words of a name or title line
+const maxSignatureWords = 6
+
+// isSignatureLine reports whether a line after a closing looks like a
+// name, a title or contact details rather than a sentence
+func isSignatureLine(line string) bool {
+	if utf8.RuneCountInString(line) > 80 || strings.ContainsAny(line, "。！？") {
+		return false
+	}
+	if r, _ := utf8.DecodeLastRuneInString(line); r == '.' || r == '!' || r == '?' {
+		return false
+	}
+
+	// 去掉联系方式后剩下的应该是 "Tel:"、"Alice Smith" 这样的标签或名字
+	rest := contactPattern.ReplaceAllString(line, " ")
+	var words []string
+	for _, w := range strings.Fields(rest) {
+		w = strings.TrimFunc(w, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+		if w != "" {
+			words = append(words, w)
+		}
+	}
+	if len(words) > maxSignatureWords {
+		return false
+	}
+	for _, w := range words {
+		first, _ := utf8.DecodeRuneInString(w)
+		// 小写开头的词说明这是一句话；中日文没有大小写，按长度判断
+		if unicode.IsLower(first) && !titleWords[w] && utf8.RuneCountInString(w) > 1 {
+			return false
+		}
+		if !unicode.IsUpper(first) && !unicode.IsLower(first) && utf8.RuneCountInString(w) > 12 {
+			return false
+		}
+	}
+	return true
+}
+
+func isAttribution(line string) bool {
+	if utf8.RuneCountInString(line) > 400 {
+		return false
+	}
+	for _, re := range attributionPatterns {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSeparator(line string) bool {
+	for _, re := range separatorPatterns {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// isOutlookHeader reports whether lines[i] starts a "From:" header block
+// followed within a few lines by "Sent:"/"Date:" and "To:"/"Subject:"
+func isOutlookHeader(lines []string, i int) bool {
+	if i >= len(lines) || !outlookFrom.MatchString(strings.TrimSpace(lines[i])) {
+		return false
+	}
+	sent, subject := false, false
+	for j := i + 1; j < len(lines) && j <= i+5; j++ {
+		line := strings.TrimSpace(lines[j])
+		sent = sent || outlookSent.MatchString(line)
+		subject = subject || outlookSubject.MatchString(line)
+	}
+	return sent && subject
+}
+
+func nextNonEmpty(lines []string, i int) int {
+	for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+		i++
+	}
+	return i
+}
+
+// group turns per-line kinds into trimmed segments. Blank lines join the
+// segment they sit in rather than starting a new one.
+func group(lines []string, kinds []SegmentKind) []Segment {
+	var segments []Segment
+	var current []string
+	var kind SegmentKind
+	flush := func() {
+		text := strings.TrimSpace(strings.Join(current, "\n"))
+		if text != "" {
+			segments = append(segments, Segment{Kind: kind, Text: text})
+		}
+		current = nil
+	}
+
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			current = append(current, line)
+			continue
+		}
+		if kinds[i] != kind && len(current) > 0 {
+			flush()
+		}
+		kind = kinds[i]
+		current = append(current, line)
+	}
+	flush()
+	return merge(segments)
+}
+
+// merge joins adjacent segments of the same kind
+func merge(segments []Segment) []Segment {
+	var out []Segment
+	for _, s := range segments {
+		if n := len(out); n > 0 && out[n-1].Kind == s.Kind {
+			out[n-1].Text += "\n\n" + s.Text
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
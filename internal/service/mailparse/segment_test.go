@@ -0,0 +1,159 @@
+package mailparse_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/mailparse"
+)
+
+func TestSegmentText(t *testing.T) {
+	body := func(text string) mailparse.Segment {
+		return mailparse.Segment{Kind: mailparse.SegmentBody, Text: text}
+	}
+	quoted := func(text string) mailparse.Segment {
+		return mailparse.Segment{Kind: mailparse.SegmentQuoted, Text: text}
+	}
+	signature := func(text string) mailparse.Segment {
+		return mailparse.Segment{Kind: mailparse.SegmentSignature, Text: text}
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  []mailparse.Segment
+	}{
+		{
+			"plain body",
+			"Hi Bob,\n\nThe report is attached.",
+			[]mailparse.Segment{body("Hi Bob,\n\nThe report is attached.")},
+		},
+
+		// 真正的签名
+		{
+			"closing with name and contact details",
+			"Hi Bob,\n\nThe report is attached.\n\nBest regards,\nAlice Smith\nVP of Engineering, Acme Corp\nTel: +1 (555) 010-0199\nalice@acme.com | https://acme.com",
+			[]mailparse.Segment{
+				body("Hi Bob,\n\nThe report is attached.\n\nBest regards,"),
+				signature("Alice Smith\nVP of Engineering, Acme Corp\nTel: +1 (555) 010-0199\nalice@acme.com | https://acme.com"),
+			},
+		},
+		{
+			"closing and name separated by a blank line",
+			"See you tomorrow.\n\nThanks,\n\nAlice",
+			[]mailparse.Segment{body("See you tomorrow.\n\nThanks,"), signature("Alice")},
+		},
+		{
+			"chinese closing",
+			"报告已经发给你了，请查收。\n\n谢谢！\n张伟\n销售部经理\n电话：138 0013 8000",
+			[]mailparse.Segment{body("报告已经发给你了，请查收。\n\n谢谢！"), signature("张伟\n销售部经理\n电话：138 0013 8000")},
+		},
+		{
+			"dash-dash delimiter",
+			"Lunch at noon?\n\n-- \nBob\nbob@example.com",
+			[]mailparse.Segment{body("Lunch at noon?"), signature("-- \nBob\nbob@example.com")},
+		},
+		{
+			"mobile footer",
+			"On my way.\n\nSent from my iPhone",
+			[]mailparse.Segment{body("On my way."), signature("Sent from my iPhone")},
+		},
+		{
+			"disclaimer",
+			"Contract attached.\n\nCONFIDENTIALITY NOTICE: This email is confidential.\nIf you are not the intended recipient, delete it.",
+			[]mailparse.Segment{
+				body("Contract attached."),
+				signature("CONFIDENTIALITY NOTICE: This email is confidential.\nIf you are not the intended recipient, delete it."),
+			},
+		},
+
+		// 落款误判：后面是正文而不是名字
+		{
+			"thanks at the top",
+			"Thanks!\nThe meeting moved to 3pm, room 4B.",
+			[]mailparse.Segment{body("Thanks!\nThe meeting moved to 3pm, room 4B.")},
+		},
+		{
+			"thanks before a sentence",
+			"Hi team,\n\nThanks\n\nThe invoice number is INV-2024-0012, due on Friday",
+			[]mailparse.Segment{body("Hi team,\n\nThanks\n\nThe invoice number is INV-2024-0012, due on Friday")},
+		},
+		{
+			"cheers before flight details",
+			"Cheers\n\nFlight JL005 departs at 10:30 from Haneda",
+			[]mailparse.Segment{body("Cheers\n\nFlight JL005 departs at 10:30 from Haneda")},
+		},
+		{
+			"regards before a question",
+			"Got it.\n\nRegards\n\nCan you send the PDF again?",
+			[]mailparse.Segment{body("Got it.\n\nRegards\n\nCan you send the PDF again?")},
+		},
+		{
+			"closing followed by too many lines",
+			"Notes below.\n\nThanks\nAlice\nBob\nCarol\nDave\nErin\nFrank\nGrace",
+			[]mailparse.Segment{body("Notes below.\n\nThanks\nAlice\nBob\nCarol\nDave\nErin\nFrank\nGrace")},
+		},
+
+		// 引用和转发
+		{
+			"top posted reply",
+			"Sounds good.\n\nOn Mon, Oct 20, 2025 at 10:00 AM Alice <alice@example.com> wrote:\n> Shall we meet at 3?\n> Alice",
+			[]mailparse.Segment{
+				body("Sounds good."),
+				quoted("On Mon, Oct 20, 2025 at 10:00 AM Alice <alice@example.com> wrote:\n> Shall we meet at 3?\n> Alice"),
+			},
+		},
+		{
+			"attribution wrapped over two lines",
+			"Yes.\n\nOn Mon, Oct 20, 2025 at 10:00 AM Alice\n<alice@example.com> wrote:\nShall we meet at 3?",
+			[]mailparse.Segment{
+				body("Yes."),
+				quoted("On Mon, Oct 20, 2025 at 10:00 AM Alice\n<alice@example.com> wrote:\nShall we meet at 3?"),
+			},
+		},
+		{
+			"inline reply",
+			"> Can you make it on Friday?\nYes, after lunch.\n> And bring the slides?\nWill do.",
+			[]mailparse.Segment{
+				quoted("> Can you make it on Friday?"),
+				body("Yes, after lunch."),
+				quoted("> And bring the slides?"),
+				body("Will do."),
+			},
+		},
+		{
+			"outlook header",
+			"Approved.\n\nFrom: Alice\nSent: Monday, October 20, 2025 10:00 AM\nTo: Bob\nSubject: Budget\n\nPlease approve the budget.",
+			[]mailparse.Segment{
+				body("Approved."),
+				quoted("From: Alice\nSent: Monday, October 20, 2025 10:00 AM\nTo: Bob\nSubject: Budget\n\nPlease approve the budget."),
+			},
+		},
+		{
+			"forward with a note",
+			"FYI, see below.\n\n---------- Forwarded message ---------\nFrom: Carol <carol@example.com>\nThe server is down.",
+			[]mailparse.Segment{
+				body("FYI, see below."),
+				quoted("---------- Forwarded message ---------\nFrom: Carol <carol@example.com>\nThe server is down."),
+			},
+		},
+		{
+			"bare forward is kept as body",
+			"---------- Forwarded message ---------\nFrom: Carol <carol@example.com>\nThe server is down.",
+			[]mailparse.Segment{body("---------- Forwarded message ---------\nFrom: Carol <carol@example.com>\nThe server is down.")},
+		},
+		{
+			"chinese attribution",
+			"收到。\n\n在 2025年10月20日 10:00，张伟 写道：\n明天开会。",
+			[]mailparse.Segment{body("收到。"), quoted("在 2025年10月20日 10:00，张伟 写道：\n明天开会。")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mailparse.SegmentText(tt.input)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SegmentText(%q)\n got %q\nwant %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
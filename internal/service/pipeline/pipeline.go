@@ -0,0 +1,470 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/config"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/rag"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/source"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+)
+
+// storeBatchSize is how many parsed emails the store stage writes at once
+const storeBatchSize = 100
+
+// progressInterval is how many indexed emails pass between progress logs
+const progressInterval = 500
+
+// Store is the store stage; sync.StoreStage satisfies it
+type Store interface {
+	// Store writes a batch of emails and returns the ones that need indexing
+	Store(ctx context.Context, emails []*domain.Email) ([]*domain.Email, error)
+	// Flush is called once the source is exhausted
+	Flush(ctx context.Context)
+}
+
+// Indexer runs the chunk, embed and upsert stages; rag.Service satisfies it
+type Indexer interface {
+	Chunk(ctx context.Context, email *domain.Email) (*rag.Document, error)
+	Embed(ctx context.Context, docs []*rag.Document) error
+	Upsert(ctx context.Context, docs []*rag.Document) error
+}
+
+// AttachmentIndexer indexes the attachments of indexed emails;
+// attachment.Service satisfies it
+type AttachmentIndexer interface {
+	IndexEmails(ctx context.Context, emails []*domain.Email) (int, error)
+}
+
+// Checkpoint is told which emails are fully indexed. It is called from
+// several workers and must be safe for concurrent use.
+type Checkpoint interface {
+	Indexed(ctx context.Context, ids []string) error
+}
+
+// Summary counts what went through each stage of a run
+type Summary struct {
+	Source string
+
+	// Fetched messages came out of the source, Parsed of the parse stage
+	Fetched int
+	Parsed  int
+	// Stored counts emails the store stage passed on for indexing (new,
+	// changed or not indexed yet); without a store stage every parsed
+	// email is passed on
+	Stored int
+
+	// Chunks is the number of chunks to embed, Embedded the ones that were.
+	// Reused chunks were already embedded with the same content and model,
+	// Deleted counts the points of chunks that are gone.
+	Chunks   int
+	Embedded int
+	Reused   int
+	Deleted  int
+	// Indexed counts emails whose vectors are up to date, Skipped the ones
+	// among them that needed no embedding at all, IndexFailed the ones that
+	// failed in the chunk, embed or upsert stage
+	Indexed     int
+	Skipped     int
+	IndexFailed int
+
+	AttachmentsIndexed int
+
+	// Failed lists messages that could not be fetched or parsed
+	Failed []source.Failure
+
+	Elapsed time.Duration
+}
+
+// Merge adds the counts of another run
+func (s *Summary) Merge(o *Summary) {
+	if o == nil {
+		return
+	}
+	s.Fetched += o.Fetched
+	s.Parsed += o.Parsed
+	s.Stored += o.Stored
+	s.Chunks += o.Chunks
+	s.Embedded += o.Embedded
+	s.Reused += o.Reused
+	s.Deleted += o.Deleted
+	s.Indexed += o.Indexed
+	s.Skipped += o.Skipped
+	s.IndexFailed += o.IndexFailed
+	s.AttachmentsIndexed += o.AttachmentsIndexed
+	s.Failed = append(s.Failed, o.Failed...)
+	s.Elapsed += o.Elapsed
+}
+
+// Pipeline streams emails through fetch → parse → store → chunk → embed →
+// upsert. Every stage has its own workers and hands its output to the next
+// one over a bounded channel, so a slow stage (usually embed) holds back
+// the ones before it instead of piling up emails in memory.
+type Pipeline struct {
+	indexer     Indexer
+	attachments AttachmentIndexer
+	checkpoint  Checkpoint
+	cfg         config.PipelineConfig
+	logger      logger.Logger
+}
+
+// New creates a pipeline that indexes through indexer
+func New(indexer Indexer, cfg config.PipelineConfig, log logger.Logger) *Pipeline {
+	cfg.Buffer = max(cfg.Buffer, 1)
+	cfg.Parsers = max(cfg.Parsers, 1)
+	cfg.Chunkers = max(cfg.Chunkers, 1)
+	cfg.Embedders = max(cfg.Embedders, 1)
+	cfg.Upserters = max(cfg.Upserters, 1)
+	cfg.EmbedBatch = max(cfg.EmbedBatch, 1)
+
+	return &Pipeline{
+		indexer: indexer,
+		cfg:     cfg,
+		logger:  log,
+	}
+}
+
+// WithAttachments also indexes the attachments of every indexed email
+func (p *Pipeline) WithAttachments(a AttachmentIndexer) *Pipeline {
+	p.attachments = a
+	return p
+}
+
+// WithCheckpoint reports indexed email IDs to cp; nil turns reporting off
+func (p *Pipeline) WithCheckpoint(cp Checkpoint) *Pipeline {
+	p.checkpoint = cp
+	return p
+}
+
+// run holds the state shared by the stages of one Run
+type run struct {
+	*Pipeline
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	err     error
+	summary *Summary
+}
+
+// Run streams src through the pipeline. With a nil store the emails are
+// only indexed, e.g. when reindexing what is already in SQLite. Fetch,
+// parse and index failures are counted and skipped; a store error or a
+// failing source stops the run.
+func (p *Pipeline) Run(ctx context.Context, src source.Source, store Store) (*Summary, error) {
+	started := time.Now()
+
+	r := &run{Pipeline: p, summary: &Summary{Source: src.Name()}}
+	r.ctx, r.cancel = context.WithCancel(ctx)
+	defer r.cancel()
+
+	fetched := make(chan source.Raw, p.cfg.Buffer)
+	parsed := make(chan *domain.Email, p.cfg.Buffer)
+	stored := make(chan *domain.Email, p.cfg.Buffer)
+	chunked := make(chan *rag.Document, p.cfg.Buffer)
+	batches := make(chan []*rag.Document, p.cfg.Embedders)
+	embedded := make(chan []*rag.Document, p.cfg.Upserters)
+
+	r.stage(1, func() { r.fetch(src, fetched) }, func() { close(fetched) })
+	r.stage(p.cfg.Parsers, func() { r.parse(fetched, parsed) }, func() { close(parsed) })
+	r.stage(1, func() { r.store(store, parsed, stored) }, func() { close(stored) })
+	r.stage(p.cfg.Chunkers, func() { r.chunk(stored, chunked) }, func() { close(chunked) })
+	r.stage(1, func() { r.batch(chunked, batches) }, func() { close(batches) })
+	r.stage(p.cfg.Embedders, func() { r.embed(batches, embedded) }, func() { close(embedded) })
+	r.stage(p.cfg.Upserters, func() { r.upsert(embedded) }, func() {})
+	r.wg.Wait()
+
+	summary := r.summary
+	summary.Failed = append(src.Failures(), summary.Failed...)
+	summary.Elapsed = time.Since(started)
+	for _, f := range summary.Failed {
+		p.logger.Warn("Failed to read message", "ref", f.Ref, "error", f.Err)
+	}
+
+	if r.err != nil {
+		return summary, r.err
+	}
+	return summary, ctx.Err()
+}
+
+// stage starts n workers and calls done once all of them returned, which
+// is where a stage closes its output channel
+func (r *run) stage(n int, work func(), done func()) {
+	var workers sync.WaitGroup
+	for range n {
+		workers.Add(1)
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			defer workers.Done()
+			work()
+		}()
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		workers.Wait()
+		done()
+	}()
+}
+
+// fail records the first fatal error and stops every stage
+func (r *run) fail(err error) {
+	r.mu.Lock()
+	if r.err == nil {
+		r.err = err
+	}
+	r.mu.Unlock()
+	r.cancel()
+}
+
+// count updates the summary under the lock
+func (r *run) count(fn func(s *Summary)) {
+	r.mu.Lock()
+	fn(r.summary)
+	r.mu.Unlock()
+}
+
+// send hands v to the next stage, giving up once the run is cancelled
+func send[T any](ctx context.Context, out chan<- T, v T) bool {
+	select {
+	case out <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// fetch streams raw messages from src. Sources that parse as they read are
+// passed through as already parsed messages.
+func (r *run) fetch(src source.Source, out chan<- source.Raw) {
+	var err error
+	if raw, ok := src.(source.RawSource); ok {
+		err = raw.StreamRaw(r.ctx, out)
+	} else {
+		err = r.fetchParsed(src, out)
+	}
+	if err != nil && r.ctx.Err() == nil {
+		r.fail(fmt.Errorf("fetch failed: %w", err))
+	}
+}
+
+func (r *run) fetchParsed(src source.Source, out chan<- source.Raw) error {
+	emails := make(chan *domain.Email)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- src.Stream(r.ctx, emails)
+		close(emails)
+	}()
+
+	for e := range emails {
+		raw := source.Raw{Ref: e.ID, Parse: func() (*domain.Email, error) { return e, nil }}
+		if !send(r.ctx, out, raw) {
+			// ctx 已取消，source 很快会退出，把剩下的收掉
+			for range emails {
+			}
+			break
+		}
+	}
+	return <-errc
+}
+
+func (r *run) parse(in <-chan source.Raw, out chan<- *domain.Email) {
+	for raw := range in {
+		e, err := raw.Parse()
+		if err != nil {
+			r.count(func(s *Summary) {
+				s.Fetched++
+				s.Failed = append(s.Failed, source.Failure{Ref: raw.Ref, Err: err})
+			})
+			continue
+		}
+		r.count(func(s *Summary) { s.Fetched++; s.Parsed++ })
+		if !send(r.ctx, out, e) {
+			return
+		}
+	}
+}
+
+// store writes parsed emails in batches; SQLite has a single writer, so
+// this stage always runs one worker
+func (r *run) store(store Store, in <-chan *domain.Email, out chan<- *domain.Email) {
+	if store == nil {
+		for e := range in {
+			r.count(func(s *Summary) { s.Stored++ })
+			if !send(r.ctx, out, e) {
+				return
+			}
+		}
+		return
+	}
+
+	batch := make([]*domain.Email, 0, storeBatchSize)
+	flush := func() bool {
+		if len(batch) == 0 {
+			return true
+		}
+		changed, err := store.Store(r.ctx, batch)
+		batch = batch[:0]
+		if err != nil {
+			if r.ctx.Err() == nil {
+				r.fail(fmt.Errorf("failed to store emails: %w", err))
+			}
+			return false
+		}
+		r.count(func(s *Summary) { s.Stored += len(changed) })
+		for _, e := range changed {
+			if !send(r.ctx, out, e) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for e := range in {
+		batch = append(batch, e)
+		if len(batch) >= storeBatchSize && !flush() {
+			return
+		}
+	}
+	if flush() {
+		store.Flush(r.ctx)
+	}
+}
+
+func (r *run) chunk(in <-chan *domain.Email, out chan<- *rag.Document) {
+	for e := range in {
+		doc, err := r.indexer.Chunk(r.ctx, e)
+		if err != nil {
+			if r.ctx.Err() != nil {
+				return
+			}
+			r.logger.Error("Failed to chunk email", "email_id", e.ID, "error", err)
+			r.count(func(s *Summary) { s.IndexFailed++ })
+			continue
+		}
+		r.count(func(s *Summary) {
+			s.Chunks += len(doc.Chunks)
+			s.Reused += doc.Reused
+		})
+		if !send(r.ctx, out, doc) {
+			return
+		}
+	}
+}
+
+// batch groups documents into embeddings requests of about EmbedBatch
+// chunks. Unchanged documents are done right away.
+func (r *run) batch(in <-chan *rag.Document, out chan<- []*rag.Document) {
+	var batch []*rag.Document
+	size := 0
+	for doc := range in {
+		if doc.Unchanged() {
+			r.count(func(s *Summary) { s.Skipped++ })
+			r.indexed([]*rag.Document{doc})
+			continue
+		}
+		if size > 0 && size+len(doc.Chunks) > r.cfg.EmbedBatch {
+			if !send(r.ctx, out, batch) {
+				return
+			}
+			batch, size = nil, 0
+		}
+		// 只需要删旧点的文档不占 size，跟着下一批走
+		batch = append(batch, doc)
+		size += len(doc.Chunks)
+	}
+	if len(batch) > 0 {
+		send(r.ctx, out, batch)
+	}
+}
+
+func (r *run) embed(in <-chan []*rag.Document, out chan<- []*rag.Document) {
+	for batch := range in {
+		if err := r.indexer.Embed(r.ctx, batch); err != nil {
+			if r.ctx.Err() != nil {
+				return
+			}
+			r.logger.Error("Failed to embed chunks", "emails", len(batch), "error", err)
+			r.count(func(s *Summary) { s.IndexFailed += len(batch) })
+			continue
+		}
+		r.count(func(s *Summary) { s.Embedded += chunkCount(batch) })
+		if !send(r.ctx, out, batch) {
+			return
+		}
+	}
+}
+
+func (r *run) upsert(in <-chan []*rag.Document) {
+	for batch := range in {
+		if err := r.indexer.Upsert(r.ctx, batch); err != nil {
+			if r.ctx.Err() != nil {
+				return
+			}
+			r.logger.Error("Failed to upsert vectors", "emails", len(batch), "error", err)
+			r.count(func(s *Summary) { s.IndexFailed += len(batch) })
+			continue
+		}
+		r.count(func(s *Summary) { s.Deleted += staleCount(batch) })
+		r.indexed(batch)
+	}
+}
+
+// indexed finishes documents: their attachments are indexed and the
+// checkpoint is told about them
+func (r *run) indexed(docs []*rag.Document) {
+	emails := make([]*domain.Email, len(docs))
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		emails[i] = doc.Email
+		ids[i] = doc.Email.ID
+	}
+
+	attachments := 0
+	if r.attachments != nil {
+		n, err := r.attachments.IndexEmails(r.ctx, emails)
+		if err != nil {
+			r.logger.Error("Failed to index attachments", "error", err)
+		}
+		attachments = n
+	}
+
+	if r.checkpoint != nil {
+		// checkpoint 写失败只意味着续跑时会重做，不中断流水线
+		if err := r.checkpoint.Indexed(r.ctx, ids); err != nil {
+			r.logger.Warn("Failed to record sync checkpoint", "error", err)
+		}
+	}
+
+	r.count(func(s *Summary) {
+		before := s.Indexed
+		s.Indexed += len(docs)
+		s.AttachmentsIndexed += attachments
+		if s.Indexed/progressInterval > before/progressInterval {
+			r.logger.Info("Index progress", "source", s.Source, "indexed", s.Indexed, "fetched", s.Fetched)
+		}
+	})
+}
+
+func staleCount(docs []*rag.Document) int {
+	n := 0
+	for _, doc := range docs {
+		n += len(doc.Stale)
+	}
+	return n
+}
+
+func chunkCount(docs []*rag.Document) int {
+	n := 0
+	for _, doc := range docs {
+		n += len(doc.Chunks)
+	}
+	return n
+}
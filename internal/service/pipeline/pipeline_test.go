@@ -0,0 +1,265 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/config"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/pipeline"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/rag"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/source"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+)
+
+// fakeSource streams its emails; endless keeps streaming numbered emails
+// until the context is cancelled
+type fakeSource struct {
+	emails  []*domain.Email
+	endless bool
+	err     error
+}
+
+func (s *fakeSource) Name() string { return "fake" }
+
+func (s *fakeSource) Stream(ctx context.Context, out chan<- *domain.Email) error {
+	for _, e := range s.emails {
+		if err := source.Emit(ctx, out, e); err != nil {
+			return err
+		}
+	}
+	for n := 0; s.endless; n++ {
+		if err := source.Emit(ctx, out, &domain.Email{ID: fmt.Sprintf("x%d", n), BodyText: "more"}); err != nil {
+			return err
+		}
+	}
+	return s.err
+}
+
+func (s *fakeSource) Failures() []source.Failure { return nil }
+
+// fakeIndexer makes one chunk per email with a body and records the order
+// of upserted emails and the size of each embed batch
+type fakeIndexer struct {
+	mu       sync.Mutex
+	upserted []string
+	batches  []int
+	embedErr error
+}
+
+func (f *fakeIndexer) Chunk(_ context.Context, e *domain.Email) (*rag.Document, error) {
+	doc := &rag.Document{Email: e}
+	if e.BodyText != "" {
+		doc.Chunks = []*domain.Chunk{{EmailID: e.ID, Content: e.BodyText}}
+	}
+	return doc, nil
+}
+
+func (f *fakeIndexer) Embed(_ context.Context, docs []*rag.Document) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.embedErr != nil {
+		return f.embedErr
+	}
+	n := 0
+	for _, doc := range docs {
+		doc.Vectors = make([][]float32, len(doc.Chunks))
+		n += len(doc.Chunks)
+	}
+	f.batches = append(f.batches, n)
+	return nil
+}
+
+func (f *fakeIndexer) Upsert(_ context.Context, docs []*rag.Document) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, doc := range docs {
+		f.upserted = append(f.upserted, doc.Email.ID)
+	}
+	return nil
+}
+
+// fakeStore passes every email on and fails the failAt-th batch
+type fakeStore struct {
+	batches []int
+	flushed int
+	failAt  int
+}
+
+func (s *fakeStore) Store(_ context.Context, emails []*domain.Email) ([]*domain.Email, error) {
+	s.batches = append(s.batches, len(emails))
+	if len(s.batches) == s.failAt {
+		return nil, errors.New("disk full")
+	}
+	return slices.Clone(emails), nil
+}
+
+func (s *fakeStore) Flush(context.Context) { s.flushed++ }
+
+type fakeCheckpoint struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (c *fakeCheckpoint) Indexed(_ context.Context, ids []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ids = append(c.ids, ids...)
+	return nil
+}
+
+func emails(n int) []*domain.Email {
+	out := make([]*domain.Email, n)
+	for i := range out {
+		out[i] = &domain.Email{ID: fmt.Sprintf("m%03d", i), BodyText: "body"}
+	}
+	return out
+}
+
+// oneWorker runs every stage with a single worker, which keeps the order
+func oneWorker(embedBatch int) config.PipelineConfig {
+	return config.PipelineConfig{Buffer: 4, Parsers: 1, Chunkers: 1, Embedders: 1, Upserters: 1, EmbedBatch: embedBatch}
+}
+
+func TestRunOrderAndFlush(t *testing.T) {
+	src := &fakeSource{emails: emails(250)}
+	// 没有正文的邮件不用 embed，直接算索引完
+	src.emails[7].BodyText = ""
+	indexer := &fakeIndexer{}
+	store := &fakeStore{}
+	cp := &fakeCheckpoint{}
+	p := pipeline.New(indexer, oneWorker(16), logger.NewSlog("error")).WithCheckpoint(cp)
+
+	summary, err := p.Run(context.Background(), src, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 按 100 封一批写入，最后不满一批的也要写，写完调一次 Flush
+	if !slices.Equal(store.batches, []int{100, 100, 50}) || store.flushed != 1 {
+		t.Errorf("store batches = %v, flushed %d times; want [100 100 50] and one flush", store.batches, store.flushed)
+	}
+
+	var want []string
+	for _, e := range src.emails {
+		if e.BodyText != "" {
+			want = append(want, e.ID)
+		}
+	}
+	if !slices.Equal(indexer.upserted, want) {
+		t.Errorf("upserted %d emails out of order or incomplete", len(indexer.upserted))
+	}
+	// 每批不超过 EmbedBatch，最后不满的一批也要发出去
+	total := 0
+	for _, n := range indexer.batches {
+		if n > 16 {
+			t.Errorf("embed batch of %d chunks, want at most 16", n)
+		}
+		total += n
+	}
+	if total != 249 {
+		t.Errorf("embedded %d chunks, want 249", total)
+	}
+
+	if summary.Fetched != 250 || summary.Stored != 250 || summary.Indexed != 250 || summary.Skipped != 1 || summary.Embedded != 249 {
+		t.Errorf("summary = %+v", summary)
+	}
+	if len(cp.ids) != 250 {
+		t.Errorf("checkpoint got %d IDs, want 250", len(cp.ids))
+	}
+}
+
+func TestRunIndexFailuresAreCounted(t *testing.T) {
+	indexer := &fakeIndexer{embedErr: errors.New("rate limited")}
+	cp := &fakeCheckpoint{}
+	p := pipeline.New(indexer, oneWorker(4), logger.NewSlog("error")).WithCheckpoint(cp)
+
+	// 索引失败只计数，不中断流水线，也不报给 checkpoint
+	summary, err := p.Run(context.Background(), &fakeSource{emails: emails(10)}, nil)
+	if err != nil {
+		t.Fatalf("Run = %v, want index failures to be counted only", err)
+	}
+	if summary.IndexFailed != 10 || summary.Indexed != 0 || len(cp.ids) != 0 {
+		t.Errorf("summary = %+v, checkpoint %v; want 10 failed and nothing indexed", summary, cp.ids)
+	}
+}
+
+func TestRunStageErrorStopsTheRun(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   *fakeSource
+		store *fakeStore
+		want  string
+	}{
+		{"store fails", &fakeSource{endless: true}, &fakeStore{failAt: 2}, "failed to store emails: disk full"},
+		{"source fails", &fakeSource{emails: emails(3), err: errors.New("connection reset")}, nil, "fetch failed: connection reset"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := pipeline.New(&fakeIndexer{}, oneWorker(4), logger.NewSlog("error"))
+
+			done := make(chan error, 1)
+			go func() {
+				var store pipeline.Store
+				if tt.store != nil {
+					store = tt.store
+				}
+				_, err := p.Run(context.Background(), tt.src, store)
+				done <- err
+			}()
+
+			select {
+			case err := <-done:
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Fatalf("Run = %v, want %q", err, tt.want)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Run did not stop the other stages after the error")
+			}
+			if tt.store != nil && tt.store.flushed != 0 {
+				t.Error("store was flushed after a failed batch")
+			}
+		})
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	indexer := &fakeIndexer{}
+	p := pipeline.New(indexer, config.PipelineConfig{Buffer: 2, Parsers: 3, Chunkers: 3, Embedders: 2, Upserters: 2, EmbedBatch: 8}, logger.NewSlog("error"))
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.Run(ctx, &fakeSource{endless: true}, &fakeStore{})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Run = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+
+	// 所有阶段的 goroutine 都要退出
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("%d goroutines left running, %d before:\n%s", runtime.NumGoroutine(), before, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
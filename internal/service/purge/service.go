@@ -0,0 +1,129 @@
+// Package purge permanently removes soft-deleted emails together with
+// everything derived from them.
+package purge
+
+import (
+	"context"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/attachment"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/blob"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/chunk"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+)
+
+// VectorIndex drops the vectors of an email; rag.Service satisfies it and
+// also forgets its embedding records
+type VectorIndex interface {
+	DeleteByEmailID(ctx context.Context, emailID string) error
+}
+
+// Result summarizes a purge
+type Result struct {
+	Emails      int
+	Attachments int
+	Blobs       int
+}
+
+// Service hard-deletes emails that sync has soft-deleted
+type Service struct {
+	emailRepo      email.Repository
+	chunkRepo      chunk.Repository
+	attachmentRepo attachment.Repository
+	blobs          *blob.Store
+	vectors        VectorIndex
+	logger         logger.Logger
+}
+
+// New creates a purge service. blobs and vectors may be nil.
+func New(emailRepo email.Repository, chunkRepo chunk.Repository, attachmentRepo attachment.Repository, blobs *blob.Store, vectors VectorIndex, log logger.Logger) *Service {
+	return &Service{
+		emailRepo:      emailRepo,
+		chunkRepo:      chunkRepo,
+		attachmentRepo: attachmentRepo,
+		blobs:          blobs,
+		vectors:        vectors,
+		logger:         log,
+	}
+}
+
+// Purge removes emails soft-deleted before the given time: their vectors,
+// chunks, attachment rows, blobs no other attachment uses, and finally
+// the email row. With dryRun it only counts what would be removed.
+func (s *Service) Purge(ctx context.Context, before time.Time, dryRun bool) (*Result, error) {
+	emails, err := s.emailRepo.ListDeleted(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	for _, e := range emails {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		atts, err := s.attachmentRepo.ListByEmail(ctx, e.ID)
+		if err != nil {
+			return result, err
+		}
+		if dryRun {
+			result.Emails++
+			result.Attachments += len(atts)
+			continue
+		}
+
+		// 先删向量：即使后面失败，邮件还留在回收站里，下次 purge 会重试
+		if s.vectors != nil {
+			if err := s.vectors.DeleteByEmailID(ctx, e.ID); err != nil {
+				return result, err
+			}
+		}
+		if err := s.chunkRepo.DeleteByEmail(ctx, e.ID); err != nil {
+			return result, err
+		}
+		if err := s.attachmentRepo.DeleteByEmail(ctx, e.ID); err != nil {
+			return result, err
+		}
+		result.Attachments += len(atts)
+		result.Blobs += s.deleteBlobs(ctx, atts)
+
+		if err := s.emailRepo.Purge(ctx, e.ID); err != nil {
+			return result, err
+		}
+		result.Emails++
+		s.logger.Debug("Purged email", "id", e.ID, "subject", e.Subject)
+	}
+	return result, nil
+}
+
+// deleteBlobs removes the blobs of purged attachments unless another
+// attachment (the same file mailed twice) still references them
+func (s *Service) deleteBlobs(ctx context.Context, atts []*domain.Attachment) int {
+	if s.blobs == nil {
+		return 0
+	}
+	deleted := 0
+	done := make(map[string]bool)
+	for _, att := range atts {
+		if att.ContentHash == "" || done[att.ContentHash] {
+			continue
+		}
+		done[att.ContentHash] = true
+
+		refs, err := s.attachmentRepo.CountByHash(ctx, att.ContentHash)
+		if err != nil || refs > 0 {
+			continue
+		}
+		if !s.blobs.Has(att.ContentHash) {
+			continue
+		}
+		if err := s.blobs.Delete(att.ContentHash); err != nil {
+			s.logger.Warn("Failed to delete blob", "hash", att.ContentHash, "error", err)
+			continue
+		}
+		deleted++
+	}
+	return deleted
+}
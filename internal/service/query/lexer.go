@@ -0,0 +1,114 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// operators are the names recognized before a colon. Anything else that
+// contains a colon ("re:", "http://...") is plain text, like in Gmail.
+var operators = map[string]bool{
+	"from": true, "to": true, "cc": true, "subject": true, "label": true,
+	"before": true, "after": true, "older_than": true, "newer_than": true,
+	"has": true, "is": true,
+}
+
+// token is one term of a query: a word, a "quoted phrase" or an
+// operator:value pair, optionally negated with a leading -
+type token struct {
+	Negated bool
+	Op      string // empty for words and phrases
+	Value   string
+	Quoted  bool
+
+	// Raw is the term as typed and Pos its byte offset, for error messages
+	Raw string
+	Pos int
+}
+
+// SyntaxError reports a malformed term of a query
+type SyntaxError struct {
+	Term string
+	Pos  int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s (at %q, column %d)", e.Msg, e.Term, e.Pos+1)
+}
+
+// lex splits a query into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for {
+		for i < len(input) {
+			r, n := utf8.DecodeRuneInString(input[i:])
+			if !unicode.IsSpace(r) {
+				break
+			}
+			i += n
+		}
+		if i == len(input) {
+			return tokens, nil
+		}
+
+		tok := token{Pos: i}
+		start := i
+		// "-" 后面紧跟内容才算取反，单独的 "-" 当普通文本
+		if input[i] == '-' && i+1 < len(input) && !isSpace(input[i+1:]) {
+			tok.Negated = true
+			i++
+		}
+
+		if input[i] == '"' {
+			value, end, err := quoted(input, i)
+			if err != nil {
+				return nil, err
+			}
+			tok.Value, tok.Quoted, i = value, true, end
+		} else {
+			word := i
+			for i < len(input) && !isSpace(input[i:]) {
+				if input[i] == ':' && operators[strings.ToLower(input[word:i])] && tok.Op == "" {
+					tok.Op = strings.ToLower(input[word:i])
+					i++
+					if i < len(input) && input[i] == '"' {
+						value, end, err := quoted(input, i)
+						if err != nil {
+							return nil, err
+						}
+						tok.Value, tok.Quoted, i = value, true, end
+						break
+					}
+					word = i
+					continue
+				}
+				_, n := utf8.DecodeRuneInString(input[i:])
+				i += n
+			}
+			if !tok.Quoted {
+				tok.Value = input[word:i]
+			}
+		}
+		tok.Raw = input[start:i]
+		tokens = append(tokens, tok)
+	}
+}
+
+// quoted reads the phrase starting at the quote at input[i] and returns
+// it with the offset after the closing quote
+func quoted(input string, i int) (string, int, error) {
+	end := strings.IndexByte(input[i+1:], '"')
+	if end < 0 {
+		return "", 0, &SyntaxError{Term: input[i:], Pos: i, Msg: "unterminated quote"}
+	}
+	return input[i+1 : i+1+end], i + end + 2, nil
+}
+
+func isSpace(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsSpace(r)
+}
@@ -0,0 +1,369 @@
+// Package query parses Gmail-style search queries such as
+//
+//	from:alice after:2025-06-01 has:attachment "budget overrun" -draft
+//
+// into structured filters for SQLite (email.Filter) and Qdrant
+// (vector.Filter), plus the free text that is left for ranking. Date
+// expressions in the text ("last week", "上个月") become date filters too.
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/vector"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/daterange"
+)
+
+// Query is a parsed search query. Repeated from:, to: and cc: values match
+// any of them, with or without an OR in between; every other condition
+// must hold.
+type Query struct {
+	// Text is the words and phrases that are not operators, used to rank
+	// the results
+	Text string
+
+	From    []string
+	To      []string
+	Cc      []string
+	Subject []string
+	Labels  []string
+
+	// Phrases are the quoted phrases of Text, which must appear verbatim
+	Phrases []string
+
+	// After (inclusive) and Before (exclusive) bound the email date
+	After  time.Time
+	Before time.Time
+
+	HasAttachment *bool
+
+	// ThreadID has no operator; search sets it from --thread
+	ThreadID string
+
+	// Not holds the negated terms: an email matching any one of them is
+	// dropped. Its dates and HasAttachment are unused (negating those is
+	// folded into the query itself).
+	Not *Query
+}
+
+// Parse parses a query. now anchors relative dates (older_than:, "last
+// week") and dates are read in its location.
+func Parse(input string, now time.Time) (*Query, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Query{}
+	dates := daterange.New().WithClock(func() time.Time { return now })
+	var text []token
+	for i, tok := range tokens {
+		if isOr(tokens, i) {
+			// 重复的 from:/to:/cc: 本来就是 OR，显式的 OR 直接跳过
+			continue
+		}
+		target := q
+		if tok.Negated && !foldsNegation[tok.Op] {
+			if q.Not == nil {
+				q.Not = &Query{}
+			}
+			target = q.Not
+		}
+
+		if tok.Op == "" {
+			if tok.Negated {
+				target.Phrases = append(target.Phrases, tok.Value)
+				continue
+			}
+			if tok.Quoted {
+				q.Phrases = append(q.Phrases, tok.Value)
+			}
+			text = append(text, tok)
+			continue
+		}
+
+		value := strings.TrimSpace(tok.Value)
+		if value == "" {
+			return nil, &SyntaxError{Term: tok.Raw, Pos: tok.Pos, Msg: tok.Op + ": needs a value"}
+		}
+		switch tok.Op {
+		case "from":
+			target.From = append(target.From, value)
+		case "to":
+			target.To = append(target.To, value)
+		case "cc":
+			target.Cc = append(target.Cc, value)
+		case "subject":
+			target.Subject = append(target.Subject, value)
+		case "label":
+			target.Labels = append(target.Labels, value)
+		case "is":
+			if err := q.parseIs(tok, value); err != nil {
+				return nil, err
+			}
+		case "has":
+			if !strings.EqualFold(value, "attachment") {
+				return nil, &SyntaxError{Term: tok.Raw, Pos: tok.Pos, Msg: fmt.Sprintf("unsupported has:%s (only has:attachment)", value)}
+			}
+			has := !tok.Negated
+			q.HasAttachment = &has
+		case "after", "before", "older_than", "newer_than":
+			if err := q.parseDate(tok, value, dates); err != nil {
+				return nil, err
+			}
+		}
+	}
+	q.Text = q.extractDates(text, dates)
+
+	if !q.After.IsZero() && !q.Before.IsZero() && !q.After.Before(q.Before) {
+		return nil, fmt.Errorf("empty date range: nothing is after %s and before %s",
+			q.After.Format("2006-01-02"), q.Before.Format("2006-01-02"))
+	}
+	return q, nil
+}
+
+// isOr reports whether tokens[i] is an OR between two from:, to: or cc:
+// terms of the same operator ("from:alice OR from:bob"). Any other OR is
+// an ordinary word, as the conditions of a query cannot be OR-ed.
+func isOr(tokens []token, i int) bool {
+	tok := tokens[i]
+	if tok.Op != "" || tok.Quoted || tok.Negated || tok.Value != "OR" || i == 0 || i == len(tokens)-1 {
+		return false
+	}
+	prev, next := tokens[i-1], tokens[i+1]
+	return anyOf[prev.Op] && prev.Op == next.Op && !prev.Negated && !next.Negated
+}
+
+// anyOf are the operators whose repeated values match any of them
+var anyOf = map[string]bool{"from": true, "to": true, "cc": true}
+
+// extractDates narrows the date range by the date expressions among the
+// plain words ("budget last week") and returns the text without them.
+// Quoted phrases are kept as typed, so "Q3 planning" in quotes stays text.
+func (q *Query) extractDates(text []token, dates *daterange.Parser) string {
+	var out []string
+	for i := 0; i < len(text); {
+		if text[i].Quoted {
+			out = append(out, text[i].Value)
+			i++
+			continue
+		}
+		var words []string
+		for ; i < len(text) && !text[i].Quoted; i++ {
+			words = append(words, text[i].Value)
+		}
+		run := strings.Join(words, " ")
+		for {
+			r, rest, ok := dates.Extract(run)
+			if !ok {
+				break
+			}
+			q.narrow(r)
+			run = rest
+		}
+		if run != "" {
+			out = append(out, run)
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// narrow intersects the date range with r
+func (q *Query) narrow(r daterange.Range) {
+	r = daterange.Range{Start: q.After, End: q.Before}.Intersect(r)
+	q.After, q.Before = r.Start, r.End
+}
+
+// foldsNegation are the operators whose negation is another condition of
+// the query rather than an exclusion (-has:attachment, -after:X, -is:read)
+var foldsNegation = map[string]bool{
+	"has": true, "is": true,
+	"after": true, "before": true, "older_than": true, "newer_than": true,
+}
+
+// isLabels maps is: values to the Gmail system labels they test
+var isLabels = map[string]string{
+	"unread":    "UNREAD",
+	"starred":   "STARRED",
+	"important": "IMPORTANT",
+}
+
+// parseIs handles is:unread/read/starred/important; is:read is the
+// negation of is:unread
+func (q *Query) parseIs(tok token, value string) error {
+	value = strings.ToLower(value)
+	negated := tok.Negated
+	if value == "read" {
+		value, negated = "unread", !negated
+	}
+	label, ok := isLabels[value]
+	if !ok {
+		return &SyntaxError{Term: tok.Raw, Pos: tok.Pos, Msg: fmt.Sprintf("unsupported is:%s (use unread, read, starred or important)", value)}
+	}
+	if negated {
+		if q.Not == nil {
+			q.Not = &Query{}
+		}
+		q.Not.Labels = append(q.Not.Labels, label)
+	} else {
+		q.Labels = append(q.Labels, label)
+	}
+	return nil
+}
+
+// parseDate narrows the date range. Negation flips the bound:
+// -after:X is before:X and -older_than:7d is newer_than:7d.
+func (q *Query) parseDate(tok token, value string, dates *daterange.Parser) error {
+	var t time.Time
+	now := dates.Now()
+	lower := tok.Op == "after" // true when value is a lower bound
+	switch tok.Op {
+	case "after", "before":
+		var err error
+		if t, err = parseDate(value, dates); err != nil {
+			return &SyntaxError{Term: tok.Raw, Pos: tok.Pos, Msg: err.Error()}
+		}
+	case "older_than", "newer_than":
+		var err error
+		if t, err = parseAge(value, now); err != nil {
+			return &SyntaxError{Term: tok.Raw, Pos: tok.Pos, Msg: err.Error()}
+		}
+		lower = tok.Op == "newer_than"
+	}
+	if tok.Negated {
+		lower = !lower
+	}
+
+	// 同一方向出现多次时取更严格的那个
+	if lower {
+		q.narrow(daterange.Range{Start: t})
+	} else {
+		q.narrow(daterange.Range{End: t})
+	}
+	return nil
+}
+
+// parseDate reads YYYY-MM-DD or YYYY/MM/DD (Gmail's format) as the start
+// of that day. Other date expressions (after:yesterday, before:"last
+// week") give the start of their range.
+func parseDate(value string, dates *daterange.Parser) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "2006/01/02", "2006/1/2"} {
+		if t, err := time.ParseInLocation(layout, value, dates.Now().Location()); err == nil {
+			return t, nil
+		}
+	}
+	if r, err := dates.Parse(value); err == nil && !r.Start.IsZero() {
+		return r.Start, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q (use YYYY-MM-DD, YYYY/MM/DD or an expression like yesterday)", value)
+}
+
+// parseAge reads a Gmail age such as 12h, 7d, 2w, 6m or 1y and returns
+// the time that long before now
+func parseAge(value string, now time.Time) (time.Time, error) {
+	invalid := fmt.Errorf("invalid age %q (use a number and h, d, w, m or y, e.g. 7d)", value)
+	if len(value) < 2 {
+		return time.Time{}, invalid
+	}
+	n, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || n < 0 {
+		return time.Time{}, invalid
+	}
+	switch strings.ToLower(value[len(value)-1:]) {
+	case "h":
+		return now.Add(-time.Duration(n) * time.Hour), nil
+	case "d":
+		return now.AddDate(0, 0, -n), nil
+	case "w":
+		return now.AddDate(0, 0, -7*n), nil
+	case "m":
+		return now.AddDate(0, -n, 0), nil
+	case "y":
+		return now.AddDate(-n, 0, 0), nil
+	}
+	return time.Time{}, invalid
+}
+
+// EmailFilter returns the SQLite filter for the query; nil matches all
+func (q *Query) EmailFilter() *email.Filter {
+	if q == nil {
+		return nil
+	}
+	f := &email.Filter{
+		FromAny:        q.From,
+		ToAny:          q.To,
+		CcAny:          q.Cc,
+		Subject:        q.Subject,
+		Labels:         q.Labels,
+		Text:           q.Phrases,
+		HasAttachments: q.HasAttachment,
+		ThreadID:       q.ThreadID,
+	}
+	if !q.After.IsZero() {
+		after := q.After
+		f.DateFrom = &after
+	}
+	if !q.Before.IsZero() {
+		before := q.Before
+		f.DateTo = &before
+	}
+	for _, term := range q.Not.terms() {
+		f.Not = append(f.Not, *term.EmailFilter())
+	}
+	return f
+}
+
+// VectorFilter returns the Qdrant filter for the query; nil matches all
+func (q *Query) VectorFilter() *vector.Filter {
+	if q == nil {
+		return nil
+	}
+	f := &vector.Filter{
+		From:          q.From,
+		To:            q.To,
+		Cc:            q.Cc,
+		Subject:       q.Subject,
+		Labels:        q.Labels,
+		Text:          q.Phrases,
+		After:         q.After,
+		Before:        q.Before,
+		HasAttachment: q.HasAttachment,
+		ThreadID:      q.ThreadID,
+	}
+	for _, term := range q.Not.terms() {
+		f.Exclude = append(f.Exclude, term.VectorFilter())
+	}
+	return f
+}
+
+// terms splits the conditions of q into one query each, so that negating
+// them drops emails matching any single one
+func (q *Query) terms() []*Query {
+	if q == nil {
+		return nil
+	}
+	var terms []*Query
+	for _, v := range q.From {
+		terms = append(terms, &Query{From: []string{v}})
+	}
+	for _, v := range q.To {
+		terms = append(terms, &Query{To: []string{v}})
+	}
+	for _, v := range q.Cc {
+		terms = append(terms, &Query{Cc: []string{v}})
+	}
+	for _, v := range q.Subject {
+		terms = append(terms, &Query{Subject: []string{v}})
+	}
+	for _, v := range q.Labels {
+		terms = append(terms, &Query{Labels: []string{v}})
+	}
+	for _, v := range q.Phrases {
+		terms = append(terms, &Query{Phrases: []string{v}})
+	}
+	return terms
+}
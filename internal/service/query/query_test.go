@@ -0,0 +1,204 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/vector"
+)
+
+// now is a Sunday noon; relative dates are anchored to it
+var now = time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Query
+	}{
+		{"budget review", Query{Text: "budget review"}},
+		{`"budget overrun" report`, Query{Text: "budget overrun report", Phrases: []string{"budget overrun"}}},
+
+		// 每个操作符
+		{"from:alice@example.com", Query{From: []string{"alice@example.com"}}},
+		{"to:team", Query{To: []string{"team"}}},
+		{"cc:me@example.com", Query{Cc: []string{"me@example.com"}}},
+		{`subject:"Q3 planning"`, Query{Subject: []string{"Q3 planning"}}},
+		{"label:Work", Query{Labels: []string{"Work"}}},
+		{"after:2025-06-01", Query{After: day(2025, 6, 1)}},
+		{"before:2025/06/10", Query{Before: day(2025, 6, 10)}},
+		{"after:yesterday", Query{After: day(2025, 6, 14)}},
+		{"older_than:7d", Query{Before: now.AddDate(0, 0, -7)}},
+		{"newer_than:2w", Query{After: now.AddDate(0, 0, -14)}},
+		{"newer_than:12h", Query{After: now.Add(-12 * time.Hour)}},
+		{"has:attachment", Query{HasAttachment: boolPtr(true)}},
+		{"is:unread", Query{Labels: []string{"UNREAD"}}},
+		{"is:starred is:important", Query{Labels: []string{"STARRED", "IMPORTANT"}}},
+		{"FROM:alice Has:Attachment", Query{From: []string{"alice"}, HasAttachment: boolPtr(true)}},
+		{"re: http://example.com", Query{Text: "re: http://example.com"}},
+		{"from:alice after:2025-06-01 has:attachment budget overrun", Query{
+			Text: "budget overrun", From: []string{"alice"},
+			After: day(2025, 6, 1), HasAttachment: boolPtr(true),
+		}},
+
+		// 同一方向的日期取更严格的一个，文本里的日期表达式也算
+		{"after:2025-06-01 newer_than:7d", Query{After: now.AddDate(0, 0, -7)}},
+		{"report yesterday", Query{Text: "report", After: day(2025, 6, 14), Before: day(2025, 6, 15)}},
+		{`"yesterday" report`, Query{Text: "yesterday report", Phrases: []string{"yesterday"}}},
+
+		// 取反：普通条件进 Not，has/is/日期折叠进查询本身
+		{"-from:noreply@example.com", Query{Not: &Query{From: []string{"noreply@example.com"}}}},
+		{"-draft budget", Query{Text: "budget", Not: &Query{Phrases: []string{"draft"}}}},
+		{`-"out of office"`, Query{Not: &Query{Phrases: []string{"out of office"}}}},
+		{"-label:spam -subject:newsletter", Query{Not: &Query{Labels: []string{"spam"}, Subject: []string{"newsletter"}}}},
+		{"-has:attachment", Query{HasAttachment: boolPtr(false)}},
+		{"-after:2025-06-01", Query{Before: day(2025, 6, 1)}},
+		{"-older_than:7d", Query{After: now.AddDate(0, 0, -7)}},
+		{"is:read", Query{Not: &Query{Labels: []string{"UNREAD"}}}},
+		{"-is:unread", Query{Not: &Query{Labels: []string{"UNREAD"}}}},
+		{"-is:read", Query{Labels: []string{"UNREAD"}}},
+		{"a - b", Query{Text: "a - b"}},
+
+		// 重复的 from:/to:/cc: 是 OR，显式的 OR 可写可不写
+		{"from:alice from:bob", Query{From: []string{"alice", "bob"}}},
+		{"from:alice OR from:bob", Query{From: []string{"alice", "bob"}}},
+		{"to:a OR to:b OR to:c", Query{To: []string{"a", "b", "c"}}},
+		{"cats OR dogs", Query{Text: "cats OR dogs"}},
+		{"from:alice or from:bob", Query{Text: "or", From: []string{"alice", "bob"}}},
+		{"from:alice OR to:bob", Query{Text: "OR", From: []string{"alice"}, To: []string{"bob"}}},
+		{"from:alice OR -from:bob", Query{Text: "OR", From: []string{"alice"}, Not: &Query{From: []string{"bob"}}}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.input, now)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("Parse(%q)\n got %+v\nwant %+v", tt.input, *got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+		term  string
+		pos   int
+	}{
+		{`budget "q3 plan`, "unterminated quote", `"q3 plan`, 7},
+		{`from:"alice`, "unterminated quote", `"alice`, 5},
+		{`-"draft`, "unterminated quote", `"draft`, 1},
+		{"budget from:", "from: needs a value", "from:", 7},
+		{`subject:""`, "subject: needs a value", `subject:""`, 0},
+		{"x has:pdf", "unsupported has:pdf (only has:attachment)", "has:pdf", 2},
+		{"is:muted", "unsupported is:muted (use unread, read, starred or important)", "is:muted", 0},
+		{"after:someday", `invalid date "someday" (use YYYY-MM-DD, YYYY/MM/DD or an expression like yesterday)`, "after:someday", 0},
+		{"a -older_than:7x", `invalid age "7x" (use a number and h, d, w, m or y, e.g. 7d)`, "-older_than:7x", 2},
+		{"newer_than:d", `invalid age "d" (use a number and h, d, w, m or y, e.g. 7d)`, "newer_than:d", 0},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.input, now)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Parse(%q) error = %v, want a SyntaxError", tt.input, err)
+			continue
+		}
+		if syntaxErr.Msg != tt.msg || syntaxErr.Term != tt.term || syntaxErr.Pos != tt.pos {
+			t.Errorf("Parse(%q) error = %+v, want {Term:%s Pos:%d Msg:%s}", tt.input, *syntaxErr, tt.term, tt.pos, tt.msg)
+		}
+	}
+
+	_, err := Parse(`budget "q3 plan`, now)
+	if want := `unterminated quote (at "\"q3 plan", column 8)`; err == nil || err.Error() != want {
+		t.Errorf("error message = %v, want %s", err, want)
+	}
+
+	_, err = Parse("after:2025-06-10 before:2025-06-01", now)
+	if want := "empty date range: nothing is after 2025-06-10 and before 2025-06-01"; err == nil || err.Error() != want {
+		t.Errorf("empty range error = %v, want %s", err, want)
+	}
+}
+
+func TestFilters(t *testing.T) {
+	tests := []struct {
+		input      string
+		wantEmail  *email.Filter
+		wantVector *vector.Filter
+	}{
+		{
+			`from:alice OR from:acme.com to:team subject:budget label:INBOX "Q3 plan" after:2025-06-01 before:2025-06-10 has:attachment`,
+			&email.Filter{
+				FromAny: []string{"alice", "acme.com"}, ToAny: []string{"team"},
+				Subject: []string{"budget"}, Labels: []string{"INBOX"}, Text: []string{"Q3 plan"},
+				DateFrom: ptr(day(2025, 6, 1)), DateTo: ptr(day(2025, 6, 10)), HasAttachments: boolPtr(true),
+			},
+			&vector.Filter{
+				From: []string{"alice", "acme.com"}, To: []string{"team"},
+				Subject: []string{"budget"}, Labels: []string{"INBOX"}, Text: []string{"Q3 plan"},
+				After: day(2025, 6, 1), Before: day(2025, 6, 10), HasAttachment: boolPtr(true),
+			},
+		},
+		{
+			// 每个取反的条件单独排除，命中任何一个就去掉
+			`is:unread -from:noreply@example.com -cc:boss -"out of office" -is:starred`,
+			&email.Filter{
+				Labels: []string{"UNREAD"},
+				Not: []email.Filter{
+					{FromAny: []string{"noreply@example.com"}},
+					{CcAny: []string{"boss"}},
+					{Labels: []string{"STARRED"}},
+					{Text: []string{"out of office"}},
+				},
+			},
+			&vector.Filter{
+				Labels: []string{"UNREAD"},
+				Exclude: []*vector.Filter{
+					{From: []string{"noreply@example.com"}},
+					{Cc: []string{"boss"}},
+					{Labels: []string{"STARRED"}},
+					{Text: []string{"out of office"}},
+				},
+			},
+		},
+		{
+			"-has:attachment older_than:1y",
+			&email.Filter{HasAttachments: boolPtr(false), DateTo: ptr(now.AddDate(-1, 0, 0))},
+			&vector.Filter{HasAttachment: boolPtr(false), Before: now.AddDate(-1, 0, 0)},
+		},
+		{"budget", &email.Filter{}, &vector.Filter{}},
+	}
+	for _, tt := range tests {
+		q, err := Parse(tt.input, now)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.input, err)
+			continue
+		}
+		if got := q.EmailFilter(); !reflect.DeepEqual(got, tt.wantEmail) {
+			t.Errorf("Parse(%q).EmailFilter()\n got %+v\nwant %+v", tt.input, *got, *tt.wantEmail)
+		}
+		if got := q.VectorFilter(); !reflect.DeepEqual(got, tt.wantVector) {
+			t.Errorf("Parse(%q).VectorFilter()\n got %+v\nwant %+v", tt.input, *got, *tt.wantVector)
+		}
+	}
+
+	var q *Query
+	if q.EmailFilter() != nil || q.VectorFilter() != nil {
+		t.Error("a nil query should give nil filters")
+	}
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,87 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+)
+
+// passagesPerEmail caps how many chunks of one email Retrieve returns, so
+// that a single long thread cannot crowd out the other results
+const passagesPerEmail = 3
+
+// Passage is a retrieved chunk of an email, the text a question is
+// answered from. It carries the search result of its email.
+type Passage struct {
+	SearchResult
+
+	Position int
+	Text     string
+}
+
+// Retrieve finds the passages most relevant to text for question
+// answering. Emails are ranked exactly like Search; each contributes its
+// best matching chunks, best email first. An email found only by keyword
+// search contributes its first stored chunks instead.
+func (s *Service) Retrieve(ctx context.Context, text string, opts SearchOptions) ([]Passage, error) {
+	results, hits, err := s.rank(ctx, text, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Qdrant 按分数从高到低返回，同一封邮件的 chunk 保持这个顺序
+	byKey := map[string][]Passage{}
+	for _, hit := range hits {
+		emailID, _ := hit.Payload["email_id"].(string)
+		attachmentID, _ := hit.Payload["attachment_id"].(string)
+		content, _ := hit.Payload["content"].(string)
+		key := emailID + "|" + attachmentID
+		if content == "" || len(byKey[key]) >= passagesPerEmail {
+			continue
+		}
+		position, _ := hit.Payload["chunk_position"].(int64)
+		byKey[key] = append(byKey[key], Passage{Position: int(position), Text: content})
+	}
+
+	var passages []Passage
+	for _, result := range results {
+		found := byKey[result.EmailID+"|"+result.AttachmentID]
+		if len(found) == 0 {
+			if found, err = s.storedPassages(ctx, result); err != nil {
+				return nil, err
+			}
+		}
+		for _, p := range found {
+			p.SearchResult = result
+			passages = append(passages, p)
+		}
+	}
+	return passages, nil
+}
+
+// storedPassages returns the first chunks of an email from SQLite, for
+// emails that only keyword search found
+func (s *Service) storedPassages(ctx context.Context, result SearchResult) ([]Passage, error) {
+	if s.chunkRepo == nil {
+		return nil, nil
+	}
+	chunks, err := s.chunkRepo.ListByEmail(ctx, result.EmailID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chunks of %s: %w", result.EmailID, err)
+	}
+
+	source := result.Source
+	if source == "" {
+		source = SourceBody
+	}
+	var passages []Passage
+	for _, c := range chunks {
+		if c.Source != source || len(passages) >= passagesPerEmail {
+			continue
+		}
+		if result.AttachmentID != "" && c.AttachmentID != result.AttachmentID {
+			continue
+		}
+		passages = append(passages, Passage{Position: c.Position, Text: c.Content})
+	}
+	return passages, nil
+}
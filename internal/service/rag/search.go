@@ -0,0 +1,182 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/keyword"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/vector"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/query"
+)
+
+// Search modes
+const (
+	ModeVector  = "vector"
+	ModeKeyword = "keyword"
+	ModeHybrid  = "hybrid"
+)
+
+// SearchOptions controls a search
+type SearchOptions struct {
+	Limit int
+
+	// Mode is vector, keyword or hybrid; empty uses rag.search.mode
+	Mode string
+
+	// Filter restricts both sides to the emails matching its operators;
+	// its Text is not used (the text argument is what gets ranked). nil
+	// matches all.
+	Filter *query.Query
+}
+
+// Search finds the emails matching text. Vector mode returns cosine
+// scores; keyword and hybrid modes return Reciprocal Rank Fusion scores
+// scaled so that a result ranked first everywhere scores 1.
+func (s *Service) Search(ctx context.Context, text string, opts SearchOptions) ([]SearchResult, error) {
+	results, _, err := s.rank(ctx, text, opts)
+	return results, err
+}
+
+// rank is Search that also returns the vector chunk hits behind the
+// ranking, which Retrieve turns into passages
+func (s *Service) rank(ctx context.Context, text string, opts SearchOptions) ([]SearchResult, []*vector.SearchResult, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil, fmt.Errorf("empty query")
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = 5
+	}
+
+	mode := opts.Mode
+	if mode == "" {
+		mode = s.search.Mode
+	}
+	switch mode {
+	case "", ModeHybrid:
+		if s.keyword == nil {
+			return s.rankVector(ctx, text, opts.Limit, opts.Filter)
+		}
+		return s.hybridSearch(ctx, text, opts.Limit, opts.Filter)
+	case ModeVector:
+		return s.rankVector(ctx, text, opts.Limit, opts.Filter)
+	case ModeKeyword:
+		if s.keyword == nil {
+			return nil, nil, fmt.Errorf("keyword search is not configured")
+		}
+		hits, err := s.keyword.Search(ctx, text, opts.Limit, opts.Filter.EmailFilter())
+		if err != nil {
+			return nil, nil, err
+		}
+		return s.fuse(nil, hits, opts.Limit), nil, nil
+	}
+	return nil, nil, fmt.Errorf("unknown search mode %q (use vector, keyword or hybrid)", mode)
+}
+
+// rankVector runs a plain vector search and records the ranks
+func (s *Service) rankVector(ctx context.Context, text string, limit int, filter *query.Query) ([]SearchResult, []*vector.SearchResult, error) {
+	results, chunks, err := s.vectorSearch(ctx, text, limit, filter.VectorFilter())
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range results {
+		results[i].VectorRank = i + 1
+	}
+	return results, chunks, nil
+}
+
+// hybridSearch fuses the vector and BM25 rankings. Both sides fetch more
+// candidates than limit so that an email ranked low on one side can still
+// make it thanks to the other.
+func (s *Service) hybridSearch(ctx context.Context, text string, limit int, filter *query.Query) ([]SearchResult, []*vector.SearchResult, error) {
+	candidates := limit * 4
+
+	vectorResults, chunks, err := s.vectorSearch(ctx, text, candidates, filter.VectorFilter())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hits, err := s.keyword.Search(ctx, text, candidates, filter.EmailFilter())
+	if errors.Is(err, keyword.ErrUnavailable) {
+		// 不带 FTS5 编译时退回纯向量检索
+		s.logger.Warn("Falling back to vector search", "error", err)
+		return s.rankVector(ctx, text, limit, filter)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return s.fuse(vectorResults, hits, limit), chunks, nil
+}
+
+// fuse merges the two rankings with weighted Reciprocal Rank Fusion:
+// score = Σ weight / (k + rank). Results are keyed like vectorSearch
+// dedupes them, by email and attachment.
+func (s *Service) fuse(vectorResults []SearchResult, hits []*keyword.Hit, limit int) []SearchResult {
+	k := float64(s.search.RRFK)
+	if k <= 0 {
+		k = 60
+	}
+	vw, kw := s.search.VectorWeight, s.search.KeywordWeight
+	if vw == 0 && kw == 0 {
+		vw, kw = 1, 1
+	}
+
+	type fused struct {
+		result SearchResult
+		score  float64
+	}
+	byKey := map[string]*fused{}
+	var order []string
+	get := func(key string) *fused {
+		f, ok := byKey[key]
+		if !ok {
+			f = &fused{}
+			byKey[key] = f
+			order = append(order, key)
+		}
+		return f
+	}
+
+	for i, r := range vectorResults {
+		f := get(r.EmailID + "|" + r.AttachmentID)
+		f.result = r
+		f.result.VectorRank = i + 1
+		f.score += vw / (k + float64(i+1))
+	}
+	for i, h := range hits {
+		f := get(h.EmailID + "|")
+		if f.result.EmailID == "" {
+			f.result = SearchResult{EmailID: h.EmailID, Subject: h.Subject, From: h.From, Source: h.Source}
+		}
+		f.result.KeywordRank = i + 1
+		f.score += kw / (k + float64(i+1))
+	}
+
+	// 满分是两边都排第一
+	best := 0.0
+	if len(vectorResults) > 0 {
+		best += vw / (k + 1)
+	}
+	if len(hits) > 0 {
+		best += kw / (k + 1)
+	}
+
+	results := make([]SearchResult, 0, len(order))
+	for _, key := range order {
+		f := byKey[key]
+		if best > 0 {
+			f.result.Score = float32(f.score / best)
+		}
+		results = append(results, f.result)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
@@ -2,27 +2,57 @@ package rag
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"maps"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode/utf8"
 
+	"github.com/M1ngdaXie/go-local-rag-email/internal/config"
 	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/chunk"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/embedding"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/keyword"
 	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/vector"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/chunker"
 	"github.com/M1ngdaXie/go-local-rag-email/internal/service/llm"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/mailparse"
 	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/tokenizer"
 	"github.com/google/uuid"
 )
 
 // Service orchestrates chunking, embedding, and vector storage
 type Service struct {
 	vectorRepo vector.Repository
+	chunkRepo  chunk.Repository
+	embeddings embedding.Repository
+	emails     email.Repository
 	llmService *llm.Service
 	logger     logger.Logger
-	chunkSize  int // Target tokens per chunk (~500)
-	overlap    int // Overlap between chunks (~50)
+	chunker    chunker.Chunker
+	keyword    keyword.Repository
+	search     config.SearchConfig
+
+	// defaultChunker builds the chunker on first use when none was set
+	defaultChunker sync.Once
+	chunkerErr     error
+
+	// sources lists the chunk sources that get embedded
+	sources map[string]bool
+
+	// embedBatch is the most chunks sent in one embeddings request
+	embedBatch int
+
+	// force re-checks emails that are up to date instead of skipping them
+	force bool
 }
 
 // New creates a new RAG service
@@ -31,68 +61,528 @@ func New(vectorRepo vector.Repository, llmSvc *llm.Service, log logger.Logger) *
 		vectorRepo: vectorRepo,
 		llmService: llmSvc,
 		logger:     log,
-		chunkSize:  500, // ~500 tokens per chunk
-		overlap:    50,  // ~50 token overlap
+		sources:    map[string]bool{SourceBody: true},
+		embedBatch: defaultEmbedBatch,
 	}
 }
 
+// defaultEmbedBatch matches the pipeline.embed_batch default
+const defaultEmbedBatch = 64
+
+// WithChunks stores every chunk (including ones that are not embedded) in SQLite
+func (s *Service) WithChunks(repo chunk.Repository) *Service {
+	s.chunkRepo = repo
+	return s
+}
+
+// WithEmbeddings records every embedded chunk with its model and content
+// hash, so that re-indexing only embeds chunks that changed and deletes the
+// points of chunks that are gone. It needs WithChunks.
+func (s *Service) WithEmbeddings(repo embedding.Repository) *Service {
+	s.embeddings = repo
+	return s
+}
+
+// WithEmails records on each email the content hash it was indexed with,
+// so that importers can tell unchanged emails that are indexed from ones
+// that never were
+func (s *Service) WithEmails(repo email.Repository) *Service {
+	s.emails = repo
+	return s
+}
+
+// WithForce makes Chunk look at every email again, even the ones that are
+// up to date, e.g. after changing the embedding model or the chunker
+func (s *Service) WithForce(force bool) *Service {
+	s.force = force
+	return s
+}
+
+// WithChunker sets the chunking strategy; the default is a 500-token
+// sliding window with 50 tokens of overlap
+func (s *Service) WithChunker(c chunker.Chunker) *Service {
+	s.chunker = c
+	return s
+}
+
+// WithKeyword enables keyword and hybrid search on the FTS5 index
+func (s *Service) WithKeyword(repo keyword.Repository) *Service {
+	s.keyword = repo
+	return s
+}
+
+// WithEmbedBatch caps the chunks sent per embeddings request; a large
+// attachment or a long email is split into several requests
+func (s *Service) WithEmbedBatch(n int) *Service {
+	if n > 0 {
+		s.embedBatch = n
+	}
+	return s
+}
+
+// WithConfig applies the rag section of config.yaml
+func (s *Service) WithConfig(cfg config.RAGConfig) *Service {
+	s.search = cfg.Search
+	s.sources[SourceQuoted] = cfg.IndexQuoted
+	s.sources[SourceSignature] = cfg.IndexSignatures
+	return s
+}
+
+// Chunk sources stored in the "source" payload field and domain.Chunk.Source
+const (
+	SourceBody       = "body"
+	SourceQuoted     = "quoted"
+	SourceSignature  = "signature"
+	SourceAttachment = "attachment"
+)
+
 // SearchResult represents a search result with email metadata
 type SearchResult struct {
 	EmailID string
 	Score   float32
 	Subject string
 	From    string
+
+	// Source is "body" or "attachment"; attachment hits also carry the file
+	Source       string
+	AttachmentID string
+	Filename     string
+
+	// VectorRank and KeywordRank are the 1-based positions in each
+	// ranking; 0 means the result did not come from that side
+	VectorRank  int
+	KeywordRank int
 }
 
-// IndexEmail chunks an email, generates embeddings, and stores in Qdrant
-func (s *Service) IndexEmail(ctx context.Context, email *domain.Email) (err error) {
-    // 【防御 1】防止单个邮件的特殊数据导致整个同步进程崩溃
-    defer func() {
-        if r := recover(); r != nil {
-            err = fmt.Errorf("recovered from panic: %v", r)
-        }
-    }()
+// Document is an email on its way through the chunk, embed and upsert
+// stages. Chunks holds only the chunks that need embedding.
+type Document struct {
+	Email   *domain.Email
+	Chunks  []*domain.Chunk
+	Vectors [][]float32
 
-    content := prepareEmailContent(email)
-    // 【清洗】修复非法 UTF-8，防止 Qdrant SDK 报错
-    content = s.fixUTF8(content)
-    cleanSubject := s.fixUTF8(email.Subject)
+	// Attachment is set when the chunks are the text of an attachment
+	Attachment *domain.Attachment
 
-    if strings.TrimSpace(content) == "" {
-        s.logger.Debug("Skipping email with empty content", "email_id", email.ID)
-        return nil
-    }
+	// Reused counts chunks already embedded with the same content and
+	// model; Stale lists the points of chunks that no longer exist
+	Reused int
+	Stale  []string
+}
 
-    chunks := s.chunkText(content)
-    if len(chunks) == 0 {
-        return nil
-    }
+// Unchanged reports whether the document needs neither embedding nor
+// point deletions
+func (d *Document) Unchanged() bool {
+	return len(d.Chunks) == 0 && len(d.Stale) == 0
+}
 
-    embeddings, err := s.llmService.GenerateEmbeddings(ctx, chunks)
-    if err != nil {
-        return fmt.Errorf("failed to generate embeddings: %w", err)
-    }
+// IndexEmail segments the body into new content, quoted history and
+// signatures, stores every chunk in SQLite and embeds the enabled sources
+func (s *Service) IndexEmail(ctx context.Context, email *domain.Email) error {
+	doc, err := s.Chunk(ctx, email)
+	if err != nil || doc.Unchanged() {
+		return err
+	}
+	docs := []*Document{doc}
+	if err := s.Embed(ctx, docs); err != nil {
+		return err
+	}
+	return s.Upsert(ctx, docs)
+}
 
-    points := make([]*vector.Point, len(chunks))
-    for i, chunk := range chunks {
-        // 【幂等】使用确定性 ID，支持重复运行不重样
-        id := uuid.NewMD5(uuid.Nil, []byte(email.ID+"_"+strconv.Itoa(i))).String()
-        
-        points[i] = &vector.Point{
-            ID:     id,
-            Vector: embeddings[i],
-            Payload: map[string]interface{}{
-                "email_id":       email.ID,
-                "subject":        cleanSubject,
-                "from":           email.From,
-                "date":           email.Date.Format(time.RFC3339),
-                "chunk_position": i,
-                "content":        chunk, // 这里已经是 fixUTF8 过的
-            },
-        }
-    }
+// Chunk is the chunk stage: it splits an email into chunks, stores all of
+// them in SQLite and keeps the ones whose source is embedded and whose
+// content or model changed since they were last embedded
+func (s *Service) Chunk(ctx context.Context, email *domain.Email) (doc *Document, err error) {
+	// 【防御 1】防止单个邮件的特殊数据导致整个同步进程崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("recovered from panic: %v", r)
+		}
+	}()
+
+	doc = &Document{Email: email}
+	// 内容和元数据都没变的邮件什么都不用做
+	if !s.force && s.UpToDate(email) {
+		return doc, nil
+	}
+	chunks, err := s.storedChunks(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if chunks == nil {
+		if chunks, err = s.segmentChunks(ctx, email); err != nil {
+			return nil, err
+		}
+		if len(chunks) == 0 {
+			s.logger.Debug("Skipping email with empty content", "email_id", email.ID)
+		}
+		if s.chunkRepo != nil {
+			if err := s.chunkRepo.ReplaceForEmail(ctx, email.ID, chunks); err != nil {
+				return nil, err
+			}
+		}
+	}
 
-    return s.vectorRepo.Upsert(ctx, points)
+	// 默认只 embed 新写的内容，引用的历史邮件在它自己那封邮件里已经索引过了
+	var embedded []*domain.Chunk
+	for _, c := range chunks {
+		if s.sources[c.Source] {
+			embedded = append(embedded, c)
+		}
+	}
+	if s.embeddings == nil || s.chunkRepo == nil {
+		doc.Chunks = embedded
+		return doc, nil
+	}
+
+	existing, err := s.embeddings.ListByEmail(ctx, email.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.compare(doc, embedded, existing)
+
+	// 复用的点不会重新 upsert，标签、线程这些元数据变了要单独刷新
+	if doc.Reused > 0 && email.IndexedMeta != metadataHash(email) {
+		if err := s.setPayload(ctx, email); err != nil {
+			return nil, err
+		}
+	}
+	// 什么都不用 embed 的邮件到这里就算索引完了，不会再经过 Upsert
+	if doc.Unchanged() {
+		s.markIndexed(ctx, []*Document{doc})
+	}
+	return doc, nil
+}
+
+// storedChunks returns the chunks stored for an email when its content has
+// not changed since it was indexed and they were made by the current
+// chunker, so it need not be chunked again (the semantic chunker embeds
+// every sentence to do so). It returns nil when the email must be chunked.
+func (s *Service) storedChunks(ctx context.Context, email *domain.Email) ([]*domain.Chunk, error) {
+	if s.chunkRepo == nil || !email.Indexed() {
+		return nil, nil
+	}
+	stored, err := s.chunkRepo.ListByEmail(ctx, email.ID)
+	if err != nil {
+		return nil, err
+	}
+	name := s.chunkerName()
+	var chunks []*domain.Chunk
+	for _, c := range stored {
+		if c.AttachmentID != "" {
+			continue
+		}
+		// 换了切块策略（或者是旧版本写的行）就重新切
+		if c.Chunker != name {
+			return nil, nil
+		}
+		chunks = append(chunks, c)
+	}
+	return chunks, nil
+}
+
+// compare keeps in doc.Chunks the chunks whose content or model changed
+// since they were embedded, and lists the points of records that match no
+// chunk any more as stale
+func (s *Service) compare(doc *Document, chunks []*domain.Chunk, existing []*domain.Embedding) {
+	// 按 embedding 记录对比：内容和模型都没变的 chunk 不再花钱 embed
+	known := make(map[string]*domain.Embedding, len(existing))
+	for _, e := range existing {
+		known[e.VectorID] = e
+	}
+	model := s.llmService.Model()
+	for _, c := range chunks {
+		id := doc.pointID(c)
+		if e, ok := known[id]; ok && e.ContentHash == c.ContentHash && e.Model == model {
+			doc.Reused++
+		} else {
+			doc.Chunks = append(doc.Chunks, c)
+		}
+		delete(known, id)
+	}
+	// 剩下的记录对应的 chunk 已经不存在了（邮件变短，或者不再 embed 这个来源）
+	for id := range known {
+		doc.Stale = append(doc.Stale, id)
+	}
+}
+
+// RefreshMetadata rewrites the email-level payload fields (sender, date,
+// labels, thread) of every vector of an email without re-embedding it,
+// e.g. after a relabel or rethread
+func (s *Service) RefreshMetadata(ctx context.Context, email *domain.Email) error {
+	if err := s.setPayload(ctx, email); err != nil {
+		return err
+	}
+	// 内容已经索引过的邮件记下新的元数据，下次 index 就能跳过它
+	if email.Indexed() {
+		s.markIndexed(ctx, []*Document{{Email: email}})
+	}
+	return nil
+}
+
+func (s *Service) setPayload(ctx context.Context, email *domain.Email) error {
+	return s.vectorRepo.SetPayload(ctx, email.ID, metadataPayload(email))
+}
+
+// UpToDate reports whether an email's content and metadata have not
+// changed since it was indexed, so indexing it again would do nothing
+func (s *Service) UpToDate(email *domain.Email) bool {
+	return email.Indexed() && email.IndexedMeta == metadataHash(email)
+}
+
+// Embed is the embed stage: it embeds the chunks of several documents,
+// at most embedBatch chunks per API request, and fills in their Vectors
+func (s *Service) Embed(ctx context.Context, docs []*Document) error {
+	var inputs []string
+	for _, doc := range docs {
+		for _, c := range doc.Chunks {
+			inputs = append(inputs, c.Content)
+		}
+	}
+	if len(inputs) == 0 {
+		return nil
+	}
+
+	embeddings := make([][]float32, 0, len(inputs))
+	for start := 0; start < len(inputs); start += s.embedBatch {
+		batch := inputs[start:min(start+s.embedBatch, len(inputs))]
+		vectors, err := s.llmService.GenerateEmbeddings(ctx, batch)
+		if err != nil {
+			return fmt.Errorf("failed to generate embeddings: %w", err)
+		}
+		// 少返回了向量时按位置对不上，宁可整批失败
+		if len(vectors) != len(batch) {
+			return fmt.Errorf("got %d embeddings for %d chunks", len(vectors), len(batch))
+		}
+		embeddings = append(embeddings, vectors...)
+	}
+
+	for _, doc := range docs {
+		doc.Vectors, embeddings = embeddings[:len(doc.Chunks)], embeddings[len(doc.Chunks):]
+	}
+	return nil
+}
+
+// Upsert is the upsert stage: it writes the embedded chunks of documents
+// to Qdrant, records them and deletes the points of stale chunks
+func (s *Service) Upsert(ctx context.Context, docs []*Document) error {
+	var points []*vector.Point
+	var records []*domain.Embedding
+	var stale []string
+	for _, doc := range docs {
+		email := doc.Email
+		// 【清洗】修复非法 UTF-8，防止 Qdrant SDK 报错
+		cleanSubject := s.fixUTF8(email.Subject)
+		chunkerName := s.chunkerName()
+
+		for i, c := range doc.Chunks {
+			if i >= len(doc.Vectors) {
+				break
+			}
+			id := doc.pointID(c)
+
+			point := &vector.Point{
+				ID:     id,
+				Vector: doc.Vectors[i],
+				Payload: map[string]interface{}{
+					"email_id":       email.ID,
+					"subject":        cleanSubject,
+					"from":           email.From,
+					"date":           email.Date.Format(time.RFC3339),
+					"chunk_position": c.Position,
+					"content":        c.Content, // 这里已经是 fixUTF8 过的
+					"source":         c.Source,
+					"chunker":        chunkerName,
+				},
+			}
+			if att := doc.Attachment; att != nil {
+				point.Payload["attachment_id"] = att.ID
+				point.Payload["filename"] = s.fixUTF8(att.Filename)
+				point.Payload["mime_type"] = att.MimeType
+			}
+			addHeaderPayload(point.Payload, email)
+			points = append(points, point)
+			records = append(records, &domain.Embedding{
+				ChunkID:      c.ID,
+				EmailID:      email.ID,
+				AttachmentID: c.AttachmentID,
+				VectorID:     id,
+				Model:        s.llmService.Model(),
+				Dim:          len(doc.Vectors[i]),
+				ContentHash:  c.ContentHash,
+			})
+		}
+		stale = append(stale, doc.Stale...)
+	}
+
+	if len(points) > 0 {
+		if err := s.vectorRepo.Upsert(ctx, points); err != nil {
+			return err
+		}
+	}
+	if len(stale) > 0 {
+		if err := s.vectorRepo.Delete(ctx, stale); err != nil {
+			return fmt.Errorf("failed to delete stale points: %w", err)
+		}
+	}
+	if s.embeddings == nil || s.chunkRepo == nil {
+		s.markIndexed(ctx, docs)
+		return nil
+	}
+	// 先写 Qdrant 再记账：记录丢了只会多 embed 一次，反过来会漏索引
+	if err := s.embeddings.Save(ctx, records); err != nil {
+		return err
+	}
+	if err := s.embeddings.DeleteByVectorIDs(ctx, stale); err != nil {
+		return err
+	}
+	s.markIndexed(ctx, docs)
+	return nil
+}
+
+// markIndexed records the emails of documents as indexed. A lost record
+// only means the email is chunked again next time, so it is logged.
+func (s *Service) markIndexed(ctx context.Context, docs []*Document) {
+	if s.emails == nil {
+		return
+	}
+	var emails []*domain.Email
+	for _, doc := range docs {
+		// 附件的文档不代表邮件本身索引完了
+		if doc.Attachment == nil {
+			doc.Email.IndexedMeta = metadataHash(doc.Email)
+			emails = append(emails, doc.Email)
+		}
+	}
+	if len(emails) == 0 {
+		return
+	}
+	if err := s.emails.MarkIndexed(ctx, emails); err != nil {
+		s.logger.Warn("Failed to record indexed emails", "count", len(emails), "error", err)
+	}
+}
+
+// pointID derives the Qdrant point ID of a chunk from its email (or
+// attachment) and position
+func pointID(ownerID string, position int) string {
+	// 【幂等】使用确定性 ID，支持重复运行不重样
+	return uuid.NewMD5(uuid.Nil, []byte(ownerID+"_"+strconv.Itoa(position))).String()
+}
+
+// pointID is the point ID of one of the document's chunks
+func (d *Document) pointID(c *domain.Chunk) string {
+	if d.Attachment != nil {
+		return pointID(d.Attachment.ID, c.Position)
+	}
+	return pointID(d.Email.ID, c.Position)
+}
+
+// segmentChunks splits an email into chunks tagged with their source.
+// Body chunks come first and carry the subject/sender/recipient header, so
+// their positions (and point IDs) are stable whatever the quoted tail holds.
+func (s *Service) segmentChunks(ctx context.Context, email *domain.Email) ([]*domain.Chunk, error) {
+	texts := map[string][]string{}
+	for _, seg := range mailparse.SegmentText(email.BodyText) {
+		texts[string(seg.Kind)] = append(texts[string(seg.Kind)], seg.Text)
+	}
+
+	var chunks []*domain.Chunk
+	add := func(source, text string) error {
+		pieces, err := s.chunkText(ctx, s.fixUTF8(text))
+		if err != nil {
+			return err
+		}
+		for _, piece := range pieces {
+			c := &domain.Chunk{
+				EmailID:  email.ID,
+				Content:  piece.Text,
+				Position: len(chunks),
+				TokenCnt: piece.Tokens,
+				Source:   source,
+				Chunker:  s.chunkerName(),
+			}
+			c.ContentHash = c.ComputeHash()
+			chunks = append(chunks, c)
+		}
+		return nil
+	}
+
+	if err := add(SourceBody, prepareEmailContent(email, strings.Join(texts[SourceBody], "\n\n"))); err != nil {
+		return nil, err
+	}
+	if err := add(SourceQuoted, strings.Join(texts[SourceQuoted], "\n\n")); err != nil {
+		return nil, err
+	}
+	if err := add(SourceSignature, strings.Join(texts[SourceSignature], "\n\n")); err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
+// IndexAttachment chunks the extracted text of an attachment and stores it
+// with source=attachment, so search can hit contracts and spreadsheets.
+// Like an email, only changed chunks are embedded again and the points of
+// chunks that are gone are deleted.
+func (s *Service) IndexAttachment(ctx context.Context, email *domain.Email, att *domain.Attachment, text string) error {
+	doc, err := s.ChunkAttachment(ctx, email, att, text)
+	if err != nil || doc.Unchanged() {
+		return err
+	}
+	docs := []*Document{doc}
+	if err := s.Embed(ctx, docs); err != nil {
+		return err
+	}
+	return s.Upsert(ctx, docs)
+}
+
+// ChunkAttachment is Chunk for the extracted text of an attachment. Every
+// chunk is prefixed with the file name and email subject.
+func (s *Service) ChunkAttachment(ctx context.Context, email *domain.Email, att *domain.Attachment, text string) (*Document, error) {
+	doc := &Document{Email: email, Attachment: att}
+
+	var chunks []*domain.Chunk
+	if text = s.fixUTF8(strings.TrimSpace(text)); text != "" {
+		// 每个 chunk 都带上文件名和邮件主题，检索 "合同 PDF" 之类的问题时更容易命中
+		header := "Attachment: " + s.fixUTF8(att.Filename)
+		if email.Subject != "" {
+			header += "\nEmail subject: " + s.fixUTF8(email.Subject)
+		}
+		pieces, err := s.chunkText(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		for i, piece := range pieces {
+			c := &domain.Chunk{
+				EmailID:      email.ID,
+				AttachmentID: att.ID,
+				Content:      header + "\n\n" + piece.Text,
+				Position:     i,
+				TokenCnt:     piece.Tokens,
+				Source:       SourceAttachment,
+				Chunker:      s.chunkerName(),
+			}
+			c.ContentHash = c.ComputeHash()
+			chunks = append(chunks, c)
+		}
+	}
+
+	// 文本变空时也要写一次，把旧的 chunk 和向量清掉
+	if s.chunkRepo != nil {
+		if err := s.chunkRepo.ReplaceForAttachment(ctx, email.ID, att.ID, chunks); err != nil {
+			return nil, err
+		}
+	}
+	if s.embeddings == nil || s.chunkRepo == nil {
+		doc.Chunks = chunks
+		return doc, nil
+	}
+	existing, err := s.embeddings.ListByAttachment(ctx, att.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.compare(doc, chunks, existing)
+	return doc, nil
 }
 
 // 辅助函数：清洗无效字符
@@ -123,25 +613,27 @@ func (s *Service) IndexEmails(ctx context.Context, emails []*domain.Email) error
 	return nil
 }
 
-// Search performs semantic search and returns matching email IDs with scores
-func (s *Service) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+// vectorSearch performs semantic search and returns matching email IDs
+// with their cosine scores, along with the raw chunk hits (best first)
+func (s *Service) vectorSearch(ctx context.Context, query string, limit int, filter *vector.Filter) ([]SearchResult, []*vector.SearchResult, error) {
 	if strings.TrimSpace(query) == "" {
-		return nil, fmt.Errorf("empty query")
+		return nil, nil, fmt.Errorf("empty query")
 	}
 
 	// Step 1: Generate query embedding
 	queryVector, err := s.llmService.GenerateEmbedding(ctx, query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to embed query: %w", err)
+		return nil, nil, fmt.Errorf("failed to embed query: %w", err)
 	}
 
 	// Step 2: Search Qdrant
 	searchResults, err := s.vectorRepo.Search(ctx, queryVector, vector.SearchOptions{
 	    Limit: limit * 3,
 	    ScoreThreshold: 0.1,
+	    Filter: filter,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("vector search failed: %w", err)
+		return nil, nil, fmt.Errorf("vector search failed: %w", err)
 	}
 	s.logger.Debug("Qdrant search completed", "raw_results", len(searchResults))
 	// Step 3: Deduplicate by email_id
@@ -160,13 +652,22 @@ func (s *Service) Search(ctx context.Context, query string, limit int) ([]Search
             continue
         }
 		
-        existing, exists := emailScores[emailID]
+        // 正文和每个附件分别去重，同一封邮件的合同 PDF 和正文可以同时出现
+        source, _ := r.Payload["source"].(string)
+        attachmentID, _ := r.Payload["attachment_id"].(string)
+        filename, _ := r.Payload["filename"].(string)
+        key := emailID + "|" + attachmentID
+
+        existing, exists := emailScores[key]
         if !exists || r.Score > existing.Score {
-            emailScores[emailID] = SearchResult{
-                EmailID: emailID,
-                Score:   r.Score,
-                Subject: subject, // 使用刚才断言出的变量
-                From:    from,    // 使用刚才断言出的变量
+            emailScores[key] = SearchResult{
+                EmailID:      emailID,
+                Score:        r.Score,
+                Subject:      subject, // 使用刚才断言出的变量
+                From:         from,    // 使用刚才断言出的变量
+                Source:       source,
+                AttachmentID: attachmentID,
+                Filename:     filename,
             }
         }
     }
@@ -187,55 +688,82 @@ func (s *Service) Search(ctx context.Context, query string, limit int) ([]Search
         finalResults = finalResults[:limit]
     }
 
-    return finalResults, nil
+    return finalResults, searchResults, nil
 }
 
-// DeleteEmailIndex removes all vectors for an email
-func (s *Service) DeleteEmailIndex(ctx context.Context, emailID string) error {
-	return s.vectorRepo.DeleteByEmailID(ctx, emailID)
+// DeleteByEmailID removes all vectors of an email and forgets its
+// embedding records, so the email is embedded again if it comes back
+func (s *Service) DeleteByEmailID(ctx context.Context, emailID string) error {
+	if err := s.vectorRepo.DeleteByEmailID(ctx, emailID); err != nil {
+		return err
+	}
+	if s.embeddings == nil {
+		return nil
+	}
+	return s.embeddings.DeleteByEmail(ctx, emailID)
 }
 
-// chunkText splits text into overlapping chunks
-func (s *Service) chunkText(text string) []string {
-	text = strings.TrimSpace(text)
-	if text == "" {
-		return []string{}
+// chunkText cuts text with the configured chunker. Token counts come
+// from the BPE vocabulary of the embedding model, so CJK text is sized
+// correctly and a chunk never ends in the middle of a character.
+func (s *Service) chunkText(ctx context.Context, text string) ([]tokenizer.Piece, error) {
+	c, err := s.textChunker()
+	if err != nil {
+		return nil, err
 	}
+	return c.Chunk(ctx, text)
+}
 
-	charChunkSize := s.chunkSize * 4 // ~4 chars per token
-	charOverlap := s.overlap * 4
+// textChunker returns the configured chunker, or a 500/50 token sliding
+// window when WithChunker was not called
+func (s *Service) textChunker() (chunker.Chunker, error) {
+	s.defaultChunker.Do(func() {
+		if s.chunker != nil {
+			return
+		}
+		tok, err := s.tokenizer()
+		if err != nil {
+			s.chunkerErr = err
+			return
+		}
+		s.chunker = chunker.NewFixed(tok, chunker.DefaultSize, chunker.DefaultOverlap)
+	})
+	return s.chunker, s.chunkerErr
+}
 
-	// If text is short enough, return as single chunk
-	if len(text) <= charChunkSize {
-		return []string{text}
+// chunkerName is stored in the payload so search results can be traced
+// back to the strategy that produced them
+func (s *Service) chunkerName() string {
+	c, err := s.textChunker()
+	if err != nil {
+		return chunker.StrategyFixed
 	}
+	return c.Name()
+}
 
-	var chunks []string
-
-	for i := 0; i < len(text); i += (charChunkSize - charOverlap) {
-	    end := min(i+charChunkSize, len(text))
-	    chunk := strings.TrimSpace(text[i:end])
-	    if chunk != "" {
-	        chunks = append(chunks, chunk)
-	    }
-	    if end == len(text) {
-	        break
-	    }
+// tokenizer returns the tokenizer of the embedding model
+func (s *Service) tokenizer() (*tokenizer.Tokenizer, error) {
+	model := ""
+	if s.llmService != nil {
+		model = s.llmService.Model()
 	}
-
-	return chunks
+	tok, err := tokenizer.ForModel(model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokenizer: %w", err)
+	}
+	return tok, nil
 }
 
-// prepareEmailContent combines subject and body for indexing
-func prepareEmailContent(email *domain.Email) string {
+// prepareEmailContent combines subject, the new body text and headers for indexing
+func prepareEmailContent(email *domain.Email, body string) string {
 	var parts []string
 
 	if email.Subject != "" {
 		parts = append(parts, "Subject: "+email.Subject)
 	}
 
-	if email.BodyText != "" {
-		parts = append(parts, email.BodyText)
+	if body != "" {
+		parts = append(parts, body)
 	}
 
 	if email.From != ""{
@@ -245,11 +773,88 @@ func prepareEmailContent(email *domain.Email) string {
     parts = append(parts, "Date: "+email.Date.Format("January 2, 2006"))
 	}
 
-	if email.ToJSON != "" {
-    cleanTo := strings.NewReplacer("[", "", "]", "", "\"", "").Replace(email.ToJSON)
-    parts = append(parts, "To: "+cleanTo)
+	if to, _ := email.GetToList(); len(to) > 0 {
+		parts = append(parts, "To: "+joinAddresses(to))
+	}
+	if cc, _ := email.GetCcList(); len(cc) > 0 {
+		parts = append(parts, "Cc: "+joinAddresses(cc))
+	}
+
+	return strings.Join(parts, "\n\n")
 }
 
+// addHeaderPayload stores recipients and threading headers alongside each
+// chunk so search results can be filtered and displayed without a DB lookup
+func addHeaderPayload(payload map[string]interface{}, email *domain.Email) {
+	if to, _ := email.GetToList(); len(to) > 0 {
+		payload["to"] = addressValues(to)
+	}
+	if cc, _ := email.GetCcList(); len(cc) > 0 {
+		payload["cc"] = addressValues(cc)
+	}
+	if email.MessageID != "" {
+		payload["message_id"] = email.MessageID
+	}
+	if email.ListID != "" {
+		payload["list_id"] = email.ListID
+	}
+	maps.Copy(payload, metadataPayload(email))
+}
 
-	return strings.Join(parts, "\n\n")
+// metadataPayload holds the payload fields search filters on; they are
+// indexed in Qdrant (see database.payloadIndexes). Addresses, domains and
+// labels are lowercased so filters can match case-insensitively.
+func metadataPayload(email *domain.Email) map[string]interface{} {
+	payload := map[string]interface{}{
+		"from":           email.From,
+		"thread_id":      email.ThreadID,
+		"labels":         []interface{}{},
+		"has_attachment": email.HasAttachments,
+	}
+	if !email.Date.IsZero() {
+		payload["date"] = email.Date.Format(time.RFC3339)
+		payload["timestamp"] = email.Date.Unix()
+	}
+	if from := mailparse.ParseAddressList(email.From); len(from) > 0 {
+		address := strings.ToLower(strings.ToValidUTF8(from[0].Address, ""))
+		payload["from_address"] = address
+		if at := strings.LastIndex(address, "@"); at >= 0 {
+			payload["from_domain"] = address[at+1:]
+		}
+	}
+	if labels, _ := email.GetLabels(); len(labels) > 0 {
+		values := make([]interface{}, len(labels))
+		for i, l := range labels {
+			values[i] = strings.ToLower(strings.ToValidUTF8(l, ""))
+		}
+		payload["labels"] = values
+	}
+	return payload
+}
+
+// metadataHash fingerprints the metadata payload of an email, to tell
+// whether its points need a SetPayload
+func metadataHash(email *domain.Email) string {
+	// map 按 key 排序编码，同样的元数据得到同样的 hash
+	data, _ := json.Marshal(metadataPayload(email))
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// addressValues returns bare addresses as []interface{}, the list type the
+// Qdrant client knows how to encode
+func addressValues(addrs []domain.Address) []interface{} {
+	values := make([]interface{}, 0, len(addrs))
+	for _, a := range addrs {
+		values = append(values, strings.ToValidUTF8(a.Address, ""))
+	}
+	return values
+}
+
+func joinAddresses(addrs []domain.Address) string {
+	parts := make([]string, len(addrs))
+	for i, a := range addrs {
+		parts[i] = a.String()
+	}
+	return strings.Join(parts, ", ")
 }
@@ -0,0 +1,411 @@
+package rag_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/config"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/database"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/chunk"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/embedding"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/vector"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/llm"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/rag"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/tokenizer"
+	"gorm.io/gorm"
+)
+
+// embeddingServer stands in for the embeddings endpoint. It records the
+// size of each request and, with short set, returns one vector too few.
+type embeddingServer struct {
+	mu       sync.Mutex
+	requests []int
+	short    bool
+}
+
+func (e *embeddingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Input []string `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	e.mu.Lock()
+	e.requests = append(e.requests, len(req.Input))
+	n := len(req.Input)
+	if e.short {
+		n--
+	}
+	e.mu.Unlock()
+
+	data := make([]map[string]interface{}, n)
+	for i := range data {
+		data[i] = map[string]interface{}{"object": "embedding", "index": i, "embedding": []float32{float32(i), 1}}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"object": "list", "data": data, "model": "test-embedding"})
+}
+
+func (e *embeddingServer) calls() []int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.requests)
+}
+
+// fakeVectors keeps the points in memory and counts SetPayload calls
+type fakeVectors struct {
+	vector.Repository
+	points   map[string]*vector.Point
+	deleted  []string
+	payloads int
+}
+
+func (f *fakeVectors) Upsert(_ context.Context, points []*vector.Point) error {
+	for _, p := range points {
+		f.points[p.ID] = p
+	}
+	return nil
+}
+
+func (f *fakeVectors) Delete(_ context.Context, ids []string) error {
+	for _, id := range ids {
+		delete(f.points, id)
+	}
+	f.deleted = append(f.deleted, ids...)
+	return nil
+}
+
+func (f *fakeVectors) SetPayload(context.Context, string, map[string]interface{}) error {
+	f.payloads++
+	return nil
+}
+
+// lineChunker makes one chunk per line, so tests control the chunks
+type lineChunker struct{}
+
+func (lineChunker) Name() string { return "lines" }
+
+func (lineChunker) Chunk(_ context.Context, text string) ([]tokenizer.Piece, error) {
+	var pieces []tokenizer.Piece
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			pieces = append(pieces, tokenizer.Piece{Text: line, Tokens: len(strings.Fields(line))})
+		}
+	}
+	return pieces, nil
+}
+
+type fixture struct {
+	db      *gorm.DB
+	server  *embeddingServer
+	vectors *fakeVectors
+	svc     *rag.Service
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	log := logger.NewSlog("error")
+	db, err := database.NewSQLite(config.SQLiteConfig{
+		Path:            filepath.Join(t.TempDir(), "emails.db"),
+		MaxOpenConns:    1,
+		MaxIdleConns:    1,
+		ConnMaxLifetime: time.Hour,
+	}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &embeddingServer{}
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+	llmSvc, err := llm.New(config.OpenAIConfig{APIKey: "test", BaseURL: srv.URL, EmbeddingModel: "test-embedding"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vectors := &fakeVectors{points: map[string]*vector.Point{}}
+	svc := rag.New(vectors, llmSvc, log).
+		WithChunks(chunk.NewSQLiteRepository(db, log)).
+		WithEmbeddings(embedding.NewSQLiteRepository(db, log)).
+		WithEmails(email.NewSQLiteRepository(db, log)).
+		WithChunker(lineChunker{}).
+		WithEmbedBatch(2)
+	return &fixture{db: db, server: server, vectors: vectors, svc: svc}
+}
+
+// chunks returns the stored chunk contents of a source, in order
+func (f *fixture) chunks(t *testing.T, source string) []string {
+	t.Helper()
+	var contents []string
+	err := f.db.Model(&domain.Chunk{}).Where("source = ?", source).
+		Order("attachment_id, position").Pluck("content", &contents).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
+
+func TestIndexAttachment(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	email := &domain.Email{ID: "e1", Subject: "Invoice", From: "billing@acme.com", BodyText: "Please find the invoice attached."}
+	att := &domain.Attachment{ID: "e1-att", EmailID: "e1", Filename: "invoice.pdf", MimeType: "application/pdf"}
+
+	if err := f.svc.IndexEmail(ctx, email); err != nil {
+		t.Fatal(err)
+	}
+	bodyPoints := len(f.vectors.points)
+
+	text := "Invoice INV-2024-0012\nTotal 1200 EUR\nDue 2024-07-01\nIBAN DE00 1234\nThank you"
+	if err := f.svc.IndexAttachment(ctx, email, att, text); err != nil {
+		t.Fatal(err)
+	}
+
+	// 附件的 chunk 写进 chunks 表，关键词检索才搜得到
+	stored := f.chunks(t, rag.SourceAttachment)
+	if len(stored) != 5 || stored[0] != "Attachment: invoice.pdf\nEmail subject: Invoice\n\nInvoice INV-2024-0012" {
+		t.Fatalf("attachment chunks = %q", stored)
+	}
+	// 五个 chunk 按每批两个分三次请求
+	if got := f.server.calls(); !slices.Equal(got[len(got)-3:], []int{2, 2, 1}) {
+		t.Errorf("embeddings requests = %v, want the last three of sizes [2 2 1]", got)
+	}
+	if got := len(f.vectors.points) - bodyPoints; got != 5 {
+		t.Fatalf("attachment added %d points, want 5", got)
+	}
+	for _, p := range f.vectors.points {
+		if p.Payload["source"] == rag.SourceAttachment && (p.Payload["attachment_id"] != att.ID || p.Payload["filename"] != "invoice.pdf") {
+			t.Errorf("attachment point payload = %v", p.Payload)
+		}
+	}
+
+	// 内容没变时不再请求 embedding
+	requests := len(f.server.calls())
+	if err := f.svc.IndexAttachment(ctx, email, att, text); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(f.server.calls()); got != requests {
+		t.Errorf("re-indexing the same text made %d embeddings requests", got-requests)
+	}
+
+	// 重新抽取后变短：多出来的点和记录要删掉，前两块复用
+	if err := f.svc.IndexAttachment(ctx, email, att, "Invoice INV-2024-0012\nTotal 1200 EUR"); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(f.server.calls()); got != requests {
+		t.Errorf("unchanged chunks were embedded again (%d requests)", got-requests)
+	}
+	if len(f.vectors.deleted) != 3 {
+		t.Errorf("deleted %d stale points, want 3", len(f.vectors.deleted))
+	}
+	if got := len(f.vectors.points) - bodyPoints; got != 2 {
+		t.Errorf("attachment has %d points, want 2", got)
+	}
+	if stored := f.chunks(t, rag.SourceAttachment); len(stored) != 2 {
+		t.Errorf("attachment chunks = %q, want 2", stored)
+	}
+	var records int64
+	f.db.Model(&domain.Embedding{}).Where("attachment_id = ?", att.ID).Count(&records)
+	if records != 2 {
+		t.Errorf("%d embedding records for the attachment, want 2", records)
+	}
+
+	// 重新索引邮件正文不能把附件的 chunk 和点当成多余的删掉
+	email.BodyText = "Please find the corrected invoice attached."
+	if err := f.svc.IndexEmail(ctx, email); err != nil {
+		t.Fatal(err)
+	}
+	if stored := f.chunks(t, rag.SourceAttachment); len(stored) != 2 {
+		t.Errorf("re-indexing the email left attachment chunks %q", stored)
+	}
+	if got := len(f.vectors.points); got != bodyPoints+2 {
+		t.Errorf("%d points after re-indexing the email, want %d", got, bodyPoints+2)
+	}
+}
+
+func TestIndexAttachmentShortEmbeddings(t *testing.T) {
+	f := newFixture(t)
+	f.server.short = true
+	email := &domain.Email{ID: "e1", Subject: "Report"}
+	att := &domain.Attachment{ID: "e1-att", EmailID: "e1", Filename: "report.pdf"}
+
+	err := f.svc.IndexAttachment(context.Background(), email, att, "page one\npage two\npage three")
+	if err == nil || !strings.Contains(err.Error(), "got 1 embeddings for 2 chunks") {
+		t.Fatalf("IndexAttachment = %v, want an error about the missing embeddings", err)
+	}
+	if len(f.vectors.points) != 0 {
+		t.Errorf("%d points written from a short response", len(f.vectors.points))
+	}
+}
+
+func TestIndexEmailMarksIndexed(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	repo := email.NewSQLiteRepository(f.db, logger.NewSlog("error"))
+	stored := func() *domain.Email {
+		t.Helper()
+		e, err := repo.Get(ctx, "e1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	e := &domain.Email{ID: "e1", Subject: "Lunch", BodyText: "Noon at the usual place?"}
+	if _, err := repo.Upsert(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	if stored().Indexed() {
+		t.Fatal("a new email is marked indexed")
+	}
+	if err := f.svc.IndexEmail(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	if !stored().Indexed() {
+		t.Fatal("IndexEmail did not record the email as indexed")
+	}
+
+	// 内容变了以后，旧的索引状态不再算数
+	e.BodyText = "Noon at the new place?"
+	if _, err := repo.Upsert(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	if stored().Indexed() {
+		t.Error("a changed email is still marked indexed")
+	}
+}
+
+// countingChunker counts how often text is chunked, like a semantic
+// chunker counts embeddings requests
+type countingChunker struct {
+	lineChunker
+	name  string
+	calls int
+}
+
+func (c *countingChunker) Name() string { return c.name }
+
+func (c *countingChunker) Chunk(ctx context.Context, text string) ([]tokenizer.Piece, error) {
+	c.calls++
+	return c.lineChunker.Chunk(ctx, text)
+}
+
+func TestChunkReusesStoredChunks(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	repo := email.NewSQLiteRepository(f.db, logger.NewSlog("error"))
+	counter := &countingChunker{name: "semantic"}
+	f.svc.WithChunker(counter)
+
+	e := &domain.Email{ID: "e1", Subject: "Plan", BodyText: "First line\nSecond line"}
+	if _, err := repo.Upsert(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.svc.IndexEmail(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	if counter.calls == 0 {
+		t.Fatal("the email was not chunked")
+	}
+	before := f.chunks(t, rag.SourceBody)
+
+	// 从库里读出来的邮件带着索引状态，没变就不再切块；
+	// --force 时也只是复用存好的 chunk 和记录对一遍
+	counter.calls = 0
+	stored, err := repo.Get(ctx, "e1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.svc.WithForce(true)
+	doc, err := f.svc.Chunk(ctx, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counter.calls != 0 {
+		t.Errorf("an unchanged, indexed email was chunked %d times", counter.calls)
+	}
+	if !doc.Unchanged() || doc.Reused != len(before) {
+		t.Errorf("doc = %d chunks to embed, %d reused; want all %d reused", len(doc.Chunks), doc.Reused, len(before))
+	}
+	if after := f.chunks(t, rag.SourceBody); !slices.Equal(after, before) {
+		t.Errorf("stored chunks changed from %q to %q", before, after)
+	}
+
+	// 换了切块策略要重新切
+	counter.name = "recursive"
+	if _, err := f.svc.Chunk(ctx, stored); err != nil {
+		t.Fatal(err)
+	}
+	if counter.calls == 0 {
+		t.Error("changing the chunker did not chunk the email again")
+	}
+}
+
+func TestChunkSkipsUpToDateEmails(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	repo := email.NewSQLiteRepository(f.db, logger.NewSlog("error"))
+	payloads := f.vectors
+
+	e := &domain.Email{ID: "e1", Subject: "Plan", BodyText: "First line\nSecond line"}
+	if _, err := repo.Upsert(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.svc.IndexEmail(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := repo.Get(ctx, "e1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.svc.UpToDate(stored) {
+		t.Fatal("an indexed email is not up to date")
+	}
+	doc, err := f.svc.Chunk(ctx, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !doc.Unchanged() || doc.Reused != 0 || payloads.payloads != 0 {
+		t.Errorf("up-to-date email: %d chunks, %d reused, %d SetPayload calls; want it skipped", len(doc.Chunks), doc.Reused, payloads.payloads)
+	}
+
+	// 只是重建了线程：不重新 embed，只刷新一次元数据
+	stored.ThreadID = "t-42"
+	if f.svc.UpToDate(stored) {
+		t.Fatal("an email with a new thread is up to date")
+	}
+	if err := f.svc.IndexEmail(ctx, stored); err != nil {
+		t.Fatal(err)
+	}
+	if payloads.payloads != 1 {
+		t.Errorf("%d SetPayload calls after a rethread, want 1", payloads.payloads)
+	}
+	if !f.svc.UpToDate(stored) {
+		t.Error("the rethreaded email is not up to date after indexing")
+	}
+
+	// 标签变了内容 hash 也会变，但没有 chunk 要重新 embed
+	requests := len(f.server.calls())
+	stored.SetLabels([]string{"INBOX", "IMPORTANT"})
+	if _, err := repo.Upsert(ctx, stored); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.svc.IndexEmail(ctx, stored); err != nil {
+		t.Fatal(err)
+	}
+	if payloads.payloads != 2 || len(f.server.calls()) != requests {
+		t.Errorf("relabel made %d SetPayload calls and %d embeddings requests, want 2 and none", payloads.payloads, len(f.server.calls())-requests)
+	}
+}
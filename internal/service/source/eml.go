@@ -0,0 +1,100 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+)
+
+// EML reads loose .eml files matched by glob patterns. A pattern that names
+// a directory is walked recursively for *.eml files.
+type EML struct {
+	patterns []string
+	failures []Failure
+}
+
+// NewEML creates a source over the files matching patterns
+func NewEML(patterns ...string) *EML {
+	return &EML{patterns: patterns}
+}
+
+// Name lists the patterns
+func (s *EML) Name() string {
+	return "eml:" + strings.Join(s.patterns, ",")
+}
+
+// Failures returns the files that could not be parsed
+func (s *EML) Failures() []Failure {
+	return s.failures
+}
+
+// Stream parses every matched file. A pattern that matches nothing is an
+// error rather than an empty import.
+func (s *EML) Stream(ctx context.Context, out chan<- *domain.Email) error {
+	s.failures = nil
+
+	seen := make(map[string]bool)
+	for _, pattern := range s.patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+		// 多半是 pattern 写错了，或者引号里的 ~ 没被 shell 展开
+		if len(matches) == 0 {
+			return fmt.Errorf("no files match %q", pattern)
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				s.failures = append(s.failures, Failure{Ref: match, Err: err})
+				continue
+			}
+
+			var files []string
+			if info.IsDir() {
+				files, err = findEML(match)
+				if err != nil {
+					return err
+				}
+			} else {
+				files = []string{match}
+			}
+
+			for _, f := range files {
+				// 多个 pattern 可能匹配到同一个文件
+				if seen[f] {
+					continue
+				}
+				seen[f] = true
+				if err := emitFile(ctx, out, f, "eml", &s.failures, nil); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// findEML walks dir for *.eml files
+func findEML(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".eml") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk %s: %w", dir, err)
+	}
+	return files, nil
+}
@@ -0,0 +1,55 @@
+package source
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+)
+
+func TestEML(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.eml":        message("a@x", "First", "One"),
+		"b.EML":        message("b@x", "Second", "Two"),
+		"notes.txt":    "not an email",
+		"nested/c.eml": message("c@x", "Third", "Three"),
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	subjects := func(patterns ...string) []string {
+		t.Helper()
+		var got []string
+		for _, e := range collect(t, NewEML(patterns...)) {
+			got = append(got, e.Subject)
+		}
+		slices.Sort(got)
+		return got
+	}
+
+	if got := subjects(filepath.Join(dir, "*.eml")); !slices.Equal(got, []string{"First"}) {
+		t.Errorf("glob *.eml imported %v, want [First]", got)
+	}
+	// 目录递归查找 .eml（不区分大小写），多个 pattern 匹配到同一个文件只导入一次
+	if got := subjects(dir, filepath.Join(dir, "a.eml")); !slices.Equal(got, []string{"First", "Second", "Third"}) {
+		t.Errorf("directory imported %v, want [First Second Third]", got)
+	}
+
+	out := make(chan *domain.Email, 10)
+	err := NewEML(filepath.Join(dir, "*.eml"), "~/Downloads/*.eml").Stream(context.Background(), out)
+	if err == nil || !strings.Contains(err.Error(), "~/Downloads/*.eml") {
+		t.Errorf("pattern matching nothing: Stream = %v, want an error naming it", err)
+	}
+}
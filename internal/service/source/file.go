@@ -0,0 +1,48 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/mailparse"
+)
+
+// parseFile reads and parses a single-message file (.eml or Maildir entry)
+func parseFile(path string) (*domain.Email, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxMessageSize {
+		return nil, fmt.Errorf("message exceeds %d bytes", maxMessageSize)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return mailparse.Parse(raw)
+}
+
+// emitFile parses path and emits it, recording a failure instead of
+// aborting when the file is unreadable
+func emitFile(ctx context.Context, out chan<- *domain.Email, path, origin string, failures *[]Failure, decorate func(*domain.Email)) error {
+	email, err := parseFile(path)
+	if err != nil {
+		*failures = append(*failures, Failure{Ref: path, Err: err})
+		return nil
+	}
+	email.Source = origin
+	if email.Date.IsZero() {
+		// 没有 Date 头时用文件修改时间兜底
+		if info, err := os.Stat(path); err == nil {
+			email.Date = info.ModTime()
+		}
+	}
+	if decorate != nil {
+		decorate(email)
+	}
+	return Emit(ctx, out, email)
+}
@@ -0,0 +1,463 @@
+package source
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/config"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/mailparse"
+	goimap "github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// imapFetchBatch is how many messages are requested per UID FETCH
+const imapFetchBatch = 100
+
+// FolderState is the UID bookkeeping for one IMAP folder
+type FolderState struct {
+	UIDValidity uint32
+	UIDNext     uint32
+}
+
+// IMAP streams messages from the folders of an IMAP account.
+//
+// Each folder is fetched incrementally: if its UIDVALIDITY matches the
+// stored state only UIDs >= UIDNext are downloaded, otherwise the whole
+// folder is refetched. With idle set, Stream then IDLEs on the first folder
+// and emits new messages as the server announces them.
+type IMAP struct {
+	cfg  config.IMAPConfig
+	idle bool
+
+	// Dial opens an unauthenticated connection. It defaults to dialing
+	// cfg.Host and can be replaced, e.g. to connect to an in-process server.
+	Dial func() (*client.Client, error)
+
+	mu         sync.Mutex
+	states     map[string]FolderState
+	checkpoint func(folder string, state FolderState)
+	failures   []Failure
+
+	// 已发出但还没确认写入的邮件。文件夹的 checkpoint 要等它们都写入后
+	// 才保存，否则中断时还在缓冲里的邮件下次就不会再取了
+	unstored map[string][]string    // email ID → folders it was fetched from
+	pending  map[string]int         // folder → unstored messages
+	reached  map[string]FolderState // folder → state waiting to be saved
+	stored   map[string]bool
+}
+
+// NewIMAP creates a source for the account described by cfg
+func NewIMAP(cfg config.IMAPConfig, idle bool) *IMAP {
+	s := &IMAP{
+		cfg:    cfg,
+		idle:   idle,
+		states: make(map[string]FolderState),
+	}
+	s.Dial = s.dial
+	return s
+}
+
+// Name identifies the account
+func (s *IMAP) Name() string {
+	return "imap:" + s.Account()
+}
+
+// Account returns "username@host"
+func (s *IMAP) Account() string {
+	return s.cfg.Username + "@" + s.cfg.Host
+}
+
+// Folders returns the folders to sync, INBOX by default
+func (s *IMAP) Folders() []string {
+	if len(s.cfg.Folders) == 0 {
+		return []string{"INBOX"}
+	}
+	return s.cfg.Folders
+}
+
+// SetState seeds the UID state of a folder from a previous sync
+func (s *IMAP) SetState(folder string, state FolderState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[folder] = state
+}
+
+// State returns the UID state of a folder
+func (s *IMAP) State(folder string) FolderState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.states[folder]
+}
+
+// OnCheckpoint registers fn to be called whenever a folder has been fully
+// fetched up to a new UIDNext and every message emitted from it has been
+// confirmed through Stored, so the caller can persist it
+func (s *IMAP) OnCheckpoint(fn func(folder string, state FolderState)) {
+	s.checkpoint = fn
+}
+
+// Stored confirms that the emails with ids have been written by the
+// consumer. A folder is only checkpointed once all the messages emitted
+// from it are confirmed; ids are email IDs, so a message also fetched
+// from another folder is confirmed for both.
+func (s *IMAP) Stored(ids []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	touched := make(map[string]bool)
+	for _, id := range ids {
+		s.stored[id] = true
+		for _, folder := range s.unstored[id] {
+			s.pending[folder]--
+			touched[folder] = true
+		}
+		delete(s.unstored, id)
+	}
+	for folder := range touched {
+		s.commit(folder)
+	}
+}
+
+// track records an emitted message as waiting for Stored
+func (s *IMAP) track(folder, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stored[id] {
+		return
+	}
+	s.unstored[id] = append(s.unstored[id], folder)
+	s.pending[folder]++
+}
+
+// reach records that folder has been fetched up to state and saves it if
+// nothing emitted from it is still unconfirmed
+func (s *IMAP) reach(folder string, state FolderState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reached[folder] = state
+	s.commit(folder)
+}
+
+// commit passes the reached state of folder to the checkpoint once all of
+// its messages are stored. Callers hold s.mu, which also keeps the saves in
+// order.
+func (s *IMAP) commit(folder string) {
+	state, ok := s.reached[folder]
+	if !ok || s.pending[folder] > 0 {
+		return
+	}
+	delete(s.reached, folder)
+	if s.checkpoint != nil {
+		s.checkpoint(folder, state)
+	}
+}
+
+// Failures returns the messages that could not be fetched or parsed
+func (s *IMAP) Failures() []Failure {
+	return s.failures
+}
+
+// Stream fetches new messages from every folder, then optionally IDLEs
+func (s *IMAP) Stream(ctx context.Context, out chan<- *domain.Email) error {
+	s.failures = nil
+	s.mu.Lock()
+	s.unstored = make(map[string][]string)
+	s.pending = make(map[string]int)
+	s.reached = make(map[string]FolderState)
+	s.stored = make(map[string]bool)
+	s.mu.Unlock()
+
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+
+	// 收到 IDLE 推送时 go-imap 会写 Updates，必须在连接期间一直有人读
+	var updates chan client.Update
+	if s.idle {
+		updates = make(chan client.Update, 16)
+		c.Updates = updates
+	}
+	defer func() {
+		_ = c.Logout()
+		<-c.LoggedOut()
+		if updates != nil {
+			close(updates)
+		}
+	}()
+
+	// ctx 取消时直接断开连接，打断阻塞中的 FETCH / IDLE
+	stopWatch := make(chan struct{})
+	defer close(stopWatch)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = c.Terminate()
+		case <-stopWatch:
+		}
+	}()
+
+	for _, folder := range s.Folders() {
+		if err := s.syncFolder(ctx, c, folder, out); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("sync folder %s: %w", folder, err)
+		}
+	}
+
+	if !s.idle {
+		return nil
+	}
+	return s.idleLoop(ctx, c, s.Folders()[0], updates, out)
+}
+
+// syncFolder emits every message of folder not covered by its stored state
+func (s *IMAP) syncFolder(ctx context.Context, c *client.Client, folder string, out chan<- *domain.Email) error {
+	status, err := c.Select(folder, true)
+	if err != nil {
+		return err
+	}
+
+	prev := s.State(folder)
+	start := uint32(1)
+	if prev.UIDValidity != 0 && prev.UIDValidity == status.UidValidity && prev.UIDNext > 0 {
+		start = prev.UIDNext
+	}
+
+	maxUID := uint32(0)
+	if status.Messages > 0 {
+		if maxUID, err = s.fetchFrom(ctx, c, folder, start, out); err != nil {
+			return err
+		}
+	}
+
+	next := max(status.UidNext, maxUID+1, start)
+	state := FolderState{UIDValidity: status.UidValidity, UIDNext: next}
+	s.SetState(folder, state)
+	s.reach(folder, state)
+	return nil
+}
+
+// fetchFrom emits all messages with UID >= start and returns the highest UID seen
+func (s *IMAP) fetchFrom(ctx context.Context, c *client.Client, folder string, start uint32, out chan<- *domain.Email) (uint32, error) {
+	set := new(goimap.SeqSet)
+	set.AddRange(start, 0) // start:*
+	criteria := goimap.NewSearchCriteria()
+	criteria.Uid = set
+
+	found, err := c.UidSearch(criteria)
+	if err != nil {
+		return 0, err
+	}
+
+	// "n:*" 在 n 大于最大 UID 时也会返回最后一封，需要再过滤一次
+	uids := found[:0]
+	for _, uid := range found {
+		if uid >= start {
+			uids = append(uids, uid)
+		}
+	}
+	slices.Sort(uids)
+
+	section := &goimap.BodySectionName{Peek: true}
+	items := []goimap.FetchItem{goimap.FetchUid, goimap.FetchFlags, goimap.FetchInternalDate, section.FetchItem()}
+
+	maxUID := uint32(0)
+	for i := 0; i < len(uids); i += imapFetchBatch {
+		batch := new(goimap.SeqSet)
+		batch.AddNum(uids[i:min(i+imapFetchBatch, len(uids))]...)
+
+		messages := make(chan *goimap.Message, 16)
+		done := make(chan error, 1)
+		go func() {
+			done <- c.UidFetch(batch, items, messages)
+		}()
+
+		var emitErr error
+		for msg := range messages {
+			// 出错后也要把 channel 读完，否则 UidFetch 会一直阻塞
+			if emitErr != nil {
+				continue
+			}
+			maxUID = max(maxUID, msg.Uid)
+			email, err := s.convert(msg, folder, section)
+			if err != nil {
+				s.failures = append(s.failures, Failure{Ref: fmt.Sprintf("%s/%s/%d", s.Account(), folder, msg.Uid), Err: err})
+				continue
+			}
+			s.track(folder, email.ID)
+			emitErr = Emit(ctx, out, email)
+		}
+		if err := <-done; err != nil {
+			return maxUID, err
+		}
+		if emitErr != nil {
+			return maxUID, emitErr
+		}
+	}
+	return maxUID, nil
+}
+
+// idleLoop waits for new mail in folder and emits it as it arrives
+func (s *IMAP) idleLoop(ctx context.Context, c *client.Client, folder string, updates <-chan client.Update, out chan<- *domain.Email) error {
+	if _, err := c.Select(folder, true); err != nil {
+		return err
+	}
+
+	// 把 Updates 转成一个“有新邮件”的信号，FETCH 期间收到的推送也不会阻塞客户端
+	wake := make(chan struct{}, 1)
+	go func() {
+		for u := range updates {
+			if _, ok := u.(*client.MailboxUpdate); ok {
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	for {
+		stop := make(chan struct{})
+		idleDone := make(chan error, 1)
+		go func() {
+			idleDone <- c.Idle(stop, nil)
+		}()
+
+		select {
+		case <-ctx.Done():
+			close(stop)
+			return ctx.Err()
+		case err := <-idleDone:
+			close(stop)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("idle on %s: %w", folder, err)
+		case <-wake:
+			close(stop)
+			if err := <-idleDone; err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return fmt.Errorf("idle on %s: %w", folder, err)
+			}
+			if err := s.syncFolder(ctx, c, folder, out); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return fmt.Errorf("sync folder %s: %w", folder, err)
+			}
+		}
+	}
+}
+
+// convert parses a fetched message and maps its flags to labels
+func (s *IMAP) convert(msg *goimap.Message, folder string, section *goimap.BodySectionName) (*domain.Email, error) {
+	body := msg.GetBody(section)
+	if body == nil {
+		return nil, fmt.Errorf("server returned no body")
+	}
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	email, err := mailparse.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	email.Source = "imap"
+	if email.Date.IsZero() {
+		email.Date = msg.InternalDate
+	}
+
+	labels, _ := email.GetLabels()
+	labels = append(labels, folder)
+	if !slices.Contains(msg.Flags, goimap.SeenFlag) {
+		labels = append(labels, "UNREAD")
+	}
+	if slices.Contains(msg.Flags, goimap.FlaggedFlag) {
+		labels = append(labels, "STARRED")
+	}
+	if slices.Contains(msg.Flags, goimap.DraftFlag) {
+		labels = append(labels, "DRAFT")
+	}
+	_ = email.SetLabels(labels)
+
+	return email, nil
+}
+
+// connect dials and authenticates
+func (s *IMAP) connect() (*client.Client, error) {
+	if s.cfg.Host == "" {
+		return nil, fmt.Errorf("imap.host is required")
+	}
+
+	c, err := s.Dial()
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", s.cfg.Host, err)
+	}
+
+	switch s.cfg.Auth {
+	case "xoauth2":
+		err = c.Authenticate(&xoauth2Client{username: s.cfg.Username, token: s.cfg.OAuthToken})
+	case "", "login":
+		err = c.Login(s.cfg.Username, s.cfg.Password)
+	default:
+		err = fmt.Errorf("unknown imap.auth %q (use login or xoauth2)", s.cfg.Auth)
+	}
+	if err != nil {
+		_ = c.Logout()
+		return nil, fmt.Errorf("authenticate as %s: %w", s.cfg.Username, err)
+	}
+	return c, nil
+}
+
+// dial connects to cfg.Host using implicit TLS or STARTTLS
+func (s *IMAP) dial() (*client.Client, error) {
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: s.cfg.Host}
+
+	if s.cfg.TLS {
+		return client.DialTLS(addr, tlsConfig)
+	}
+
+	c, err := client.Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ok, _ := c.SupportStartTLS(); ok {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			_ = c.Logout()
+			return nil, fmt.Errorf("starttls: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// xoauth2Client implements the SASL XOAUTH2 mechanism used by Gmail and
+// Outlook (https://developers.google.com/gmail/imap/xoauth2-protocol)
+type xoauth2Client struct {
+	username string
+	token    string
+}
+
+func (a *xoauth2Client) Start() (string, []byte, error) {
+	ir := "user=" + a.username + "\x01auth=Bearer " + a.token + "\x01\x01"
+	return "XOAUTH2", []byte(ir), nil
+}
+
+// Next answers the server's error challenge with an empty response, after
+// which the server fails the AUTHENTICATE command with its final status
+func (a *xoauth2Client) Next(challenge []byte) ([]byte, error) {
+	return []byte{}, nil
+}
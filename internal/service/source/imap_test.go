@@ -0,0 +1,459 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/config"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/server"
+	"github.com/emersion/go-sasl"
+)
+
+// testBackend is the go-imap memory backend with what a real server adds:
+// a settable UIDVALIDITY, "*" resolved to the highest UID and EXISTS
+// pushed to idling clients when mail is delivered
+type testBackend struct {
+	*memory.Backend
+
+	mu       sync.Mutex
+	inbox    *memory.Mailbox
+	validity atomic.Uint32
+	updates  chan backend.Update
+}
+
+func newTestBackend(t *testing.T) *testBackend {
+	t.Helper()
+	be := &testBackend{Backend: memory.New(), updates: make(chan backend.Update, 16)}
+	be.validity.Store(1)
+
+	user, err := be.Backend.Login(nil, "username", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mbox, err := user.GetMailbox("INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	be.inbox = mbox.(*memory.Mailbox)
+	be.inbox.Messages = nil
+	return be
+}
+
+func (be *testBackend) Login(info *imap.ConnInfo, username, password string) (backend.User, error) {
+	user, err := be.Backend.Login(info, username, password)
+	if err != nil {
+		return nil, err
+	}
+	return &testUser{User: user, be: be}, nil
+}
+
+func (be *testBackend) Updates() <-chan backend.Update {
+	return be.updates
+}
+
+// add stores a message in INBOX and returns its UID
+func (be *testBackend) add(t *testing.T, n int) uint32 {
+	t.Helper()
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	if err := be.inbox.CreateMessage(nil, time.Now(), bytes.NewBufferString(testMessage(n))); err != nil {
+		t.Fatal(err)
+	}
+	return be.inbox.Messages[len(be.inbox.Messages)-1].Uid
+}
+
+// deliver adds a message and announces it to the clients that have INBOX
+// selected
+func (be *testBackend) deliver(t *testing.T, n int) {
+	t.Helper()
+	be.add(t, n)
+	be.mu.Lock()
+	status, err := be.inbox.Status([]imap.StatusItem{imap.StatusMessages, imap.StatusUidNext})
+	be.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	be.updates <- &backend.MailboxUpdate{Update: backend.NewUpdate("username", "INBOX"), MailboxStatus: status}
+}
+
+type testUser struct {
+	backend.User
+	be *testBackend
+}
+
+func (u *testUser) GetMailbox(name string) (backend.Mailbox, error) {
+	if name != "INBOX" {
+		return nil, backend.ErrNoSuchMailbox
+	}
+	return &testMailbox{Mailbox: u.be.inbox, be: u.be}, nil
+}
+
+type testMailbox struct {
+	*memory.Mailbox
+	be *testBackend
+}
+
+func (m *testMailbox) Status(items []imap.StatusItem) (*imap.MailboxStatus, error) {
+	m.be.mu.Lock()
+	defer m.be.mu.Unlock()
+	status, err := m.Mailbox.Status(items)
+	if err == nil && status.UidValidity != 0 {
+		status.UidValidity = m.be.validity.Load()
+	}
+	return status, err
+}
+
+func (m *testMailbox) ListMessages(uid bool, set *imap.SeqSet, items []imap.FetchItem, ch chan<- *imap.Message) error {
+	m.be.mu.Lock()
+	defer m.be.mu.Unlock()
+	return m.Mailbox.ListMessages(uid, set, items, ch)
+}
+
+// SearchMessages resolves "*" to the highest UID, so that "n:*" past the
+// end still matches the last message (RFC 3501 section 6.4.8)
+func (m *testMailbox) SearchMessages(uid bool, criteria *imap.SearchCriteria) ([]uint32, error) {
+	m.be.mu.Lock()
+	defer m.be.mu.Unlock()
+	if uid && criteria.Uid != nil && len(m.Messages) > 0 {
+		last := m.Messages[len(m.Messages)-1].Uid
+		set := new(imap.SeqSet)
+		for _, seq := range criteria.Uid.Set {
+			if seq.Stop == 0 {
+				seq.Stop = last
+			}
+			set.AddRange(seq.Start, seq.Stop)
+		}
+		c := *criteria
+		c.Uid = set
+		criteria = &c
+	}
+	return m.Mailbox.SearchMessages(uid, criteria)
+}
+
+// xoauth2Server checks the XOAUTH2 initial response against token
+type xoauth2Server struct {
+	conn  server.Conn
+	be    *testBackend
+	token string
+}
+
+func (s *xoauth2Server) Next(response []byte) ([]byte, bool, error) {
+	if response == nil {
+		return []byte{}, false, nil
+	}
+	if string(response) != "user=username\x01auth=Bearer "+s.token+"\x01\x01" {
+		return nil, true, errors.New("invalid credentials")
+	}
+	user, err := s.be.Login(s.conn.Info(), "username", "password")
+	if err != nil {
+		return nil, true, err
+	}
+	ctx := s.conn.Context()
+	ctx.State = imap.AuthenticatedState
+	ctx.User = user
+	return nil, true, nil
+}
+
+// startServer serves be on a local port and returns its address
+func startServer(t *testing.T, be *testBackend) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := server.New(be)
+	srv.AllowInsecureAuth = true
+	srv.ErrorLog = log.New(io.Discard, "", 0)
+	srv.EnableAuth("XOAUTH2", func(conn server.Conn) sasl.Server {
+		return &xoauth2Server{conn: conn, be: be, token: "token"}
+	})
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return l.Addr().String()
+}
+
+func testMessage(n int) string {
+	return fmt.Sprintf("From: sender%d@example.com\r\n"+
+		"To: username@example.com\r\n"+
+		"Subject: Message %d\r\n"+
+		"Date: Wed, 15 Oct 2025 10:%02d:00 +0000\r\n"+
+		"Message-ID: <%d@example.com>\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n"+
+		"Body of message %d\r\n", n, n, n, n, n)
+}
+
+// checkpoints records the folder states a source saves
+type checkpoints struct {
+	mu     sync.Mutex
+	states []FolderState
+}
+
+func (c *checkpoints) save(_ string, state FolderState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.states = append(c.states, state)
+}
+
+func (c *checkpoints) all() []FolderState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]FolderState(nil), c.states...)
+}
+
+func newTestIMAP(addr, auth string, idle bool) (*IMAP, *checkpoints) {
+	src := NewIMAP(config.IMAPConfig{
+		Host:       "127.0.0.1",
+		Username:   "username",
+		Password:   "password",
+		Auth:       auth,
+		OAuthToken: "token",
+	}, idle)
+	src.Dial = func() (*client.Client, error) { return client.Dial(addr) }
+	cps := &checkpoints{}
+	src.OnCheckpoint(cps.save)
+	return src, cps
+}
+
+// stream runs a non-idle Stream to the end and returns what it emitted
+func stream(t *testing.T, src *IMAP) ([]*domain.Email, error) {
+	t.Helper()
+	out := make(chan *domain.Email, 64)
+	err := src.Stream(context.Background(), out)
+	close(out)
+	var emails []*domain.Email
+	for e := range out {
+		emails = append(emails, e)
+	}
+	return emails, err
+}
+
+func subjects(emails []*domain.Email) string {
+	var s []string
+	for _, e := range emails {
+		s = append(s, e.Subject)
+	}
+	return strings.Join(s, ", ")
+}
+
+func ids(emails []*domain.Email) []string {
+	var s []string
+	for _, e := range emails {
+		s = append(s, e.ID)
+	}
+	return s
+}
+
+func TestIMAPAuth(t *testing.T) {
+	be := newTestBackend(t)
+	be.add(t, 1)
+	addr := startServer(t, be)
+
+	tests := []struct {
+		auth     string
+		password string
+		token    string
+		ok       bool
+	}{
+		{"login", "password", "", true},
+		{"", "password", "", true},
+		{"login", "wrong", "", false},
+		{"xoauth2", "", "token", true},
+		{"xoauth2", "", "expired", false},
+		{"cram-md5", "password", "", false},
+	}
+	for _, tt := range tests {
+		src, _ := newTestIMAP(addr, tt.auth, false)
+		src.cfg.Password, src.cfg.OAuthToken = tt.password, tt.token
+
+		emails, err := stream(t, src)
+		if tt.ok && (err != nil || len(emails) != 1) {
+			t.Errorf("auth %q: got %d emails, %v; want 1 email", tt.auth, len(emails), err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("auth %q with bad credentials succeeded", tt.auth)
+		}
+	}
+}
+
+func TestIMAPIncremental(t *testing.T) {
+	be := newTestBackend(t)
+	for n := 1; n <= 3; n++ {
+		be.add(t, n)
+	}
+	addr := startServer(t, be)
+
+	src, cps := newTestIMAP(addr, "login", false)
+	emails, err := stream(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := subjects(emails); got != "Message 1, Message 2, Message 3" {
+		t.Fatalf("first sync emitted %q", got)
+	}
+	src.Stored(ids(emails))
+	want := FolderState{UIDValidity: 1, UIDNext: 4}
+	if got := cps.all(); len(got) != 1 || got[0] != want {
+		t.Fatalf("checkpoints = %+v, want [%+v]", got, want)
+	}
+
+	// 下一次只取 UIDNEXT 之后的新邮件
+	be.add(t, 4)
+	src, cps = newTestIMAP(addr, "login", false)
+	src.SetState("INBOX", want)
+	emails, err = stream(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := subjects(emails); got != "Message 4" {
+		t.Fatalf("incremental sync emitted %q, want only Message 4", got)
+	}
+	src.Stored(ids(emails))
+	if got := cps.all(); len(got) != 1 || got[0].UIDNext != 5 {
+		t.Errorf("checkpoints = %+v, want UIDNext 5", got)
+	}
+}
+
+func TestIMAPUIDValidityChange(t *testing.T) {
+	be := newTestBackend(t)
+	for n := 1; n <= 3; n++ {
+		be.add(t, n)
+	}
+	be.validity.Store(2)
+	addr := startServer(t, be)
+
+	// 保存的状态属于旧的 UIDVALIDITY，UID 已经不可信，要全部重取
+	src, cps := newTestIMAP(addr, "login", false)
+	src.SetState("INBOX", FolderState{UIDValidity: 1, UIDNext: 4})
+	emails, err := stream(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emails) != 3 {
+		t.Fatalf("refetch emitted %q, want all 3 messages", subjects(emails))
+	}
+	src.Stored(ids(emails))
+	want := FolderState{UIDValidity: 2, UIDNext: 4}
+	if got := cps.all(); len(got) != 1 || got[0] != want {
+		t.Errorf("checkpoints = %+v, want [%+v]", got, want)
+	}
+}
+
+func TestIMAPLastMessageFilter(t *testing.T) {
+	be := newTestBackend(t)
+	for n := 1; n <= 3; n++ {
+		be.add(t, n)
+	}
+	addr := startServer(t, be)
+
+	// 没有新邮件时 "4:*" 仍会匹配最后一封 (UID 3)，不能再发一次
+	src, cps := newTestIMAP(addr, "login", false)
+	src.SetState("INBOX", FolderState{UIDValidity: 1, UIDNext: 4})
+	emails, err := stream(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emails) != 0 {
+		t.Errorf("emitted %q, want nothing", subjects(emails))
+	}
+	if got := cps.all(); len(got) != 1 || got[0].UIDNext != 4 {
+		t.Errorf("checkpoints = %+v, want UIDNext 4", got)
+	}
+}
+
+func TestIMAPIdle(t *testing.T) {
+	be := newTestBackend(t)
+	be.add(t, 1)
+	addr := startServer(t, be)
+
+	src, cps := newTestIMAP(addr, "login", true)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out := make(chan *domain.Email, 64)
+	errc := make(chan error, 1)
+	go func() { errc <- src.Stream(ctx, out) }()
+
+	next := func() *domain.Email {
+		t.Helper()
+		select {
+		case e := <-out:
+			return e
+		case err := <-errc:
+			t.Fatalf("Stream returned early: %v", err)
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for a message")
+		}
+		return nil
+	}
+
+	first := next()
+	if first.Subject != "Message 1" {
+		t.Fatalf("initial sync emitted %q", first.Subject)
+	}
+	src.Stored([]string{first.ID})
+
+	be.deliver(t, 2)
+	second := next()
+	if second.Subject != "Message 2" {
+		t.Fatalf("IDLE emitted %q, want Message 2", second.Subject)
+	}
+	src.Stored([]string{second.ID})
+
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("Stream after cancel = %v, want context.Canceled", err)
+	}
+	got := cps.all()
+	if len(got) == 0 || got[len(got)-1].UIDNext != 3 {
+		t.Errorf("checkpoints = %+v, want the last at UIDNext 3", got)
+	}
+}
+
+func TestIMAPCheckpointWaitsForStored(t *testing.T) {
+	be := newTestBackend(t)
+	for n := 1; n <= 3; n++ {
+		be.add(t, n)
+	}
+	addr := startServer(t, be)
+
+	// 邮件已经发出但还没写入时按了 Ctrl+C：不能保存新的 UIDNEXT，
+	// 否则下次会跳过这些邮件
+	src, cps := newTestIMAP(addr, "login", false)
+	emails, err := stream(t, src)
+	if err != nil || len(emails) != 3 {
+		t.Fatalf("stream = %d emails, %v", len(emails), err)
+	}
+	if got := cps.all(); len(got) != 0 {
+		t.Fatalf("checkpointed %+v before anything was stored", got)
+	}
+	src.Stored(ids(emails[:2]))
+	if got := cps.all(); len(got) != 0 {
+		t.Fatalf("checkpointed %+v with a message still unstored", got)
+	}
+
+	// 没有保存状态，下一次从头再取
+	src, cps = newTestIMAP(addr, "login", false)
+	emails, err = stream(t, src)
+	if err != nil || len(emails) != 3 {
+		t.Fatalf("rerun = %d emails, %v; want all 3 again", len(emails), err)
+	}
+	src.Stored(ids(emails))
+	if got := cps.all(); len(got) != 1 || got[0].UIDNext != 4 {
+		t.Errorf("checkpoints = %+v, want UIDNext 4 once all are stored", got)
+	}
+}
@@ -0,0 +1,287 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Maildir reads every Maildir folder (a directory with cur/ and new/) under
+// a root directory, including Maildir++ sub-folders such as ".Work".
+type Maildir struct {
+	root     string
+	watch    bool
+	failures []Failure
+}
+
+// NewMaildir creates a source for the Maildir tree at root. With watch set,
+// Stream keeps running after the initial scan and emits messages delivered
+// to any new/ directory until ctx is cancelled. Folders created under root
+// while watching are scanned and watched as well.
+func NewMaildir(root string, watch bool) *Maildir {
+	return &Maildir{root: root, watch: watch}
+}
+
+// Name identifies the Maildir root
+func (m *Maildir) Name() string {
+	return "maildir:" + m.root
+}
+
+// Failures returns the files that could not be parsed
+func (m *Maildir) Failures() []Failure {
+	return m.failures
+}
+
+// Stream scans cur/ and new/ of every folder, then optionally watches new/
+func (m *Maildir) Stream(ctx context.Context, out chan<- *domain.Email) error {
+	m.failures = nil
+
+	folders, err := m.folders()
+	if err != nil {
+		return err
+	}
+	if len(folders) == 0 {
+		return fmt.Errorf("no Maildir folders (cur/ + new/) found under %s", m.root)
+	}
+
+	// 先建立监听再扫描，避免扫描期间投递的邮件被漏掉（重复的由 ID 去重）
+	var watcher *fsnotify.Watcher
+	if m.watch {
+		if watcher, err = fsnotify.NewWatcher(); err != nil {
+			return fmt.Errorf("create watcher: %w", err)
+		}
+		defer watcher.Close()
+		if err := m.watchTree(watcher, m.root); err != nil {
+			return err
+		}
+	}
+
+	for dir, label := range folders {
+		if err := m.scan(ctx, out, dir, label); err != nil {
+			return err
+		}
+	}
+
+	if watcher == nil {
+		return nil
+	}
+	return m.watchNew(ctx, out, watcher, folders)
+}
+
+// scan emits the messages in new/ and cur/ of a folder
+func (m *Maildir) scan(ctx context.Context, out chan<- *domain.Email, dir, label string) error {
+	for _, sub := range []string{"new", "cur"} {
+		entries, err := os.ReadDir(filepath.Join(dir, sub))
+		if err != nil {
+			return fmt.Errorf("read %s: %w", dir, err)
+		}
+		for _, e := range entries {
+			if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			if err := m.emit(ctx, out, filepath.Join(dir, sub, e.Name()), label); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// watchTree watches dir and every directory below it except cur/ and tmp/:
+// new/ for deliveries, the others for folders created later
+func (m *Maildir) watchTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if d.Name() == "cur" || d.Name() == "tmp" {
+			return fs.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("watch %s: %w", path, err)
+		}
+		if d.Name() == "new" {
+			return fs.SkipDir
+		}
+		return nil
+	})
+}
+
+// watchNew emits messages as they are delivered into new/ and picks up
+// folders created after the initial scan
+func (m *Maildir) watchNew(ctx context.Context, out chan<- *domain.Email, watcher *fsnotify.Watcher, folders map[string]string) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return fmt.Errorf("watch maildir: %w", err)
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// MDA 先写 tmp/ 再 rename 到 new/，rename 进来的文件在 inotify 里表现为 Create
+			if !ev.Has(fsnotify.Create) {
+				continue
+			}
+			// Maildir++ 的子文件夹以 "." 开头，隐藏文件的判断只用在邮件上
+			if isDir(ev.Name) {
+				if err := m.addFolders(ctx, out, watcher, folders, ev.Name); err != nil {
+					return err
+				}
+				continue
+			}
+			label, ok := folders[filepath.Dir(filepath.Dir(ev.Name))]
+			if !ok || filepath.Base(filepath.Dir(ev.Name)) != "new" || strings.HasPrefix(filepath.Base(ev.Name), ".") {
+				continue
+			}
+			if err := m.emit(ctx, out, ev.Name, label); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// addFolders handles a directory created while watching. Folders usually
+// appear in steps (the folder, then its cur/, new/ and tmp/), so every
+// step checks whether a new folder is complete; a complete one is watched
+// and scanned for messages delivered before the watch was in place.
+func (m *Maildir) addFolders(ctx context.Context, out chan<- *domain.Email, watcher *fsnotify.Watcher, folders map[string]string, dir string) error {
+	if err := m.watchTree(watcher, dir); err != nil {
+		return err
+	}
+	var candidates []string
+	switch filepath.Base(dir) {
+	case "cur", "new", "tmp":
+		candidates = []string{filepath.Dir(dir)}
+	default:
+		found, err := findFolders(dir)
+		if err != nil {
+			return err
+		}
+		candidates = found
+	}
+
+	for _, folder := range candidates {
+		if _, ok := folders[folder]; ok || !isFolder(folder) {
+			continue
+		}
+		rel, _ := filepath.Rel(m.root, folder)
+		folders[folder] = folderLabel(rel)
+		if err := m.scan(ctx, out, folder, folders[folder]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Maildir) emit(ctx context.Context, out chan<- *domain.Email, path, folder string) error {
+	return emitFile(ctx, out, path, "maildir", &m.failures, func(e *domain.Email) {
+		labels := flagLabels(path)
+		if folder != "" {
+			labels = append(labels, folder)
+		}
+		if existing, _ := e.GetLabels(); len(existing) > 0 {
+			labels = append(existing, labels...)
+		}
+		if len(labels) > 0 {
+			_ = e.SetLabels(labels)
+		}
+	})
+}
+
+// folders finds Maildir folders under root, mapped to their label
+// ("INBOX" for the root itself, "Work/Reports" for ".Work.Reports")
+func (m *Maildir) folders() (map[string]string, error) {
+	paths, err := findFolders(m.root)
+	if err != nil {
+		return nil, err
+	}
+	folders := make(map[string]string, len(paths))
+	for _, path := range paths {
+		rel, _ := filepath.Rel(m.root, path)
+		folders[path] = folderLabel(rel)
+	}
+	return folders, nil
+}
+
+// findFolders walks dir for Maildir folders
+func findFolders(dir string) ([]string, error) {
+	var folders []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		switch d.Name() {
+		case "cur", "new", "tmp":
+			return fs.SkipDir
+		}
+		if isFolder(path) {
+			folders = append(folders, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan maildir: %w", err)
+	}
+	return folders, nil
+}
+
+// isFolder reports whether dir is a Maildir folder
+func isFolder(dir string) bool {
+	return isDir(filepath.Join(dir, "cur")) && isDir(filepath.Join(dir, "new"))
+}
+
+func folderLabel(rel string) string {
+	if rel == "." {
+		return "INBOX"
+	}
+	parts := strings.FieldsFunc(filepath.ToSlash(rel), func(r rune) bool {
+		return r == '/' || r == '.'
+	})
+	return strings.Join(parts, "/")
+}
+
+// flagLabels maps Maildir info flags (":2,FRS") to Gmail-style labels
+func flagLabels(path string) []string {
+	name := filepath.Base(path)
+	flags := ""
+	if i := strings.LastIndex(name, ":2,"); i >= 0 {
+		flags = name[i+3:]
+	}
+
+	var labels []string
+	if !strings.ContainsRune(flags, 'S') {
+		labels = append(labels, "UNREAD")
+	}
+	if strings.ContainsRune(flags, 'F') {
+		labels = append(labels, "STARRED")
+	}
+	if strings.ContainsRune(flags, 'D') {
+		labels = append(labels, "DRAFT")
+	}
+	if strings.ContainsRune(flags, 'T') {
+		labels = append(labels, "TRASH")
+	}
+	return labels
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,131 @@
+package source
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+)
+
+// makeFolder creates a Maildir folder with cur/, new/ and tmp/
+func makeFolder(t *testing.T, dir string) {
+	t.Helper()
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// deliver writes a message the way an MDA does: into tmp/, then renamed
+func deliver(t *testing.T, path, content string) {
+	t.Helper()
+	tmp := filepath.Join(filepath.Dir(filepath.Dir(path)), "tmp", filepath.Base(path))
+	if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func labels(e *domain.Email) []string {
+	l, _ := e.GetLabels()
+	return l
+}
+
+func TestMaildirFlags(t *testing.T) {
+	root := t.TempDir()
+	makeFolder(t, root)
+	makeFolder(t, filepath.Join(root, ".Work.Reports"))
+	deliver(t, filepath.Join(root, "new", "1.host"), message("new@x", "New", "Unread"))
+	deliver(t, filepath.Join(root, "cur", "2.host:2,S"), message("seen@x", "Seen", "Read"))
+	deliver(t, filepath.Join(root, "cur", "3.host:2,FST"), message("flagged@x", "Flagged", "Starred"))
+	deliver(t, filepath.Join(root, "cur", "4.host:2,D"), message("draft@x", "Draft", "Draft"))
+	deliver(t, filepath.Join(root, ".Work.Reports", "cur", "5.host:2,RS"), message("report@x", "Report", "Work"))
+
+	want := map[string][]string{
+		"New":     {"UNREAD", "INBOX"},
+		"Seen":    {"INBOX"},
+		"Flagged": {"STARRED", "TRASH", "INBOX"},
+		"Draft":   {"UNREAD", "DRAFT", "INBOX"},
+		"Report":  {"Work/Reports"},
+	}
+	emails := collect(t, NewMaildir(root, false))
+	if len(emails) != len(want) {
+		t.Fatalf("got %d emails, want %d", len(emails), len(want))
+	}
+	for _, e := range emails {
+		if got := labels(e); !slices.Equal(got, want[e.Subject]) {
+			t.Errorf("%s: labels %v, want %v", e.Subject, got, want[e.Subject])
+		}
+		if e.Source != "maildir" {
+			t.Errorf("%s: source %q, want maildir", e.Subject, e.Source)
+		}
+	}
+
+	out := make(chan *domain.Email, 1)
+	if err := NewMaildir(t.TempDir(), false).Stream(context.Background(), out); err == nil {
+		t.Error("root without Maildir folders: Stream returned no error")
+	}
+}
+
+func TestMaildirWatch(t *testing.T) {
+	root := t.TempDir()
+	makeFolder(t, root)
+	deliver(t, filepath.Join(root, "cur", "1.host:2,S"), message("old@x", "Old", "Before"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := make(chan *domain.Email, 10)
+	done := make(chan error, 1)
+	go func() { done <- NewMaildir(root, true).Stream(ctx, out) }()
+
+	next := func() *domain.Email {
+		t.Helper()
+		select {
+		case e := <-out:
+			return e
+		case err := <-done:
+			t.Fatalf("Stream stopped: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for an email")
+		}
+		return nil
+	}
+
+	// 初始扫描完成后监听已经就位
+	if e := next(); e.Subject != "Old" {
+		t.Fatalf("initial scan emitted %q, want Old", e.Subject)
+	}
+	deliver(t, filepath.Join(root, "new", "2.host"), message("inbox@x", "Delivered", "Later"))
+	if e := next(); e.Subject != "Delivered" || !slices.Equal(labels(e), []string{"UNREAD", "INBOX"}) {
+		t.Errorf("delivered %q with labels %v", e.Subject, labels(e))
+	}
+
+	// 启动后才建的文件夹：建好后先收到的邮件靠扫描补上，之后的靠监听
+	folder := filepath.Join(root, ".Later")
+	makeFolder(t, folder)
+	deliver(t, filepath.Join(folder, "new", "3.host"), message("later@x", "New folder", "Later"))
+	e := next()
+	if e.Subject != "New folder" || !slices.Equal(labels(e), []string{"UNREAD", "Later"}) {
+		t.Errorf("new folder emitted %q with labels %v", e.Subject, labels(e))
+	}
+	// 新文件夹的 new/ 也在监听；同一封邮件可能被扫描和监听各发一次，下游按 ID 去重
+	deliver(t, filepath.Join(folder, "new", "4.host"), message("after@x", "After", "Watched"))
+	for e.Subject == "New folder" {
+		e = next()
+	}
+	if e.Subject != "After" || !slices.Equal(labels(e), []string{"UNREAD", "Later"}) {
+		t.Errorf("delivery to the new folder emitted %q with labels %v", e.Subject, labels(e))
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Stream = %v, want context.Canceled", err)
+	}
+}
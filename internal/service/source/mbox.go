@@ -0,0 +1,148 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/mailparse"
+)
+
+// maxMessageSize guards against a corrupt mbox swallowing the whole file
+// into a single message
+const maxMessageSize = 64 << 20
+
+// Mbox reads messages from an mbox file (Thunderbird, Google Takeout, ...)
+type Mbox struct {
+	path     string
+	failures []Failure
+}
+
+// NewMbox creates a source for the mbox file at path
+func NewMbox(path string) *Mbox {
+	return &Mbox{path: path}
+}
+
+// Name identifies the mbox file
+func (m *Mbox) Name() string {
+	return "mbox:" + m.path
+}
+
+// Failures returns the messages that could not be parsed
+func (m *Mbox) Failures() []Failure {
+	return m.failures
+}
+
+// Stream parses the file message by message; only one message is held in
+// memory at a time
+func (m *Mbox) Stream(ctx context.Context, out chan<- *domain.Email) error {
+	m.failures = nil
+
+	f, err := os.Open(m.path)
+	if err != nil {
+		return fmt.Errorf("open mbox: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReaderSize(f, 64<<10)
+
+	var (
+		msg       bytes.Buffer
+		fromLine  string
+		offset    int64 // 当前消息在文件中的起始偏移，用于错误定位
+		pos       int64
+		started   bool
+		prevBlank = true
+	)
+
+	flush := func() error {
+		if !started {
+			return nil
+		}
+		ref := fmt.Sprintf("%s@%d", m.path, offset)
+		if msg.Len() > maxMessageSize {
+			m.failures = append(m.failures, Failure{Ref: ref, Err: fmt.Errorf("message exceeds %d bytes", maxMessageSize)})
+			return nil
+		}
+		email, err := mailparse.Parse(msg.Bytes())
+		if err != nil {
+			m.failures = append(m.failures, Failure{Ref: ref, Err: err})
+			return nil
+		}
+		email.Source = "mbox"
+		if email.Date.IsZero() {
+			email.Date = fromLineDate(fromLine)
+		}
+		return Emit(ctx, out, email)
+	}
+
+	for {
+		line, readErr := r.ReadBytes('\n')
+		if len(line) > 0 {
+			// "From " 分隔行：必须出现在文件开头或空行之后
+			if prevBlank && bytes.HasPrefix(line, []byte("From ")) {
+				if err := flush(); err != nil {
+					return err
+				}
+				msg.Reset()
+				started = true
+				offset = pos
+				fromLine = string(bytes.TrimRight(line, "\r\n"))
+			} else if started && msg.Len() <= maxMessageSize {
+				msg.Write(unescapeFrom(line))
+			}
+			pos += int64(len(line))
+			prevBlank = len(bytes.TrimRight(line, "\r\n")) == 0
+		}
+
+		if readErr != nil {
+			if errors.Is(readErr, io.EOF) {
+				break
+			}
+			return fmt.Errorf("read mbox: %w", readErr)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	return flush()
+}
+
+// unescapeFrom undoes mboxrd quoting: ">From " -> "From ", ">>From " -> ">From "
+func unescapeFrom(line []byte) []byte {
+	i := 0
+	for i < len(line) && line[i] == '>' {
+		i++
+	}
+	if i > 0 && bytes.HasPrefix(line[i:], []byte("From ")) {
+		return line[1:]
+	}
+	return line
+}
+
+// fromLineDate parses the date of an mbox separator line, used when a
+// message has no usable Date header:
+//
+//	From sender@example.com Mon Jan  2 15:04:05 2006
+//	From 1234567890@xxx Mon Jan 02 15:04:05 +0000 2006   (Google Takeout)
+func fromLineDate(line string) time.Time {
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) < 3 {
+		return time.Time{}
+	}
+	value := strings.TrimSpace(fields[2])
+	for _, layout := range []string{time.ANSIC, "Mon Jan _2 15:04:05 -0700 2006"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,164 @@
+package source
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+)
+
+// message builds a minimal RFC 5322 message
+func message(id, subject, body string) string {
+	return "Message-ID: <" + id + ">\r\n" +
+		"From: alice@example.com\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Date: Fri, 1 Mar 2024 09:00:00 +0000\r\n" +
+		"\r\n" + body + "\r\n"
+}
+
+// collect runs src and returns what it streamed
+func collect(t *testing.T, src Source) []*domain.Email {
+	t.Helper()
+	out := make(chan *domain.Email, 100)
+	if err := src.Stream(context.Background(), out); err != nil {
+		t.Fatal(err)
+	}
+	close(out)
+	var emails []*domain.Email
+	for e := range out {
+		emails = append(emails, e)
+	}
+	return emails
+}
+
+func TestMbox(t *testing.T) {
+	noDate := "Message-ID: <c@x>\nSubject: No date\n\nBody\n"
+	mbox := "From alice@example.com Fri Mar  1 09:00:00 2024\n" +
+		strings.ReplaceAll(message("a@x", "Escaped",
+			"First line\r\n>From the archive\r\n>>From quoted twice\r\nFrom not a separator, no blank line before"), "\r\n", "\n") +
+		"\n" +
+		"From bob@example.com Sat Mar  2 10:00:00 2024\n" +
+		strings.ReplaceAll(message("b@x", "Second", "Hi"), "\r\n", "\n") +
+		"\n" +
+		"From 1234567890@xxx Sun Mar 03 11:30:00 +0100 2024\n" +
+		noDate
+	path := filepath.Join(t.TempDir(), "archive.mbox")
+	if err := os.WriteFile(path, []byte(mbox), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	src := NewMbox(path)
+	emails := collect(t, src)
+	if len(emails) != 3 || len(src.Failures()) != 0 {
+		t.Fatalf("got %d emails and failures %v, want 3 and none", len(emails), src.Failures())
+	}
+
+	// mboxrd 转义去掉一层 ">"，前面不是空行的 "From " 不是分隔行
+	body := emails[0].BodyText
+	for _, want := range []string{"\nFrom the archive", "\n>From quoted twice", "From not a separator"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body %q does not contain %q", body, want)
+		}
+	}
+	if strings.Contains(body, ">From the") {
+		t.Errorf("body %q kept the escape", body)
+	}
+	if emails[1].Subject != "Second" || emails[1].Source != "mbox" {
+		t.Errorf("second email = %q from %q", emails[1].Subject, emails[1].Source)
+	}
+
+	// 没有 Date 头时用分隔行里的时间
+	want := time.Date(2024, 3, 3, 11, 30, 0, 0, time.FixedZone("", 3600))
+	if !emails[2].Date.Equal(want) {
+		t.Errorf("date from the From line = %v, want %v", emails[2].Date, want)
+	}
+}
+
+func TestFromLineDate(t *testing.T) {
+	tests := []struct {
+		line string
+		want time.Time
+	}{
+		{"From alice@example.com Mon Jan  2 15:04:05 2006", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"From 1234567890@xxx Mon Jan 02 15:04:05 -0700 2006", time.Date(2006, 1, 2, 22, 4, 5, 0, time.UTC)},
+		{"From alice@example.com", time.Time{}},
+		{"From alice@example.com yesterday", time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := fromLineDate(tt.line); !got.Equal(tt.want) {
+			t.Errorf("fromLineDate(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+// TestMboxExports reads the two exports the mbox importer is for:
+// Thunderbird ("From - " separators, LF) and Google Takeout (CRLF, Gmail
+// headers, encoded subjects and multipart bodies)
+func TestMboxExports(t *testing.T) {
+	thunderbird := "From - Fri Mar 01 09:00:00 2024\n" +
+		"X-Mozilla-Status: 0001\n" +
+		"Message-ID: <tb@x>\n" +
+		"From: alice@example.com\n" +
+		"Subject: No date header\n" +
+		"\n" +
+		"Sent from Thunderbird\n"
+	takeout := strings.ReplaceAll("From 1790345213450116541@xxx Sat Mar 02 10:00:00 +0000 2024\n"+
+		"X-GM-THRID: 1790345213450116541\n"+
+		"X-Gmail-Labels: Inbox,Important\n"+
+		"Message-ID: <takeout@x>\n"+
+		"From: =?UTF-8?Q?Bj=C3=B6rn?= <bjorn@example.com>\n"+
+		"Subject: =?UTF-8?B?5pyI5bqm5oql5ZGK?=\n"+
+		"Date: Sat, 2 Mar 2024 10:00:00 +0000\n"+
+		"MIME-Version: 1.0\n"+
+		"Content-Type: multipart/alternative; boundary=\"b1\"\n"+
+		"\n"+
+		"--b1\n"+
+		"Content-Type: text/plain; charset=UTF-8\n"+
+		"Content-Transfer-Encoding: quoted-printable\n"+
+		"\n"+
+		"Umsatz gr=C3=B6=C3=9Fer als erwartet\n"+
+		"--b1\n"+
+		"Content-Type: text/html; charset=UTF-8\n"+
+		"\n"+
+		"<p>Umsatz gr&ouml;&szlig;er als erwartet</p>\n"+
+		"--b1--\n", "\n", "\r\n")
+
+	for name, mbox := range map[string]string{"thunderbird": thunderbird, "takeout": takeout} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name+".mbox")
+			if err := os.WriteFile(path, []byte(mbox), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			src := NewMbox(path)
+			emails := collect(t, src)
+			if len(emails) != 1 || len(src.Failures()) != 0 {
+				t.Fatalf("got %d emails and failures %v, want 1 and none", len(emails), src.Failures())
+			}
+			e := emails[0]
+
+			if name == "thunderbird" {
+				if want := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC); !e.Date.Equal(want) {
+					t.Errorf("date = %v, want %v from the From line", e.Date, want)
+				}
+				if e.BodyText != "Sent from Thunderbird" {
+					t.Errorf("body = %q", e.BodyText)
+				}
+				return
+			}
+			if e.Subject != "月度报告" || !strings.Contains(e.From, "Björn") {
+				t.Errorf("encoded headers decoded to subject %q, from %q", e.Subject, e.From)
+			}
+			if e.BodyText != "Umsatz größer als erwartet" {
+				t.Errorf("body = %q, want the decoded text part", e.BodyText)
+			}
+			if e.ThreadID != "1790345213450116541" || !slices.Equal(labels(e), []string{"Inbox", "Important"}) {
+				t.Errorf("thread %q and labels %v, want the Gmail thread and labels", e.ThreadID, labels(e))
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package source
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+)
+
+// Source streams emails from a mail store (Gmail, mbox archives, ...)
+type Source interface {
+	// Name identifies the source in logs and reports, e.g. "mbox:/path/to/archive.mbox"
+	Name() string
+
+	// Stream sends every email to out until the source is exhausted or ctx
+	// is cancelled. It does not close out. Messages that cannot be read are
+	// skipped and reported through Failures rather than aborting the stream.
+	Stream(ctx context.Context, out chan<- *domain.Email) error
+
+	// Failures returns the messages skipped by the last Stream call
+	Failures() []Failure
+}
+
+// RawSource is a Source that can also hand out messages before parsing
+// them, so a pipeline can run the parsing on its own workers
+type RawSource interface {
+	Source
+
+	// StreamRaw is Stream without the parsing: every message is sent as a
+	// Raw whose Parse decodes it. Failures covers fetch errors only.
+	StreamRaw(ctx context.Context, out chan<- Raw) error
+}
+
+// Raw is a fetched message that has not been parsed yet
+type Raw struct {
+	// Ref locates the message, like Failure.Ref
+	Ref   string
+	Parse func() (*domain.Email, error)
+}
+
+// Failure records a message a source could not read or parse
+type Failure struct {
+	// Ref locates the message within its source (Gmail ID, mbox offset, file path)
+	Ref string
+	Err error
+}
+
+func (f Failure) Error() string {
+	return fmt.Sprintf("%s: %v", f.Ref, f.Err)
+}
+
+// Emit sends e to out, giving up if ctx is cancelled first
+func Emit(ctx context.Context, out chan<- *domain.Email, e *domain.Email) error {
+	select {
+	case out <- e:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
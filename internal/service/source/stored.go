@@ -0,0 +1,139 @@
+package source
+
+import (
+	"context"
+	"errors"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+)
+
+// storedPageSize is how many rows Stored loads per query
+const storedPageSize = 100
+
+// AttachmentLister loads the attachment rows of a stored email;
+// attachment.Service satisfies it
+type AttachmentLister interface {
+	List(ctx context.Context, emailID string) ([]*domain.Attachment, error)
+}
+
+// Stored streams emails that are already in the local database, newest
+// first, e.g. to (re)index them. It implements Source.
+type Stored struct {
+	repo        email.Repository
+	filter      email.Filter
+	limit       int
+	ids         []string
+	attachments AttachmentLister
+	skip        func(*domain.Email) bool
+	skipped     int
+	failures    []Failure
+}
+
+// NewStored streams the stored emails matching filter; limit 0 means all
+func NewStored(repo email.Repository, filter email.Filter, limit int) *Stored {
+	return &Stored{repo: repo, filter: filter, limit: limit}
+}
+
+// NewStoredIDs streams the given stored emails, skipping deleted ones
+func NewStoredIDs(repo email.Repository, ids []string) *Stored {
+	if ids == nil {
+		ids = []string{}
+	}
+	return &Stored{repo: repo, ids: ids}
+}
+
+// WithAttachments loads the attachments of every streamed email
+func (s *Stored) WithAttachments(a AttachmentLister) *Stored {
+	s.attachments = a
+	return s
+}
+
+// WithSkip leaves out the emails skip returns true for, e.g. the ones that
+// are already indexed. It sees the email with its attachments loaded.
+func (s *Stored) WithSkip(skip func(*domain.Email) bool) *Stored {
+	s.skip = skip
+	return s
+}
+
+// Skipped returns how many emails the last Stream call left out
+func (s *Stored) Skipped() int {
+	return s.skipped
+}
+
+// Name identifies the source
+func (s *Stored) Name() string {
+	return "sqlite"
+}
+
+// Failures returns the emails whose attachments could not be loaded
+func (s *Stored) Failures() []Failure {
+	return s.failures
+}
+
+// Stream sends the stored emails to out
+func (s *Stored) Stream(ctx context.Context, out chan<- *domain.Email) error {
+	s.failures, s.skipped = nil, 0
+	if s.ids != nil {
+		return s.streamIDs(ctx, out)
+	}
+
+	sent := 0
+	for offset := 0; ; offset += storedPageSize {
+		size := storedPageSize
+		if s.limit > 0 {
+			size = min(size, s.limit-sent)
+		}
+		if size <= 0 {
+			return nil
+		}
+
+		emails, err := s.repo.List(ctx, s.filter, email.Pagination{Limit: size, Offset: offset})
+		if err != nil {
+			return err
+		}
+		for _, e := range emails {
+			if err := s.emit(ctx, out, e); err != nil {
+				return err
+			}
+			sent++
+		}
+		if len(emails) < size {
+			return nil
+		}
+	}
+}
+
+func (s *Stored) streamIDs(ctx context.Context, out chan<- *domain.Email) error {
+	for _, id := range s.ids {
+		e, err := s.repo.Get(ctx, id)
+		if errors.Is(err, email.ErrNotFound) {
+			// 已经被删除的邮件不用再索引
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.emit(ctx, out, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Stored) emit(ctx context.Context, out chan<- *domain.Email, e *domain.Email) error {
+	if s.attachments != nil {
+		atts, err := s.attachments.List(ctx, e.ID)
+		if err != nil {
+			s.failures = append(s.failures, Failure{Ref: e.ID, Err: err})
+		}
+		for _, att := range atts {
+			e.Attachments = append(e.Attachments, *att)
+		}
+	}
+	if s.skip != nil && s.skip(e) {
+		s.skipped++
+		return nil
+	}
+	return Emit(ctx, out, e)
+}
@@ -0,0 +1,56 @@
+package source
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/config"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/database"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+)
+
+func TestStoredSkip(t *testing.T) {
+	log := logger.NewSlog("error")
+	db, err := database.NewSQLite(config.SQLiteConfig{
+		Path:            filepath.Join(t.TempDir(), "emails.db"),
+		MaxOpenConns:    1,
+		MaxIdleConns:    1,
+		ConnMaxLifetime: time.Hour,
+	}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := email.NewSQLiteRepository(db, log)
+	ctx := context.Background()
+	now := time.Now()
+	stored := []*domain.Email{
+		{ID: "a", Subject: "one", Date: now.Add(-3 * time.Hour)},
+		{ID: "b", Subject: "two", Date: now.Add(-2 * time.Hour)},
+		{ID: "c", Subject: "three", Date: now.Add(-time.Hour)},
+	}
+	if _, err := repo.BulkUpsert(ctx, stored); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.MarkIndexed(ctx, stored[1:2]); err != nil {
+		t.Fatal(err)
+	}
+
+	src := NewStored(repo, email.Filter{}, 0).WithSkip((*domain.Email).Indexed)
+	out := make(chan *domain.Email, 10)
+	if err := src.Stream(ctx, out); err != nil {
+		t.Fatal(err)
+	}
+	close(out)
+	var got []string
+	for e := range out {
+		got = append(got, e.ID)
+	}
+	if !slices.Equal(got, []string{"c", "a"}) || src.Skipped() != 1 {
+		t.Errorf("streamed %v and skipped %d, want [c a] and 1 skipped", got, src.Skipped())
+	}
+}
@@ -0,0 +1,97 @@
+// Package summary summarizes emails with the chat model
+package summary
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/llm"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/tokenizer"
+)
+
+// defaultBudget caps the body tokens sent to the model; longer bodies are
+// truncated, which mostly cuts old quoted history
+const defaultBudget = 6000
+
+// ChatModel generates the summary; llm.Service satisfies it
+type ChatModel interface {
+	Chat(ctx context.Context, messages []llm.Message) (string, error)
+	ChatStream(ctx context.Context, messages []llm.Message, onDelta func(string) error) (string, error)
+}
+
+// Service summarizes emails
+type Service struct {
+	chat   ChatModel
+	tok    *tokenizer.Tokenizer
+	budget int
+	logger logger.Logger
+}
+
+// New creates a summary service. tok must match the chat model
+// (tokenizer.ForModel).
+func New(chat ChatModel, tok *tokenizer.Tokenizer, log logger.Logger) *Service {
+	return &Service{chat: chat, tok: tok, budget: defaultBudget, logger: log}
+}
+
+// WithBudget sets how many tokens of the body go into the prompt
+func (s *Service) WithBudget(tokens int) *Service {
+	if tokens > 0 {
+		s.budget = tokens
+	}
+	return s
+}
+
+const systemPrompt = `You summarize emails. Give a one-sentence overview, then short bullet points with the key facts, decisions and requests. End with the action items for the reader (who, what, by when) if there are any.
+Do not add anything the email does not say. Write in the language of the email.`
+
+// Summarize summarizes an email. With onDelta the summary is streamed to
+// it as it is generated; if the stream is interrupted (Ctrl+C) the partial
+// summary is returned along with the error.
+func (s *Service) Summarize(ctx context.Context, email *domain.Email, onDelta func(string) error) (string, error) {
+	body := strings.TrimSpace(email.BodyText)
+	if body == "" {
+		return "", fmt.Errorf("email %s has no text to summarize", email.ID)
+	}
+	if s.tok.Count(body) > s.budget {
+		s.logger.Debug("Truncating email for summary", "email_id", email.ID, "budget", s.budget)
+		body = s.tok.Truncate(body, s.budget) + "\n[…truncated]"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Subject: %s\nFrom: %s\n", email.Subject, email.From)
+	if to, _ := email.GetToList(); len(to) > 0 {
+		fmt.Fprintf(&b, "To: %s\n", joinAddresses(to))
+	}
+	if cc, _ := email.GetCcList(); len(cc) > 0 {
+		fmt.Fprintf(&b, "Cc: %s\n", joinAddresses(cc))
+	}
+	if !email.Date.IsZero() {
+		fmt.Fprintf(&b, "Date: %s\n", email.Date.Format("2006-01-02 15:04 MST"))
+	}
+	b.WriteString("\n")
+	b.WriteString(body)
+
+	messages := []llm.Message{
+		{Role: llm.RoleSystem, Content: systemPrompt},
+		{Role: llm.RoleUser, Content: b.String()},
+	}
+	var text string
+	var err error
+	if onDelta != nil {
+		text, err = s.chat.ChatStream(ctx, messages, onDelta)
+	} else {
+		text, err = s.chat.Chat(ctx, messages)
+	}
+	return strings.TrimSpace(text), err
+}
+
+func joinAddresses(addrs []domain.Address) string {
+	parts := make([]string, len(addrs))
+	for i, a := range addrs {
+		parts[i] = a.String()
+	}
+	return strings.Join(parts, ", ")
+}
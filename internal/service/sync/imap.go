@@ -0,0 +1,91 @@
+package sync
+
+import (
+	"context"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/metadata"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/source"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+)
+
+// IMAPSyncer runs incremental IMAP syncs, keeping each folder's
+// UIDVALIDITY/UIDNEXT in SyncMetadata
+type IMAPSyncer struct {
+	importer *Importer
+	metaRepo metadata.Repository
+	logger   logger.Logger
+}
+
+// NewIMAPSyncer creates an IMAP syncer that stores through importer
+func NewIMAPSyncer(importer *Importer, metaRepo metadata.Repository, log logger.Logger) *IMAPSyncer {
+	return &IMAPSyncer{
+		importer: importer,
+		metaRepo: metaRepo,
+		logger:   log,
+	}
+}
+
+// Run loads the stored folder state into src, imports everything new and
+// persists the updated state. In IDLE mode it keeps running until ctx is
+// cancelled, checkpointing after each batch of new mail. A folder's state is
+// only saved once the importer has stored everything fetched from it.
+func (s *IMAPSyncer) Run(ctx context.Context, src *source.IMAP) (*ImportResult, error) {
+	metas := make(map[string]*domain.SyncMetadata)
+	for _, folder := range src.Folders() {
+		key := folderKey(src, folder)
+		meta, err := s.metaRepo.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if meta == nil {
+			meta = &domain.SyncMetadata{Source: key}
+		} else {
+			src.SetState(folder, source.FolderState{UIDValidity: meta.UIDValidity, UIDNext: meta.UIDNext})
+		}
+		metas[folder] = meta
+	}
+
+	src.OnCheckpoint(func(folder string, state source.FolderState) {
+		meta := metas[folder]
+		if meta.UIDValidity != 0 && meta.UIDValidity != state.UIDValidity {
+			s.logger.Warn("UIDVALIDITY changed, folder was refetched", "folder", folder,
+				"old", meta.UIDValidity, "new", state.UIDValidity)
+		}
+		meta.UIDValidity = state.UIDValidity
+		meta.UIDNext = state.UIDNext
+		meta.LastSyncTime = time.Now()
+
+		// checkpoint 在该文件夹的邮件全部写入后才触发；用独立 ctx 保存，
+		// 避免 Ctrl+C 时已经写入的进度丢失
+		if err := s.metaRepo.Save(context.WithoutCancel(ctx), meta); err != nil {
+			s.logger.Error("Failed to save IMAP folder state", "folder", folder, "error", err)
+		}
+	})
+
+	s.importer.WithCheckpoint(imapCheckpoint{src: src})
+	defer s.importer.WithCheckpoint(nil)
+
+	return s.importer.Import(ctx, src)
+}
+
+// imapCheckpoint confirms the importer's stored batches to the source,
+// which checkpoints a folder once everything fetched from it is stored
+type imapCheckpoint struct {
+	src *source.IMAP
+}
+
+func (c imapCheckpoint) Stored(_ context.Context, ids []string) error {
+	c.src.Stored(ids)
+	return nil
+}
+
+func (c imapCheckpoint) Indexed(context.Context, []string) error {
+	return nil
+}
+
+// folderKey is the SyncMetadata source key of an IMAP folder
+func folderKey(src *source.IMAP, folder string) string {
+	return "imap:" + src.Account() + "/" + folder
+}
@@ -0,0 +1,357 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/source"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+)
+
+// indexBatchSize is how many stored emails are handed to the Indexer at once
+const indexBatchSize = 50
+
+// storeBatchSize is how many emails are written per BulkUpsert transaction
+const storeBatchSize = 100
+
+// indexFlushInterval flushes a partial batch when the source goes quiet,
+// e.g. while watching a Maildir for new deliveries
+const indexFlushInterval = 2 * time.Second
+
+// Indexer embeds stored emails; rag.Service satisfies it
+type Indexer interface {
+	IndexEmails(ctx context.Context, emails []*domain.Email) error
+}
+
+// AttachmentStore persists the attachments of stored emails and indexes
+// their text; attachment.Service satisfies it
+type AttachmentStore interface {
+	Save(ctx context.Context, email *domain.Email) error
+	IndexEmails(ctx context.Context, emails []*domain.Email) (int, error)
+}
+
+// ThreadUpdater keeps conversation threads current; thread.Service
+// satisfies it
+type ThreadUpdater interface {
+	// Assign picks a provisional thread for an email before it is stored
+	Assign(ctx context.Context, email *domain.Email) error
+	// Update rethreads and refreshes the threads of stored emails
+	Update(ctx context.Context, emails []*domain.Email) error
+}
+
+// Checkpoint records per-message progress so an interrupted sync can
+// resume; the sync service implements it on top of its job record
+type Checkpoint interface {
+	// Stored is called once a batch is written to the repository
+	Stored(ctx context.Context, ids []string) error
+	// Indexed is called once emails are embedded, or need no embedding
+	// because they are unchanged and were indexed before
+	Indexed(ctx context.Context, ids []string) error
+}
+
+// ImportResult summarizes storing the output of a Source
+type ImportResult struct {
+	Source  string
+	Seen    int
+	Created int
+	// Updated counts stored emails whose content changed, Unchanged the
+	// ones that were already stored as-is
+	Updated    int
+	Unchanged  int
+	Duplicates int
+	Indexed    int
+
+	// Attachments counts stored attachments, AttachmentsIndexed the ones
+	// whose text was extracted and embedded
+	Attachments        int
+	AttachmentsIndexed int
+
+	// Failed lists messages the source could not read
+	Failed []source.Failure
+}
+
+// Importer drains any Source into the email repository
+type Importer struct {
+	emailRepo   email.Repository
+	indexer     Indexer
+	attachments AttachmentStore
+	threads     ThreadUpdater
+	checkpoint  Checkpoint
+	logger      logger.Logger
+}
+
+// NewImporter creates an importer that stores into emailRepo
+func NewImporter(emailRepo email.Repository, log logger.Logger) *Importer {
+	return &Importer{
+		emailRepo: emailRepo,
+		logger:    log,
+	}
+}
+
+// WithIndexer makes the importer index newly stored emails in batches
+func (i *Importer) WithIndexer(indexer Indexer) *Importer {
+	i.indexer = indexer
+	return i
+}
+
+// WithAttachments stores the attachments of newly stored emails and, when
+// an Indexer is set, indexes them together with the email batch
+func (i *Importer) WithAttachments(store AttachmentStore) *Importer {
+	i.attachments = store
+	return i
+}
+
+// WithThreads maintains the thread aggregates of imported emails
+func (i *Importer) WithThreads(threads ThreadUpdater) *Importer {
+	i.threads = threads
+	return i
+}
+
+// WithCheckpoint reports stored and indexed message IDs to cp; nil
+// turns reporting off
+func (i *Importer) WithCheckpoint(cp Checkpoint) *Importer {
+	i.checkpoint = cp
+	return i
+}
+
+// Import streams every email from src and upserts it. New and changed
+// emails are threaded, get their attachments stored and are indexed;
+// unchanged ones are only indexed if they never were. Emails sharing an
+// ID (i.e. the same Message-ID) are stored once. A database error aborts
+// the import.
+func (i *Importer) Import(ctx context.Context, src source.Source) (*ImportResult, error) {
+	result := &ImportResult{Source: src.Name()}
+	stage := i.Stage(result)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	out := make(chan *domain.Email, 64)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- src.Stream(ctx, out)
+		close(out)
+	}()
+
+	var batch, pending []*domain.Email
+	received := false
+
+	flush := func() {
+		if i.indexer == nil || len(pending) == 0 {
+			return
+		}
+		if err := i.indexer.IndexEmails(ctx, pending); err != nil {
+			i.logger.Error("Failed to index imported emails", "count", len(pending), "error", err)
+		} else {
+			result.Indexed += len(pending)
+			i.markIndexed(ctx, pending)
+		}
+		if i.attachments != nil {
+			n, err := i.attachments.IndexEmails(ctx, pending)
+			if err != nil {
+				i.logger.Error("Failed to index attachments", "error", err)
+			}
+			result.AttachmentsIndexed += n
+		}
+		pending = pending[:0]
+	}
+
+	// store 把缓冲的邮件一次性写入；只有新增或内容变化的邮件才继续往下走
+	store := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		changed, err := stage.Store(ctx, batch)
+		batch = batch[:0]
+		if err != nil {
+			return err
+		}
+		for _, e := range changed {
+			pending = append(pending, e)
+			if len(pending) >= indexBatchSize {
+				flush()
+			}
+		}
+		return nil
+	}
+
+	ticker := time.NewTicker(indexFlushInterval)
+	defer ticker.Stop()
+
+	var storeErr error
+loop:
+	for {
+		select {
+		case e, ok := <-out:
+			if !ok {
+				break loop
+			}
+			received = true
+			batch = append(batch, e)
+			if len(batch) >= storeBatchSize {
+				if storeErr = store(); storeErr != nil {
+					break loop
+				}
+			}
+		case <-ticker.C:
+			if storeErr = store(); storeErr != nil {
+				break loop
+			}
+			if !received {
+				stage.Flush(ctx)
+			}
+			received = false
+			flush()
+		}
+	}
+	if storeErr == nil {
+		storeErr = store()
+	}
+	stage.Flush(ctx)
+	flush()
+
+	if storeErr != nil {
+		// 让 source 停下来，再把它的 goroutine 收回
+		cancel()
+		for range out {
+		}
+		<-errc
+		return result, fmt.Errorf("failed to store emails: %w", storeErr)
+	}
+
+	result.Failed = src.Failures()
+	for _, f := range result.Failed {
+		i.logger.Warn("Failed to read message", "ref", f.Ref, "error", f.Err)
+	}
+
+	return result, <-errc
+}
+
+// StoreStage is the store step of Import on its own, so that a pipeline
+// can run it as its store stage. Counts are added to its ImportResult.
+type StoreStage struct {
+	importer *Importer
+	result   *ImportResult
+	seen     map[string]bool
+
+	// 会话重建要扫描全部邮件头，所以不按批做，而是等 source 安静下来
+	// （或者结束）时再统一更新
+	unthreaded []*domain.Email
+}
+
+// Stage returns a store stage that adds its counts to result
+func (i *Importer) Stage(result *ImportResult) *StoreStage {
+	return &StoreStage{
+		importer: i,
+		result:   result,
+		seen:     make(map[string]bool),
+	}
+}
+
+// Store upserts a batch of emails. Duplicates are dropped; new and changed
+// emails get a thread and their attachments stored and are returned for
+// indexing. Unchanged emails are returned too when their content was never
+// indexed, the others are only counted. The batch is not retained.
+func (s *StoreStage) Store(ctx context.Context, emails []*domain.Email) ([]*domain.Email, error) {
+	i, result := s.importer, s.result
+
+	batch := make([]*domain.Email, 0, len(emails))
+	for _, e := range emails {
+		result.Seen++
+		// 同一个 Message-ID 在多个文件夹/归档里出现时只保留一份
+		if s.seen[e.ID] {
+			result.Duplicates++
+			continue
+		}
+		s.seen[e.ID] = true
+
+		if i.threads != nil {
+			if err := i.threads.Assign(ctx, e); err != nil {
+				i.logger.Debug("Failed to assign thread", "id", e.ID, "error", err)
+			}
+		}
+		if result.Seen%500 == 0 {
+			i.logger.Info("Import progress", "source", result.Source, "seen", result.Seen, "created", result.Created)
+		}
+		batch = append(batch, e)
+	}
+	if len(batch) == 0 {
+		return nil, nil
+	}
+
+	upserted, err := i.emailRepo.BulkUpsert(ctx, batch)
+	if err != nil {
+		return nil, err
+	}
+	result.Created += upserted.Inserted
+	result.Updated += upserted.Updated
+	result.Unchanged += upserted.Unchanged
+	i.markStored(ctx, batch)
+
+	var changed, indexed []*domain.Email
+	for _, e := range batch {
+		if upserted.Changes[e.ID] == email.Unchanged {
+			// 没变不等于索引过：上次可能存完就中断了，或者索引失败
+			if e.Indexed() {
+				indexed = append(indexed, e)
+			} else {
+				changed = append(changed, e)
+			}
+			continue
+		}
+		if i.attachments != nil && len(e.Attachments) > 0 {
+			if err := i.attachments.Save(ctx, e); err != nil {
+				i.logger.Warn("Failed to store attachments", "id", e.ID, "error", err)
+			} else {
+				result.Attachments += len(e.Attachments)
+			}
+		}
+		s.unthreaded = append(s.unthreaded, e)
+		changed = append(changed, e)
+	}
+	i.markIndexed(ctx, indexed)
+	return changed, nil
+}
+
+// Flush rethreads the emails stored since the last Flush
+func (s *StoreStage) Flush(ctx context.Context) {
+	i := s.importer
+	if i.threads == nil || len(s.unthreaded) == 0 {
+		return
+	}
+	if err := i.threads.Update(ctx, s.unthreaded); err != nil {
+		i.logger.Error("Failed to update threads", "count", len(s.unthreaded), "error", err)
+	}
+	s.unthreaded = s.unthreaded[:0]
+}
+
+// markStored and markIndexed pass progress to the checkpoint. A failed
+// checkpoint only means the work is redone on resume, so it is logged.
+func (i *Importer) markStored(ctx context.Context, emails []*domain.Email) {
+	if i.checkpoint == nil || len(emails) == 0 {
+		return
+	}
+	if err := i.checkpoint.Stored(ctx, emailIDs(emails)); err != nil {
+		i.logger.Warn("Failed to record sync checkpoint", "error", err)
+	}
+}
+
+func (i *Importer) markIndexed(ctx context.Context, emails []*domain.Email) {
+	if i.checkpoint == nil || len(emails) == 0 {
+		return
+	}
+	if err := i.checkpoint.Indexed(ctx, emailIDs(emails)); err != nil {
+		i.logger.Warn("Failed to record sync checkpoint", "error", err)
+	}
+}
+
+func emailIDs(emails []*domain.Email) []string {
+	ids := make([]string, len(emails))
+	for n, e := range emails {
+		ids[n] = e.ID
+	}
+	return ids
+}
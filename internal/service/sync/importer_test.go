@@ -0,0 +1,92 @@
+package sync_test
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/config"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/database"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	syncsvc "github.com/M1ngdaXie/go-local-rag-email/internal/service/sync"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+)
+
+type fakeCheckpoint struct {
+	stored, indexed []string
+}
+
+func (c *fakeCheckpoint) Stored(_ context.Context, ids []string) error {
+	c.stored = append(c.stored, ids...)
+	return nil
+}
+
+func (c *fakeCheckpoint) Indexed(_ context.Context, ids []string) error {
+	c.indexed = append(c.indexed, ids...)
+	return nil
+}
+
+func ids(emails []*domain.Email) []string {
+	var out []string
+	for _, e := range emails {
+		out = append(out, e.ID)
+	}
+	return out
+}
+
+func TestStoreUnchangedEmails(t *testing.T) {
+	log := logger.NewSlog("error")
+	db, err := database.NewSQLite(config.SQLiteConfig{
+		Path:            filepath.Join(t.TempDir(), "emails.db"),
+		MaxOpenConns:    1,
+		MaxIdleConns:    1,
+		ConnMaxLifetime: time.Hour,
+	}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := email.NewSQLiteRepository(db, log)
+	ctx := context.Background()
+
+	parse := func() []*domain.Email {
+		return []*domain.Email{
+			{ID: "a", Subject: "Budget", BodyText: "Q3 numbers"},
+			{ID: "b", Subject: "Lunch", BodyText: "Noon?"},
+		}
+	}
+	store := func() ([]*domain.Email, *fakeCheckpoint) {
+		t.Helper()
+		cp := &fakeCheckpoint{}
+		stage := syncsvc.NewImporter(repo, log).WithCheckpoint(cp).Stage(&syncsvc.ImportResult{})
+		changed, err := stage.Store(ctx, parse())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return changed, cp
+	}
+
+	changed, cp := store()
+	if got := ids(changed); !slices.Equal(got, []string{"a", "b"}) || len(cp.indexed) != 0 {
+		t.Fatalf("first import passed on %v and marked %v indexed; want [a b], none", got, cp.indexed)
+	}
+
+	// 上次存完就中断了：内容没变，但从来没索引过，要重新交给索引
+	changed, cp = store()
+	if got := ids(changed); !slices.Equal(got, []string{"a", "b"}) || len(cp.indexed) != 0 {
+		t.Errorf("re-import of unindexed emails passed on %v and marked %v indexed; want [a b], none", got, cp.indexed)
+	}
+
+	if err := repo.MarkIndexed(ctx, changed[:1]); err != nil {
+		t.Fatal(err)
+	}
+	changed, cp = store()
+	if got := ids(changed); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("passed on %v, want only the unindexed b", got)
+	}
+	if !slices.Equal(cp.indexed, []string{"a"}) {
+		t.Errorf("checkpoint marked %v indexed, want [a]", cp.indexed)
+	}
+}
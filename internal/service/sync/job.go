@@ -0,0 +1,267 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/syncjob"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/gmail"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/source"
+)
+
+// storeChunkSize is how many listed messages are downloaded per Import
+const storeChunkSize = 500
+
+// startJob discards any unfinished job of the source and records a new one
+// for the mode the options and sync state call for
+func (s *Service) startJob(ctx context.Context, source string, opts Options, meta *domain.SyncMetadata, profile *gmail.Profile) (*domain.SyncJob, error) {
+	if err := s.jobs.Discard(ctx, source); err != nil {
+		return nil, err
+	}
+
+	job := &domain.SyncJob{
+		Source:           source,
+		Phase:            domain.SyncPhaseFetch,
+		Query:            opts.List.SearchQuery(),
+		MaxResults:       opts.List.MaxResults,
+		IncludeSpamTrash: opts.IncludeTrash,
+	}
+	switch {
+	case opts.scoped():
+		job.Mode = string(ModeBackfill)
+		// 回填不会推进 historyId；但如果从没同步过，就从现在开始记录增量
+		job.HistoryID = meta.HistoryID
+		if job.HistoryID == 0 {
+			job.HistoryID = profile.HistoryID
+		}
+	case !opts.Full && meta.HistoryID != 0:
+		// 增量同步在 fetch 阶段结束后，HistoryID 换成 history 返回的新值
+		job.Mode = string(ModeIncremental)
+		job.HistoryID = meta.HistoryID
+	default:
+		// historyId 在列邮件之前取，同步期间的变化下次会被重放
+		job.Mode = string(ModeFull)
+		job.HistoryID = profile.HistoryID
+	}
+
+	if err := s.jobs.Create(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// runJob drives a job through its remaining phases, saving the job after
+// every step so that it can be resumed from there
+func (s *Service) runJob(ctx context.Context, job *domain.SyncJob, result *Result) error {
+	result.Mode = Mode(job.Mode)
+
+	for job.Phase != domain.SyncPhaseDone {
+		var err error
+		switch job.Phase {
+		case domain.SyncPhaseFetch:
+			if job.Mode == string(ModeIncremental) {
+				err = s.replayHistory(ctx, job, result)
+			} else {
+				err = s.listMessages(ctx, job)
+			}
+		case domain.SyncPhaseStore:
+			err = s.storeMessages(ctx, job, result)
+		case domain.SyncPhaseIndex:
+			err = s.indexMessages(ctx, job, result)
+		default:
+			return errors.New("unknown sync job phase: " + job.Phase)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	result.HistoryID = job.HistoryID
+	return nil
+}
+
+// listMessages pages through messages.list, recording every page of IDs
+// together with the token of the next page
+func (s *Service) listMessages(ctx context.Context, job *domain.SyncJob) error {
+	list := gmail.ListOptions{Query: job.Query, IncludeSpamTrash: job.IncludeSpamTrash}
+	if job.Query != "" {
+		s.logger.Info("Listing messages", "query", job.Query, "max", job.MaxResults)
+	}
+
+	for {
+		pageSize := int64(0)
+		if job.MaxResults > 0 {
+			pageSize = job.MaxResults - int64(job.Listed)
+			if pageSize <= 0 {
+				break
+			}
+		}
+
+		ids, next, err := s.gmail.ListMessagePage(ctx, list, job.PageToken, pageSize)
+		if err != nil {
+			return err
+		}
+		if err := s.jobs.AddItems(ctx, job.ID, ids, job.Listed); err != nil {
+			return err
+		}
+		job.Listed += len(ids)
+		job.PageToken = next
+		if err := s.jobs.Save(ctx, job); err != nil {
+			return err
+		}
+		s.logger.Debug("Listed message page", "job", job.ID, "listed", job.Listed)
+
+		if next == "" {
+			break
+		}
+	}
+
+	job.PageToken = ""
+	return s.advance(ctx, job, domain.SyncPhaseStore)
+}
+
+// replayHistory applies the label changes and deletions since the job's
+// historyId and records the added messages for the store phase. Restored
+// messages are recorded as stored, so the index phase embeds them again.
+func (s *Service) replayHistory(ctx context.Context, job *domain.SyncJob, result *Result) error {
+	changes, err := s.gmail.History(ctx, job.HistoryID)
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("Replaying mailbox history",
+		"since", job.HistoryID,
+		"added", len(changes.Added),
+		"deleted", len(changes.Deleted),
+		"relabeled", len(changes.Relabeled),
+	)
+
+	// 标签变化和删除都是幂等的，中断后重放一遍没有副作用
+	restored, err := s.relabel(ctx, changes.Relabeled, job.IncludeSpamTrash, result)
+	if err != nil {
+		return err
+	}
+	if err := s.remove(ctx, changes.Deleted, result); err != nil {
+		return err
+	}
+
+	if err := s.jobs.AddItems(ctx, job.ID, changes.Added, 0); err != nil {
+		return err
+	}
+	job.Listed = len(changes.Added)
+
+	// 移回来的邮件已经在本地，不用重新下载，但向量在删除时清掉了，
+	// 记成已存储、未索引，索引阶段会重新生成（不带 --index 时由 index 命令补上）
+	if err := s.jobs.AddItems(ctx, job.ID, restored, job.Listed); err != nil {
+		return err
+	}
+	if err := s.jobs.MarkStored(ctx, job.ID, restored); err != nil {
+		return err
+	}
+	job.Listed += len(restored)
+	job.Stored += len(restored)
+	job.HistoryID = changes.HistoryID
+	return s.advance(ctx, job, domain.SyncPhaseStore)
+}
+
+// storeMessages downloads and stores the listed messages that are not
+// stored yet. The importer reports each stored batch back to the job.
+func (s *Service) storeMessages(ctx context.Context, job *domain.SyncJob, result *Result) error {
+	pending, err := s.jobs.Pending(ctx, job.ID)
+	if err != nil {
+		return err
+	}
+
+	cp := &jobCheckpoint{jobs: s.jobs, job: job}
+	s.importer.WithCheckpoint(cp)
+	defer s.importer.WithCheckpoint(nil)
+	if s.pipeline != nil {
+		s.pipeline.WithCheckpoint(cp)
+		defer s.pipeline.WithCheckpoint(nil)
+	}
+
+	for start := 0; start < len(pending); start += storeChunkSize {
+		chunk := pending[start:min(start+storeChunkSize, len(pending))]
+		if err := s.store(ctx, s.gmail.NewMessageSource(chunk), result); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		s.logger.Info("Sync progress", "job", job.ID, "stored", job.Stored, "listed", job.Listed)
+	}
+
+	if job.Mode == string(ModeIncremental) && !job.IncludeSpamTrash {
+		if err := s.removeTrashed(ctx, pending, result); err != nil {
+			return err
+		}
+	}
+
+	// 下载失败的邮件留在 pending 里，报告给用户，不在这里无限重试
+	return s.advance(ctx, job, domain.SyncPhaseIndex)
+}
+
+// indexMessages embeds messages an interrupted run stored but did not get
+// to index, then finishes the job
+func (s *Service) indexMessages(ctx context.Context, job *domain.SyncJob, result *Result) error {
+	if s.pipeline != nil {
+		ids, err := s.jobs.Unindexed(ctx, job.ID)
+		if err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			s.logger.Info("Indexing messages left over by the interrupted run", "job", job.ID, "count", len(ids))
+
+			src := source.NewStoredIDs(s.emailRepo, ids)
+			if lister, ok := s.attachments.(source.AttachmentLister); ok {
+				src.WithAttachments(lister)
+			}
+			s.pipeline.WithCheckpoint(&jobCheckpoint{jobs: s.jobs, job: job})
+			defer s.pipeline.WithCheckpoint(nil)
+
+			summary, err := s.pipeline.Run(ctx, src, nil)
+			s.addIndexed(summary, result)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.jobs.Finish(ctx, job)
+}
+
+// advance moves a job to the next phase and saves it
+func (s *Service) advance(ctx context.Context, job *domain.SyncJob, phase string) error {
+	job.Phase = phase
+	return s.jobs.Save(ctx, job)
+}
+
+// jobCheckpoint records the progress of the importer and the pipeline on
+// a sync job. The pipeline stages report concurrently, hence the lock.
+type jobCheckpoint struct {
+	mu   sync.Mutex
+	jobs syncjob.Repository
+	job  *domain.SyncJob
+}
+
+func (c *jobCheckpoint) Stored(ctx context.Context, ids []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.jobs.MarkStored(ctx, c.job.ID, ids); err != nil {
+		return err
+	}
+	c.job.Stored += len(ids)
+	return c.jobs.Save(ctx, c.job)
+}
+
+func (c *jobCheckpoint) Indexed(ctx context.Context, ids []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.jobs.MarkIndexed(ctx, c.job.ID, ids); err != nil {
+		return err
+	}
+	c.job.Indexed += len(ids)
+	return c.jobs.Save(ctx, c.job)
+}
@@ -0,0 +1,184 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/gmail"
+)
+
+// reconcileInterval is how often a sync also diffs the local message IDs
+// against the mailbox, catching deletions the history replay missed
+const reconcileInterval = 7 * 24 * time.Hour
+
+// removedLabels mark messages that count as deleted unless trash is kept
+var removedLabels = map[string]bool{"TRASH": true, "SPAM": true}
+
+// VectorIndex drops the vectors of removed emails and updates the
+// payload of relabeled ones; rag.Service satisfies it and also forgets
+// the embedding records of removed emails
+type VectorIndex interface {
+	DeleteByEmailID(ctx context.Context, emailID string) error
+	RefreshMetadata(ctx context.Context, email *domain.Email) error
+}
+
+// trashed reports whether a label set puts a message in Trash or Spam
+func trashed(labels []string) bool {
+	for _, l := range labels {
+		if removedLabels[l] {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcile lists every message ID in the mailbox and removes local Gmail
+// emails that are no longer there
+func (s *Service) reconcile(ctx context.Context, includeTrash bool, result *Result) error {
+	remote, err := s.gmail.ListMessageIDs(ctx, gmail.ListOptions{IncludeSpamTrash: includeTrash})
+	if err != nil {
+		return err
+	}
+	local, err := s.emailRepo.ListIDs(ctx, email.Filter{Source: "gmail"})
+	if err != nil {
+		return err
+	}
+
+	// 远端一封都没有时更可能是请求出了问题，而不是邮箱被清空了
+	if len(remote) == 0 && len(local) > 0 {
+		s.logger.Warn("Mailbox listed no messages, skipping reconciliation", "local", len(local))
+		return nil
+	}
+
+	present := make(map[string]bool, len(remote))
+	for _, id := range remote {
+		present[id] = true
+	}
+	var gone []string
+	for _, id := range local {
+		if !present[id] {
+			gone = append(gone, id)
+		}
+	}
+
+	s.logger.Info("Reconciled message IDs", "remote", len(remote), "local", len(local), "removed", len(gone))
+	result.Reconciled = true
+	return s.remove(ctx, gone, result)
+}
+
+// remove soft-deletes emails, drops their vectors and refreshes the
+// threads they belonged to
+func (s *Service) remove(ctx context.Context, ids []string, result *Result) error {
+	var touched []string
+	for _, id := range ids {
+		e, err := s.emailRepo.Get(ctx, id)
+		if errors.Is(err, email.ErrNotFound) {
+			// 本地没有，或者已经删过了
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		touched = append(touched, e.ThreadID)
+		if err := s.emailRepo.Delete(ctx, id); err != nil {
+			return err
+		}
+		// 向量删除失败不影响本地软删除，purge 时会再删一次
+		if s.vectors != nil {
+			if err := s.vectors.DeleteByEmailID(ctx, id); err != nil {
+				s.logger.Warn("Failed to delete vectors", "id", id, "error", err)
+			}
+		}
+		result.Deleted++
+	}
+	s.refreshThreads(ctx, touched)
+	return ctx.Err()
+}
+
+// removeTrashed removes stored emails that arrived already in Trash or Spam
+func (s *Service) removeTrashed(ctx context.Context, ids []string, result *Result) error {
+	var gone []string
+	for _, id := range ids {
+		e, err := s.emailRepo.Get(ctx, id)
+		if errors.Is(err, email.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if labels, err := e.GetLabels(); err == nil && trashed(labels) {
+			gone = append(gone, id)
+		}
+	}
+	return s.remove(ctx, gone, result)
+}
+
+// relabel applies label changes. Messages moved to Trash or Spam are
+// removed, and removed messages that came back are restored. Removing a
+// message dropped its vectors, so the restored IDs are returned to be
+// indexed again.
+func (s *Service) relabel(ctx context.Context, changes map[string][]string, includeTrash bool, result *Result) ([]string, error) {
+	var gone, touched, restored []string
+	for id, labels := range changes {
+		if !includeTrash && trashed(labels) {
+			gone = append(gone, id)
+			continue
+		}
+		err := s.emailRepo.UpdateLabels(ctx, id, labels)
+		if err == nil {
+			s.refreshMetadata(ctx, id)
+			result.Relabeled++
+			continue
+		}
+		if !errors.Is(err, email.ErrNotFound) {
+			return nil, err
+		}
+		// 可能是之前被删到回收站、现在又被移回来的邮件
+		if err := s.emailRepo.Restore(ctx, id); err != nil {
+			if errors.Is(err, email.ErrNotFound) {
+				// 本地没有这封邮件（比如超出了首次同步的范围），忽略
+				s.logger.Debug("Skipping label change", "id", id)
+				continue
+			}
+			return nil, err
+		}
+		if err := s.emailRepo.UpdateLabels(ctx, id, labels); err != nil {
+			return nil, err
+		}
+		if e, err := s.emailRepo.Get(ctx, id); err == nil {
+			touched = append(touched, e.ThreadID)
+		}
+		restored = append(restored, id)
+		result.Restored++
+	}
+	s.refreshThreads(ctx, touched)
+	return restored, s.remove(ctx, gone, result)
+}
+
+// refreshMetadata pushes the new labels of an email to its vectors so
+// label filters see them without re-embedding. A failure only leaves the
+// filter stale until the next index run, so it is logged, not returned.
+func (s *Service) refreshMetadata(ctx context.Context, id string) {
+	if s.vectors == nil {
+		return
+	}
+	e, err := s.emailRepo.Get(ctx, id)
+	if err == nil {
+		err = s.vectors.RefreshMetadata(ctx, e)
+	}
+	if err != nil {
+		s.logger.Warn("Failed to update vector labels", "id", id, "error", err)
+	}
+}
+
+func (s *Service) refreshThreads(ctx context.Context, ids []string) {
+	if s.threads == nil || len(ids) == 0 {
+		return
+	}
+	if err := s.threads.Refresh(ctx, ids...); err != nil {
+		s.logger.Error("Failed to refresh threads", "error", err)
+	}
+}
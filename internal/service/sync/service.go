@@ -0,0 +1,269 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/metadata"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/syncjob"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/gmail"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/pipeline"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/source"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+)
+
+// Mode describes how a sync run fetched its messages
+type Mode string
+
+const (
+	// ModeFull lists the newest messages and records the mailbox historyId
+	ModeFull Mode = "full"
+	// ModeIncremental replays users.history.list since the stored historyId
+	ModeIncremental Mode = "incremental"
+	// ModeBackfill fetches a scoped slice of the mailbox (query, labels or
+	// date range) without touching the incremental sync state
+	ModeBackfill Mode = "backfill"
+)
+
+// Options configures a sync run
+type Options struct {
+	// List caps and scopes the messages fetched on a full sync or backfill
+	List gmail.ListOptions
+
+	// Full forces a full resync even if a historyId is stored
+	Full bool
+
+	// IncludeTrash keeps messages in Trash and Spam; by default they are
+	// treated like deleted messages
+	IncludeTrash bool
+
+	// Reconcile diffs the local message IDs against the whole mailbox even
+	// if the last reconciliation is recent
+	Reconcile bool
+
+	// Resume continues the last interrupted run with its original options;
+	// the other options only apply when there is nothing to resume
+	Resume bool
+}
+
+// scoped reports whether the run only covers part of the mailbox
+func (o Options) scoped() bool {
+	return o.List.SearchQuery() != ""
+}
+
+// Result summarizes a sync run
+type Result struct {
+	Mode      Mode
+	Account   string
+	HistoryID uint64
+
+	Fetched   int
+	Created   int
+	Updated   int
+	Unchanged int
+	Indexed   int
+	Relabeled int
+	Deleted   int
+	Restored  int
+
+	// Reconciled is set when local IDs were diffed against the mailbox
+	Reconciled bool
+
+	// Resumed is set when the run continued an interrupted sync job
+	Resumed bool
+
+	// Failed lists messages that could not be downloaded after retries
+	Failed []source.Failure
+
+	// Index sums up the pipeline stages when the run also indexed
+	Index *pipeline.Summary
+}
+
+// Service orchestrates fetching mail from Gmail and storing it locally
+type Service struct {
+	gmail       *gmail.Service
+	emailRepo   email.Repository
+	metaRepo    metadata.Repository
+	jobs        syncjob.Repository
+	importer    *Importer
+	pipeline    *pipeline.Pipeline
+	attachments AttachmentStore
+	threads     ThreadRefresher
+	vectors     VectorIndex
+	logger      logger.Logger
+}
+
+// New creates a new sync service
+func New(gmailSvc *gmail.Service, emailRepo email.Repository, metaRepo metadata.Repository, jobs syncjob.Repository, log logger.Logger) *Service {
+	return &Service{
+		gmail:     gmailSvc,
+		emailRepo: emailRepo,
+		metaRepo:  metaRepo,
+		jobs:      jobs,
+		importer:  NewImporter(emailRepo, log),
+		logger:    log,
+	}
+}
+
+// WithThreads maintains thread aggregates for synced and deleted messages
+func (s *Service) WithThreads(threads ThreadRefresher) *Service {
+	s.threads = threads
+	s.importer.WithThreads(threads)
+	return s
+}
+
+// ThreadRefresher is the ThreadUpdater the sync service also uses to
+// refresh threads that lost messages
+type ThreadRefresher interface {
+	ThreadUpdater
+	Refresh(ctx context.Context, ids ...string) error
+}
+
+// WithPipeline indexes synced messages as they are stored, streaming them
+// through the stages of p. Messages stored by an interrupted run but not
+// indexed yet are picked up when the run is resumed.
+func (s *Service) WithPipeline(p *pipeline.Pipeline) *Service {
+	s.pipeline = p
+	return s
+}
+
+// WithVectors removes the vectors of deleted and trashed messages
+func (s *Service) WithVectors(vectors VectorIndex) *Service {
+	s.vectors = vectors
+	return s
+}
+
+// WithAttachments stores the attachments of synced messages
+func (s *Service) WithAttachments(store AttachmentStore) *Service {
+	s.attachments = store
+	s.importer.WithAttachments(store)
+	return s
+}
+
+// Run syncs the mailbox. It replays history since the last run when
+// possible and falls back to a full sync on the first run or when the
+// stored historyId has expired.
+//
+// Every run is tracked by a sync job. If a run is interrupted (Ctrl+C,
+// network loss, the laptop going to sleep), Options.Resume continues the
+// unfinished job where it stopped instead of starting over.
+func (s *Service) Run(ctx context.Context, opts Options) (*Result, error) {
+	profile, err := s.gmail.Profile(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	source := "gmail:" + profile.EmailAddress
+	meta, err := s.metaRepo.Get(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		meta = &domain.SyncMetadata{Source: source}
+	}
+
+	result := &Result{Account: profile.EmailAddress}
+	opts.List.IncludeSpamTrash = opts.IncludeTrash
+
+	var job *domain.SyncJob
+	if opts.Resume {
+		if job, err = s.jobs.Unfinished(ctx, source); err != nil {
+			return nil, err
+		}
+		if job == nil {
+			s.logger.Info("No interrupted sync to resume, starting a new one", "source", source)
+		} else {
+			result.Resumed = true
+			s.logger.Info("Resuming sync", "job", job.ID, "mode", job.Mode, "phase", job.Phase,
+				"listed", job.Listed, "stored", job.Stored)
+		}
+	}
+	if job == nil {
+		if job, err = s.startJob(ctx, source, opts, meta, profile); err != nil {
+			return nil, err
+		}
+	}
+
+	// history 过期后，窗口内的删除事件已经丢了，需要全量比对一次 ID
+	reconcile := opts.Reconcile ||
+		(job.Mode != string(ModeBackfill) && meta.HistoryID != 0 && time.Since(meta.ReconciledAt) > reconcileInterval)
+
+	err = s.runJob(ctx, job, result)
+	if errors.Is(err, gmail.ErrHistoryExpired) {
+		s.logger.Warn("Stored historyId expired, falling back to full sync", "history_id", job.HistoryID)
+		*result = Result{Account: profile.EmailAddress}
+		opts.Full = true
+		if job, err = s.startJob(ctx, source, opts, meta, profile); err != nil {
+			return nil, err
+		}
+		err = s.runJob(ctx, job, result)
+		reconcile = true
+	}
+	if err == nil && reconcile {
+		err = s.reconcile(ctx, job.IncludeSpamTrash, result)
+	}
+	if err != nil {
+		// 记下中断原因；ctx 可能已经取消，所以不用它来写
+		job.Error = err.Error()
+		if saveErr := s.jobs.Save(context.WithoutCancel(ctx), job); saveErr != nil {
+			s.logger.Warn("Failed to save sync job", "job", job.ID, "error", saveErr)
+		}
+		return result, err
+	}
+
+	// 只有整个同步成功后才推进 historyId，失败时下次会重放同一段 history
+	meta.HistoryID = result.HistoryID
+	meta.LastSyncTime = time.Now()
+	if result.Reconciled {
+		meta.ReconciledAt = meta.LastSyncTime
+	}
+	if count, err := s.emailRepo.Count(ctx, email.Filter{}); err == nil {
+		meta.EmailsCount = int(count)
+	}
+	if err := s.metaRepo.Save(ctx, meta); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// store imports a Gmail source, through the pipeline if the run indexes,
+// and folds its counts into result
+func (s *Service) store(ctx context.Context, src source.Source, result *Result) error {
+	var imported *ImportResult
+	var err error
+	if s.pipeline == nil {
+		imported, err = s.importer.Import(ctx, src)
+	} else {
+		imported = &ImportResult{Source: src.Name()}
+		var summary *pipeline.Summary
+		summary, err = s.pipeline.Run(ctx, src, s.importer.Stage(imported))
+		s.addIndexed(summary, result)
+		imported.Failed = summary.Failed
+	}
+	if imported != nil {
+		result.Fetched += imported.Seen
+		result.Created += imported.Created
+		result.Updated += imported.Updated
+		result.Unchanged += imported.Unchanged
+		result.Indexed += imported.Indexed
+		result.Failed = append(result.Failed, imported.Failed...)
+	}
+	if err != nil {
+		return fmt.Errorf("fetch failed: %w", err)
+	}
+	return nil
+}
+
+// addIndexed folds a pipeline summary into result
+func (s *Service) addIndexed(summary *pipeline.Summary, result *Result) {
+	if result.Index == nil {
+		result.Index = &pipeline.Summary{Source: summary.Source}
+	}
+	result.Index.Merge(summary)
+	result.Indexed += summary.Indexed
+}
@@ -0,0 +1,258 @@
+package thread
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message is the part of an email the threading algorithm looks at
+type Message struct {
+	EmailID   string
+	MessageID string
+	// References lists ancestor Message-IDs oldest first, with In-Reply-To last
+	References []string
+	Subject    string
+	Date       time.Time
+}
+
+// container is a node of the JWZ reference tree. It may be empty when a
+// message is only known because another message referenced it.
+type container struct {
+	msg      *Message
+	parent   *container
+	children []*container
+}
+
+func (c *container) addChild(child *container) {
+	if child.parent != nil {
+		child.parent.removeChild(child)
+	}
+	child.parent = c
+	c.children = append(c.children, child)
+}
+
+func (c *container) removeChild(child *container) {
+	for i, x := range c.children {
+		if x == child {
+			c.children = append(c.children[:i], c.children[i+1:]...)
+			break
+		}
+	}
+	child.parent = nil
+}
+
+// isAncestor reports whether c is an ancestor of (or the same node as) other
+func (c *container) isAncestor(other *container) bool {
+	for p := other; p != nil; p = p.parent {
+		if p == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Group threads messages with Jamie Zawinski's algorithm
+// (https://www.jwz.org/doc/threading.html) and returns, for every
+// message, the ID of its thread. A thread is identified by the EmailID of
+// its earliest message, so IDs stay stable as replies arrive.
+//
+// Subject grouping is deliberately conservative: a root is only merged by
+// subject when it is a reply ("Re: ...") or an empty placeholder, so two
+// unrelated "Weekly report" emails do not end up in one thread.
+func Group(msgs []Message) map[string]string {
+	sorted := make([]Message, len(msgs))
+	copy(sorted, msgs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].Date.Equal(sorted[j].Date) {
+			return sorted[i].Date.Before(sorted[j].Date)
+		}
+		return sorted[i].EmailID < sorted[j].EmailID
+	})
+
+	idTable := make(map[string]*container)
+	var all []*container
+	get := func(id string) *container {
+		if c, ok := idTable[id]; ok {
+			return c
+		}
+		c := &container{}
+		idTable[id] = c
+		all = append(all, c)
+		return c
+	}
+
+	// 1. 按 References 建立父子关系
+	for i := range sorted {
+		m := &sorted[i]
+
+		var c *container
+		if existing, ok := idTable[m.MessageID]; ok && m.MessageID != "" && existing.msg == nil {
+			c = existing
+		} else if m.MessageID != "" && !ok {
+			c = get(m.MessageID)
+		} else {
+			// 没有 Message-ID 或者 ID 重复，单独建一个节点
+			c = &container{}
+			all = append(all, c)
+		}
+		c.msg = m
+
+		var prev *container
+		for _, ref := range m.References {
+			if ref == "" || ref == m.MessageID {
+				continue
+			}
+			rc := get(ref)
+			if prev != nil && rc.parent == nil && !rc.isAncestor(prev) {
+				prev.addChild(rc)
+			}
+			prev = rc
+		}
+
+		if prev != nil && !c.isAncestor(prev) {
+			prev.addChild(c)
+		} else if prev == nil && c.parent != nil {
+			// 消息自己的 References 说它是根，以消息本身为准
+			c.parent.removeChild(c)
+		}
+	}
+
+	// 2. 找出根节点并剪掉空节点
+	var roots []*container
+	for _, c := range all {
+		if c.parent == nil {
+			roots = append(roots, c)
+		}
+	}
+	roots = prune(roots, true)
+
+	// 3. 按主题合并缺少引用头的回复
+	groups := newUnionFind(len(roots))
+	bySubject := make(map[string]int)
+	for i, root := range roots {
+		subject, reply := rootSubject(root)
+		if subject == "" {
+			continue
+		}
+		prev, ok := bySubject[subject]
+		if !ok {
+			bySubject[subject] = i
+			continue
+		}
+		if reply || root.msg == nil {
+			groups.union(prev, i)
+			continue
+		}
+		// 先出现的是回复、后出现的是原始邮件（时间乱序），同样归为一组
+		if _, prevReply := rootSubject(roots[prev]); prevReply {
+			groups.union(prev, i)
+			bySubject[subject] = i
+		}
+	}
+
+	// 4. 每组以最早的一封邮件的 ID 作为 thread ID
+	members := make(map[int][]*Message)
+	for i, root := range roots {
+		g := groups.find(i)
+		members[g] = collect(root, members[g])
+	}
+
+	result := make(map[string]string, len(msgs))
+	for _, ms := range members {
+		if len(ms) == 0 {
+			continue
+		}
+		earliest := ms[0]
+		for _, m := range ms[1:] {
+			if m.Date.Before(earliest.Date) || m.Date.Equal(earliest.Date) && m.EmailID < earliest.EmailID {
+				earliest = m
+			}
+		}
+		for _, m := range ms {
+			result[m.EmailID] = earliest.EmailID
+		}
+	}
+	return result
+}
+
+// prune removes empty containers without children and splices the
+// children of other empty containers into their parent. Empty roots with
+// several children are kept so their children stay one thread.
+func prune(list []*container, atRoot bool) []*container {
+	var out []*container
+	for _, c := range list {
+		c.children = prune(c.children, false)
+		switch {
+		case c.msg == nil && len(c.children) == 0:
+			continue
+		case c.msg == nil && (!atRoot || len(c.children) == 1):
+			for _, child := range c.children {
+				child.parent = c.parent
+			}
+			out = append(out, c.children...)
+			c.children = nil
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func collect(c *container, out []*Message) []*Message {
+	if c.msg != nil {
+		out = append(out, c.msg)
+	}
+	for _, child := range c.children {
+		out = collect(child, out)
+	}
+	return out
+}
+
+// rootSubject returns the normalized subject of a root (taken from its
+// first child when the root is empty) and whether it was a reply
+func rootSubject(c *container) (string, bool) {
+	m := c.msg
+	if m == nil && len(c.children) > 0 {
+		m = c.children[0].msg
+	}
+	if m == nil {
+		return "", false
+	}
+	base := BaseSubject(m.Subject)
+	return strings.ToLower(base), base != strings.TrimSpace(m.Subject)
+}
+
+// replyPrefix matches reply/forward markers, including localized and
+// counted forms such as "Re[2]:", "AW:", "回复：" and "转发:"
+var replyPrefix = regexp.MustCompile(`(?i)^\s*((re|fw|fwd|aw|sv|vs|antw|wg|tr|rv|回复|回覆|答复|转发|轉寄)(\[\d+\]|\(\d+\))?\s*[:：]\s*)+`)
+
+// BaseSubject strips reply and forward prefixes and surrounding space
+func BaseSubject(subject string) string {
+	return strings.TrimSpace(replyPrefix.ReplaceAllString(subject, ""))
+}
+
+type unionFind struct {
+	parent []int
+}
+
+func newUnionFind(n int) *unionFind {
+	u := &unionFind{parent: make([]int, n)}
+	for i := range u.parent {
+		u.parent[i] = i
+	}
+	return u
+}
+
+func (u *unionFind) find(i int) int {
+	for u.parent[i] != i {
+		u.parent[i] = u.parent[u.parent[i]]
+		i = u.parent[i]
+	}
+	return i
+}
+
+func (u *unionFind) union(a, b int) {
+	u.parent[u.find(b)] = u.find(a)
+}
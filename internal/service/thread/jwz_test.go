@@ -0,0 +1,147 @@
+package thread_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/thread"
+)
+
+var base = time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+func at(hours int) time.Time {
+	return base.Add(time.Duration(hours) * time.Hour)
+}
+
+func TestGroup(t *testing.T) {
+	tests := []struct {
+		name string
+		msgs []thread.Message
+		want map[string]string
+	}{
+		{
+			name: "reply chain",
+			msgs: []thread.Message{
+				{EmailID: "a", MessageID: "a@x", Subject: "Budget", Date: at(0)},
+				{EmailID: "b", MessageID: "b@x", References: []string{"a@x"}, Subject: "Re: Budget", Date: at(1)},
+				{EmailID: "c", MessageID: "c@x", References: []string{"a@x", "b@x"}, Subject: "Re: Budget", Date: at(2)},
+				{EmailID: "d", MessageID: "d@x", Subject: "Lunch", Date: at(3)},
+			},
+			want: map[string]string{"a": "a", "b": "a", "c": "a", "d": "d"},
+		},
+		{
+			// 回复的时间比原始邮件还早（时钟不准），依然归到一起，以最早的邮件为 thread ID
+			name: "reply dated before its parent",
+			msgs: []thread.Message{
+				{EmailID: "b", MessageID: "b@x", References: []string{"a@x"}, Subject: "Re: Plan", Date: at(0)},
+				{EmailID: "a", MessageID: "a@x", Subject: "Plan", Date: at(1)},
+			},
+			want: map[string]string{"a": "b", "b": "b"},
+		},
+		{
+			// 中间那封不在库里，只靠 References 里的祖先也能串起来
+			name: "missing parent",
+			msgs: []thread.Message{
+				{EmailID: "a", MessageID: "a@x", Subject: "Offsite", Date: at(0)},
+				{EmailID: "c", MessageID: "c@x", References: []string{"a@x", "b@x"}, Subject: "Re: Offsite", Date: at(2)},
+			},
+			want: map[string]string{"a": "a", "c": "a"},
+		},
+		{
+			// 两封回复引用同一封没收到的邮件
+			name: "siblings of an unknown parent",
+			msgs: []thread.Message{
+				{EmailID: "b", MessageID: "b@x", References: []string{"a@x"}, Subject: "Re: Party", Date: at(1)},
+				{EmailID: "c", MessageID: "c@x", References: []string{"a@x"}, Subject: "Re: Party", Date: at(2)},
+			},
+			want: map[string]string{"b": "b", "c": "b"},
+		},
+		{
+			name: "subject-only replies",
+			msgs: []thread.Message{
+				{EmailID: "a", MessageID: "a@x", Subject: "Q3 forecast", Date: at(0)},
+				{EmailID: "b", MessageID: "b@x", Subject: "Re: Q3 forecast", Date: at(1)},
+				{EmailID: "c", MessageID: "c@x", Subject: "AW: RE: q3 Forecast ", Date: at(2)},
+				{EmailID: "d", MessageID: "d@x", Subject: "回复：Q3 forecast", Date: at(3)},
+			},
+			want: map[string]string{"a": "a", "b": "a", "c": "a", "d": "a"},
+		},
+		{
+			name: "subject-only reply before the original",
+			msgs: []thread.Message{
+				{EmailID: "b", MessageID: "b@x", Subject: "Re: Invoice", Date: at(0)},
+				{EmailID: "a", MessageID: "a@x", Subject: "Invoice", Date: at(1)},
+			},
+			want: map[string]string{"a": "b", "b": "b"},
+		},
+		{
+			// 同一主题的两封原始邮件不是回复，不合并
+			name: "same subject without a reply marker",
+			msgs: []thread.Message{
+				{EmailID: "a", MessageID: "a@x", Subject: "Weekly report", Date: at(0)},
+				{EmailID: "b", MessageID: "b@x", Subject: "Weekly report", Date: at(168)},
+			},
+			want: map[string]string{"a": "a", "b": "b"},
+		},
+		{
+			name: "missing Message-IDs",
+			msgs: []thread.Message{
+				{EmailID: "a", Subject: "Hello", Date: at(0)},
+				{EmailID: "b", Subject: "Other", Date: at(1)},
+				{EmailID: "c", MessageID: "c@x", Subject: "Meeting", Date: at(2)},
+				// 没有 Message-ID 的回复照样跟着 References 走
+				{EmailID: "d", References: []string{"c@x"}, Subject: "Re: Meeting", Date: at(3)},
+				// 没有 Message-ID 也没有引用头，只能按主题归组
+				{EmailID: "e", Subject: "Re: Hello", Date: at(4)},
+			},
+			want: map[string]string{"a": "a", "b": "b", "c": "c", "d": "c", "e": "a"},
+		},
+		{
+			// Message-ID 重复的第二封不能顶替第一封的位置
+			name: "duplicate Message-ID",
+			msgs: []thread.Message{
+				{EmailID: "a", MessageID: "dup@x", Subject: "First", Date: at(0)},
+				{EmailID: "b", MessageID: "dup@x", Subject: "Second", Date: at(1)},
+				{EmailID: "c", MessageID: "c@x", References: []string{"dup@x"}, Subject: "Re: First", Date: at(2)},
+			},
+			want: map[string]string{"a": "a", "b": "b", "c": "a"},
+		},
+		{
+			name: "reference loop",
+			msgs: []thread.Message{
+				{EmailID: "a", MessageID: "a@x", References: []string{"b@x"}, Subject: "Loop", Date: at(0)},
+				{EmailID: "b", MessageID: "b@x", References: []string{"a@x"}, Subject: "Re: Loop", Date: at(1)},
+			},
+			want: map[string]string{"a": "a", "b": "a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := thread.Group(tt.msgs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Group() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBaseSubject(t *testing.T) {
+	tests := map[string]string{
+		"Budget":               "Budget",
+		"  Re: Budget ":        "Budget",
+		"RE: Fwd: re: Budget":  "Budget",
+		"Re[2]: Budget":        "Budget",
+		"Re(3): Budget":        "Budget",
+		"AW: WG: Budget":       "Budget",
+		"SV: VS: Antw: Budget": "Budget",
+		"回复：预算":                "预算",
+		"转发: 回覆: 预算":           "预算",
+		"Report: Q3":           "Report: Q3",
+		"Re:":                  "",
+	}
+	for subject, want := range tests {
+		if got := thread.BaseSubject(subject); got != want {
+			t.Errorf("BaseSubject(%q) = %q, want %q", subject, got, want)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+// Package thread maintains conversation aggregates and rebuilds threads for
+// sources that do not provide thread IDs.
+package thread
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	threadrepo "github.com/M1ngdaXie/go-local-rag-email/internal/repository/thread"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/mailparse"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+)
+
+// gmailSource is the only source whose thread IDs come from the server
+const gmailSource = "gmail"
+
+// Service keeps the threads table in sync with the emails table
+type Service struct {
+	emailRepo  email.Repository
+	threadRepo threadrepo.Repository
+	index      MetadataIndex
+	logger     logger.Logger
+}
+
+// MetadataIndex updates the thread ID stored with the vectors of an email;
+// rag.Service satisfies it
+type MetadataIndex interface {
+	RefreshMetadata(ctx context.Context, email *domain.Email) error
+}
+
+// New creates a thread service
+func New(emailRepo email.Repository, threadRepo threadrepo.Repository, log logger.Logger) *Service {
+	return &Service{
+		emailRepo:  emailRepo,
+		threadRepo: threadRepo,
+		logger:     log,
+	}
+}
+
+// WithIndex keeps the thread IDs in the vector payload up to date when
+// emails are rethreaded, so thread filters find them
+func (s *Service) WithIndex(index MetadataIndex) *Service {
+	s.index = index
+	return s
+}
+
+// Assign gives a new email a provisional thread before it is stored: a
+// reply joins the thread of the message it references. Out-of-order
+// arrivals and subject-only replies are fixed up by Update.
+func (s *Service) Assign(ctx context.Context, e *domain.Email) error {
+	if !rethreadable(e) {
+		return nil
+	}
+
+	refs := references(e)
+	for i := len(refs) - 1; i >= 0; i-- {
+		parents, err := s.emailRepo.List(ctx, email.Filter{MessageID: refs[i]}, email.Pagination{Limit: 1})
+		if err != nil {
+			return err
+		}
+		if len(parents) > 0 && parents[0].ThreadID != "" {
+			e.ThreadID = parents[0].ThreadID
+			return nil
+		}
+	}
+	return nil
+}
+
+// Update brings the threads of newly stored emails up to date. Emails that
+// need header-based threading are rethreaded together with every email
+// their Message-ID, References and subject can reach (see reachable), and
+// the thread IDs of emails are updated in place.
+func (s *Service) Update(ctx context.Context, emails []*domain.Email) error {
+	affected := make(map[string]bool)
+	var seeds []*domain.Email
+	for _, e := range emails {
+		affected[e.ThreadID] = true
+		if rethreadable(e) {
+			seeds = append(seeds, e)
+		}
+	}
+
+	if len(seeds) > 0 {
+		headers, err := s.reachable(ctx, seeds)
+		if err != nil {
+			return err
+		}
+		moved, err := s.rethread(ctx, headers)
+		if err != nil {
+			return err
+		}
+		for _, m := range moved {
+			affected[m.from] = true
+			affected[m.to] = true
+		}
+		for _, e := range emails {
+			if m, ok := moved[e.ID]; ok {
+				e.ThreadID = m.to
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(affected))
+	for id := range affected {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return s.Refresh(ctx, ids...)
+}
+
+// Rebuild rethreads every non-Gmail email and recomputes every thread.
+// It returns the number of emails that moved to a different thread.
+func (s *Service) Rebuild(ctx context.Context) (int, error) {
+	all, err := s.emailRepo.ListHeaders(ctx, email.Filter{ExcludeSource: gmailSource})
+	if err != nil {
+		return 0, err
+	}
+	moved, err := s.rethread(ctx, all)
+	if err != nil {
+		return 0, err
+	}
+
+	headers, err := s.emailRepo.ListHeaders(ctx, email.Filter{})
+	if err != nil {
+		return 0, err
+	}
+	seen := make(map[string]bool)
+	var ids []string
+	for _, e := range headers {
+		if !seen[e.ThreadID] {
+			seen[e.ThreadID] = true
+			ids = append(ids, e.ThreadID)
+		}
+	}
+	for _, m := range moved {
+		if !seen[m.from] {
+			seen[m.from] = true
+			ids = append(ids, m.from)
+		}
+	}
+	return len(moved), s.Refresh(ctx, ids...)
+}
+
+// Refresh recomputes the aggregates of the given threads and deletes
+// threads that no longer have any emails
+func (s *Service) Refresh(ctx context.Context, ids ...string) error {
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		emails, err := s.emailRepo.ListHeaders(ctx, email.Filter{ThreadID: id})
+		if err != nil {
+			return err
+		}
+		if len(emails) == 0 {
+			if err := s.threadRepo.Delete(ctx, id); err != nil {
+				return err
+			}
+			continue
+		}
+
+		thread, err := s.threadRepo.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if thread == nil {
+			thread = &domain.Thread{ID: id}
+		}
+		if err := aggregate(thread, emails); err != nil {
+			return err
+		}
+		if err := s.threadRepo.Save(ctx, thread); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Conversation returns a thread and its emails, oldest first
+func (s *Service) Conversation(ctx context.Context, id string) (*domain.Thread, []*domain.Email, error) {
+	thread, err := s.threadRepo.Get(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	emails, err := s.emailRepo.List(ctx, email.Filter{ThreadID: id}, email.Pagination{})
+	if err != nil {
+		return nil, nil, err
+	}
+	if thread == nil && len(emails) == 0 {
+		return nil, nil, fmt.Errorf("thread not found: %s", id)
+	}
+	sort.SliceStable(emails, func(i, j int) bool {
+		return emails[i].Date.Before(emails[j].Date)
+	})
+	return thread, emails, nil
+}
+
+type move struct {
+	from, to string
+}
+
+// reachable loads the headers of every email JWZ could group with seeds:
+// emails with a Message-ID they reference or that references them, emails
+// with the same base subject, and the rest of their current threads. It
+// repeats from the emails it finds until nothing new turns up, so the
+// result holds whole threads and running Group over it gives the same
+// threads as running it over every email.
+func (s *Service) reachable(ctx context.Context, seeds []*domain.Email) ([]*domain.Email, error) {
+	type lookup struct {
+		filter email.Filter
+		// subject 非空时只保留基础主题完全相同的邮件，LIKE 只是子串匹配
+		subject string
+	}
+	var (
+		found   = make(map[string]*domain.Email)
+		queued  = make(map[string]bool)
+		pending []lookup
+	)
+	enqueue := func(key string, l lookup) {
+		if !queued[key] {
+			queued[key] = true
+			l.filter.ExcludeSource = gmailSource
+			pending = append(pending, l)
+		}
+	}
+	visit := func(e *domain.Email) {
+		if _, ok := found[e.ID]; ok || !rethreadable(e) {
+			return
+		}
+		found[e.ID] = e
+		for _, id := range append(references(e), e.MessageID) {
+			if id != "" {
+				enqueue("id:"+id, lookup{filter: email.Filter{MessageID: id}})
+				enqueue("ref:"+id, lookup{filter: email.Filter{References: id}})
+			}
+		}
+		if base := strings.ToLower(BaseSubject(e.Subject)); base != "" {
+			enqueue("subject:"+base, lookup{filter: email.Filter{Subject: []string{base}}, subject: base})
+		}
+		if e.ThreadID != "" {
+			enqueue("thread:"+e.ThreadID, lookup{filter: email.Filter{ThreadID: e.ThreadID}})
+		}
+	}
+
+	for _, e := range seeds {
+		visit(e)
+	}
+	for len(pending) > 0 {
+		l := pending[0]
+		pending = pending[1:]
+		headers, err := s.emailRepo.ListHeaders(ctx, l.filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range headers {
+			if l.subject == "" || strings.ToLower(BaseSubject(e.Subject)) == l.subject {
+				visit(e)
+			}
+		}
+	}
+
+	headers := make([]*domain.Email, 0, len(found))
+	for _, e := range found {
+		headers = append(headers, e)
+	}
+	return headers, nil
+}
+
+// rethread runs JWZ over the given emails that get their thread from
+// headers and persists the emails whose thread changed
+func (s *Service) rethread(ctx context.Context, headers []*domain.Email) (map[string]move, error) {
+	msgs := make([]Message, 0, len(headers))
+	current := make(map[string]string, len(headers))
+	for _, e := range headers {
+		if !rethreadable(e) {
+			continue
+		}
+		msgs = append(msgs, Message{
+			EmailID:    e.ID,
+			MessageID:  e.MessageID,
+			References: references(e),
+			Subject:    e.Subject,
+			Date:       e.Date,
+		})
+		current[e.ID] = e.ThreadID
+	}
+
+	moved := make(map[string]move)
+	updates := make(map[string]string)
+	for id, threadID := range Group(msgs) {
+		if current[id] != threadID {
+			moved[id] = move{from: current[id], to: threadID}
+			updates[id] = threadID
+		}
+	}
+	if err := s.emailRepo.UpdateThreadIDs(ctx, updates); err != nil {
+		return nil, err
+	}
+	if len(moved) > 0 {
+		s.logger.Info("Rethreaded emails", "considered", len(msgs), "moved", len(moved))
+	}
+	s.refreshIndex(ctx, moved)
+	return moved, nil
+}
+
+// refreshIndex updates the vectors of moved emails. Emails not indexed yet
+// have no vectors and get the new thread ID when they are.
+func (s *Service) refreshIndex(ctx context.Context, moved map[string]move) {
+	if s.index == nil {
+		return
+	}
+	for id := range moved {
+		e, err := s.emailRepo.Get(ctx, id)
+		if err == nil {
+			err = s.index.RefreshMetadata(ctx, e)
+		}
+		if err != nil {
+			s.logger.Warn("Failed to update vector thread ID", "id", id, "error", err)
+		}
+	}
+}
+
+// rethreadable reports whether an email's thread comes from its headers.
+// Gmail messages, and archive messages carrying Gmail's X-Gm-Thrid, keep
+// the thread Gmail assigned.
+func rethreadable(e *domain.Email) bool {
+	if e.Source == gmailSource {
+		return false
+	}
+	return e.ThreadID == "" || e.ThreadID == e.ID || strings.HasPrefix(e.ThreadID, "msg-")
+}
+
+// references returns the References chain with In-Reply-To appended when
+// it is not already the last entry
+func references(e *domain.Email) []string {
+	refs, _ := e.GetReferences()
+	if e.InReplyTo != "" && (len(refs) == 0 || refs[len(refs)-1] != e.InReplyTo) {
+		refs = append(refs, e.InReplyTo)
+	}
+	return refs
+}
+
+// aggregate fills the thread summary from its emails (sorted oldest first)
+func aggregate(t *domain.Thread, emails []*domain.Email) error {
+	first, last := emails[0], emails[0]
+	for _, e := range emails[1:] {
+		if e.Date.Before(first.Date) {
+			first = e
+		}
+		if e.Date.After(last.Date) {
+			last = e
+		}
+	}
+
+	t.Subject = BaseSubject(first.Subject)
+	t.MessageCount = len(emails)
+	t.FirstDate = first.Date
+	t.LastDate = last.Date
+
+	// 参与者按首次出现的顺序去重
+	seen := make(map[string]bool)
+	var participants []domain.Address
+	add := func(addrs []domain.Address) {
+		for _, a := range addrs {
+			key := strings.ToLower(a.Address)
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			participants = append(participants, a)
+		}
+	}
+	for _, e := range emails {
+		add(mailparse.ParseAddressList(e.From))
+		to, _ := e.GetToList()
+		add(to)
+		cc, _ := e.GetCcList()
+		add(cc)
+	}
+	return t.SetParticipants(participants)
+}
@@ -0,0 +1,88 @@
+package thread_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/M1ngdaXie/go-local-rag-email/internal/config"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/database"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/domain"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/repository/email"
+	threadrepo "github.com/M1ngdaXie/go-local-rag-email/internal/repository/thread"
+	"github.com/M1ngdaXie/go-local-rag-email/internal/service/thread"
+	"github.com/M1ngdaXie/go-local-rag-email/pkg/logger"
+)
+
+func TestUpdateOnlyRethreadsReachableEmails(t *testing.T) {
+	log := logger.NewSlog("error")
+	db, err := database.NewSQLite(config.SQLiteConfig{
+		Path:            filepath.Join(t.TempDir(), "emails.db"),
+		MaxOpenConns:    1,
+		MaxIdleConns:    1,
+		ConnMaxLifetime: time.Hour,
+	}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emailRepo := email.NewSQLiteRepository(db, log)
+	threads := threadrepo.NewSQLiteRepository(db, log)
+	svc := thread.New(emailRepo, threads, log)
+	ctx := context.Background()
+
+	stored := []*domain.Email{
+		{ID: "msg-a", MessageID: "a@x", Subject: "Budget", Date: at(0), ThreadID: "msg-a"},
+		// c 比它回复的 b 先到，暂时自成一个 thread
+		{ID: "msg-c", MessageID: "c@x", InReplyTo: "b@x", Subject: "Re: Budget", Date: at(2), ThreadID: "msg-c"},
+		// p 和 q 全量重建时会按主题合并，但跟新邮件无关，Update 不该碰它们
+		{ID: "msg-p", MessageID: "p@x", Subject: "Lunch", Date: at(0), ThreadID: "msg-p"},
+		{ID: "msg-q", MessageID: "q@x", Subject: "Re: Lunch", Date: at(1), ThreadID: "msg-q"},
+	}
+	if _, err := emailRepo.BulkUpsert(ctx, stored); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Refresh(ctx, "msg-a", "msg-c", "msg-p", "msg-q"); err != nil {
+		t.Fatal(err)
+	}
+
+	b := &domain.Email{ID: "msg-b", MessageID: "b@x", InReplyTo: "a@x", Subject: "Re: Budget", Date: at(1)}
+	if err := svc.Assign(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	if b.ThreadID != "msg-a" {
+		t.Fatalf("Assign gave b thread %q, want msg-a", b.ThreadID)
+	}
+	if _, err := emailRepo.BulkUpsert(ctx, []*domain.Email{b}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Update(ctx, []*domain.Email{b}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"msg-a": "msg-a", "msg-b": "msg-a", "msg-c": "msg-a", "msg-p": "msg-p", "msg-q": "msg-q"}
+	for id, threadID := range want {
+		e, err := emailRepo.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.ThreadID != threadID {
+			t.Errorf("email %s is in thread %q, want %q", id, e.ThreadID, threadID)
+		}
+	}
+	if th, err := threads.Get(ctx, "msg-a"); err != nil || th == nil || th.MessageCount != 3 {
+		t.Errorf("thread msg-a = %+v, %v; want 3 messages", th, err)
+	}
+	if th, err := threads.Get(ctx, "msg-c"); err != nil || th != nil {
+		t.Errorf("emptied thread msg-c = %+v, %v; want it deleted", th, err)
+	}
+
+	// 全量重建才会合并 p 和 q
+	moved, err := svc.Rebuild(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q, _ := emailRepo.Get(ctx, "msg-q"); moved != 1 || q.ThreadID != "msg-p" {
+		t.Errorf("Rebuild moved %d emails and left q in %q, want 1 and msg-p", moved, q.ThreadID)
+	}
+}
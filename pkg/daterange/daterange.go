@@ -0,0 +1,113 @@
+// Package daterange turns date expressions such as "last week", "since
+// March", "in Q3 2025", "two days ago", "上个月" or "2025年第三季度" into
+// time ranges. Parsing is deterministic: relative expressions are resolved
+// against the parser's clock, which tests fix with WithClock.
+//
+// Weeks start on Monday. A month, day or quarter given without a year is
+// the latest one that has started, so in February "March" is last March.
+package daterange
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Range is the half-open range [Start, End). A zero Start or End leaves
+// that side open, e.g. "since March" has no End.
+type Range struct {
+	Start time.Time
+	End   time.Time
+}
+
+// IsZero reports whether the range is unbounded on both sides
+func (r Range) IsZero() bool {
+	return r.Start.IsZero() && r.End.IsZero()
+}
+
+// Intersect returns the part of r that is also in o
+func (r Range) Intersect(o Range) Range {
+	if o.Start.After(r.Start) {
+		r.Start = o.Start
+	}
+	if !o.End.IsZero() && (r.End.IsZero() || o.End.Before(r.End)) {
+		r.End = o.End
+	}
+	return r
+}
+
+// Parser parses date expressions relative to its clock
+type Parser struct {
+	now func() time.Time
+}
+
+// New creates a parser that uses the current time
+func New() *Parser {
+	return &Parser{now: time.Now}
+}
+
+// WithClock makes the parser resolve relative expressions against now
+// instead of the current time; ranges are in now's location
+func (p *Parser) WithClock(now func() time.Time) *Parser {
+	p.now = now
+	return p
+}
+
+// Now returns the time the parser resolves relative expressions against
+func (p *Parser) Now() time.Time {
+	return p.now()
+}
+
+// Parse parses a whole date expression
+func (p *Parser) Parse(expr string) (Range, error) {
+	m := &matcher{toks: lex(expr), now: p.now()}
+	if len(m.toks) == 0 {
+		return Range{}, fmt.Errorf("empty date expression")
+	}
+	if res, ok := m.expr(0); ok && res.next == len(m.toks) {
+		return res.r, nil
+	}
+	return Range{}, fmt.Errorf("unrecognized date expression %q (try e.g. \"last week\", \"since March\", \"Q3 2025\", \"2 days ago\", \"上个月\")", expr)
+}
+
+// Extract finds the first date expression in free text, such as "last
+// week" in "budget emails from last week", and returns its range and the
+// text without it. Bare years and month names ("2024", "may") only count
+// after a preposition ("in 2024", "since May"), since in running text they
+// are more often something else.
+func (p *Parser) Extract(text string) (Range, string, bool) {
+	m := &matcher{toks: lex(text), now: p.now()}
+	for i := range m.toks {
+		res, ok := m.expr(i)
+		if !ok || res.weak {
+			continue
+		}
+		start, end := m.toks[i].start, m.toks[res.next-1].end
+		if !boundary(text, start, end) {
+			continue
+		}
+		rest := strings.TrimPrefix(strings.TrimLeftFunc(text[end:], unicode.IsSpace), "的")
+		return res.r, strings.Join(strings.Fields(text[:start]+" "+rest), " "), true
+	}
+	return Range{}, text, false
+}
+
+// boundary reports whether text[start:end] stands on its own rather than
+// being part of a longer token such as "INV-2025-03-17"
+func boundary(text string, start, end int) bool {
+	if start > 0 {
+		r, _ := utf8.DecodeLastRuneInString(text[:start])
+		if r < utf8.RuneSelf && !unicode.IsSpace(r) && !strings.ContainsRune(`"'(,;`, r) {
+			return false
+		}
+	}
+	if end < len(text) {
+		r, _ := utf8.DecodeRuneInString(text[end:])
+		if r < utf8.RuneSelf && !unicode.IsSpace(r) && !strings.ContainsRune(`"'),;.?!`, r) {
+			return false
+		}
+	}
+	return true
+}
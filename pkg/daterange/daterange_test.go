@@ -0,0 +1,191 @@
+package daterange
+
+import (
+	"testing"
+	"time"
+)
+
+// now is Wednesday 2025-10-15 14:30 UTC
+var now = time.Date(2025, 10, 15, 14, 30, 0, 0, time.UTC)
+
+func newParser() *Parser {
+	return New().WithClock(func() time.Time { return now })
+}
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func span(y int, m time.Month, d int) Range {
+	return Range{Start: date(y, m, d), End: date(y, m, d+1)}
+}
+
+func monthOf(y int, m time.Month) Range {
+	return Range{Start: date(y, m, 1), End: date(y, m+1, 1)}
+}
+
+func yearOf(y int) Range {
+	return Range{Start: date(y, 1, 1), End: date(y+1, 1, 1)}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr string
+		want Range
+	}{
+		// 相对日期
+		{"today", span(2025, 10, 15)},
+		{"Yesterday", span(2025, 10, 14)},
+		{"the day before yesterday", span(2025, 10, 13)},
+		{"this week", Range{Start: date(2025, 10, 13), End: date(2025, 10, 20)}},
+		{"last week", Range{Start: date(2025, 10, 6), End: date(2025, 10, 13)}},
+		{"last month", monthOf(2025, 9)},
+		{"this year", yearOf(2025)},
+		{"the previous year", yearOf(2024)},
+		{"the past week", Range{Start: now.AddDate(0, 0, -7)}},
+		{"last 7 days", Range{Start: now.AddDate(0, 0, -7)}},
+		{"past 24 hours", Range{Start: now.Add(-24 * time.Hour)}},
+		{"within the last 3 days", Range{Start: now.AddDate(0, 0, -3)}},
+		{"two days ago", span(2025, 10, 13)},
+		{"a couple of weeks ago", Range{Start: date(2025, 9, 29), End: date(2025, 10, 6)}},
+		{"3 months ago", monthOf(2025, 7)},
+		{"monday", span(2025, 10, 13)},
+		{"wednesday", span(2025, 10, 15)},
+		{"last wednesday", span(2025, 10, 8)},
+		{"on fri", span(2025, 10, 10)},
+
+		// 绝对日期
+		{"2025-03-05", span(2025, 3, 5)},
+		{"2025/3", monthOf(2025, 3)},
+		{"March 5", span(2025, 3, 5)},
+		{"March 5th, 2024", span(2024, 3, 5)},
+		{"5 March 2024", span(2024, 3, 5)},
+		{"the 5th of May", span(2025, 5, 5)},
+		{"december", monthOf(2024, 12)},
+		{"May 2024", monthOf(2024, 5)},
+		{"2024", yearOf(2024)},
+		{"Q3", Range{Start: date(2025, 7, 1), End: date(2025, 10, 1)}},
+		{"Q4", Range{Start: date(2025, 10, 1), End: date(2026, 1, 1)}},
+		{"Q1 2024", Range{Start: date(2024, 1, 1), End: date(2024, 4, 1)}},
+		{"2024 Q1", Range{Start: date(2024, 1, 1), End: date(2024, 4, 1)}},
+		{"third quarter of 2024", Range{Start: date(2024, 7, 1), End: date(2024, 10, 1)}},
+
+		// 介词和区间
+		{"since March", Range{Start: date(2025, 3, 1)}},
+		{"after last week", Range{Start: date(2025, 10, 13)}},
+		{"before 2025-03-05", Range{End: date(2025, 3, 5)}},
+		{"until yesterday", Range{End: date(2025, 10, 15)}},
+		{"in Q3 2024", Range{Start: date(2024, 7, 1), End: date(2024, 10, 1)}},
+		{"from last week", Range{Start: date(2025, 10, 6), End: date(2025, 10, 13)}},
+		{"between March and May", Range{Start: date(2025, 3, 1), End: date(2025, 6, 1)}},
+		{"from 2025-01-01 to 2025-01-31", Range{Start: date(2025, 1, 1), End: date(2025, 2, 1)}},
+
+		// 中文
+		{"今天", span(2025, 10, 15)},
+		{"昨天", span(2025, 10, 14)},
+		{"前天", span(2025, 10, 13)},
+		{"大前天", span(2025, 10, 12)},
+		{"本周", Range{Start: date(2025, 10, 13), End: date(2025, 10, 20)}},
+		{"上周", Range{Start: date(2025, 10, 6), End: date(2025, 10, 13)}},
+		{"上个月", monthOf(2025, 9)},
+		{"今年", yearOf(2025)},
+		{"去年", yearOf(2024)},
+		{"前年", yearOf(2023)},
+		{"最近三天", Range{Start: now.AddDate(0, 0, -3)}},
+		{"过去两周", Range{Start: now.AddDate(0, 0, -14)}},
+		{"三天前", span(2025, 10, 12)},
+		{"两个月之前", monthOf(2025, 8)},
+		{"周五", span(2025, 10, 10)},
+		{"上周三", span(2025, 10, 8)},
+		{"本周日", span(2025, 10, 19)},
+		{"星期天", span(2025, 10, 12)},
+		{"3月", monthOf(2025, 3)},
+		{"十二月", monthOf(2024, 12)},
+		{"3月5日", span(2025, 3, 5)},
+		{"十月二十号", span(2024, 10, 20)},
+		{"2024年3月", monthOf(2024, 3)},
+		{"去年十月", monthOf(2024, 10)},
+		{"2024年", yearOf(2024)},
+		{"2024年第三季度", Range{Start: date(2024, 7, 1), End: date(2024, 10, 1)}},
+		{"第一季度", Range{Start: date(2025, 1, 1), End: date(2025, 4, 1)}},
+		{"上季度", Range{Start: date(2025, 7, 1), End: date(2025, 10, 1)}},
+		{"3月以来", Range{Start: date(2025, 3, 1)}},
+		{"自从上个月", Range{Start: date(2025, 9, 1)}},
+		{"上周之前", Range{End: date(2025, 10, 6)}},
+		{"上周之后", Range{Start: date(2025, 10, 13)}},
+		{"从3月到5月", Range{Start: date(2025, 3, 1), End: date(2025, 6, 1)}},
+		{"3月至5月", Range{Start: date(2025, 3, 1), End: date(2025, 6, 1)}},
+		{"在去年", yearOf(2024)},
+	}
+	p := newParser()
+	for _, tt := range tests {
+		got, err := p.Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.expr, err)
+			continue
+		}
+		if !got.Start.Equal(tt.want.Start) || !got.End.Equal(tt.want.End) {
+			t.Errorf("Parse(%q) = [%v, %v), want [%v, %v)", tt.expr, got.Start, got.End, tt.want.Start, tt.want.End)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	p := newParser()
+	for _, expr := range []string{"", "next fortnight", "2025-02-30", "Q5", "last week budget", "三五天前"} {
+		if got, err := p.Parse(expr); err == nil {
+			t.Errorf("Parse(%q) = %v, want an error", expr, got)
+		}
+	}
+}
+
+func TestParseLocation(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	p := New().WithClock(func() time.Time { return now.In(loc) })
+	got, err := p.Parse("today")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 14:30 UTC 在 UTC+8 已经是 22:30，还是同一天
+	if want := time.Date(2025, 10, 15, 0, 0, 0, 0, loc); !got.Start.Equal(want) {
+		t.Errorf("today starts at %v, want %v", got.Start, want)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		text string
+		want Range
+		rest string
+		ok   bool
+	}{
+		{"budget emails from last week", Range{Start: date(2025, 10, 6), End: date(2025, 10, 13)}, "budget emails", true},
+		{"invoices in 2024", yearOf(2024), "invoices", true},
+		{"meeting notes since March 3 please", Range{Start: date(2025, 3, 3)}, "meeting notes please", true},
+		{"上个月的报销单", monthOf(2025, 9), "报销单", true},
+
+		// 单独的年份、月份名和缩写不算日期
+		{"report 2024", Range{}, "report 2024", false},
+		{"may I ask", Range{}, "may I ask", false},
+		{"sun protection", Range{}, "sun protection", false},
+		{"INV-2025-03-17 receipt", Range{}, "INV-2025-03-17 receipt", false},
+	}
+	p := newParser()
+	for _, tt := range tests {
+		got, rest, ok := p.Extract(tt.text)
+		if ok != tt.ok || rest != tt.rest || !got.Start.Equal(tt.want.Start) || !got.End.Equal(tt.want.End) {
+			t.Errorf("Extract(%q) = [%v, %v), %q, %v; want [%v, %v), %q, %v",
+				tt.text, got.Start, got.End, rest, ok, tt.want.Start, tt.want.End, tt.rest, tt.ok)
+		}
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	r := Range{Start: date(2025, 3, 1)}.Intersect(Range{End: date(2025, 6, 1)})
+	if !r.Start.Equal(date(2025, 3, 1)) || !r.End.Equal(date(2025, 6, 1)) {
+		t.Errorf("Intersect = [%v, %v)", r.Start, r.End)
+	}
+	if !(Range{}).IsZero() || r.IsZero() {
+		t.Error("IsZero wrong")
+	}
+}
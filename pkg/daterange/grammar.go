@@ -0,0 +1,710 @@
+package daterange
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type unit int
+
+const (
+	hour unit = iota
+	day
+	week
+	month
+	quarter
+	year
+)
+
+// start truncates t to the start of the unit containing it
+func (u unit) start(t time.Time) time.Time {
+	y, mo, d := t.Date()
+	switch u {
+	case hour:
+		return t.Truncate(time.Hour)
+	case day:
+		return time.Date(y, mo, d, 0, 0, 0, 0, t.Location())
+	case week:
+		// 周一是一周的开始
+		return time.Date(y, mo, d-(int(t.Weekday())+6)%7, 0, 0, 0, 0, t.Location())
+	case month:
+		return time.Date(y, mo, 1, 0, 0, 0, 0, t.Location())
+	case quarter:
+		return time.Date(y, mo-(mo-1)%3, 1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(y, 1, 1, 0, 0, 0, 0, t.Location())
+}
+
+// add moves t by n units
+func (u unit) add(t time.Time, n int) time.Time {
+	switch u {
+	case hour:
+		return t.Add(time.Duration(n) * time.Hour)
+	case day:
+		return t.AddDate(0, 0, n)
+	case week:
+		return t.AddDate(0, 0, 7*n)
+	case month:
+		return t.AddDate(0, n, 0)
+	case quarter:
+		return t.AddDate(0, 3*n, 0)
+	}
+	return t.AddDate(n, 0, 0)
+}
+
+// span is the whole unit containing t
+func (u unit) span(t time.Time) Range {
+	start := u.start(t)
+	return Range{Start: start, End: u.add(start, 1)}
+}
+
+// units maps unit words, English and Chinese, to units
+var units = map[string]unit{
+	"hour": hour, "hours": hour, "hr": hour, "hrs": hour,
+	"day": day, "days": day,
+	"week": week, "weeks": week, "wk": week, "wks": week,
+	"month": month, "months": month, "mo": month,
+	"quarter": quarter, "quarters": quarter,
+	"year": year, "years": year, "yr": year, "yrs": year,
+	"小时": hour, "个小时": hour, "钟头": hour, "个钟头": hour,
+	"天": day, "日": day,
+	"周": week, "星期": week, "个星期": week, "礼拜": week, "个礼拜": week,
+	"月": month, "个月": month,
+	"季度": quarter, "个季度": quarter,
+	"年": year,
+}
+
+// relativeUnits are the Chinese words for this/last week, month ... as
+// (unit, offset from the current one)
+var relativeUnits = map[string]struct {
+	unit   unit
+	offset int
+}{
+	"本周": {week, 0}, "这周": {week, 0}, "这个星期": {week, 0}, "这星期": {week, 0}, "本星期": {week, 0},
+	"这礼拜": {week, 0}, "这个礼拜": {week, 0}, "本礼拜": {week, 0},
+	"上周": {week, -1}, "上个星期": {week, -1}, "上星期": {week, -1}, "上礼拜": {week, -1}, "上个礼拜": {week, -1},
+	"上上周": {week, -2},
+	"本月":  {month, 0}, "这个月": {month, 0}, "这月": {month, 0},
+	"上个月": {month, -1}, "上月": {month, -1}, "上上个月": {month, -2},
+	"本季度": {quarter, 0}, "这个季度": {quarter, 0}, "这季度": {quarter, 0},
+	"上季度": {quarter, -1}, "上个季度": {quarter, -1},
+	"今年": {year, 0}, "本年": {year, 0}, "去年": {year, -1}, "前年": {year, -2},
+}
+
+// relativeDays are today, yesterday ... as offsets in days
+var relativeDays = map[string]int{
+	"today": 0, "yesterday": -1, "tomorrow": 1,
+	"day before yesterday": -2, "the day before yesterday": -2,
+	"今天": 0, "今日": 0, "昨天": -1, "昨日": -1, "前天": -2, "大前天": -3, "明天": 1,
+}
+
+var months = map[string]time.Month{
+	"january": time.January, "jan": time.January,
+	"february": time.February, "feb": time.February,
+	"march": time.March, "mar": time.March,
+	"april": time.April, "apr": time.April,
+	"may":  time.May,
+	"june": time.June, "jun": time.June,
+	"july": time.July, "jul": time.July,
+	"august": time.August, "aug": time.August,
+	"september": time.September, "sep": time.September, "sept": time.September,
+	"october": time.October, "oct": time.October,
+	"november": time.November, "nov": time.November,
+	"december": time.December, "dec": time.December,
+}
+
+// weekdays maps English weekday names; the abbreviations are also common
+// words ("sun", "wed"), so they only count as dates after a preposition
+var weekdays = map[string]time.Weekday{
+	"monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday, "sunday": time.Sunday,
+	"mon": time.Monday, "tue": time.Tuesday, "tues": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "fri": time.Friday,
+	"sat": time.Saturday, "sun": time.Sunday,
+}
+
+// cjkWeekdays are the days after 周/星期/礼拜
+var cjkWeekdays = map[string]time.Weekday{
+	"一": time.Monday, "二": time.Tuesday, "三": time.Wednesday, "四": time.Thursday,
+	"五": time.Friday, "六": time.Saturday, "日": time.Sunday, "天": time.Sunday,
+}
+
+var numberWords = map[string]int{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+	"seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12,
+	"fifteen": 15, "twenty": 20, "thirty": 30, "couple": 2, "a couple of": 2, "few": 3, "a few": 3,
+}
+
+var ordinals = map[string]int{
+	"first": 1, "second": 2, "third": 3, "fourth": 4,
+}
+
+var cjkDigits = map[string]int{
+	"零": 0, "一": 1, "二": 2, "两": 2, "三": 3, "四": 4, "五": 5, "六": 6, "七": 7, "八": 8, "九": 9,
+}
+
+// matcher matches the grammar against a token stream
+type matcher struct {
+	toks []token
+	now  time.Time
+}
+
+// match is a recognized expression ending before toks[next]
+type match struct {
+	r    Range
+	next int
+
+	// weak marks a bare year, month or abbreviated weekday, which Extract
+	// only takes after a preposition
+	weak bool
+}
+
+// longest collects candidate matches and keeps the one that consumed the
+// most tokens; on a tie the earlier one wins
+type longest struct {
+	m  match
+	ok bool
+}
+
+func (l *longest) keep(m match, ok bool) {
+	if ok && (!l.ok || m.next > l.m.next) {
+		l.m, l.ok = m, true
+	}
+}
+
+// expr matches a date expression with its prepositions and range forms
+func (m *matcher) expr(i int) (match, bool) {
+	var best longest
+
+	b, ok := m.base(i)
+	best.keep(b, ok)
+	if ok {
+		best.keep(m.suffixed(b))
+	}
+
+	// "since March", "before last week", "in Q3", "between X and Y"
+	for _, p := range []string{
+		"since", "from", "after", "before", "until", "till", "through", "up to",
+		"in", "on", "during", "within", "between",
+		"自", "从", "自从", "在", "于",
+	} {
+		j, ok := m.phrase(i, p)
+		if !ok {
+			continue
+		}
+		b, ok := m.base(j)
+		if !ok {
+			continue
+		}
+		switch p {
+		case "since", "自", "从", "自从":
+			since := match{r: Range{Start: b.r.Start}, next: b.next}
+			best.keep(since, true)
+			best.keep(m.suffixed(b))
+		case "after":
+			best.keep(match{r: after(b.r), next: b.next}, true)
+		case "before":
+			best.keep(match{r: Range{End: b.r.Start}, next: b.next}, true)
+		case "until", "till", "through", "up to":
+			best.keep(match{r: until(b.r), next: b.next}, true)
+		default:
+			// "from last week" 单独出现时就是指上周，和 to 连用才是区间的起点
+			b.weak = false
+			best.keep(b, true)
+			best.keep(m.suffixed(b))
+		}
+
+		// "from X to Y", "between X and Y", "从X到Y"
+		for _, sep := range []string{"to", "and", "until", "till", "through", "-", "~", "到", "至"} {
+			k, ok := m.phrase(b.next, sep)
+			if !ok {
+				continue
+			}
+			if e, ok := m.base(k); ok {
+				best.keep(match{r: Range{Start: b.r.Start, End: until(e.r).End}, next: e.next}, true)
+			}
+		}
+	}
+	return best.m, best.ok
+}
+
+// suffixed matches the Chinese postpositions after b: "3月以来",
+// "上周之前", "3月到5月"
+func (m *matcher) suffixed(b match) (match, bool) {
+	var best longest
+	for _, s := range []string{"以来", "起", "开始", "之后", "以后", "后", "之前", "以前", "前", "到", "至", "-", "~"} {
+		j, ok := m.phrase(b.next, s)
+		if !ok {
+			continue
+		}
+		switch s {
+		case "以来", "起", "开始":
+			best.keep(match{r: Range{Start: b.r.Start}, next: j}, true)
+		case "之后", "以后", "后":
+			best.keep(match{r: after(b.r), next: j}, true)
+		case "之前", "以前", "前":
+			best.keep(match{r: Range{End: b.r.Start}, next: j}, true)
+		default:
+			if e, ok := m.base(j); ok {
+				best.keep(match{r: Range{Start: b.r.Start, End: until(e.r).End}, next: e.next}, true)
+			}
+		}
+	}
+	return best.m, best.ok
+}
+
+// after is the open range following r
+func after(r Range) Range {
+	if r.End.IsZero() {
+		return Range{Start: r.Start}
+	}
+	return Range{Start: r.End}
+}
+
+// until is the open range ending with r
+func until(r Range) Range {
+	if r.End.IsZero() {
+		return Range{}
+	}
+	return Range{End: r.End}
+}
+
+// base matches a single date, period or relative expression
+func (m *matcher) base(i int) (match, bool) {
+	var best longest
+	for _, f := range []func(int) (match, bool){
+		m.relativeDay, m.relativeUnit, m.lastN, m.ago, m.weekday,
+		m.isoDate, m.monthDay, m.cjkDate, m.quarter, m.bareYear,
+	} {
+		best.keep(f(i))
+	}
+	return best.m, best.ok
+}
+
+// relativeDay: today, yesterday, 前天
+func (m *matcher) relativeDay(i int) (match, bool) {
+	j, w, ok := m.oneOf(i, keys(relativeDays)...)
+	if !ok {
+		return match{}, false
+	}
+	return match{r: day.span(m.now.AddDate(0, 0, relativeDays[w])), next: j}, true
+}
+
+// relativeUnit: this week, last month, the past year, 上个月, 去年
+func (m *matcher) relativeUnit(i int) (match, bool) {
+	if j, w, ok := m.oneOf(i, keys(relativeUnits)...); ok {
+		ru := relativeUnits[w]
+		return match{r: ru.unit.span(ru.unit.add(m.now, ru.offset)), next: j}, true
+	}
+
+	j := i
+	if k, ok := m.phrase(j, "the"); ok {
+		j = k
+	}
+	j, w, ok := m.oneOf(j, "this", "current", "last", "previous", "past")
+	if !ok {
+		return match{}, false
+	}
+	k, u, ok := m.unit(j)
+	if !ok || u == hour {
+		return match{}, false
+	}
+	switch w {
+	case "this", "current":
+		return match{r: u.span(m.now), next: k}, true
+	case "past":
+		// "the past week" 是滚动的 7 天，"last week" 是上一个自然周
+		return match{r: Range{Start: u.add(m.now, -1)}, next: k}, true
+	}
+	return match{r: u.span(u.add(m.now, -1)), next: k}, true
+}
+
+// lastN: last 7 days, the past 2 weeks, 最近三天, 过去两周
+func (m *matcher) lastN(i int) (match, bool) {
+	j := i
+	if k, ok := m.phrase(j, "the"); ok {
+		j = k
+	}
+	j, _, ok := m.oneOf(j, "last", "past", "最近", "过去", "近")
+	if !ok {
+		return match{}, false
+	}
+	n, j, ok := m.number(j)
+	if !ok {
+		return match{}, false
+	}
+	j, u, ok := m.unit(j)
+	if !ok {
+		return match{}, false
+	}
+	return match{r: Range{Start: u.add(m.now, -n)}, next: j}, true
+}
+
+// ago: two days ago, 3 weeks back, 三天前, 两个月之前
+func (m *matcher) ago(i int) (match, bool) {
+	n, j, ok := m.number(i)
+	if !ok {
+		return match{}, false
+	}
+	j, u, ok := m.unit(j)
+	if !ok {
+		return match{}, false
+	}
+	j, _, ok = m.oneOf(j, "ago", "back", "前", "以前", "之前")
+	if !ok {
+		return match{}, false
+	}
+	return match{r: u.span(u.add(m.now, -n)), next: j}, true
+}
+
+// weekday: monday, last friday, 周五, 上星期三
+func (m *matcher) weekday(i int) (match, bool) {
+	j, w, ok := m.oneOf(i, "last", "this", "上", "上个", "本", "这", "这个")
+	if !ok {
+		j, w = i, ""
+	}
+
+	var wd time.Weekday
+	weak := false
+	if k, name, ok := m.oneOf(j, keys(weekdays)...); ok {
+		wd, j = weekdays[name], k
+		weak = len(name) <= 4 && w == ""
+	} else if k, _, ok := m.oneOf(j, "周", "星期", "礼拜"); ok && k < len(m.toks) {
+		d, ok := cjkWeekdays[m.toks[k].text]
+		if !ok {
+			return match{}, false
+		}
+		wd, j = d, k+1
+	} else {
+		return match{}, false
+	}
+
+	today := day.start(m.now)
+	thisWeek := week.start(m.now).AddDate(0, 0, (int(wd)+6)%7)
+	var d time.Time
+	switch w {
+	case "上", "上个":
+		d = thisWeek.AddDate(0, 0, -7)
+	case "本", "这", "这个", "this":
+		d = thisWeek
+	case "last":
+		// 最近一个已经过去的这一天，不含今天
+		d = today.AddDate(0, 0, -((int(today.Weekday())-int(wd)+6)%7 + 1))
+	default:
+		d = today.AddDate(0, 0, -((int(today.Weekday()) - int(wd) + 7) % 7))
+	}
+	return match{r: day.span(d), next: j, weak: weak}, true
+}
+
+// isoDate: 2025-03-05, 2025/3/5, 2025-03
+func (m *matcher) isoDate(i int) (match, bool) {
+	y, j, ok := m.year(i)
+	if !ok || j >= len(m.toks) {
+		return match{}, false
+	}
+	sep := m.toks[j].text
+	if sep != "-" && sep != "/" && sep != "." {
+		return match{}, false
+	}
+	mo, j, ok := m.numberIn(j+1, 1, 12)
+	if !ok {
+		return match{}, false
+	}
+	if k, ok := m.phrase(j, sep); ok {
+		if d, k, ok := m.numberIn(k, 1, 31); ok {
+			return m.dayMatch(y, mo, d, k)
+		}
+	}
+	return match{r: month.span(m.date(y, mo, 1)), next: j}, true
+}
+
+// monthDay: March, March 5, March 5th 2025, 5 March, the 5th of May 2025.
+// Without a year, "may", "mar" and a leading day ("5 may") are weak.
+func (m *matcher) monthDay(i int) (match, bool) {
+	j := m.skip(i, "the")
+	d, j, dayFirst := m.digitsIn(j, 1, 31)
+	suffixed := false
+	if dayFirst {
+		k := m.skip(j, "st", "nd", "rd", "th")
+		k = m.skip(k, "of")
+		suffixed, j = k > j, k
+	} else {
+		j = i
+	}
+	j, name, ok := m.oneOf(j, keys(months)...)
+	if !ok {
+		return match{}, false
+	}
+	j = m.skip(j, ".")
+	mo := int(months[name])
+
+	if !dayFirst {
+		if n, k, ok := m.digitsIn(j, 1, 31); ok {
+			d, j = n, m.skip(k, "st", "nd", "rd", "th")
+		}
+	}
+	if y, k, ok := m.year(m.skip(j, ",")); ok {
+		if d > 0 {
+			return m.dayMatch(y, mo, d, k)
+		}
+		return match{r: month.span(m.date(y, mo, 1)), next: k}, true
+	}
+
+	weak := len(name) == 3 || dayFirst && !suffixed
+	if d > 0 {
+		res, ok := m.dayMatch(m.latestYear(mo, d), mo, d, j)
+		res.weak = weak
+		return res, ok
+	}
+	return match{r: month.span(m.date(m.latestYear(mo, 1), mo, 1)), next: j, weak: true}, true
+}
+
+// cjkDate: 2025年, 2025年3月, 3月5日, 去年三月, 3月份
+func (m *matcher) cjkDate(i int) (match, bool) {
+	y, j, hasYear := m.cjkYear(i)
+	mo, k, ok := m.numberIn(j, 1, 12)
+	if ok {
+		k, ok = m.phrase(k, "月")
+	}
+	if !ok {
+		// 只有 "2025年"；"今年" 这类由 relativeUnit 处理
+		if hasYear && m.toks[i].kind == numToken {
+			return match{r: year.span(m.date(y, 1, 1)), next: j}, true
+		}
+		return match{}, false
+	}
+	k = m.skip(k, "份")
+
+	if d, l, ok := m.numberIn(k, 1, 31); ok {
+		if l, _, ok := m.oneOf(l, "日", "号"); ok {
+			if !hasYear {
+				y = m.latestYear(mo, d)
+			}
+			return m.dayMatch(y, mo, d, l)
+		}
+	}
+	if !hasYear {
+		y = m.latestYear(mo, 1)
+	}
+	return match{r: month.span(m.date(y, mo, 1)), next: k}, true
+}
+
+// cjkYear matches 2025年, 今年, 去年 or 前年
+func (m *matcher) cjkYear(i int) (int, int, bool) {
+	if y, j, ok := m.year(i); ok {
+		if k, ok := m.phrase(j, "年"); ok {
+			return y, k, true
+		}
+	}
+	if j, w, ok := m.oneOf(i, "今年", "去年", "前年"); ok {
+		return m.now.Year() + relativeUnits[w].offset, j, true
+	}
+	return 0, i, false
+}
+
+// quarter: Q3, Q3 2025, 2025 Q3, third quarter of 2025, 2025年第三季度
+func (m *matcher) quarter(i int) (match, bool) {
+	y, j, hasYear := m.cjkYear(i)
+	if !hasYear {
+		if y, j, hasYear = m.year(i); hasYear {
+			j = m.skip(j, "-")
+		}
+	}
+
+	var q int
+	if k, ok := m.phrase(j, "q"); ok {
+		n, k, ok := m.digitsIn(k, 1, 4)
+		if !ok {
+			return match{}, false
+		}
+		q, j = n, k
+	} else if k, w, ok := m.oneOf(m.skip(j, "the"), keys(ordinals)...); ok {
+		k, ok := m.phrase(k, "quarter")
+		if !ok {
+			return match{}, false
+		}
+		q, j = ordinals[w], k
+	} else {
+		n, k, ok := m.numberIn(m.skip(j, "第"), 1, 4)
+		if !ok {
+			return match{}, false
+		}
+		if k, ok = m.phrase(k, "季度"); !ok {
+			return match{}, false
+		}
+		q, j = n, k
+	}
+
+	if !hasYear {
+		if n, k, ok := m.year(m.skip(m.skip(j, "of"), ",")); ok {
+			y, j, hasYear = n, k, true
+		}
+	}
+	if !hasYear {
+		y = m.latestYear(3*q-2, 1)
+	}
+	return match{r: quarter.span(m.date(y, 3*q-2, 1)), next: j}, true
+}
+
+// bareYear: 2024 on its own
+func (m *matcher) bareYear(i int) (match, bool) {
+	y, j, ok := m.year(i)
+	if !ok {
+		return match{}, false
+	}
+	return match{r: year.span(m.date(y, 1, 1)), next: j, weak: true}, true
+}
+
+// dayMatch validates the day (no February 30th) and returns its span
+func (m *matcher) dayMatch(y, mo, d, next int) (match, bool) {
+	t := m.date(y, mo, d)
+	if t.Day() != d {
+		return match{}, false
+	}
+	return match{r: day.span(t), next: next}, true
+}
+
+func (m *matcher) date(y, mo, d int) time.Time {
+	return time.Date(y, time.Month(mo), d, 0, 0, 0, 0, m.now.Location())
+}
+
+// latestYear is the year of the latest month/day that has started
+func (m *matcher) latestYear(mo, d int) int {
+	y := m.now.Year()
+	if m.date(y, mo, d).After(m.now) {
+		y--
+	}
+	return y
+}
+
+// year matches a four-digit year
+func (m *matcher) year(i int) (int, int, bool) {
+	if i < len(m.toks) && m.toks[i].kind == numToken && len(m.toks[i].text) == 4 &&
+		m.toks[i].num >= 1900 && m.toks[i].num <= 2199 {
+		return m.toks[i].num, i + 1, true
+	}
+	return 0, i, false
+}
+
+// digitsIn matches a decimal number in [lo, hi]
+func (m *matcher) digitsIn(i, lo, hi int) (int, int, bool) {
+	if i < len(m.toks) && m.toks[i].kind == numToken && m.toks[i].num >= lo && m.toks[i].num <= hi {
+		return m.toks[i].num, i + 1, true
+	}
+	return 0, i, false
+}
+
+// numberIn matches a decimal or Chinese number in [lo, hi]
+func (m *matcher) numberIn(i, lo, hi int) (int, int, bool) {
+	if n, j, ok := m.digitsIn(i, lo, hi); ok {
+		return n, j, true
+	}
+	n, j, ok := m.cjkNumber(i)
+	if !ok || n < lo || n > hi {
+		return 0, i, false
+	}
+	return n, j, true
+}
+
+// number matches a count: digits, an English number word ("two", "a
+// couple of") or a Chinese numeral
+func (m *matcher) number(i int) (int, int, bool) {
+	if n, j, ok := m.digitsIn(i, 0, 9999); ok {
+		return n, j, true
+	}
+	if j, w, ok := m.oneOf(i, keys(numberWords)...); ok {
+		return numberWords[w], m.skip(j, "of"), true
+	}
+	return m.cjkNumber(i)
+}
+
+// cjkNumber matches a Chinese numeral up to 99: 三, 两, 十, 十二, 二十, 二十五
+func (m *matcher) cjkNumber(i int) (int, int, bool) {
+	var s []string
+	for j := i; j < len(m.toks) && m.toks[j].kind == runeToken && len(s) < 3; j++ {
+		if _, ok := cjkDigits[m.toks[j].text]; !ok && m.toks[j].text != "十" {
+			break
+		}
+		s = append(s, m.toks[j].text)
+	}
+
+	// 取能组成数字的最长前缀
+	for n := len(s); n > 0; n-- {
+		if v, ok := cjkValue(s[:n]); ok {
+			return v, i + n, true
+		}
+	}
+	return 0, i, false
+}
+
+func cjkValue(s []string) (int, bool) {
+	switch {
+	case len(s) == 1 && s[0] == "十":
+		return 10, true
+	case len(s) == 1:
+		return cjkDigits[s[0]], true
+	case len(s) == 2 && s[0] == "十":
+		return 10 + cjkDigits[s[1]], s[1] != "十"
+	case len(s) == 2 && s[1] == "十":
+		return cjkDigits[s[0]] * 10, true
+	case len(s) == 3 && s[1] == "十":
+		return cjkDigits[s[0]]*10 + cjkDigits[s[2]], s[0] != "十" && s[2] != "十"
+	}
+	return 0, false
+}
+
+// unit matches a unit word
+func (m *matcher) unit(i int) (int, unit, bool) {
+	j, w, ok := m.oneOf(i, keys(units)...)
+	if !ok {
+		return i, 0, false
+	}
+	return j, units[w], true
+}
+
+// phrase matches a fixed phrase: space-separated English words, Chinese
+// characters one by one, or a punctuation character
+func (m *matcher) phrase(i int, p string) (int, bool) {
+	for _, part := range strings.Fields(p) {
+		if part[0] < utf8.RuneSelf {
+			if i >= len(m.toks) || m.toks[i].text != part {
+				return i, false
+			}
+			i++
+			continue
+		}
+		for _, r := range part {
+			if i >= len(m.toks) || m.toks[i].kind != runeToken || m.toks[i].text != string(r) {
+				return i, false
+			}
+			i++
+		}
+	}
+	return i, true
+}
+
+// oneOf matches the longest of phrases
+func (m *matcher) oneOf(i int, phrases ...string) (int, string, bool) {
+	best, bestNext := "", i
+	for _, p := range phrases {
+		if j, ok := m.phrase(i, p); ok && j > bestNext {
+			best, bestNext = p, j
+		}
+	}
+	return bestNext, best, best != ""
+}
+
+// skip steps over an optional phrase
+func (m *matcher) skip(i int, phrases ...string) int {
+	j, _, _ := m.oneOf(i, phrases...)
+	return j
+}
+
+func keys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
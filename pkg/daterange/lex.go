@@ -0,0 +1,70 @@
+package daterange
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	wordToken  tokenKind = iota // a run of ASCII letters, lowercased
+	numToken                    // a run of ASCII digits
+	runeToken                   // one non-ASCII letter, e.g. a Chinese character
+	punctToken                  // one punctuation character
+)
+
+// token is a piece of the input with its byte span
+type token struct {
+	kind  tokenKind
+	text  string
+	num   int
+	start int
+	end   int
+}
+
+// lex splits text into words, numbers, single CJK characters and single
+// punctuation characters; whitespace only separates. Letters and digits
+// are split apart, so "q3" and "5th" are two tokens each.
+func lex(text string) []token {
+	var toks []token
+	for i := 0; i < len(text); {
+		r, n := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += n
+		case isASCIILetter(r):
+			j := i
+			for j < len(text) && isASCIILetter(rune(text[j])) {
+				j++
+			}
+			toks = append(toks, token{kind: wordToken, text: strings.ToLower(text[i:j]), start: i, end: j})
+			i = j
+		case r >= '0' && r <= '9':
+			j := i
+			for j < len(text) && text[j] >= '0' && text[j] <= '9' {
+				j++
+			}
+			num, err := strconv.Atoi(text[i:j])
+			if err != nil {
+				// 太长的数字不可能是日期
+				num = -1
+			}
+			toks = append(toks, token{kind: numToken, text: text[i:j], num: num, start: i, end: j})
+			i = j
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			toks = append(toks, token{kind: runeToken, text: text[i : i+n], start: i, end: i + n})
+			i += n
+		default:
+			toks = append(toks, token{kind: punctToken, text: text[i : i+n], start: i, end: i + n})
+			i += n
+		}
+	}
+	return toks
+}
+
+func isASCIILetter(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
@@ -0,0 +1,79 @@
+package retry
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Policy configures exponential backoff with full jitter
+type Policy struct {
+	// MaxAttempts is the total number of calls, including the first one
+	MaxAttempts int
+
+	// BaseDelay is the backoff cap for the first retry; it doubles per attempt
+	BaseDelay time.Duration
+
+	// MaxDelay bounds a single backoff sleep
+	MaxDelay time.Duration
+
+	// Classify reports whether err is worth retrying. wait is a server hint
+	// (e.g. Retry-After) and overrides the computed backoff when larger.
+	// A nil Classify retries every error.
+	Classify func(err error) (retry bool, wait time.Duration)
+}
+
+// DefaultPolicy retries up to 5 times between 500ms and 30s
+var DefaultPolicy = Policy{
+	MaxAttempts: 5,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// Do calls fn until it succeeds, returns a non-retryable error, the
+// attempts are exhausted, or ctx is cancelled. It returns fn's last error.
+func Do(ctx context.Context, p Policy, fn func() error) error {
+	attempts := max(p.MaxAttempts, 1)
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+
+		retry, wait := true, time.Duration(0)
+		if p.Classify != nil {
+			retry, wait = p.Classify(err)
+		}
+		if !retry || attempt == attempts-1 {
+			return err
+		}
+
+		delay := max(p.backoff(attempt), wait)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return err
+}
+
+// backoff returns a random delay in [0, min(MaxDelay, BaseDelay*2^attempt))
+func (p Policy) backoff(attempt int) time.Duration {
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+	ceiling := p.BaseDelay << min(attempt, 30)
+	if ceiling <= 0 || ceiling>>min(attempt, 30) != p.BaseDelay {
+		// 移位溢出了
+		ceiling = math.MaxInt64
+	}
+	if p.MaxDelay > 0 && ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	return time.Duration(rand.Int64N(int64(ceiling)) + 1)
+}
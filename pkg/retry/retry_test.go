@@ -0,0 +1,127 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errTransient = errors.New("transient")
+
+func TestDoRetriesUntilSuccess(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), Policy{MaxAttempts: 5, BaseDelay: time.Millisecond}, func() error {
+		calls++
+		if calls < 3 {
+			return errTransient
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("Do = %v after %d calls, want nil after 3", err, calls)
+	}
+}
+
+func TestDoExhaustsAttempts(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), Policy{MaxAttempts: 3, BaseDelay: time.Millisecond}, func() error {
+		calls++
+		return errTransient
+	})
+	if !errors.Is(err, errTransient) || calls != 3 {
+		t.Errorf("Do = %v after %d calls, want %v after 3", err, calls, errTransient)
+	}
+
+	// MaxAttempts 为 0 时至少调用一次
+	calls = 0
+	_ = Do(context.Background(), Policy{}, func() error {
+		calls++
+		return errTransient
+	})
+	if calls != 1 {
+		t.Errorf("zero policy made %d calls, want 1", calls)
+	}
+}
+
+func TestDoNonRetryable(t *testing.T) {
+	permanent := errors.New("permanent")
+	calls := 0
+	err := Do(context.Background(), Policy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Millisecond,
+		Classify:    func(err error) (bool, time.Duration) { return err != permanent, 0 },
+	}, func() error {
+		calls++
+		if calls == 2 {
+			return permanent
+		}
+		return errTransient
+	})
+	if err != permanent || calls != 2 {
+		t.Errorf("Do = %v after %d calls, want %v after 2", err, calls, permanent)
+	}
+}
+
+func TestDoContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	calls := 0
+	start := time.Now()
+	err := Do(ctx, Policy{MaxAttempts: 5, BaseDelay: time.Hour}, func() error {
+		calls++
+		return errTransient
+	})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("Do = %v after %d calls, want context.Canceled after 1", err, calls)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Do returned %s after cancellation, want immediately", elapsed)
+	}
+}
+
+func TestDoWaitHint(t *testing.T) {
+	calls := 0
+	start := time.Now()
+	err := Do(context.Background(), Policy{
+		MaxAttempts: 2,
+		Classify:    func(error) (bool, time.Duration) { return true, 50 * time.Millisecond },
+	}, func() error {
+		calls++
+		if calls == 1 {
+			return errTransient
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("retried after %s, want the 50ms server hint", elapsed)
+	}
+}
+
+func TestBackoffCap(t *testing.T) {
+	p := Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt := 0; attempt < 70; attempt++ {
+		ceiling := min(p.BaseDelay<<min(attempt, 30), p.MaxDelay)
+		for range 100 {
+			if d := p.backoff(attempt); d <= 0 || d > ceiling {
+				t.Fatalf("backoff(%d) = %s, want in (0, %s]", attempt, d, ceiling)
+			}
+		}
+	}
+
+	// 没有 MaxDelay 时移位溢出也不能变成负数
+	p = Policy{BaseDelay: time.Hour}
+	for attempt := 0; attempt < 70; attempt++ {
+		if d := p.backoff(attempt); d <= 0 {
+			t.Fatalf("backoff(%d) = %s without MaxDelay, want > 0", attempt, d)
+		}
+	}
+
+	if d := (Policy{}).backoff(3); d != 0 {
+		t.Errorf("backoff without BaseDelay = %s, want 0", d)
+	}
+}
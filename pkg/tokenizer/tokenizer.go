@@ -0,0 +1,174 @@
+// Package tokenizer counts and splits text in OpenAI BPE tokens without
+// network access: the cl100k_base and o200k_base vocabularies are embedded
+// in the binary.
+package tokenizer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+	loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// Supported encodings
+const (
+	// CL100K is used by the text-embedding-3 models, gpt-4 and gpt-3.5-turbo
+	CL100K = "cl100k_base"
+	// O200K is used by gpt-4o, gpt-4.1 and the o-series models
+	O200K = "o200k_base"
+)
+
+func init() {
+	// tiktoken-go 默认会去 openaipublic 下载词表，这里换成内嵌的
+	tiktoken.SetBpeLoader(loader.NewOfflineLoader())
+}
+
+// Tokenizer encodes text with one BPE vocabulary. It is safe for
+// concurrent use.
+type Tokenizer struct {
+	name string
+	enc  *tiktoken.Tiktoken
+}
+
+var (
+	mu    sync.Mutex
+	cache = map[string]*Tokenizer{}
+)
+
+// Get returns the tokenizer of an encoding (CL100K or O200K). Vocabularies
+// are parsed on first use and shared afterwards.
+func Get(encoding string) (*Tokenizer, error) {
+	if encoding != CL100K && encoding != O200K {
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if t, ok := cache[encoding]; ok {
+		return t, nil
+	}
+	enc, err := tiktoken.GetEncoding(encoding)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", encoding, err)
+	}
+	t := &Tokenizer{name: encoding, enc: enc}
+	cache[encoding] = t
+	return t, nil
+}
+
+// ForModel returns the tokenizer of an OpenAI model. Unknown models get
+// cl100k_base, which all embedding models use.
+func ForModel(model string) (*Tokenizer, error) {
+	return Get(EncodingForModel(model))
+}
+
+// EncodingForModel maps an OpenAI model name to its encoding
+func EncodingForModel(model string) string {
+	model = strings.ToLower(model)
+	for _, prefix := range []string{"gpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "o1", "o3", "o4"} {
+		if strings.HasPrefix(model, prefix) {
+			return O200K
+		}
+	}
+	return CL100K
+}
+
+// Name returns the encoding name, e.g. "cl100k_base"
+func (t *Tokenizer) Name() string {
+	return t.name
+}
+
+// Encode returns the tokens of text. Special tokens such as <|endoftext|>
+// are encoded as plain text, since email bodies are untrusted input.
+func (t *Tokenizer) Encode(text string) []int {
+	return t.enc.EncodeOrdinary(text)
+}
+
+// Decode turns tokens back into text. A slice that ends inside a
+// multi-byte character yields invalid UTF-8; use Split to cut text safely.
+func (t *Tokenizer) Decode(tokens []int) string {
+	return t.enc.Decode(tokens)
+}
+
+// Count returns the number of tokens in text
+func (t *Tokenizer) Count(text string) int {
+	return len(t.Encode(text))
+}
+
+// Truncate returns the longest prefix of text that fits in limit tokens,
+// without cutting a character in half
+func (t *Tokenizer) Truncate(text string, limit int) string {
+	pieces := t.Split(text, limit, 0)
+	if len(pieces) == 0 {
+		return ""
+	}
+	return pieces[0].Text
+}
+
+// Piece is a window of text produced by Split
+type Piece struct {
+	Text string
+	// Tokens is the number of tokens of the window in the original text
+	Tokens int
+}
+
+// Split cuts text into windows of at most size tokens, each one repeating
+// about the last overlap tokens of the previous window. Byte-level BPE can
+// spread one character (typically CJK or emoji) over several tokens; a cut
+// never falls inside such a character, it moves back to the previous
+// character boundary instead. Invalid UTF-8 is replaced with U+FFFD.
+func (t *Tokenizer) Split(text string, size, overlap int) []Piece {
+	if text == "" {
+		return nil
+	}
+	text = strings.ToValidUTF8(text, "�")
+	size = max(size, 1)
+	overlap = max(min(overlap, size-1), 0)
+
+	tokens := t.Encode(text)
+	if len(tokens) <= size {
+		return []Piece{{Text: text, Tokens: len(tokens)}}
+	}
+
+	// offsets[i] 是第 i 个 token 在 text 中的起始字节
+	offsets := make([]int, len(tokens)+1)
+	for i, tok := range tokens {
+		offsets[i+1] = offsets[i] + len(t.enc.Decode([]int{tok}))
+	}
+	if offsets[len(tokens)] != len(text) {
+		// 正常不会发生：合法 UTF-8 总能无损往返
+		return []Piece{{Text: text, Tokens: len(tokens)}}
+	}
+	boundary := func(i int) bool {
+		return i == 0 || i == len(tokens) || utf8.RuneStart(text[offsets[i]])
+	}
+
+	var pieces []Piece
+	for start := 0; start < len(tokens); {
+		end := min(start+size, len(tokens))
+		for end > start+1 && !boundary(end) {
+			end--
+		}
+		// size 小于一个字符的 token 数时只能超出 size
+		for !boundary(end) {
+			end++
+		}
+		pieces = append(pieces, Piece{Text: text[offsets[start]:offsets[end]], Tokens: end - start})
+		if end == len(tokens) {
+			break
+		}
+
+		next := max(end-overlap, start+1)
+		for next > start+1 && !boundary(next) {
+			next--
+		}
+		for !boundary(next) {
+			next++
+		}
+		start = next
+	}
+	return pieces
+}
@@ -0,0 +1,215 @@
+package tokenizer
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func mustGet(t testing.TB, encoding string) *Tokenizer {
+	t.Helper()
+	tok, err := Get(encoding)
+	if err != nil {
+		t.Fatalf("Get(%s): %v", encoding, err)
+	}
+	return tok
+}
+
+func TestEncodeKnownTokens(t *testing.T) {
+	tests := []struct {
+		encoding string
+		text     string
+		want     []int
+	}{
+		{CL100K, "hello world", []int{15339, 1917}},
+		{O200K, "hello world", []int{24912, 2375}},
+		{CL100K, "", nil},
+	}
+	for _, tt := range tests {
+		got := mustGet(t, tt.encoding).Encode(tt.text)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s Encode(%q) = %v, want %v", tt.encoding, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeSpecialTokensAsText(t *testing.T) {
+	tok := mustGet(t, CL100K)
+	text := "before <|endoftext|> after"
+	if got := tok.Decode(tok.Encode(text)); got != text {
+		t.Errorf("round trip = %q, want %q", got, text)
+	}
+	if slices.Contains(tok.Encode(text), 100257) {
+		t.Error("<|endoftext|> encoded as a special token")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, encoding := range []string{CL100K, O200K} {
+		tok := mustGet(t, encoding)
+		for _, text := range []string{
+			"Subject: Q3 planning\n\nHi team,\n\nSee the attached deck.",
+			"你好，明天下午三点开会，请准时参加。",
+			"émoji 👩‍👩‍👧 and ñ and 日本語",
+		} {
+			if got := tok.Decode(tok.Encode(text)); got != text {
+				t.Errorf("%s round trip = %q, want %q", encoding, got, text)
+			}
+		}
+	}
+}
+
+func TestForModel(t *testing.T) {
+	tests := map[string]string{
+		"text-embedding-3-small": CL100K,
+		"text-embedding-ada-002": CL100K,
+		"gpt-3.5-turbo":          CL100K,
+		"gpt-4o-mini":            O200K,
+		"gpt-4.1":                O200K,
+		"o3-mini":                O200K,
+		"":                       CL100K,
+	}
+	for model, want := range tests {
+		if got := EncodingForModel(model); got != want {
+			t.Errorf("EncodingForModel(%q) = %s, want %s", model, got, want)
+		}
+	}
+	if _, err := Get("p50k_base"); err == nil {
+		t.Error("Get(p50k_base) succeeded, want an error")
+	}
+}
+
+func TestCountCJK(t *testing.T) {
+	tok := mustGet(t, CL100K)
+	text := strings.Repeat("会议纪要", 100)
+	// 4 字符/token 的估算对中文差得很远：这里每个字至少一个 token
+	if n := tok.Count(text); n < utf8.RuneCountInString(text) {
+		t.Errorf("Count = %d, want at least %d", n, utf8.RuneCountInString(text))
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tok := mustGet(t, CL100K)
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 50)
+
+	pieces := tok.Split(text, 40, 8)
+	if len(pieces) < 2 {
+		t.Fatalf("got %d pieces, want several", len(pieces))
+	}
+	for i, p := range pieces {
+		if p.Tokens > 40 {
+			t.Errorf("piece %d has %d tokens, want <= 40", i, p.Tokens)
+		}
+		if i > 0 {
+			// 相邻两段有重叠
+			prev := pieces[i-1].Text
+			if !strings.Contains(prev, p.Text[:20]) {
+				t.Errorf("piece %d does not overlap the previous one", i)
+			}
+		}
+	}
+	if !strings.HasSuffix(text, pieces[len(pieces)-1].Text) {
+		t.Error("last piece does not end the text")
+	}
+
+	if got := tok.Split("short text", 40, 8); len(got) != 1 || got[0].Text != "short text" || got[0].Tokens != 2 {
+		t.Errorf("Split(short) = %+v", got)
+	}
+	if got := tok.Split("", 40, 8); got != nil {
+		t.Errorf("Split(empty) = %+v, want nil", got)
+	}
+}
+
+func TestSplitRuneSafe(t *testing.T) {
+	tok := mustGet(t, CL100K)
+	// 生僻字和 emoji 在 cl100k 里会被拆成多个 byte token
+	text := strings.Repeat("龘靐齉👩‍👩‍👧𠮷", 30)
+
+	for _, size := range []int{1, 2, 3, 5, 16} {
+		pieces := tok.Split(text, size, size/2)
+		if len(pieces) == 0 {
+			t.Fatalf("size %d: no pieces", size)
+		}
+		for i, p := range pieces {
+			if !utf8.ValidString(p.Text) {
+				t.Fatalf("size %d: piece %d is not valid UTF-8: %q", size, i, p.Text)
+			}
+		}
+	}
+}
+
+func TestSplitWithoutOverlapCoversText(t *testing.T) {
+	tok := mustGet(t, O200K)
+	text := strings.Repeat("订单 #4521 已发货，预计周五送达。Order shipped! ", 40)
+
+	var b strings.Builder
+	for _, p := range tok.Split(text, 25, 0) {
+		b.WriteString(p.Text)
+	}
+	if b.String() != text {
+		t.Error("pieces without overlap do not add up to the text")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tok := mustGet(t, CL100K)
+	text := strings.Repeat("数据", 50)
+	got := tok.Truncate(text, 10)
+	if !strings.HasPrefix(text, got) || !utf8.ValidString(got) {
+		t.Errorf("Truncate = %q, want a valid prefix", got)
+	}
+	if n := tok.Count(got); n > 10 {
+		t.Errorf("Truncate kept %d tokens, want <= 10", n)
+	}
+}
+
+func FuzzSplit(f *testing.F) {
+	f.Add("hello world, this is an email body", 4, 1)
+	f.Add("你好，明天下午三点开会，请准时参加。", 3, 1)
+	f.Add("👩‍👩‍👧 龘 𠮷 ñ", 1, 0)
+	f.Add("\xff\xfe broken \xc3", 2, 1)
+
+	tok := mustGet(f, CL100K)
+	f.Fuzz(func(t *testing.T, text string, size, overlap int) {
+		size = 1 + abs(size)%64
+		overlap = abs(overlap) % 64
+
+		pieces := tok.Split(text, size, overlap)
+		if text == "" {
+			if pieces != nil {
+				t.Fatalf("Split(empty) = %+v", pieces)
+			}
+			return
+		}
+		valid := strings.ToValidUTF8(text, "�")
+		if len(pieces) == 0 {
+			t.Fatal("no pieces for non-empty text")
+		}
+		if !strings.HasPrefix(valid, pieces[0].Text) {
+			t.Fatal("first piece does not start the text")
+		}
+		if !strings.HasSuffix(valid, pieces[len(pieces)-1].Text) {
+			t.Fatal("last piece does not end the text")
+		}
+		for i, p := range pieces {
+			if !utf8.ValidString(p.Text) {
+				t.Fatalf("piece %d is not valid UTF-8: %q", i, p.Text)
+			}
+			if p.Text == "" || !strings.Contains(valid, p.Text) {
+				t.Fatalf("piece %d %q is not part of the text", i, p.Text)
+			}
+		}
+
+		if got := tok.Decode(tok.Encode(valid)); got != valid {
+			t.Fatalf("round trip = %q, want %q", got, valid)
+		}
+	})
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}